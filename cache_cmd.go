@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/cache"
+	"github.com/roowe/tushareproxy/internal/config"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+const cacheCommandUsage = `用法:
+  tushareproxy cache export-keys [-config proxy.toml] <file.csv>
+  tushareproxy cache export [-config proxy.toml] <file>
+  tushareproxy cache import [-config proxy.toml] <file>
+  tushareproxy cache migrate [-config proxy.toml]
+  tushareproxy cache rotate-key [-config proxy.toml] [-old-key-file old.key]
+
+rotate-key 把 badger 缓存的加密密钥从 -old-key-file（不指定表示原来没有加密）换成配置中的
+cache.encryption_key_file / encryption_key_env（都不配置表示取消加密）。
+
+注意: BadgerDB 不支持多进程同时打开，执行前请先停止代理服务；使用 redis 存储时可以直接执行。`
+
+// runCacheCommand 执行 cache 子命令，返回进程退出码
+func runCacheCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, cacheCommandUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("cache "+args[0], flag.ContinueOnError)
+	configPath := fs.String("config", "", "配置文件路径，默认搜索 ./proxy.toml 和 ./config/proxy.toml")
+	oldKeyFile := fs.String("old-key-file", "", "rotate-key 使用：原来的加密密钥文件，不指定表示原来没有加密")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	var run func(cm *cache.CacheManager, args []string) error
+	switch args[0] {
+	case "export-keys":
+		run = exportCacheKeys
+	case "export":
+		run = exportCache
+	case "import":
+		run = importCache
+	case "migrate":
+		run = migrateCache
+	case "rotate-key":
+	default:
+		fmt.Fprintln(os.Stderr, cacheCommandUsage)
+		return 2
+	}
+
+	if err := config.InitConfigFromPath(*configPath); err != nil {
+		logger.Error("读取配置文件失败", zap.Error(err))
+		return 1
+	}
+	cfg := config.GetConfig()
+	if err := logger.InitLogger(&cfg.Log); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer logger.Sync()
+
+	// 换密钥时不能用新密钥打开缓存，直接改写 KEYREGISTRY
+	if args[0] == "rotate-key" {
+		if err := rotateCacheKey(&cfg.Cache, *oldKeyFile); err != nil {
+			logger.Error("更换缓存加密密钥失败", zap.Error(err))
+			return 1
+		}
+		return 0
+	}
+
+	cacheManager, err := openCacheManager(&cfg.Cache)
+	if err != nil {
+		logger.Error("打开缓存失败", zap.Error(err))
+		return 1
+	}
+	defer cacheManager.Close()
+
+	if err := run(cacheManager, fs.Args()); err != nil {
+		logger.Error("执行 cache 子命令失败", zap.String("command", args[0]), zap.Error(err))
+		return 1
+	}
+	return 0
+}
+
+// exportCacheKeys 导出缓存键及元数据到 CSV
+func exportCacheKeys(cm *cache.CacheManager, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("需要指定输出文件路径")
+	}
+
+	file, err := os.Create(args[0])
+	if err != nil {
+		return fmt.Errorf("创建输出文件失败: %w", err)
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	if err := w.Write([]string{
+		"key", "namespace", "api_name", "params", "status_code",
+		"response_size", "cached_at", "expires_at", "age_seconds", "hit_count",
+	}); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	count := 0
+	err = cm.ForEachEntry(func(key string, entry *cache.CacheEntry, hitCount uint64) error {
+		apiName, params := describeRequestBody(entry.RequestBody)
+		count++
+		return w.Write([]string{
+			key,
+			entry.Namespace,
+			apiName,
+			params,
+			strconv.Itoa(entry.StatusCode),
+			strconv.Itoa(len(entry.ResponseBody)),
+			formatUnix(entry.Timestamp),
+			formatUnix(entry.ExpiresAt),
+			strconv.FormatInt(now.Unix()-entry.Timestamp, 10),
+			strconv.FormatUint(hitCount, 10),
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("写入 CSV 失败: %w", err)
+	}
+
+	logger.Info("缓存键导出完成", zap.String("file", args[0]), zap.Int("count", count))
+	return nil
+}
+
+// migrateCache 把旧格式的缓存条目按当前格式重写
+func migrateCache(cm *cache.CacheManager, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("migrate 不需要参数")
+	}
+	_, err := cm.MigrateEntries()
+	return err
+}
+
+// rotateCacheKey 把缓存的加密密钥从 oldKeyFile 换成配置中的密钥
+func rotateCacheKey(cfg *config.CacheConfig, oldKeyFile string) error {
+	if cfg.Backend == cache.BackendRedis {
+		return fmt.Errorf("只有 badger 存储支持加密")
+	}
+
+	var oldKey []byte
+	if oldKeyFile != "" {
+		raw, err := os.ReadFile(oldKeyFile)
+		if err != nil {
+			return fmt.Errorf("读取旧密钥文件失败: %w", err)
+		}
+		if oldKey, err = config.ParseEncryptionKey(raw); err != nil {
+			return fmt.Errorf("旧密钥: %w", err)
+		}
+	}
+	newKey, err := cfg.EncryptionKey()
+	if err != nil {
+		return err
+	}
+
+	if err := cache.RotateEncryptionKey(cfg.DBPath, oldKey, newKey); err != nil {
+		return err
+	}
+	logger.Info("缓存加密密钥已更换",
+		zap.String("db_path", cfg.DBPath),
+		zap.Bool("was_encrypted", oldKey != nil),
+		zap.Bool("encrypted", newKey != nil))
+	return nil
+}
+
+// describeRequestBody 从缓存的请求体中提取 api_name 和 params，不导出 token
+func describeRequestBody(body []byte) (string, string) {
+	var request struct {
+		APIName string          `json:"api_name"`
+		Params  json.RawMessage `json:"params"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return "", ""
+	}
+
+	var params bytes.Buffer
+	if len(request.Params) > 0 {
+		if err := json.Compact(&params, request.Params); err != nil {
+			return request.APIName, string(request.Params)
+		}
+	}
+	return request.APIName, params.String()
+}
+
+func formatUnix(ts int64) string {
+	if ts <= 0 {
+		return ""
+	}
+	return time.Unix(ts, 0).Format(time.RFC3339)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/roowe/tushareproxy/internal/cache"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// 缓存导出文件格式：zstd 压缩的 JSON Lines，第一行为文件头，之后每行一个条目。
+// 与缓存存储和 BadgerDB 版本无关，可以在不同版本、不同存储的代理之间迁移
+const (
+	cacheExportFormat  = "tushareproxy-cache"
+	cacheExportVersion = 1
+)
+
+type cacheExportHeader struct {
+	Format     string `json:"format"`
+	Version    int    `json:"version"`
+	ExportedAt string `json:"exported_at"`
+}
+
+type cacheExportRecord struct {
+	Key   string            `json:"key"`
+	Entry *cache.CacheEntry `json:"entry"`
+}
+
+// exportCache 把所有未过期的缓存条目导出到文件，请求体中的 token 不导出
+func exportCache(cm *cache.CacheManager, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("需要指定输出文件路径")
+	}
+
+	file, err := os.Create(args[0])
+	if err != nil {
+		return fmt.Errorf("创建输出文件失败: %w", err)
+	}
+	defer file.Close()
+
+	zw, err := zstd.NewWriter(file)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(zw)
+	if err := enc.Encode(&cacheExportHeader{
+		Format:     cacheExportFormat,
+		Version:    cacheExportVersion,
+		ExportedAt: time.Now().Format(time.RFC3339),
+	}); err != nil {
+		return err
+	}
+
+	count := 0
+	err = cm.ForEachEntry(func(key string, entry *cache.CacheEntry, hitCount uint64) error {
+		// 冷存储中的条目导出完整内容
+		entry, err := cm.LoadCold(entry)
+		if err != nil {
+			return fmt.Errorf("导出 %s 失败: %w", key, err)
+		}
+		entry.RequestBody = stripRequestToken(entry.RequestBody)
+		count++
+		return enc.Encode(&cacheExportRecord{Key: key, Entry: entry})
+	})
+	if err != nil {
+		zw.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("写入导出文件失败: %w", err)
+	}
+
+	logger.Info("缓存导出完成", zap.String("file", args[0]), zap.Int("count", count))
+	return nil
+}
+
+// importCache 从导出文件导入缓存条目。已过期的条目跳过，
+// 本地已有上游响应时间更新的条目时保留本地条目
+func importCache(cm *cache.CacheManager, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("需要指定导入文件路径")
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("打开导入文件失败: %w", err)
+	}
+	defer file.Close()
+
+	zr, err := zstd.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("读取导入文件失败: %w", err)
+	}
+	defer zr.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(zr))
+	var header cacheExportHeader
+	if err := dec.Decode(&header); err != nil || header.Format != cacheExportFormat {
+		return fmt.Errorf("不是缓存导出文件: %s", args[0])
+	}
+	if header.Version > cacheExportVersion {
+		return fmt.Errorf("导出文件版本 %d 高于当前支持的版本 %d，请升级代理", header.Version, cacheExportVersion)
+	}
+
+	var imported, skipped int
+	for {
+		var record cacheExportRecord
+		if err := dec.Decode(&record); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("解析导入文件失败（已导入 %d 条）: %w", imported, err)
+		}
+		if record.Key == "" || record.Entry == nil {
+			skipped++
+			continue
+		}
+
+		written, err := cm.Restore(record.Key, record.Entry)
+		if err != nil {
+			return fmt.Errorf("导入缓存键 %s 失败（已导入 %d 条）: %w", record.Key, imported, err)
+		}
+		if written {
+			imported++
+		} else {
+			skipped++
+		}
+	}
+
+	logger.Info("缓存导入完成",
+		zap.String("file", args[0]),
+		zap.String("exported_at", header.ExportedAt),
+		zap.Int("imported", imported),
+		zap.Int("skipped", skipped))
+	return nil
+}
+
+// stripRequestToken 去掉缓存请求体中的 token，解析失败时原样返回
+func stripRequestToken(body []byte) []byte {
+	var request map[string]json.RawMessage
+	if err := json.Unmarshal(body, &request); err != nil {
+		return body
+	}
+	if _, ok := request["token"]; !ok {
+		return body
+	}
+	delete(request, "token")
+	stripped, err := json.Marshal(request)
+	if err != nil {
+		return body
+	}
+	return stripped
+}
@@ -31,15 +31,27 @@ class DataApi:
     # __http_url = 'http://api.waditu.com/dataapi'
     __http_url = "http://127.0.0.1:1155/dataapi"
 
-    def __init__(self, token: str, timeout: int = 30, http_url: str | None = None):
+    def __init__(
+        self,
+        token: str,
+        timeout: int = 30,
+        http_url: str | None = None,
+        proxy_key: str | None = None,
+    ):
         """
         Parameters
         ----------
         token: str
             API接口TOKEN，用于用户认证
+        proxy_key: str
+            代理开启 static 或 oidc 客户端鉴权时使用的 key/令牌
         """
         self.__token = token
         self.__timeout = timeout
+        self.__headers: dict[str, str] = {}
+        proxy_key = (proxy_key or os.getenv("TUSHAREPROXY_KEY") or "").strip()
+        if proxy_key:
+            self.__headers["Authorization"] = f"Bearer {proxy_key}"
         http_url = (http_url or os.getenv("TUSHARE_DATAAPI_URL") or "").strip()
         if http_url:
             self.__http_url = http_url
@@ -57,7 +69,9 @@ class DataApi:
             "fields": fields,
             "_cache": self._build_cache(api_name),
         }
-        res = requests.post(f"{self.__http_url}", json=req_params, timeout=self.__timeout)
+        res = requests.post(
+            f"{self.__http_url}", json=req_params, headers=self.__headers, timeout=self.__timeout
+        )
         if res:
             result = json.loads(res.text)
             if result["code"] != 0:
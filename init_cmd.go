@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/roowe/tushareproxy/internal/config"
+)
+
+const initCommandUsage = `用法:
+  tushareproxy init [-o proxy.toml] [-token TOKEN] [-port 1155] [-cache-path ./data/cache] [-y] [-force]
+
+在终端中运行时逐项询问，直接回车使用方括号中的默认值；-y 或非终端输入时只使用命令行参数。`
+
+// initOptions 生成配置文件需要的选项
+type initOptions struct {
+	Token     string
+	Port      int
+	CachePath string
+}
+
+// runInitCommand 生成带注释的 proxy.toml，返回进程退出码
+func runInitCommand(args []string) int {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprintln(os.Stderr, initCommandUsage) }
+	output := fs.String("o", "proxy.toml", "输出的配置文件路径")
+	token := fs.String("token", "", "tushare token，用于加载交易日历和 token 巡检")
+	port := fs.Int("port", 1155, "监听端口")
+	cachePath := fs.String("cache-path", "./data/cache", "缓存目录")
+	yes := fs.Bool("y", false, "不询问，直接使用命令行参数")
+	force := fs.Bool("force", false, "覆盖已有的配置文件")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if _, err := os.Stat(*output); err == nil && !*force {
+		fmt.Fprintf(os.Stderr, "%s 已存在，使用 -force 覆盖\n", *output)
+		return 1
+	}
+
+	opts := initOptions{Token: *token, Port: *port, CachePath: *cachePath}
+	if !*yes && isTerminal(os.Stdin) {
+		if err := promptInitOptions(os.Stdin, os.Stdout, &opts); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	if err := writeInitConfig(*output, &opts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// 按正常启动的方式加载一遍，确认生成的配置可用
+	if err := config.InitConfigFromPath(*output); err != nil {
+		fmt.Fprintf(os.Stderr, "生成的配置文件校验失败: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("已生成 %s，启动: tushareproxy %s\n", *output, *output)
+	if opts.Token == "" {
+		fmt.Println("未填写 token，交易日历和 token 巡检未开启，需要时在配置文件中补充")
+	}
+	return 0
+}
+
+// promptInitOptions 逐项询问配置，直接回车保留当前值
+func promptInitOptions(in io.Reader, out io.Writer, opts *initOptions) error {
+	reader := bufio.NewReader(in)
+	ask := func(question, current string) (string, error) {
+		fmt.Fprintf(out, "%s [%s]: ", question, current)
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			return line, nil
+		}
+		return current, nil
+	}
+
+	var err error
+	if opts.Token, err = ask("tushare token（用于交易日历和 token 巡检，可留空）", opts.Token); err != nil {
+		return err
+	}
+	for {
+		answer, err := ask("监听端口", strconv.Itoa(opts.Port))
+		if err != nil {
+			return err
+		}
+		port, err := strconv.Atoi(answer)
+		if err == nil && port > 0 && port <= 65535 {
+			opts.Port = port
+			break
+		}
+		fmt.Fprintln(out, "端口必须是 1-65535 之间的整数")
+	}
+	if opts.CachePath, err = ask("缓存目录", opts.CachePath); err != nil {
+		return err
+	}
+	return nil
+}
+
+// writeInitConfig 按模板写入配置文件
+func writeInitConfig(name string, opts *initOptions) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("创建配置文件失败: %w", err)
+	}
+	defer file.Close()
+
+	if err := initConfigTemplate.Execute(file, opts); err != nil {
+		return fmt.Errorf("写入配置文件失败: %w", err)
+	}
+	return nil
+}
+
+// isTerminal 标准输入是否为终端
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+var initConfigTemplate = template.Must(template.New("proxy.toml").Funcs(template.FuncMap{
+	"quote": strconv.Quote,
+}).Parse(`# 由 tushareproxy init 生成，完整配置项见 proxy.toml.example
+
+[server]
+host = "0.0.0.0"
+port = {{.Port}}
+read_timeout = 30
+# 开启限流重试后需大于 rate_limit_max_wait_seconds + tushare.timeout_seconds
+write_timeout = 120
+
+[cache]
+enabled = true
+backend = "badger"
+db_path = {{quote .CachePath}}
+# 默认缓存 100 天，历史行情不会变化
+default_ttl_seconds = 8640000
+# 实时行情不缓存
+uncacheable_apis = ["realtime_*", "rt_*"]
+# 日线类接口只缓存历史数据，盘中请求当天的数据直接转发
+intraday_apis = ["daily", "adj_factor", "daily_basic", "moneyflow"]
+# 没有权限、不存在的代码等错误响应缓存 10 分钟，避免反复消耗额度
+negative_ttl_seconds = 600
+
+# 按 api_name 覆盖默认 TTL（秒），会定期变化的基础信息缓存时间短一些
+[cache.ttl_overrides]
+stock_basic = 86400
+trade_cal = 86400
+namechange = 86400
+stock_company = 604800
+
+[tushare]
+api_url = "http://api.waditu.com/dataapi"
+timeout_seconds = 30
+# 遇到每分钟限流时等到下一分钟透明重试，并按学到的上限在本地限流
+rate_limit_retries = 2
+rate_limit_max_wait_seconds = 61
+local_rate_limit = true
+# 下游任务重试时，相同请求在 2 秒内共用同一次 tushare 结果
+dedupe_window_seconds = 2
+
+[calendar]
+# 非交易日的按日请求不访问 tushare
+enabled = {{if .Token}}true{{else}}false{{end}}
+token = {{quote .Token}}
+
+[token_check]
+# 定期检查 token 是否失效、积分或配额是否不足
+tokens = [{{if .Token}}{{quote .Token}}{{end}}]
+
+[log]
+level = "info"
+format = "console"
+output = "both"
+file_path = "logs/proxy.log"
+max_size = 10
+max_backups = 5
+max_age = 30
+`))
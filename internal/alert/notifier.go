@@ -0,0 +1,111 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/config"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// Event 告警事件
+type Event struct {
+	Type    string                 `json:"type"`
+	APIName string                 `json:"api_name,omitempty"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+	Time    int64                  `json:"time"`
+}
+
+// Notifier 告警通知器，通过 webhook 发送告警，同一告警键在冷却时间内只发送一次
+type Notifier struct {
+	webhookURL string
+	cooldown   time.Duration
+	client     *http.Client
+
+	mu       sync.Mutex
+	lastSent map[string]time.Time
+}
+
+// NewNotifier 创建告警通知器
+func NewNotifier(cfg *config.AlertConfig) *Notifier {
+	return &Notifier{
+		webhookURL: cfg.WebhookURL,
+		cooldown:   time.Duration(cfg.CooldownSeconds) * time.Second,
+		client: &http.Client{
+			Timeout: time.Duration(cfg.TimeoutSeconds) * time.Second,
+		},
+		lastSent: make(map[string]time.Time),
+	}
+}
+
+// Notify 异步发送告警，key 用于冷却去重
+func (n *Notifier) Notify(key string, event Event) {
+	if n == nil {
+		return
+	}
+
+	now := time.Now()
+	n.mu.Lock()
+	if last, ok := n.lastSent[key]; ok && now.Sub(last) < n.cooldown {
+		n.mu.Unlock()
+		return
+	}
+	n.lastSent[key] = now
+	n.mu.Unlock()
+
+	if event.Time == 0 {
+		event.Time = now.Unix()
+	}
+
+	logger.Warn("触发告警",
+		zap.String("type", event.Type),
+		zap.String("api_name", event.APIName),
+		zap.String("message", event.Message),
+		zap.Any("details", event.Details))
+
+	if n.webhookURL == "" {
+		return
+	}
+
+	go func() {
+		if err := n.send(event); err != nil {
+			logger.Error("发送告警 webhook 失败", zap.Error(err), zap.String("type", event.Type))
+		}
+	}()
+}
+
+// Send 同步发送事件，不受冷却时间限制，用于进程退出前必须送达的通知。没有配置 webhook 时不发送
+func (n *Notifier) Send(event Event) error {
+	if n == nil || n.webhookURL == "" {
+		return nil
+	}
+	if event.Time == 0 {
+		event.Time = time.Now().Unix()
+	}
+	return n.send(event)
+}
+
+func (n *Notifier) send(event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("序列化告警失败: %w", err)
+	}
+
+	resp, err := n.client.Post(n.webhookURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("请求 webhook 失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook 返回状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package alert
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/config"
+)
+
+// 滚动窗口按分钟分桶
+const errorBucketDuration = time.Minute
+
+type errorBucket struct {
+	index    int64
+	errors   int64
+	requests int64
+}
+
+// UpstreamErrorTracker 按 api_name 统计滚动窗口内的上游错误率，超过阈值时告警
+type UpstreamErrorTracker struct {
+	threshold   float64
+	buckets     int
+	minRequests int64
+	notifier    *Notifier
+
+	mu   sync.Mutex
+	apis map[string][]errorBucket
+}
+
+// NewUpstreamErrorTracker 创建上游错误率跟踪器
+func NewUpstreamErrorTracker(cfg *config.AlertConfig, notifier *Notifier) *UpstreamErrorTracker {
+	buckets := int(time.Duration(cfg.UpstreamErrorWindowSeconds) * time.Second / errorBucketDuration)
+	if buckets < 1 {
+		buckets = 1
+	}
+
+	return &UpstreamErrorTracker{
+		threshold:   cfg.UpstreamErrorRate,
+		buckets:     buckets,
+		minRequests: int64(cfg.UpstreamErrorMinRequests),
+		notifier:    notifier,
+		apis:        make(map[string][]errorBucket),
+	}
+}
+
+// Record 记录一次上游请求结果，errMsg 为空表示成功。记录错误后立即检查错误率
+func (t *UpstreamErrorTracker) Record(apiName string, errMsg string) {
+	if t == nil {
+		return
+	}
+
+	index := time.Now().Unix() / int64(errorBucketDuration/time.Second)
+
+	t.mu.Lock()
+	ring, ok := t.apis[apiName]
+	if !ok {
+		ring = make([]errorBucket, t.buckets)
+		t.apis[apiName] = ring
+	}
+
+	b := &ring[index%int64(t.buckets)]
+	if b.index != index {
+		*b = errorBucket{index: index}
+	}
+	b.requests++
+	if errMsg == "" {
+		t.mu.Unlock()
+		return
+	}
+	b.errors++
+
+	var errors, requests int64
+	for _, b := range ring {
+		if index-b.index < int64(t.buckets) {
+			errors += b.errors
+			requests += b.requests
+		}
+	}
+	t.mu.Unlock()
+
+	if requests < t.minRequests {
+		return
+	}
+	rate := float64(errors) / float64(requests)
+	if rate < t.threshold {
+		return
+	}
+
+	t.notifier.Notify("upstream_error:"+apiName, Event{
+		Type:    "upstream_error_rate_high",
+		APIName: apiName,
+		Message: fmt.Sprintf("%s 上游错误率 %.2f 超过阈值 %.2f，最近错误: %s", apiName, rate, t.threshold, errMsg),
+		Details: map[string]interface{}{
+			"errors":     errors,
+			"requests":   requests,
+			"rate":       rate,
+			"threshold":  t.threshold,
+			"last_error": errMsg,
+		},
+	})
+}
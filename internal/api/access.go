@@ -0,0 +1,132 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/config"
+)
+
+// timeWindow 一天中的时间窗口，单位为分钟；start 大于 end 表示跨零点
+type timeWindow struct {
+	start int
+	end   int
+}
+
+func (w timeWindow) contains(minute int) bool {
+	if w.start <= w.end {
+		return minute >= w.start && minute < w.end
+	}
+	return minute >= w.start || minute < w.end
+}
+
+// accessRule 按来源和接口限制访问时间窗口
+type accessRule struct {
+	name     string
+	tokens   map[string]struct{}
+	prefixes []netip.Prefix
+	apis     []string
+	allow    []timeWindow
+	// 原始窗口配置，用于错误提示
+	allowText string
+}
+
+// accessWindows 访问时间窗口规则
+type accessWindows struct {
+	location *time.Location
+	rules    []accessRule
+}
+
+// 全局访问时间窗口规则，未配置时为 nil
+var accessControl *accessWindows
+
+func newAccessWindows(cfg *config.AccessConfig) *accessWindows {
+	if len(cfg.Rules) == 0 {
+		return nil
+	}
+
+	// 配置校验阶段已经检查过，这里不会出错
+	location, _ := time.LoadLocation(cfg.Timezone)
+	a := &accessWindows{location: location}
+	for i, rule := range cfg.Rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		prefixes, _ := config.ParseIPRanges(rule.IPs)
+		r := accessRule{
+			name:      name,
+			tokens:    make(map[string]struct{}, len(rule.Tokens)),
+			prefixes:  prefixes,
+			apis:      rule.APIs,
+			allowText: strings.Join(rule.Allow, ", "),
+		}
+		for _, token := range rule.Tokens {
+			if token != "" {
+				r.tokens[token] = struct{}{}
+			}
+		}
+		for _, window := range rule.Allow {
+			start, end, _ := config.ParseTimeWindow(window)
+			r.allow = append(r.allow, timeWindow{start: start, end: end})
+		}
+		a.rules = append(a.rules, r)
+	}
+	return a
+}
+
+// matches 规则是否适用于该请求
+func (rule *accessRule) matches(preparedRequest *PreparedRequest, r *http.Request) bool {
+	if len(rule.tokens) > 0 || len(rule.prefixes) > 0 {
+		_, tokenMatched := rule.tokens[preparedRequest.Token]
+		if !tokenMatched && !matchRemoteAddr(rule.prefixes, r) {
+			return false
+		}
+	}
+	if len(rule.apis) == 0 {
+		return true
+	}
+	for _, pattern := range rule.apis {
+		// 模式已在配置校验时检查过
+		if ok, _ := path.Match(pattern, preparedRequest.APIName); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// allows 当前时间是否在规则允许的窗口内
+func (rule *accessRule) allows(minute int) bool {
+	for _, window := range rule.allow {
+		if window.contains(minute) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAccessWindow 请求匹配的所有规则都必须允许当前时间，否则拒绝
+func checkAccessWindow(preparedRequest *PreparedRequest, r *http.Request, now time.Time) *proxyError {
+	if accessControl == nil {
+		return nil
+	}
+
+	local := now.In(accessControl.location)
+	minute := local.Hour()*60 + local.Minute()
+	for i := range accessControl.rules {
+		rule := &accessControl.rules[i]
+		if !rule.matches(preparedRequest, r) || rule.allows(minute) {
+			continue
+		}
+		return &proxyError{
+			Code: CodeForbidden,
+			Msg: fmt.Sprintf("访问规则 %s 只允许在 %s 访问接口 %s",
+				rule.name, rule.allowText, preparedRequest.APIName),
+		}
+	}
+	return nil
+}
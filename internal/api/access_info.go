@@ -0,0 +1,74 @@
+package api
+
+import (
+	"context"
+)
+
+// AccessInfo 处理请求时记下的接口名、缓存状态和上游状态码，由访问日志中间件在请求结束后输出
+type AccessInfo struct {
+	APIName     string
+	CacheStatus string
+	// tushare 响应的 HTTP 状态码，没有访问 tushare（命中缓存、请求被拒绝）时为 0
+	UpstreamStatus int
+	// 代理自身返回的错误码，没有出错时为 0
+	ErrorCode int
+	// 批量请求的子请求数，其他请求为 0
+	BatchSize int
+}
+
+// 批量请求在访问日志中的接口名
+const batchAccessAPIName = "batch"
+
+type accessInfoKey struct{}
+
+// WithAccessInfo 在请求上下文中放入一个空的 AccessInfo，处理函数会填写它
+func WithAccessInfo(ctx context.Context) (context.Context, *AccessInfo) {
+	info := &AccessInfo{}
+	return context.WithValue(ctx, accessInfoKey{}, info), info
+}
+
+// accessInfoFrom 取出请求上下文中的 AccessInfo，没有访问日志中间件时返回 nil
+func accessInfoFrom(ctx context.Context) *AccessInfo {
+	info, _ := ctx.Value(accessInfoKey{}).(*AccessInfo)
+	return info
+}
+
+// recordAccessResult 记下请求的处理结果
+func recordAccessResult(ctx context.Context, preparedRequest *PreparedRequest, result *proxyResult, perr *proxyError) {
+	info := accessInfoFrom(ctx)
+	if info == nil {
+		return
+	}
+	info.APIName = preparedRequest.APIName
+	if perr != nil {
+		info.ErrorCode = perr.Code
+		return
+	}
+	info.CacheStatus = result.CacheStatus
+	if !result.FromCache {
+		info.UpstreamStatus = result.StatusCode
+	}
+}
+
+// recordAccessQueued 记下进入限流排队、还没有结果的请求的接口名
+func recordAccessQueued(ctx context.Context, preparedRequest *PreparedRequest) {
+	if info := accessInfoFrom(ctx); info != nil {
+		info.APIName = preparedRequest.APIName
+	}
+}
+
+// recordBatchAccess 记下批量请求的子请求数和第一个失败的子请求的错误码，没有失败时为 0
+func recordBatchAccess(ctx context.Context, size int, errorCode int) {
+	if info := accessInfoFrom(ctx); info != nil {
+		info.APIName = batchAccessAPIName
+		info.BatchSize = size
+		info.ErrorCode = errorCode
+	}
+}
+
+// recordAccessError 记下解析出接口名之前就返回的错误
+func recordAccessError(ctx context.Context, code int) {
+	if info := accessInfoFrom(ctx); info != nil {
+		info.ErrorCode = code
+	}
+}
@@ -0,0 +1,586 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/cache"
+	"github.com/roowe/tushareproxy/internal/history"
+	"github.com/roowe/tushareproxy/internal/jobs"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// 请求历史查询默认返回的条数
+const defaultHistoryLimit = 1000
+
+// 缓存键列表默认返回的条数
+const defaultCacheKeysLimit = 1000
+
+func init() {
+	// 缓存统计同时随 Badger 自带的 expvar 指标从 /admin/metrics 导出
+	expvar.Publish("tushareproxy_cache", expvar.Func(func() interface{} {
+		if cacheManager == nil {
+			return nil
+		}
+		return cacheManager.Stats()
+	}))
+}
+
+// AdminParamStatsHandler 返回按 api_name 聚合的请求参数组合抽样统计
+func AdminParamStatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		sendErrorResponse(w, "只支持GET方法", CodeMethodNotAllowed)
+		return
+	}
+
+	sendAdminResponse(w, paramCollector.Snapshot())
+}
+
+// AdminCanaryStatsHandler 返回按 api_name 汇总的缓存抽检结果
+func AdminCanaryStatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		sendErrorResponse(w, "只支持GET方法", CodeMethodNotAllowed)
+		return
+	}
+
+	sendAdminResponse(w, canaryStats.Snapshot())
+}
+
+// AdminCacheStatsHandler 返回缓存大小和 Badger 内部指标（L0 表数、待压缩层、写入阻塞、值日志文件数等）
+func AdminCacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		sendErrorResponse(w, "只支持GET方法", CodeMethodNotAllowed)
+		return
+	}
+	if cacheManager == nil {
+		sendErrorResponse(w, "缓存未开启", CodeNotFound)
+		return
+	}
+
+	sendAdminResponse(w, cacheManager.Stats())
+}
+
+// AdminCacheInvalidateHandler 手动失效缓存条目，POST ?key=缓存键[&ttl_seconds=墓碑时长]。
+// 缓存键可以从响应头 X-Cache-Key 或日志的 cache_key 拿到
+func AdminCacheInvalidateHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		sendErrorResponse(w, "只支持POST方法", CodeMethodNotAllowed)
+		return
+	}
+	if cacheManager == nil {
+		sendErrorResponse(w, "缓存未开启", CodeNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	key := query.Get("key")
+	if key == "" {
+		sendErrorResponse(w, "缺少 key 参数", CodeBadRequest)
+		return
+	}
+	ttlSeconds := proxyConfig.Cache.TombstoneTTLSeconds
+	if raw := query.Get("ttl_seconds"); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value <= 0 {
+			sendErrorResponse(w, "ttl_seconds 参数必须是正整数", CodeBadRequest)
+			return
+		}
+		ttlSeconds = value
+	}
+
+	ttl := time.Duration(ttlSeconds) * time.Second
+	if err := cacheManager.Invalidate(key, ttl); err != nil {
+		sendErrorResponse(w, err.Error(), CodeInternal)
+		return
+	}
+	sendAdminResponse(w, map[string]interface{}{
+		"key":                  key,
+		"tombstone_expires_at": time.Now().Add(ttl).Unix(),
+	})
+}
+
+// cachedKey 缓存键列表中的一项
+type cachedKey struct {
+	Key        string `json:"key"`
+	Namespace  string `json:"namespace"`
+	APIName    string `json:"api_name"`
+	AgeSeconds int64  `json:"age_seconds"`
+	ExpiresAt  int64  `json:"expires_at"`
+	Size       int    `json:"size"`
+	HitCount   uint64 `json:"hit_count"`
+	// 最近一次命中的时间（unix 秒），写入后没有命中过时不返回
+	LastAccessAt int64 `json:"last_access_at,omitempty"`
+}
+
+// AdminCacheKeysHandler 列出缓存键，GET [?api_name=接口名，支持通配符][&namespace=命名空间][&limit=条数]
+func AdminCacheKeysHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		sendErrorResponse(w, "只支持GET方法", CodeMethodNotAllowed)
+		return
+	}
+	if cacheManager == nil {
+		sendErrorResponse(w, "缓存未开启", CodeNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	pattern := query.Get("api_name")
+	if _, err := path.Match(pattern, ""); err != nil {
+		sendErrorResponse(w, "api_name 通配符格式错误", CodeBadRequest)
+		return
+	}
+	namespace := query.Get("namespace")
+	limit := defaultCacheKeysLimit
+	if raw := query.Get("limit"); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value <= 0 {
+			sendErrorResponse(w, "limit 参数必须是正整数", CodeBadRequest)
+			return
+		}
+		limit = value
+	}
+
+	now := time.Now().Unix()
+	keys := []cachedKey{}
+	total := 0
+	err := cacheManager.ForEachEntry(func(key string, entry *cache.CacheEntry, hitCount uint64) error {
+		apiName := entry.APIName()
+		if !matchCacheEntry(entry, apiName, pattern, namespace) {
+			return nil
+		}
+		total++
+		if len(keys) < limit {
+			keys = append(keys, cachedKey{
+				Key:          key,
+				Namespace:    entry.Namespace,
+				APIName:      apiName,
+				AgeSeconds:   now - entry.Timestamp,
+				ExpiresAt:    entry.ExpiresAt,
+				Size:         len(entry.ResponseBody),
+				HitCount:     hitCount,
+				LastAccessAt: entry.LastAccessAt,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		sendErrorResponse(w, "遍历缓存失败: "+err.Error(), CodeInternal)
+		return
+	}
+
+	sendAdminResponse(w, map[string]interface{}{
+		"total": total,
+		"keys":  keys,
+	})
+}
+
+// entryInspector 能读取单个缓存键诊断信息的缓存，内置的 CacheManager 实现了该接口
+type entryInspector interface {
+	Inspect(key string) (*cache.EntryInfo, error)
+}
+
+// cacheEntryDetail 单个缓存条目的诊断信息
+type cacheEntryDetail struct {
+	Key       string `json:"key"`
+	Namespace string `json:"namespace,omitempty"`
+	APIName   string `json:"api_name,omitempty"`
+	// 按请求体查询时，请求在查缓存前就被判定为不可缓存的原因
+	UncacheableReason string `json:"uncacheable_reason,omitempty"`
+	Found             bool   `json:"found"`
+	Expired           bool   `json:"expired"`
+	// Request 缓存的请求体，已去掉 token
+	Request      json.RawMessage `json:"request,omitempty"`
+	StatusCode   int             `json:"status_code,omitempty"`
+	ResponseSize int             `json:"response_size"`
+	Header       http.Header     `json:"header,omitempty"`
+	Timestamp    int64           `json:"timestamp,omitempty"`
+	FetchedAtMs  int64           `json:"fetched_at_ms,omitempty"`
+	AgeSeconds   int64           `json:"age_seconds,omitempty"`
+	ExpiresAt    int64           `json:"expires_at,omitempty"`
+	TTLSeconds   int64           `json:"ttl_seconds"`
+	HitCount     uint64          `json:"hit_count"`
+	LastAccessAt int64           `json:"last_access_at,omitempty"`
+	// 手动失效墓碑的剩余秒数，期间该键不会被写入
+	TombstoneTTLSeconds int64 `json:"tombstone_ttl_seconds,omitempty"`
+}
+
+// AdminCacheEntryHandler 查看单个缓存条目，GET ?key=缓存键，或 POST 原始请求体（与 /dataapi 相同）按请求计算缓存键。
+// 返回缓存的请求、响应大小、状态码、写入时间和剩余 TTL，不计入命中次数
+func AdminCacheEntryHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if cacheManager == nil {
+		sendErrorResponse(w, "缓存未开启", CodeNotFound)
+		return
+	}
+	inspector, ok := cacheManager.(entryInspector)
+	if !ok {
+		sendErrorResponse(w, "当前缓存存储不支持查看条目", CodeNotFound)
+		return
+	}
+
+	detail := &cacheEntryDetail{}
+	switch r.Method {
+	case http.MethodGet:
+		detail.Key = r.URL.Query().Get("key")
+		if detail.Key == "" {
+			sendErrorResponse(w, "需要指定 key 参数", CodeBadRequest)
+			return
+		}
+	case http.MethodPost:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			sendErrorResponse(w, "读取请求体失败", CodeBadRequest)
+			return
+		}
+		preparedRequest, err := parseIncomingRequest(body)
+		if err != nil {
+			sendErrorResponse(w, err.Error(), CodeBadRequest)
+			return
+		}
+		detail.Namespace = preparedRequest.Policy.ResolvedNamespace(cacheKeys.DefaultNamespace())
+		detail.Key = cacheKeys.GenerateKey(detail.Namespace, preparedRequest.ForwardBody)
+		detail.APIName = preparedRequest.APIName
+		detail.UncacheableReason = uncacheableReason(preparedRequest, time.Now())
+	default:
+		sendErrorResponse(w, "只支持GET和POST方法", CodeMethodNotAllowed)
+		return
+	}
+
+	info, err := inspector.Inspect(detail.Key)
+	if err != nil {
+		sendErrorResponse(w, err.Error(), CodeInternal)
+		return
+	}
+
+	now := time.Now()
+	detail.HitCount = info.HitCount
+	if !info.LastAccess.IsZero() {
+		detail.LastAccessAt = info.LastAccess.Unix()
+	}
+	detail.TombstoneTTLSeconds = int64(info.TombstoneTTL / time.Second)
+	if entry := info.Entry; entry != nil {
+		detail.Found = true
+		detail.Expired = info.Expired
+		detail.Namespace = entry.Namespace
+		detail.APIName = entry.APIName()
+		detail.Request = stripToken(entry.RequestBody)
+		detail.StatusCode = entry.StatusCode
+		detail.ResponseSize = len(entry.ResponseBody)
+		detail.Header = entry.Header
+		detail.Timestamp = entry.Timestamp
+		detail.FetchedAtMs = entry.FetchedAtMs
+		detail.AgeSeconds = now.Unix() - entry.Timestamp
+		if !info.ExpiresAt.IsZero() {
+			detail.ExpiresAt = info.ExpiresAt.Unix()
+			detail.TTLSeconds = max(int64(info.ExpiresAt.Sub(now)/time.Second), 0)
+		}
+	}
+
+	sendAdminResponse(w, detail)
+}
+
+// stripToken 去掉请求体中的 token，解析失败时返回 nil
+func stripToken(body []byte) json.RawMessage {
+	var request map[string]json.RawMessage
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil
+	}
+	delete(request, "token")
+	stripped, err := json.Marshal(request)
+	if err != nil {
+		return nil
+	}
+	return stripped
+}
+
+// AdminCacheDeleteHandler 删除缓存条目，不写墓碑，下次请求会重新缓存。
+// POST ?key=缓存键，或 ?api_name=接口名（支持通配符，如 stk_*）[&namespace=命名空间]
+func AdminCacheDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		sendErrorResponse(w, "只支持POST方法", CodeMethodNotAllowed)
+		return
+	}
+	if cacheManager == nil {
+		sendErrorResponse(w, "缓存未开启", CodeNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	if key := query.Get("key"); key != "" {
+		if err := cacheManager.Delete(key); err != nil {
+			sendErrorResponse(w, err.Error(), CodeInternal)
+			return
+		}
+		sendAdminResponse(w, map[string]int{"deleted": 1})
+		return
+	}
+
+	pattern := query.Get("api_name")
+	if pattern == "" {
+		sendErrorResponse(w, "需要指定 key 或 api_name 参数", CodeBadRequest)
+		return
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		sendErrorResponse(w, "api_name 通配符格式错误", CodeBadRequest)
+		return
+	}
+	namespace := query.Get("namespace")
+
+	deleted, err := deleteCacheEntries(func(entry *cache.CacheEntry) bool {
+		return matchCacheEntry(entry, entry.APIName(), pattern, namespace)
+	})
+	if err != nil {
+		sendErrorResponse(w, err.Error(), CodeInternal)
+		return
+	}
+	logger.Info("已按接口名删除缓存",
+		zap.String("api_name", pattern),
+		zap.String("namespace", namespace),
+		zap.Int("deleted", deleted))
+	sendAdminResponse(w, map[string]int{"deleted": deleted})
+}
+
+// AdminCachePurgeHandler 清空全部缓存条目，POST ?confirm=true。
+// 命中计数随条目删除，墓碑和请求历史保留
+func AdminCachePurgeHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		sendErrorResponse(w, "只支持POST方法", CodeMethodNotAllowed)
+		return
+	}
+	if cacheManager == nil {
+		sendErrorResponse(w, "缓存未开启", CodeNotFound)
+		return
+	}
+	if r.URL.Query().Get("confirm") != "true" {
+		sendErrorResponse(w, "清空缓存需要带上 confirm=true", CodeBadRequest)
+		return
+	}
+
+	deleted, err := deleteCacheEntries(func(*cache.CacheEntry) bool { return true })
+	if err != nil {
+		sendErrorResponse(w, err.Error(), CodeInternal)
+		return
+	}
+	logger.Warn("缓存已清空", zap.Int("deleted", deleted))
+	sendAdminResponse(w, map[string]int{"deleted": deleted})
+}
+
+// gcRunner 能手动运行垃圾回收的缓存，内置的 CacheManager 实现了该接口
+type gcRunner interface {
+	RunGC(discardRatio float64) (*cache.GCResult, error)
+}
+
+// AdminCacheGCHandler 立即运行一次值日志垃圾回收并返回结果，不受定时回收的时间窗口和暂停限制。
+// discard_ratio 参数可临时覆盖配置的回收比例
+func AdminCacheGCHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		sendErrorResponse(w, "只支持POST方法", CodeMethodNotAllowed)
+		return
+	}
+	if cacheManager == nil {
+		sendErrorResponse(w, "缓存未开启", CodeNotFound)
+		return
+	}
+	runner, ok := cacheManager.(gcRunner)
+	if !ok {
+		sendErrorResponse(w, "当前缓存不支持垃圾回收", CodeBadRequest)
+		return
+	}
+
+	var discardRatio float64
+	if raw := r.URL.Query().Get("discard_ratio"); raw != "" {
+		ratio, err := strconv.ParseFloat(raw, 64)
+		if err != nil || ratio <= 0 || ratio >= 1 {
+			sendErrorResponse(w, "discard_ratio 必须在 0 到 1 之间", CodeBadRequest)
+			return
+		}
+		discardRatio = ratio
+	}
+
+	result, err := runner.RunGC(discardRatio)
+	if err != nil {
+		sendErrorResponse(w, "垃圾回收失败: "+err.Error(), CodeInternal)
+		return
+	}
+	sendAdminResponse(w, result)
+}
+
+// matchCacheEntry 条目是否匹配接口名通配符和命名空间，条件为空时不过滤
+func matchCacheEntry(entry *cache.CacheEntry, apiName, pattern, namespace string) bool {
+	if namespace != "" && entry.Namespace != namespace {
+		return false
+	}
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(pattern, apiName)
+	return ok
+}
+
+// deleteCacheEntries 先遍历出要删除的键再逐个删除，不在遍历过程中修改存储
+func deleteCacheEntries(match func(entry *cache.CacheEntry) bool) (int, error) {
+	var keys []string
+	err := cacheManager.ForEachEntry(func(key string, entry *cache.CacheEntry, hitCount uint64) error {
+		if match(entry) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("遍历缓存失败: %w", err)
+	}
+
+	for i, key := range keys {
+		if err := cacheManager.Delete(key); err != nil {
+			return i, err
+		}
+	}
+	return len(keys), nil
+}
+
+// AdminHistoryHandler 查询请求历史，GET [?api_name=接口名][&date=YYYYMMDD][&limit=条数]
+func AdminHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		sendErrorResponse(w, "只支持GET方法", CodeMethodNotAllowed)
+		return
+	}
+	if historyRecorder == nil {
+		sendErrorResponse(w, "请求历史未开启", CodeNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	date := query.Get("date")
+	if date != "" && !history.ValidDate(date) {
+		sendErrorResponse(w, "date 参数必须是 YYYYMMDD 格式", CodeBadRequest)
+		return
+	}
+	limit := defaultHistoryLimit
+	if raw := query.Get("limit"); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value <= 0 {
+			sendErrorResponse(w, "limit 参数必须是正整数", CodeBadRequest)
+			return
+		}
+		limit = value
+	}
+
+	records, err := historyRecorder.Query(query.Get("api_name"), date)
+	if err != nil {
+		sendErrorResponse(w, err.Error(), CodeInternal)
+		return
+	}
+	total := len(records)
+	if total > limit {
+		records = records[:limit]
+	}
+	sendAdminResponse(w, map[string]interface{}{
+		"total":   total,
+		"records": records,
+	})
+}
+
+// AdminOfflineHandler 查询或切换离线模式，POST ?enabled=true|false 切换
+func AdminOfflineHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		enabled, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+		if err != nil {
+			sendErrorResponse(w, "enabled 参数必须是 true 或 false", CodeBadRequest)
+			return
+		}
+		SetOfflineMode(enabled)
+	default:
+		sendErrorResponse(w, "只支持GET和POST方法", CodeMethodNotAllowed)
+		return
+	}
+
+	sendAdminResponse(w, map[string]bool{"offline": IsOfflineMode()})
+}
+
+// AdminJobsHandler 查询或暂停/恢复后台任务，POST ?paused=true|false[&name=任务名] 切换，
+// 不带 name 时作用于全部任务
+func AdminJobsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		paused, err := strconv.ParseBool(r.URL.Query().Get("paused"))
+		if err != nil {
+			sendErrorResponse(w, "paused 参数必须是 true 或 false", CodeBadRequest)
+			return
+		}
+		if err := jobs.SetPaused(r.URL.Query().Get("name"), paused); err != nil {
+			sendErrorResponse(w, err.Error(), CodeBadRequest)
+			return
+		}
+	default:
+		sendErrorResponse(w, "只支持GET和POST方法", CodeMethodNotAllowed)
+		return
+	}
+
+	sendAdminResponse(w, jobs.Status())
+}
+
+// AdminTokensHandler 返回 token 巡检状态
+func AdminTokensHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		sendErrorResponse(w, "只支持GET方法", CodeMethodNotAllowed)
+		return
+	}
+
+	sendAdminResponse(w, tokenMonitor.Statuses())
+}
+
+// sendAdminResponse 以 tushare 格式返回管理接口数据
+func sendAdminResponse(w http.ResponseWriter, data interface{}) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(map[string]interface{}{
+		"code": 0,
+		"msg":  "",
+		"data": data,
+	}); err != nil {
+		logger.Error("序列化管理接口响应失败", zap.Error(err))
+		sendErrorResponse(w, "序列化响应失败", CodeInternal)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
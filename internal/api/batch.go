@@ -0,0 +1,165 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// batchItem 批量请求中单个请求的处理结果
+type batchItem struct {
+	result *proxyResult
+	err    *proxyError
+}
+
+// BatchAPIHandler 处理/dataapi/batch请求，请求体为 tushare 请求数组，
+// 按顺序返回响应数组，每个请求独立查缓存
+func BatchAPIHandler(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		logger.Warn("不支持的HTTP方法", zap.String("method", r.Method))
+		recordBatchAccess(r.Context(), 0, CodeMethodNotAllowed)
+		sendErrorResponse(w, "只支持POST方法", CodeMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		logger.Error("读取请求体失败", zap.Error(err))
+		recordBatchAccess(r.Context(), 0, CodeBadRequest)
+		sendErrorResponse(w, "读取请求体失败", CodeBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	rawRequests, err := parseBatchRequest(body, proxyConfig.Batch.MaxRequests)
+	if err != nil {
+		logger.Warn("解析批量请求失败", zap.Error(err))
+		recordBatchAccess(r.Context(), 0, CodeBadRequest)
+		sendErrorResponse(w, err.Error(), CodeBadRequest)
+		return
+	}
+
+	items := make([]batchItem, len(rawRequests))
+	sem := make(chan struct{}, proxyConfig.Batch.Concurrency)
+	var wg sync.WaitGroup
+
+	for i, raw := range rawRequests {
+		preparedRequest, err := parseIncomingRequest(raw)
+		if err != nil {
+			items[i].err = &proxyError{Code: CodeBadRequest, Msg: err.Error()}
+			continue
+		}
+		applySourceBypass(preparedRequest, r)
+		preparedRequest.Header = passthroughHeaders(r.Header)
+		preparedRequest.Refresh = wantsRefresh(r)
+		preparedRequest.RequestID = requestIDOf(w)
+		if perr := checkAccessWindow(preparedRequest, r, startTime); perr != nil {
+			items[i].err = perr
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, preparedRequest *PreparedRequest) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			items[i].result, items[i].err = executeRequest(r.Context(), preparedRequest, nil, time.Now())
+		}(i, preparedRequest)
+	}
+	wg.Wait()
+
+	defer func() {
+		for _, item := range items {
+			if item.result != nil {
+				item.result.Body.Close()
+			}
+		}
+	}()
+
+	// 按请求顺序拼接响应数组，落盘的响应直接从文件读取
+	var readers []io.Reader
+	var size int64
+	var hits, firstErrorCode int
+	appendPart := func(r io.Reader, n int64) {
+		readers = append(readers, r)
+		size += n
+	}
+
+	appendPart(bytes.NewReader([]byte("[")), 1)
+	for i, item := range items {
+		if i > 0 {
+			appendPart(bytes.NewReader([]byte(",")), 1)
+		}
+
+		perr := item.err
+		if perr == nil && item.result.StatusCode != http.StatusOK {
+			perr = &proxyError{
+				Code: CodeUpstreamError,
+				Msg:  fmt.Sprintf("tushare API返回HTTP状态码 %d", item.result.StatusCode),
+			}
+		}
+		if perr != nil {
+			if firstErrorCode == 0 {
+				firstErrorCode = perr.Code
+			}
+			errorResp, _ := json.Marshal(TushareAPIResult{Code: perr.Code, Msg: perr.Msg, RequestID: requestIDOf(w)})
+			appendPart(bytes.NewReader(errorResp), int64(len(errorResp)))
+			continue
+		}
+
+		if item.result.FromCache {
+			hits++
+		}
+		appendPart(item.result.Body.Reader(), item.result.Body.Size())
+	}
+	appendPart(bytes.NewReader([]byte("]")), 1)
+	recordBatchAccess(r.Context(), len(items), firstErrorCode)
+
+	if err := writeResponseBody(w, r, http.StatusOK, io.MultiReader(readers...), size); err != nil {
+		logger.Error("写入响应失败", zap.Error(err))
+	}
+
+	logger.Info("批量请求处理完成",
+		zap.Duration("duration", time.Since(startTime)),
+		zap.Int("count", len(items)),
+		zap.Int("cache_hits", hits))
+}
+
+// parseBatchRequest 解析批量请求体，返回每个请求的原始 JSON
+func parseBatchRequest(body []byte, maxRequests int) ([]json.RawMessage, error) {
+	trimmedBody := bytes.TrimSpace(body)
+	if len(trimmedBody) == 0 {
+		return nil, fmt.Errorf("请求体不能为空")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(trimmedBody))
+	var rawRequests []json.RawMessage
+	if err := decoder.Decode(&rawRequests); err != nil {
+		return nil, fmt.Errorf("请求体必须是 JSON 数组: %w", err)
+	}
+	if err := ensureSingleJSONObject(decoder); err != nil {
+		return nil, err
+	}
+
+	if len(rawRequests) == 0 {
+		return nil, fmt.Errorf("批量请求不能为空")
+	}
+	if len(rawRequests) > maxRequests {
+		return nil, fmt.Errorf("批量请求最多包含 %d 个请求", maxRequests)
+	}
+
+	return rawRequests, nil
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/config"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// bulkheadRoute api_name 通配模式到分组名额的映射
+type bulkheadRoute struct {
+	pattern string
+	group   string
+	sem     chan struct{}
+}
+
+// bulkheads 按接口隔离访问 tushare 的并发：分组内的接口共用名额，
+// 未归组的接口各自一份默认名额，慢接口排队不会占满其他接口的名额
+type bulkheads struct {
+	// 按模式长度降序排列，更具体的模式优先
+	routes      []bulkheadRoute
+	defaultSize int
+	maxWait     time.Duration
+
+	mu     sync.Mutex
+	perAPI map[string]chan struct{}
+}
+
+// 全局并发隔离，未配置时为 nil
+var upstreamBulkheads *bulkheads
+
+func newBulkheads(cfg *config.BulkheadConfig) *bulkheads {
+	if cfg.DefaultConcurrency == 0 && len(cfg.Groups) == 0 {
+		return nil
+	}
+
+	b := &bulkheads{
+		defaultSize: cfg.DefaultConcurrency,
+		maxWait:     time.Duration(cfg.MaxWaitSeconds) * time.Second,
+		perAPI:      make(map[string]chan struct{}),
+	}
+	for name, group := range cfg.Groups {
+		sem := make(chan struct{}, group.Concurrency)
+		for _, pattern := range group.APIs {
+			b.routes = append(b.routes, bulkheadRoute{pattern: pattern, group: name, sem: sem})
+		}
+	}
+	sort.Slice(b.routes, func(i, j int) bool {
+		if len(b.routes[i].pattern) != len(b.routes[j].pattern) {
+			return len(b.routes[i].pattern) > len(b.routes[j].pattern)
+		}
+		return b.routes[i].pattern < b.routes[j].pattern
+	})
+	return b
+}
+
+// pool 返回接口所属的分组名和名额，不限制时名额为 nil
+func (b *bulkheads) pool(apiName string) (string, chan struct{}) {
+	for _, route := range b.routes {
+		// 模式已在配置校验时检查过
+		if ok, _ := path.Match(route.pattern, apiName); ok {
+			return route.group, route.sem
+		}
+	}
+	if b.defaultSize == 0 {
+		return "", nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sem, ok := b.perAPI[apiName]
+	if !ok {
+		sem = make(chan struct{}, b.defaultSize)
+		b.perAPI[apiName] = sem
+	}
+	return apiName, sem
+}
+
+// acquire 占用一个并发名额，返回释放函数。名额已满时最多等待 max_wait_seconds
+func (b *bulkheads) acquire(ctx context.Context, apiName string) (func(), *proxyError) {
+	if b == nil {
+		return func() {}, nil
+	}
+	group, sem := b.pool(apiName)
+	if sem == nil {
+		return func() {}, nil
+	}
+
+	release := func() { <-sem }
+	select {
+	case sem <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	logger.Debug("接口并发已满，等待名额",
+		zap.String("api_name", apiName),
+		zap.String("group", group),
+		zap.Int("concurrency", cap(sem)))
+
+	timer := time.NewTimer(b.maxWait)
+	defer timer.Stop()
+
+	select {
+	case sem <- struct{}{}:
+		return release, nil
+	case <-ctx.Done():
+		return nil, &proxyError{Code: CodeClientClosed, Msg: "等待接口并发名额时客户端已断开"}
+	case <-timer.C:
+		logger.Warn("等待接口并发名额超时",
+			zap.String("api_name", apiName),
+			zap.String("group", group),
+			zap.Duration("max_wait", b.maxWait))
+		return nil, &proxyError{
+			Code:       CodeBusy,
+			Msg:        fmt.Sprintf("接口 %s 并发已满（%s 最多 %d 个），请稍后重试", apiName, group, cap(sem)),
+			RetryAfter: time.Second,
+		}
+	}
+}
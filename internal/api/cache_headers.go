@@ -0,0 +1,52 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/cache"
+)
+
+// 缓存状态响应头，便于客户端和压测直接看到数据来源，不用翻代理日志
+const (
+	headerCache    = "X-Cache"
+	headerCacheKey = "X-Cache-Key"
+	headerCacheAge = "X-Cache-Age"
+	// 缓存的过期时间（Unix 秒），客户端可以据此在本地缓存同一请求
+	headerCacheExpires = "X-Cache-Expires"
+	headerRetryAfter   = "Retry-After"
+)
+
+// setCacheHeaders 设置缓存状态响应头。X-Cache 取值与日志中的 cache_status 一致，
+// X-Cache-Age 只在命中缓存时设置，单位为秒
+func setCacheHeaders(header http.Header, result *proxyResult, now time.Time) {
+	header.Set(headerCache, result.CacheStatus)
+	if result.CacheKey != "" {
+		header.Set(headerCacheKey, result.CacheKey)
+	}
+	if result.FromCache && !result.CachedAt.IsZero() {
+		age := max(now.Sub(result.CachedAt), 0)
+		header.Set(headerCacheAge, strconv.FormatInt(int64(age/time.Second), 10))
+	}
+	if !result.ExpiresAt.IsZero() {
+		header.Set(headerCacheExpires, strconv.FormatInt(result.ExpiresAt.Unix(), 10))
+	}
+}
+
+// entryExpiresAt 缓存条目的过期时间，旧版本写入的条目没有记录时返回零值
+func entryExpiresAt(entry *cache.CacheEntry) time.Time {
+	if entry.ExpiresAt <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(entry.ExpiresAt, 0)
+}
+
+// setRetryAfter 限流、并发已满时告诉客户端多少秒后重试，不足 1 秒按 1 秒
+func setRetryAfter(header http.Header, wait time.Duration) {
+	if wait <= 0 {
+		return
+	}
+	seconds := int64((wait + time.Second - 1) / time.Second)
+	header.Set(headerRetryAfter, strconv.FormatInt(seconds, 10))
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/alert"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// cacheHealthChecker 能报告存储是否可用的缓存，内置的 CacheManager 实现了该接口
+type cacheHealthChecker interface {
+	// Healthy 存储可用时返回 nil，不可用时返回最近一次错误
+	Healthy() error
+	// Probe 检查存储是否恢复，成功时恢复可用
+	Probe() error
+}
+
+// cacheHealth 缓存存储不可用时返回最近一次错误。不可用期间请求不读写缓存，直接转发 tushare
+func cacheHealth() error {
+	if checker, ok := cacheManager.(cacheHealthChecker); ok {
+		return checker.Healthy()
+	}
+	return nil
+}
+
+// StartCacheHealthCheck 存储不可用期间按 cache.health_probe_interval_seconds 探测，恢复后重新使用缓存，
+// 不可用时通过告警 webhook 通知
+func StartCacheHealthCheck(notifier *alert.Notifier) {
+	checker, ok := cacheManager.(cacheHealthChecker)
+	if !ok || proxyConfig.Cache.HealthErrorThreshold <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(proxyConfig.Cache.HealthProbeIntervalSeconds) * time.Second)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			err := checker.Healthy()
+			if err == nil {
+				continue
+			}
+			notifier.Notify("cache_unhealthy", alert.Event{
+				Type:    "cache_unhealthy",
+				Message: "缓存存储连续出错，已暂停使用缓存，请求直接转发 tushare",
+				Details: map[string]interface{}{"error": err.Error()},
+			})
+			if err := checker.Probe(); err != nil {
+				logger.Debug("缓存存储仍不可用", zap.Error(err))
+			}
+		}
+	}()
+}
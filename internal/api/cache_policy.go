@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
 	"regexp"
 	"strings"
 	"time"
@@ -14,6 +15,8 @@ var cacheNamespacePattern = regexp.MustCompile(`^[A-Za-z0-9._:-]+$`)
 
 const maxUnixTimestampSeconds int64 = 9999999999
 
+var utf8BOM = []byte("\xef\xbb\xbf")
+
 // CachePolicy 表示请求级缓存控制策略。
 type CachePolicy struct {
 	Namespace string `json:"namespace,omitempty"`
@@ -27,10 +30,21 @@ type PreparedRequest struct {
 	ForwardBody []byte
 	Policy      CachePolicy
 	APIName     string
+	Token       string
+	Params      map[string]interface{}
+	// 客户端指定的返回字段，只用于请求历史
+	Fields string
+	// 需要透传给 tushare 的客户端请求头，不参与缓存键
+	Header http.Header
+	// 跳过缓存读取，回源后覆盖缓存，由 X-Cache-Refresh 请求头开启
+	Refresh bool
+	// 客户端请求的 ID，预热、预取等代理自己发起的请求为空
+	RequestID string
 }
 
 func parseIncomingRequest(body []byte) (*PreparedRequest, error) {
-	trimmedBody := bytes.TrimSpace(body)
+	// 以 text/plain 发送的请求体可能带 UTF-8 BOM
+	trimmedBody := bytes.TrimSpace(bytes.TrimPrefix(body, utf8BOM))
 	if len(trimmedBody) == 0 {
 		return nil, fmt.Errorf("请求体不能为空")
 	}
@@ -53,6 +67,15 @@ func parseIncomingRequest(body []byte) (*PreparedRequest, error) {
 	if apiName, ok := payload["api_name"].(string); ok {
 		prepared.APIName = strings.TrimSpace(apiName)
 	}
+	if token, ok := payload["token"].(string); ok {
+		prepared.Token = token
+	}
+	if params, ok := payload["params"].(map[string]interface{}); ok {
+		prepared.Params = params
+	}
+	if fields, ok := payload["fields"].(string); ok {
+		prepared.Fields = fields
+	}
 
 	if rawPolicy, ok := payload["_cache"]; ok {
 		if rawPolicy != nil {
@@ -79,6 +102,36 @@ func parseIncomingRequest(body []byte) (*PreparedRequest, error) {
 	return prepared, nil
 }
 
+// withParams 返回覆盖了部分 params 的请求副本，转发请求体同步更新
+func (p *PreparedRequest) withParams(overrides map[string]interface{}) (*PreparedRequest, error) {
+	decoder := json.NewDecoder(bytes.NewReader(p.ForwardBody))
+	decoder.UseNumber()
+
+	var payload map[string]interface{}
+	if err := decoder.Decode(&payload); err != nil {
+		return nil, err
+	}
+
+	params := make(map[string]interface{}, len(p.Params)+len(overrides))
+	for k, v := range p.Params {
+		params[k] = v
+	}
+	for k, v := range overrides {
+		params[k] = v
+	}
+	payload["params"] = params
+
+	forwardBody, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	rewritten := *p
+	rewritten.ForwardBody = forwardBody
+	rewritten.Params = params
+	return &rewritten, nil
+}
+
 func ensureSingleJSONObject(decoder *json.Decoder) error {
 	var extra interface{}
 	err := decoder.Decode(&extra)
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/cache"
+)
+
+// lookupCounters 启动以来可缓存请求的命中/未命中次数，总数和按 api_name 分别统计。
+// 错误响应缓存的命中（NEGATIVE）也算命中
+type lookupCounters struct {
+	hits   atomic.Int64
+	misses atomic.Int64
+
+	mu     sync.Mutex
+	perAPI map[string]*apiLookupCount
+	since  time.Time
+}
+
+type apiLookupCount struct {
+	hits   int64
+	misses int64
+}
+
+var lookupStats = &lookupCounters{
+	perAPI: make(map[string]*apiLookupCount),
+	since:  time.Now(),
+}
+
+// recordLookup 记录一次可缓存请求是否命中，同时用于缓存统计、命中率 SLO 和就绪检查
+func recordLookup(apiName string, hit bool) {
+	sloTracker.Record(apiName, hit)
+	lookupStats.record(apiName, hit)
+}
+
+func (c *lookupCounters) record(apiName string, hit bool) {
+	if hit {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	count, ok := c.perAPI[apiName]
+	if !ok {
+		count = &apiLookupCount{}
+		c.perAPI[apiName] = count
+	}
+	if hit {
+		count.hits++
+	} else {
+		count.misses++
+	}
+}
+
+// totals 返回命中次数和可缓存请求总数
+func (c *lookupCounters) totals() (hits, requests int64) {
+	hits = c.hits.Load()
+	return hits, hits + c.misses.Load()
+}
+
+// cacheStatsReport /admin/cache/stats 的响应
+type cacheStatsReport struct {
+	Since    string  `json:"since"`
+	Hits     int64   `json:"hits"`
+	Misses   int64   `json:"misses"`
+	HitRatio float64 `json:"hit_ratio"`
+	Entries  int     `json:"entries"`
+	// 缓存条目中响应体解压后的字节数之和
+	EntryBytes int64 `json:"entry_bytes"`
+	// 存储占用的磁盘大小，使用 Redis 时为 0
+	TotalBytes int64           `json:"total_bytes"`
+	APIs       []apiCacheStats `json:"apis"`
+	Storage    *cache.Stats    `json:"storage"`
+	// 热点键提前刷新的统计，未开启时为空
+	HotRefresh *hotRefreshStats `json:"hot_refresh,omitempty"`
+}
+
+// apiCacheStats 单个 api_name 的缓存统计
+type apiCacheStats struct {
+	APIName    string  `json:"api_name"`
+	Hits       int64   `json:"hits"`
+	Misses     int64   `json:"misses"`
+	HitRatio   float64 `json:"hit_ratio"`
+	Entries    int     `json:"entries"`
+	EntryBytes int64   `json:"entry_bytes"`
+	// 现有条目各自累计的命中次数之和（条目重新写入时归零），以及其中最近一次命中的时间
+	EntryHits    uint64 `json:"entry_hits"`
+	LastAccessAt int64  `json:"last_access_at,omitempty"`
+}
+
+// AdminCacheSummaryHandler 返回启动以来的命中/未命中次数、命中率，以及缓存条目数和大小，
+// 总数和按 api_name 分别统计。条目数需要遍历整个缓存，缓存很大时较慢
+func AdminCacheSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		sendErrorResponse(w, "只支持GET方法", CodeMethodNotAllowed)
+		return
+	}
+	if cacheManager == nil {
+		sendErrorResponse(w, "缓存未开启", CodeNotFound)
+		return
+	}
+
+	perAPI := make(map[string]*apiCacheStats)
+	apiStats := func(apiName string) *apiCacheStats {
+		stats, ok := perAPI[apiName]
+		if !ok {
+			stats = &apiCacheStats{APIName: apiName}
+			perAPI[apiName] = stats
+		}
+		return stats
+	}
+
+	report := &cacheStatsReport{
+		Since:   lookupStats.since.Format(time.RFC3339),
+		Storage: cacheManager.Stats(),
+	}
+	report.TotalBytes = report.Storage.TotalSize
+	if hotRefresh != nil {
+		report.HotRefresh = hotRefresh.stats()
+	}
+
+	err := cacheManager.ForEachEntry(func(key string, entry *cache.CacheEntry, hitCount uint64) error {
+		stats := apiStats(entry.APIName())
+		stats.Entries++
+		stats.EntryBytes += int64(len(entry.ResponseBody))
+		stats.EntryHits += hitCount
+		stats.LastAccessAt = max(stats.LastAccessAt, entry.LastAccessAt)
+		report.Entries++
+		report.EntryBytes += int64(len(entry.ResponseBody))
+		return nil
+	})
+	if err != nil {
+		sendErrorResponse(w, "遍历缓存失败: "+err.Error(), CodeInternal)
+		return
+	}
+
+	lookupStats.mu.Lock()
+	for apiName, count := range lookupStats.perAPI {
+		stats := apiStats(apiName)
+		stats.Hits, stats.Misses = count.hits, count.misses
+	}
+	lookupStats.mu.Unlock()
+
+	report.Hits, report.Misses = lookupStats.hits.Load(), lookupStats.misses.Load()
+	report.HitRatio = hitRatio(report.Hits, report.Misses)
+	report.APIs = make([]apiCacheStats, 0, len(perAPI))
+	for _, stats := range perAPI {
+		stats.HitRatio = hitRatio(stats.Hits, stats.Misses)
+		report.APIs = append(report.APIs, *stats)
+	}
+	// 按请求次数降序，次数相同时按条目数降序
+	sort.Slice(report.APIs, func(i, j int) bool {
+		a, b := report.APIs[i], report.APIs[j]
+		if a.Hits+a.Misses != b.Hits+b.Misses {
+			return a.Hits+a.Misses > b.Hits+b.Misses
+		}
+		if a.Entries != b.Entries {
+			return a.Entries > b.Entries
+		}
+		return a.APIName < b.APIName
+	})
+
+	sendAdminResponse(w, report)
+}
+
+// hitRatio 命中率，没有请求时为 0
+func hitRatio(hits, misses int64) float64 {
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"context"
+	"expvar"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/cache"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// cacheWrite 一次待写入缓存的上游响应
+type cacheWrite struct {
+	apiName     string
+	key         string
+	namespace   string
+	requestBody []byte
+	response    []byte
+	statusCode  int
+	header      http.Header
+	expiresAt   time.Time
+	fetchedAt   time.Time
+	integrity   cache.Integrity
+	// 写入成功后执行，例如登记区间拼接的分段
+	onStored func()
+}
+
+// cacheWriter 异步缓存写入队列：序列化和写存储放到后台，客户端不用等待。
+// 未开启时 queue 为 nil，直接同步写入
+var cacheWriter struct {
+	mu     sync.RWMutex
+	queue  chan cacheWrite
+	closed bool
+	wg     sync.WaitGroup
+
+	queued  atomic.Int64
+	dropped atomic.Int64
+	written atomic.Int64
+	failed  atomic.Int64
+}
+
+func init() {
+	expvar.Publish("tushareproxy_cache_writes", expvar.Func(func() interface{} {
+		cacheWriter.mu.RLock()
+		defer cacheWriter.mu.RUnlock()
+		if cacheWriter.queue == nil {
+			return nil
+		}
+		return map[string]interface{}{
+			"pending": len(cacheWriter.queue),
+			"queued":  cacheWriter.queued.Load(),
+			"dropped": cacheWriter.dropped.Load(),
+			"written": cacheWriter.written.Load(),
+			"failed":  cacheWriter.failed.Load(),
+		}
+	}))
+}
+
+// StartCacheWriter 按 cache.async_write_queue 启动异步写入的 worker，为 0 时保持同步写入
+func StartCacheWriter() {
+	size := proxyConfig.Cache.AsyncWriteQueue
+	if size <= 0 {
+		return
+	}
+
+	cacheWriter.mu.Lock()
+	cacheWriter.queue = make(chan cacheWrite, size)
+	cacheWriter.mu.Unlock()
+
+	for i := 0; i < proxyConfig.Cache.AsyncWriteWorkers; i++ {
+		cacheWriter.wg.Add(1)
+		go func() {
+			defer cacheWriter.wg.Done()
+			for write := range cacheWriter.queue {
+				writeCacheEntry(write)
+			}
+		}()
+	}
+	logger.Info("异步缓存写入已启用",
+		zap.Int("queue", size),
+		zap.Int("workers", proxyConfig.Cache.AsyncWriteWorkers))
+}
+
+// StopCacheWriter 停止接收新的写入并等待队列中的写入完成，需在关闭缓存之前调用。
+// 之后到达的写入改为同步执行
+func StopCacheWriter(ctx context.Context) error {
+	cacheWriter.mu.Lock()
+	if cacheWriter.queue == nil || cacheWriter.closed {
+		cacheWriter.mu.Unlock()
+		return nil
+	}
+	cacheWriter.closed = true
+	pending := len(cacheWriter.queue)
+	close(cacheWriter.queue)
+	cacheWriter.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		cacheWriter.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		logger.Info("异步缓存写入队列已清空", zap.Int("pending", pending))
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// storeCacheEntry 写入缓存。开启异步写入时放入队列后立即返回，队列已满时丢弃本次写入，
+// 下次请求同样的数据时会重新回源并写入
+func storeCacheEntry(write cacheWrite) {
+	cacheWriter.mu.RLock()
+	defer cacheWriter.mu.RUnlock()
+
+	if cacheWriter.queue == nil || cacheWriter.closed {
+		writeCacheEntry(write)
+		return
+	}
+	select {
+	case cacheWriter.queue <- write:
+		cacheWriter.queued.Add(1)
+	default:
+		cacheWriter.dropped.Add(1)
+		logger.Warn("缓存写入队列已满，丢弃本次写入",
+			zap.String("api_name", write.apiName),
+			zap.String("cache_key", write.key),
+			zap.Int("queue", cap(cacheWriter.queue)))
+	}
+}
+
+// writeCacheEntry 把响应写入缓存，失败只记录日志，不影响响应
+func writeCacheEntry(write cacheWrite) {
+	if err := cacheManager.Set(
+		write.key,
+		write.namespace,
+		write.requestBody,
+		write.response,
+		write.statusCode,
+		write.header,
+		write.expiresAt,
+		write.fetchedAt,
+		write.integrity,
+	); err != nil {
+		cacheWriter.failed.Add(1)
+		logger.Error("设置缓存失败", zap.Error(err))
+		return
+	}
+	cacheWriter.written.Add(1)
+	logger.Debug("响应已缓存",
+		zap.String("cache_key", write.key),
+		zap.String("namespace", write.namespace),
+		zap.Int64("expires_at", write.expiresAt.Unix()))
+	if write.onStored != nil {
+		write.onStored()
+	}
+	replicateEntry(write)
+}
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"fmt"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/config"
+)
+
+// 按配置判断为不可缓存、直接转发的请求
+const cacheStatusUncacheable = "UNCACHEABLE"
+
+// 不再变化的历史数据的缓存时长，相当于永不过期
+const immutableTTL = 100 * 365 * 24 * time.Hour
+
+// 按 api_name 记住的可缓存性判断结果的上限，客户端可以传任意 api_name，超过后不再记录
+const maxCacheabilityEntries = 4096
+
+// apiCacheability 只取决于 api_name 的可缓存性判断结果
+type apiCacheability struct {
+	// 为 false 时结果还取决于参数或日期，需要逐个请求判断
+	static bool
+	reason string
+}
+
+// cacheabilityTable 按 api_name 记住的判断结果，配置或策略文件变化时整体替换
+type cacheabilityTable struct {
+	entries sync.Map
+	size    atomic.Int64
+}
+
+var cacheability atomic.Pointer[cacheabilityTable]
+
+// resetCacheability 清空按 api_name 记住的判断结果，缓存规则、接口列表或策略文件变化后调用
+func resetCacheability() {
+	cacheability.Store(&cacheabilityTable{})
+}
+
+// uncacheableReason 在查缓存之前判断请求能否缓存，不能缓存时返回原因。
+// 不可缓存的请求跳过缓存键生成、缓存查询和写入，减少实时行情等请求的开销。
+// 结果只取决于 api_name 的（例如 uncacheable_apis 中的实时接口）按 api_name 记住，之后只查一次表
+func uncacheableReason(preparedRequest *PreparedRequest, now time.Time) string {
+	table := cacheability.Load()
+	if table == nil {
+		return evaluateCacheability(preparedRequest, now)
+	}
+	if value, ok := table.entries.Load(preparedRequest.APIName); ok {
+		if known := value.(apiCacheability); known.static {
+			return known.reason
+		}
+		return evaluateCacheability(preparedRequest, now)
+	}
+
+	known := classifyCacheability(preparedRequest.APIName)
+	if table.size.Load() < maxCacheabilityEntries {
+		if _, loaded := table.entries.LoadOrStore(preparedRequest.APIName, known); !loaded {
+			table.size.Add(1)
+		}
+	}
+	if known.static {
+		return known.reason
+	}
+	return evaluateCacheability(preparedRequest, now)
+}
+
+// classifyCacheability 判断 api_name 的可缓存性是否与参数和日期无关，与 evaluateCacheability 的判断顺序一致
+func classifyCacheability(apiName string) apiCacheability {
+	for i := range proxyConfig.Cache.Rules {
+		rule := &proxyConfig.Cache.Rules[i]
+		if len(rule.APIs) > 0 && !matchAPIPatterns(rule.APIs, apiName) {
+			continue
+		}
+		if len(rule.Params) > 0 {
+			return apiCacheability{}
+		}
+		// 没有参数条件的规则对该接口的所有请求都生效
+		if rule.Action == "no_cache" {
+			name := rule.Name
+			if name == "" {
+				name = fmt.Sprintf("#%d", i+1)
+			}
+			return apiCacheability{static: true, reason: "rule:" + name}
+		}
+		return apiCacheability{static: true}
+	}
+
+	cfg := proxyConfig.Cache
+	policy := policyFor(apiName)
+	if (policy != nil && policy.Uncacheable) || matchAPIPatterns(cfg.UncacheableAPIs, apiName) {
+		return apiCacheability{static: true, reason: "uncacheable_api"}
+	}
+	if (policy != nil && policy.Intraday) || matchAPIPatterns(cfg.IntradayAPIs, apiName) {
+		return apiCacheability{}
+	}
+	return apiCacheability{static: true}
+}
+
+// evaluateCacheability 按请求的参数和日期判断能否缓存
+func evaluateCacheability(preparedRequest *PreparedRequest, now time.Time) string {
+	if rule, name := matchCacheRule(preparedRequest, now); rule != nil {
+		if rule.Action == "no_cache" {
+			return "rule:" + name
+		}
+		return ""
+	}
+	cfg := proxyConfig.Cache
+	policy := policyFor(preparedRequest.APIName)
+	if (policy != nil && policy.Uncacheable) || matchAPIPatterns(cfg.UncacheableAPIs, preparedRequest.APIName) {
+		return "uncacheable_api"
+	}
+	intraday := (policy != nil && policy.Intraday) || matchAPIPatterns(cfg.IntradayAPIs, preparedRequest.APIName)
+	if intraday && !isHistoricalRequest(preparedRequest, now) {
+		return "intraday"
+	}
+	return ""
+}
+
+// cacheTTLFor 请求未指定 _cache.ttl/expires_at 时的缓存时长。
+// immutable_apis 中数据日期早于今天的历史数据不会再变化，永久缓存；
+// 实时类接口的当天数据随时在变，按 realtime_ttls 只缓存几秒到几分钟。
+// 匹配的缓存规则配置了 ttl_seconds 时优先使用，策略文件中的设置优先于主配置
+func cacheTTLFor(preparedRequest *PreparedRequest, now time.Time) time.Duration {
+	if rule, _ := matchCacheRule(preparedRequest, now); rule != nil && rule.TTLSeconds > 0 {
+		return time.Duration(rule.TTLSeconds) * time.Second
+	}
+	policy := policyFor(preparedRequest.APIName)
+	if policy == nil {
+		policy = &config.APIPolicy{}
+	}
+	historical := isHistoricalRequest(preparedRequest, now)
+	if historical && (policy.Immutable || matchAPIPatterns(proxyConfig.Cache.ImmutableAPIs, preparedRequest.APIName)) {
+		return immutableTTL
+	}
+	if !historical {
+		if policy.RealtimeTTLSeconds > 0 {
+			return time.Duration(policy.RealtimeTTLSeconds) * time.Second
+		}
+		if ttl, ok := cacheKeys.RealtimeTTLFor(preparedRequest.APIName); ok {
+			return ttl
+		}
+	}
+	if policy.TTLSeconds > 0 {
+		return time.Duration(policy.TTLSeconds) * time.Second
+	}
+	return cacheKeys.TTLFor(preparedRequest.APIName)
+}
+
+// matchAPIPatterns api_name 是否匹配任一通配模式，模式已在配置校验时检查过
+func matchAPIPatterns(patterns []string, apiName string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, apiName); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchCacheRule 返回第一条匹配请求的缓存规则和规则名，没有匹配时返回 nil
+func matchCacheRule(preparedRequest *PreparedRequest, now time.Time) (*config.CacheRule, string) {
+	rules := proxyConfig.Cache.Rules
+	for i := range rules {
+		rule := &rules[i]
+		if len(rule.APIs) > 0 && !matchAPIPatterns(rule.APIs, preparedRequest.APIName) {
+			continue
+		}
+		if !matchRuleParams(rule.Params, preparedRequest.Params, now) {
+			continue
+		}
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		return rule, name
+	}
+	return nil, ""
+}
+
+// matchRuleParams 请求参数是否满足规则的全部参数条件
+func matchRuleParams(conds map[string]string, params map[string]interface{}, now time.Time) bool {
+	today := clockAdjusted(now).Format(tushareDateLayout)
+	for name, cond := range conds {
+		// 空字符串和 null 与没有传参数一样
+		raw := params[name]
+		present := raw != nil && raw != ""
+		if cond == config.CacheRuleAbsent {
+			if present {
+				return false
+			}
+			continue
+		}
+		if !present {
+			return false
+		}
+
+		value, ok := raw.(string)
+		if !ok {
+			value = fmt.Sprint(raw)
+		}
+		switch cond {
+		case config.CacheRuleToday, config.CacheRuleBeforeToday, config.CacheRuleSinceToday:
+			if _, err := time.Parse(tushareDateLayout, value); err != nil {
+				return false
+			}
+			if (cond == config.CacheRuleToday && value != today) ||
+				(cond == config.CacheRuleBeforeToday && value >= today) ||
+				(cond == config.CacheRuleSinceToday && value < today) {
+				return false
+			}
+		default:
+			if ok, _ := path.Match(cond, value); !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
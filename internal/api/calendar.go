@@ -0,0 +1,279 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/calendar"
+	"github.com/roowe/tushareproxy/internal/config"
+	"github.com/roowe/tushareproxy/internal/jobs"
+	"github.com/roowe/tushareproxy/pkg/logger"
+	"github.com/roowe/tushareproxy/pkg/tsdata"
+
+	"go.uber.org/zap"
+)
+
+// 非交易日请求由本地日历直接应答时的缓存状态
+const cacheStatusCalendar = "CALENDAR"
+
+// 未指定交易所时使用的日历
+const defaultCalendarExchange = "SSE"
+
+// exchangeCalendar 一个交易所的交易日历和按它检查交易日的接口
+type exchangeCalendar struct {
+	exchange string
+	source   config.CalendarSource
+	patterns []string
+	calendar *calendar.Calendar
+}
+
+// 全局交易日历，按交易所区分，未开启时为 nil
+var tradeCalendars map[string]*exchangeCalendar
+
+// StartTradeCalendar 加载各交易所的交易日历并启动定期刷新，需在 SetConfig 之后、服务启动之前调用
+func StartTradeCalendar() {
+	calendars := make(map[string]*exchangeCalendar)
+	add := func(exchange string, patterns []string) {
+		// viper 读出的键是小写
+		exchange = strings.ToUpper(exchange)
+		if c, ok := calendars[exchange]; ok {
+			c.patterns = append(c.patterns, patterns...)
+			return
+		}
+		calendars[exchange] = &exchangeCalendar{
+			exchange: exchange,
+			source:   config.CalendarSources[exchange],
+			patterns: patterns,
+			calendar: calendar.New(),
+		}
+	}
+	for exchange, patterns := range proxyConfig.Calendar.Exchanges {
+		add(exchange, patterns)
+	}
+	// 定时预取按任务的交易所判断交易日，没有接口的交易所也要加载日历
+	for _, job := range proxyConfig.Prefetch.Jobs {
+		add(cmp.Or(job.Exchange, defaultCalendarExchange), nil)
+	}
+	tradeCalendars = calendars
+
+	if err := refreshTradeCalendars(context.Background()); err != nil {
+		logger.Error("加载交易日历失败，暂不检查交易日", zap.Error(err))
+	}
+
+	jobs.Register(jobs.CalendarRefresh)
+	go func() {
+		ticker := time.NewTicker(time.Duration(proxyConfig.Calendar.RefreshIntervalSeconds) * time.Second)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if jobs.Paused(jobs.CalendarRefresh) {
+				continue
+			}
+			if err := refreshTradeCalendars(context.Background()); err != nil {
+				logger.Error("刷新交易日历失败，继续使用旧日历", zap.Error(err))
+			}
+		}
+	}()
+}
+
+// refreshTradeCalendars 依次刷新各交易所的日历，某个交易所失败不影响其他交易所
+func refreshTradeCalendars(ctx context.Context) error {
+	var errs []error
+	for _, c := range tradeCalendars {
+		if err := refreshTradeCalendar(ctx, c); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.exchange, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// refreshTradeCalendar 通过缓存拉取交易所去年到明年的日历，缓存时间与刷新间隔一致
+func refreshTradeCalendar(ctx context.Context, c *exchangeCalendar) error {
+	cfg := proxyConfig.Calendar
+	now := time.Now()
+	params := map[string]string{
+		"start_date": fmt.Sprintf("%d0101", now.Year()-1),
+		"end_date":   fmt.Sprintf("%d1231", now.Year()+1),
+	}
+	// hk_tradecal、us_tradecal 每个接口只有一个市场，trade_cal 按 exchange 区分
+	if c.source.APIName == "trade_cal" {
+		params["exchange"] = c.exchange
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"api_name": c.source.APIName,
+		"token":    cfg.Token,
+		"params":   params,
+		"fields":   "cal_date,is_open",
+	})
+	if err != nil {
+		return err
+	}
+
+	preparedRequest, err := parseIncomingRequest(body)
+	if err != nil {
+		return err
+	}
+	ttl := int64(cfg.RefreshIntervalSeconds)
+	preparedRequest.Policy.TTL = &ttl
+
+	result, perr := lookupOrFetch(ctx, preparedRequest, nil, now)
+	if perr != nil {
+		return perr
+	}
+	defer result.Body.Close()
+
+	raw, err := result.Body.Bytes()
+	if err != nil {
+		return err
+	}
+	days, err := parseTradeCalendar(c.source.APIName, raw)
+	if err != nil {
+		return err
+	}
+
+	c.calendar.Update(days)
+	first, last := c.calendar.Range()
+	logger.Info("交易日历已更新",
+		zap.String("exchange", c.exchange),
+		zap.Int("days", len(days)),
+		zap.String("first", first),
+		zap.String("last", last),
+		zap.String("cache_status", result.CacheStatus))
+	return nil
+}
+
+// calendarFor 返回按哪个交易所的日历检查接口，没有配置时返回 nil。
+// 多个模式匹配时不含通配符的优先，其次是较长的模式
+func calendarFor(apiName string) *exchangeCalendar {
+	var matched *exchangeCalendar
+	var matchedPattern string
+	for _, c := range tradeCalendars {
+		for _, pattern := range c.patterns {
+			if ok, _ := path.Match(pattern, apiName); !ok {
+				continue
+			}
+			if pattern == apiName {
+				return c
+			}
+			if matched == nil || len(pattern) > len(matchedPattern) ||
+				(len(pattern) == len(matchedPattern) && c.exchange < matched.exchange) {
+				matched, matchedPattern = c, pattern
+			}
+		}
+	}
+	return matched
+}
+
+// parseTradeCalendar 解析 trade_cal、hk_tradecal、us_tradecal 响应为 cal_date -> is_open
+func parseTradeCalendar(apiName string, raw []byte) (map[string]bool, error) {
+	data, err := tsdata.Decode(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", apiName, err)
+	}
+
+	dateIdx := data.Index("cal_date")
+	openIdx := data.Index("is_open")
+	if dateIdx < 0 || openIdx < 0 {
+		return nil, fmt.Errorf("%s 响应缺少 cal_date 或 is_open 字段", apiName)
+	}
+
+	days := make(map[string]bool, len(data.Items))
+	for _, item := range data.Items {
+		if len(item) <= dateIdx || len(item) <= openIdx {
+			continue
+		}
+		date, ok := item[dateIdx].(string)
+		if !ok {
+			continue
+		}
+		days[date] = fmt.Sprint(item[openIdx]) == "1"
+	}
+	if len(days) == 0 {
+		return nil, fmt.Errorf("%s 没有返回数据", apiName)
+	}
+	return days, nil
+}
+
+// applyTradeCalendar 检查按日请求的 trade_date，非交易日时按配置返回空结果或改到前一交易日。
+// 返回的 result 非空时直接应答，否则使用返回的请求继续处理
+func applyTradeCalendar(preparedRequest *PreparedRequest) (*proxyResult, *PreparedRequest) {
+	c := calendarFor(preparedRequest.APIName)
+	if c == nil {
+		return nil, preparedRequest
+	}
+
+	tradeDate, ok := preparedRequest.Params["trade_date"].(string)
+	if !ok || tradeDate == "" {
+		return nil, preparedRequest
+	}
+	if open, known := c.calendar.IsOpen(tradeDate); open || !known {
+		return nil, preparedRequest
+	}
+
+	if proxyConfig.Calendar.Mode == "previous" {
+		if previous, ok := c.calendar.PreviousOpen(tradeDate); ok {
+			rewritten, err := preparedRequest.withParams(map[string]interface{}{"trade_date": previous})
+			if err == nil {
+				logger.Info("非交易日请求改到前一交易日",
+					zap.String("api_name", preparedRequest.APIName),
+					zap.String("exchange", c.exchange),
+					zap.String("trade_date", tradeDate),
+					zap.String("previous", previous),
+					requestIDField(preparedRequest))
+				return nil, rewritten
+			}
+			logger.Error("改写 trade_date 失败", zap.Error(err))
+		}
+	}
+
+	logger.Info("非交易日请求直接返回空结果",
+		zap.String("api_name", preparedRequest.APIName),
+		zap.String("exchange", c.exchange),
+		zap.String("trade_date", tradeDate),
+		requestIDField(preparedRequest))
+	return emptyTushareResult(preparedRequest), nil
+}
+
+// emptyResultBody 空结果，字段顺序与 tushare 一致
+type emptyResultBody struct {
+	Code int             `json:"code"`
+	Msg  string          `json:"msg"`
+	Data emptyResultData `json:"data"`
+}
+
+type emptyResultData struct {
+	Fields  []string      `json:"fields"`
+	Items   []interface{} `json:"items"`
+	HasMore bool          `json:"has_more"`
+}
+
+// emptyTushareResult 构造与 tushare 一致的空结果，fields 取自请求的 fields 参数
+func emptyTushareResult(preparedRequest *PreparedRequest) *proxyResult {
+	var payload struct {
+		Fields string `json:"fields"`
+	}
+	json.Unmarshal(preparedRequest.ForwardBody, &payload)
+
+	fields := []string{}
+	for _, field := range strings.Split(payload.Fields, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+
+	body, _ := json.Marshal(emptyResultBody{
+		Data: emptyResultData{Fields: fields, Items: []interface{}{}},
+	})
+	return &proxyResult{
+		StatusCode:  http.StatusOK,
+		Body:        newBufferedBody(body),
+		CacheStatus: cacheStatusCalendar,
+	}
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"math/rand"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/cache"
+	"github.com/roowe/tushareproxy/pkg/logger"
+	"github.com/roowe/tushareproxy/pkg/tsdata"
+
+	"go.uber.org/zap"
+)
+
+// 同时进行的抽检请求，达到 cache.canary_concurrency 时跳过本次抽检，避免抽检挤占 tushare 额度
+var canarySem chan struct{}
+
+// CanaryStats 单个接口的缓存抽检统计
+type CanaryStats struct {
+	APIName  string `json:"api_name"`
+	Checked  int64  `json:"checked"`
+	Diverged int64  `json:"diverged"`
+	Failed   int64  `json:"failed"`
+	// 最近一次发现不一致时的缓存年龄（秒）
+	LastDivergedAge int64 `json:"last_diverged_age"`
+}
+
+// canaryCollector 按接口汇总抽检结果
+type canaryCollector struct {
+	mu   sync.Mutex
+	apis map[string]*CanaryStats
+}
+
+// 全局抽检统计
+var canaryStats = &canaryCollector{apis: make(map[string]*CanaryStats)}
+
+func (c *canaryCollector) stats(apiName string) *CanaryStats {
+	s, ok := c.apis[apiName]
+	if !ok {
+		s = &CanaryStats{APIName: apiName}
+		c.apis[apiName] = s
+	}
+	return s
+}
+
+func (c *canaryCollector) recordFailed(apiName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats(apiName).Failed++
+}
+
+func (c *canaryCollector) recordChecked(apiName string, diverged bool, age time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.stats(apiName)
+	s.Checked++
+	if diverged {
+		s.Diverged++
+		s.LastDivergedAge = int64(age / time.Second)
+	}
+}
+
+// Snapshot 返回按接口名排序的抽检统计
+func (c *canaryCollector) Snapshot() []CanaryStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := make([]CanaryStats, 0, len(c.apis))
+	for _, s := range c.apis {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].APIName < stats[j].APIName })
+	return stats
+}
+
+// maybeCanaryCheck 按 canary_rate 抽取缓存命中，在后台重新请求 tushare 并与缓存比对，
+// 用于发现 TTL 策略导致的过期数据。抽检结果只做统计，不回写缓存
+func maybeCanaryCheck(key string, entry *cache.CacheEntry, preparedRequest *PreparedRequest) {
+	rate := proxyConfig.Cache.CanaryRate
+	if rate <= 0 || IsOfflineMode() || fixtureStore.Replaying() {
+		return
+	}
+	if rate < 1 && rand.Float64() >= rate {
+		return
+	}
+
+	select {
+	case canarySem <- struct{}{}:
+	default:
+		return
+	}
+
+	go func() {
+		defer func() { <-canarySem }()
+		runCanaryCheck(key, entry, preparedRequest)
+	}()
+}
+
+// runCanaryCheck 重新请求 tushare 并比对 data 字段
+func runCanaryCheck(key string, entry *cache.CacheEntry, preparedRequest *PreparedRequest) {
+	apiName := preparedRequest.APIName
+
+	// 抽检同样占用本地限流额度，额度用完时跳过
+	if wait := localLimiter.Reserve(apiName, time.Now()); wait > 0 {
+		return
+	}
+	if _, ok := dailyLimiter.Reserve(apiName, time.Now()); !ok {
+		return
+	}
+
+	// 转发给主代理时也不能用缓存应答
+	canaryRequest := *preparedRequest
+	canaryRequest.Policy.NoCache = true
+
+	upstream, statusCode, err := forwardRawRequestToTushareAPI(&canaryRequest, nil)
+	if err != nil {
+		canaryStats.recordFailed(apiName)
+		logger.Warn("缓存抽检请求 tushare 失败", zap.String("api_name", apiName), zap.Error(err))
+		return
+	}
+	defer upstream.Close()
+
+	fresh, err := upstream.Bytes()
+	if err != nil || statusCode != http.StatusOK {
+		canaryStats.recordFailed(apiName)
+		return
+	}
+
+	freshData, ok := comparableData(fresh)
+	if !ok {
+		// tushare 返回错误（如限流）时无法比对
+		canaryStats.recordFailed(apiName)
+		return
+	}
+	cachedData, ok := comparableData(entry.ResponseBody)
+	if !ok {
+		canaryStats.recordFailed(apiName)
+		return
+	}
+
+	age := time.Since(time.Unix(entry.Timestamp, 0))
+	diverged := !reflect.DeepEqual(freshData, cachedData)
+	canaryStats.recordChecked(apiName, diverged, age)
+	if diverged {
+		logger.Warn("缓存抽检发现数据与 tushare 不一致",
+			zap.String("api_name", apiName),
+			zap.String("cache_key", key),
+			zap.Duration("cache_age", age),
+			zap.Int64("expires_at", entry.ExpiresAt))
+	}
+}
+
+// comparableData 解析 code 为 0 的 tushare 响应的表格数据，其他响应无法比对
+func comparableData(body []byte) (*tsdata.Data, bool) {
+	data, err := tsdata.Decode(body)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/config"
+)
+
+// 全局上游 HTTP 客户端，复用连接
+var upstreamClient = &http.Client{
+	Timeout: 30 * time.Second,
+}
+
+// newUpstreamClient 根据配置创建带连接池的上游 HTTP 客户端
+func newUpstreamClient(cfg *config.TushareConfig) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   time.Duration(cfg.DialTimeoutSeconds) * time.Second,
+		KeepAlive: time.Duration(cfg.KeepAliveSeconds) * time.Second,
+	}
+
+	// 配置了出站代理时优先使用，地址已在配置校验时检查过
+	proxy := http.ProxyFromEnvironment
+	if cfg.ProxyURL != "" {
+		if proxyURL, err := url.Parse(cfg.ProxyURL); err == nil {
+			proxy = http.ProxyURL(proxyURL)
+		}
+	}
+
+	transport := &http.Transport{
+		Proxy:               proxy,
+		DialContext:         dialer.DialContext,
+		MaxIdleConns:        cfg.MaxIdleConns,
+		MaxIdleConnsPerHost: cfg.MaxIdleConnsPerHost,
+		IdleConnTimeout:     time.Duration(cfg.IdleConnTimeoutSeconds) * time.Second,
+		DisableKeepAlives:   cfg.KeepAliveSeconds < 0,
+		ForceAttemptHTTP2:   true,
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   time.Duration(cfg.TimeoutSeconds) * time.Second,
+	}
+}
+
+// upstreamRoute 按 api_name 通配模式指定的上游地址
+type upstreamRoute struct {
+	pattern string
+	url     string
+}
+
+// 全局上游路由，按模式长度降序排列
+var upstreamRoutes []upstreamRoute
+
+// newUpstreamRoutes 按模式长度降序排列路由，更具体的模式优先匹配
+func newUpstreamRoutes(routes map[string]string) []upstreamRoute {
+	sorted := make([]upstreamRoute, 0, len(routes))
+	for pattern, target := range routes {
+		sorted = append(sorted, upstreamRoute{pattern: pattern, url: target})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if len(sorted[i].pattern) != len(sorted[j].pattern) {
+			return len(sorted[i].pattern) > len(sorted[j].pattern)
+		}
+		return sorted[i].pattern < sorted[j].pattern
+	})
+	return sorted
+}
+
+// upstreamURL 接口的转发地址。只读副本把未命中的请求都转发给主代理，由主代理按路由转发
+func upstreamURL(apiName string) string {
+	if proxyConfig.Replica.Enabled {
+		return proxyConfig.Replica.PrimaryURL
+	}
+	for _, route := range upstreamRoutes {
+		// 模式已在配置校验时检查过
+		if ok, _ := path.Match(route.pattern, apiName); ok {
+			return route.url
+		}
+	}
+	return proxyConfig.Tushare.APIURL
+}
+
+// upstreamRequestBody 转发的请求体。转发给主代理时带回 _cache，让主代理按同样的策略缓存，
+// 之后随快照同步到副本
+func upstreamRequestBody(preparedRequest *PreparedRequest) []byte {
+	if !proxyConfig.Replica.Enabled {
+		return preparedRequest.ForwardBody
+	}
+
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(preparedRequest.ForwardBody, &payload); err != nil {
+		return preparedRequest.ForwardBody
+	}
+	policy, err := json.Marshal(preparedRequest.Policy)
+	if err != nil {
+		return preparedRequest.ForwardBody
+	}
+	payload["_cache"] = policy
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return preparedRequest.ForwardBody
+	}
+	return body
+}
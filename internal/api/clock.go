@@ -0,0 +1,106 @@
+package api
+
+import (
+	"expvar"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// 估算时钟偏差保留的最近样本数，取中位数，个别慢响应不影响结果
+const clockSkewSamples = 9
+
+// 至少有这么多样本才判断本机时钟是否偏差
+const clockSkewMinSamples = 3
+
+// 往返超过该时长的响应误差太大，不作为样本
+const clockSkewMaxRTT = 5 * time.Second
+
+// clockSkew 根据上游响应的 Date 头估算本机时钟偏差（上游时间减本机时间）
+var clockSkew struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	offset  time.Duration
+	skewed  bool
+}
+
+// 判断日期时补偿的偏差（纳秒），只在开启补偿且偏差超过阈值时非 0
+var clockCompensation atomic.Int64
+
+func init() {
+	expvar.Publish("tushareproxy_clock", expvar.Func(func() interface{} {
+		clockSkew.mu.Lock()
+		defer clockSkew.mu.Unlock()
+		return map[string]interface{}{
+			"samples":         len(clockSkew.samples),
+			"offset_ms":       clockSkew.offset.Milliseconds(),
+			"skewed":          clockSkew.skewed,
+			"compensation_ms": time.Duration(clockCompensation.Load()).Milliseconds(),
+		}
+	}))
+}
+
+// observeUpstreamClock 用一次上游响应的 Date 头更新偏差估算。
+// Date 头只精确到秒，按该秒的中点和请求往返的中点比较
+func observeUpstreamClock(date string, sentAt, receivedAt time.Time) {
+	threshold := time.Duration(proxyConfig.Clock.SkewWarnSeconds) * time.Second
+	if threshold <= 0 || date == "" {
+		return
+	}
+	upstreamTime, err := http.ParseTime(date)
+	if err != nil {
+		return
+	}
+	rtt := receivedAt.Sub(sentAt)
+	if rtt < 0 || rtt > clockSkewMaxRTT {
+		return
+	}
+	sample := upstreamTime.Add(500 * time.Millisecond).Sub(sentAt.Add(rtt / 2))
+
+	clockSkew.mu.Lock()
+	defer clockSkew.mu.Unlock()
+
+	clockSkew.samples = append(clockSkew.samples, sample)
+	if len(clockSkew.samples) > clockSkewSamples {
+		clockSkew.samples = clockSkew.samples[1:]
+	}
+	if len(clockSkew.samples) < clockSkewMinSamples {
+		return
+	}
+	sorted := slices.Clone(clockSkew.samples)
+	slices.Sort(sorted)
+	clockSkew.offset = sorted[len(sorted)/2]
+
+	skewed := clockSkew.offset.Abs() >= threshold
+	if skewed {
+		if proxyConfig.Clock.Compensate {
+			clockCompensation.Store(int64(clockSkew.offset))
+		}
+	} else {
+		clockCompensation.Store(0)
+	}
+	if skewed == clockSkew.skewed {
+		return
+	}
+	clockSkew.skewed = skewed
+	if skewed {
+		logger.Warn("本机时钟与上游相差过大，判断今天的缓存逻辑可能出错，请检查 NTP 同步",
+			zap.Duration("offset", clockSkew.offset.Round(time.Second)),
+			zap.Bool("compensate", proxyConfig.Clock.Compensate))
+	} else {
+		logger.Info("本机时钟与上游的偏差已恢复正常",
+			zap.Duration("offset", clockSkew.offset.Round(time.Second)))
+	}
+}
+
+// clockAdjusted 用于判断日期的当前时间：开启补偿且本机时钟偏差过大时按上游时间计算，否则原样返回。
+// 缓存过期按本机时钟计时和判断，偏差不影响缓存时长，不需要补偿
+func clockAdjusted(now time.Time) time.Time {
+	return now.Add(time.Duration(clockCompensation.Load()))
+}
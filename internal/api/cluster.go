@@ -0,0 +1,324 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/roowe/tushareproxy/internal/cache"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// ClusterEntriesPath 接收其他实例推送的缓存条目的路径
+const ClusterEntriesPath = "/cluster/entries"
+
+// 攒一批条目最多等待的时间
+const clusterFlushInterval = time.Second
+
+// clusterEntry 推送给其他实例的一个缓存条目，请求体中不含 token。
+// 请求体为 zstd 压缩的 JSON Lines，与 cache export 的条目格式相同
+type clusterEntry struct {
+	Key   string            `json:"key"`
+	Entry *cache.CacheEntry `json:"entry"`
+}
+
+// entryRestorer 能按原样写入条目的缓存，内置的 CacheManager 实现了该接口
+type entryRestorer interface {
+	Restore(key string, entry *cache.CacheEntry) (bool, error)
+}
+
+// clusterPeer 推送目标的状态，失败和恢复时各记录一次日志
+type clusterPeer struct {
+	url    string
+	failed atomic.Bool
+}
+
+// clusterReplicator 把本实例新写入的缓存条目推送给 cluster.peers，
+// 其他实例收到后直接写入自己的缓存，整个集群只需回源一次
+var clusterReplicator struct {
+	mu     sync.RWMutex
+	queue  chan clusterEntry
+	closed bool
+	done   chan struct{}
+	peers  []*clusterPeer
+	client *http.Client
+
+	sent     atomic.Int64
+	dropped  atomic.Int64
+	failed   atomic.Int64
+	received atomic.Int64
+	stored   atomic.Int64
+}
+
+func init() {
+	expvar.Publish("tushareproxy_cluster", expvar.Func(func() interface{} {
+		if proxyConfig == nil || proxyConfig.Cluster.Token == "" {
+			return nil
+		}
+		return map[string]int64{
+			"sent":     clusterReplicator.sent.Load(),
+			"dropped":  clusterReplicator.dropped.Load(),
+			"failed":   clusterReplicator.failed.Load(),
+			"received": clusterReplicator.received.Load(),
+			"stored":   clusterReplicator.stored.Load(),
+		}
+	}))
+}
+
+// StartClusterReplication 配置了 cluster.peers 时启动推送
+func StartClusterReplication() {
+	cfg := proxyConfig.Cluster
+	if len(cfg.Peers) == 0 {
+		return
+	}
+
+	clusterReplicator.mu.Lock()
+	clusterReplicator.queue = make(chan clusterEntry, cfg.QueueSize)
+	clusterReplicator.done = make(chan struct{})
+	clusterReplicator.client = &http.Client{Timeout: time.Duration(cfg.TimeoutSeconds) * time.Second}
+	for _, peer := range cfg.Peers {
+		clusterReplicator.peers = append(clusterReplicator.peers, &clusterPeer{
+			url: strings.TrimRight(peer, "/") + ClusterEntriesPath,
+		})
+	}
+	clusterReplicator.mu.Unlock()
+
+	go runClusterReplicator(cfg.BatchSize)
+	logger.Info("缓存集群推送已启用", zap.Strings("peers", cfg.Peers))
+}
+
+// StopClusterReplication 停止接收新条目，推送完队列中剩余的条目
+func StopClusterReplication(ctx context.Context) error {
+	clusterReplicator.mu.Lock()
+	if clusterReplicator.queue == nil || clusterReplicator.closed {
+		clusterReplicator.mu.Unlock()
+		return nil
+	}
+	clusterReplicator.closed = true
+	close(clusterReplicator.queue)
+	clusterReplicator.mu.Unlock()
+
+	select {
+	case <-clusterReplicator.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// replicateEntry 把刚写入本地缓存的条目放入推送队列，队列满时丢弃，对方之后会自己回源
+func replicateEntry(write cacheWrite) {
+	clusterReplicator.mu.RLock()
+	defer clusterReplicator.mu.RUnlock()
+	if clusterReplicator.queue == nil || clusterReplicator.closed {
+		return
+	}
+
+	requestBody := []byte(stripToken(write.requestBody))
+	if requestBody == nil {
+		requestBody = write.requestBody
+	}
+	entry := clusterEntry{
+		Key: write.key,
+		Entry: &cache.CacheEntry{
+			Version:      cache.EntryVersion,
+			RequestBody:  requestBody,
+			ResponseBody: write.response,
+			StatusCode:   write.statusCode,
+			Header:       write.header,
+			Timestamp:    time.Now().Unix(),
+			ExpiresAt:    write.expiresAt.Unix(),
+			Namespace:    write.namespace,
+			FetchedAtMs:  write.fetchedAt.UnixMilli(),
+			Integrity:    write.integrity,
+		},
+	}
+	select {
+	case clusterReplicator.queue <- entry:
+	default:
+		clusterReplicator.dropped.Add(1)
+		logger.Debug("缓存集群推送队列已满，丢弃条目", zap.String("cache_key", write.key))
+	}
+}
+
+// runClusterReplicator 攒够 batchSize 个条目或等待超过 clusterFlushInterval 时推送一批
+func runClusterReplicator(batchSize int) {
+	defer close(clusterReplicator.done)
+
+	ticker := time.NewTicker(clusterFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]clusterEntry, 0, batchSize)
+	for {
+		select {
+		case entry, ok := <-clusterReplicator.queue:
+			if !ok {
+				pushClusterBatch(batch)
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) < batchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+		pushClusterBatch(batch)
+		batch = batch[:0]
+	}
+}
+
+// pushClusterBatch 把一批条目并发推送给所有实例，失败不重试
+func pushClusterBatch(batch []clusterEntry) {
+	if len(batch) == 0 {
+		return
+	}
+	body, err := encodeClusterEntries(batch)
+	if err != nil {
+		logger.Error("序列化缓存集群推送失败", zap.Error(err))
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, peer := range clusterReplicator.peers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := postClusterEntries(peer.url, body)
+			if err != nil {
+				clusterReplicator.failed.Add(int64(len(batch)))
+				if !peer.failed.Swap(true) {
+					logger.Warn("推送缓存条目到其他实例失败", zap.String("peer", peer.url), zap.Error(err))
+				}
+				return
+			}
+			clusterReplicator.sent.Add(int64(len(batch)))
+			if peer.failed.Swap(false) {
+				logger.Info("推送缓存条目到其他实例已恢复", zap.String("peer", peer.url))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func encodeClusterEntries(batch []clusterEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, err := zstd.NewWriter(&buf)
+	if err != nil {
+		return nil, err
+	}
+	enc := json.NewEncoder(zw)
+	for i := range batch {
+		if err := enc.Encode(&batch[i]); err != nil {
+			zw.Close()
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func postClusterEntries(url string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("Content-Encoding", "zstd")
+	req.Header.Set("Authorization", "Bearer "+proxyConfig.Cluster.Token)
+
+	resp, err := clusterReplicator.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("解析响应失败（HTTP %d）: %w", resp.StatusCode, err)
+	}
+	if result.Code != 0 {
+		return fmt.Errorf("%d %s", result.Code, result.Msg)
+	}
+	return nil
+}
+
+// ClusterEntriesHandler 接收其他实例推送的缓存条目并写入本地缓存。
+// 本地已有上游响应时间更新的条目、手动失效的键和其他缓存键版本的条目不写入
+func ClusterEntriesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	token := proxyConfig.Cluster.Token
+	restorer, ok := cacheManager.(entryRestorer)
+	if token == "" || !ok {
+		sendErrorResponse(w, "未开启缓存集群", CodeNotFound)
+		return
+	}
+	provided, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+		logger.Warn("缓存集群推送鉴权失败", zap.String("remote_addr", r.RemoteAddr))
+		sendErrorResponse(w, "缓存集群鉴权失败", CodeUnauthorized)
+		return
+	}
+	if r.Method != http.MethodPost {
+		sendErrorResponse(w, "只支持POST方法", CodeMethodNotAllowed)
+		return
+	}
+
+	zr, err := zstd.NewReader(r.Body)
+	if err != nil {
+		sendErrorResponse(w, "解压推送内容失败", CodeBadRequest)
+		return
+	}
+	defer zr.Close()
+
+	received, stored := 0, 0
+	dec := json.NewDecoder(zr)
+	for {
+		var record clusterEntry
+		if err := dec.Decode(&record); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			sendErrorResponse(w, "解析推送内容失败: "+err.Error(), CodeBadRequest)
+			return
+		}
+		received++
+		if record.Entry == nil || cacheKeys.StaleKey(record.Key) {
+			continue
+		}
+		ok, err := restorer.Restore(record.Key, record.Entry)
+		if err != nil {
+			logger.Warn("写入其他实例推送的缓存条目失败", zap.String("cache_key", record.Key), zap.Error(err))
+			continue
+		}
+		if ok {
+			stored++
+		}
+	}
+	clusterReplicator.received.Add(int64(received))
+	clusterReplicator.stored.Add(int64(stored))
+	logger.Debug("收到其他实例推送的缓存条目",
+		zap.String("remote_addr", r.RemoteAddr),
+		zap.Int("received", received),
+		zap.Int("stored", stored))
+
+	sendAdminResponse(w, map[string]int{"received": received, "stored": stored})
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var gzipWriterPool = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	},
+}
+
+// writeResponseBody 写出响应，客户端支持且响应足够大时使用 gzip 压缩
+func writeResponseBody(w http.ResponseWriter, r *http.Request, statusCode int, body io.Reader, size int64) error {
+	if !shouldGzipResponse(r, size) {
+		w.WriteHeader(statusCode)
+		_, err := io.Copy(w, body)
+		return err
+	}
+
+	w.Header().Set("Content-Encoding", "gzip")
+	w.Header().Add("Vary", "Accept-Encoding")
+	w.Header().Del("Content-Length")
+	w.WriteHeader(statusCode)
+
+	gz := gzipWriterPool.Get().(*gzip.Writer)
+	defer gzipWriterPool.Put(gz)
+	gz.Reset(w)
+
+	if _, err := io.Copy(gz, body); err != nil {
+		gz.Close()
+		return err
+	}
+	return gz.Close()
+}
+
+func shouldGzipResponse(r *http.Request, size int64) bool {
+	if proxyConfig == nil || !proxyConfig.Compression.Enabled {
+		return false
+	}
+	if size < int64(proxyConfig.Compression.MinSizeKB)<<10 {
+		return false
+	}
+	return acceptsGzip(r.Header.Get("Accept-Encoding"))
+}
+
+// acceptsGzip 判断 Accept-Encoding 是否接受 gzip，忽略 q=0
+func acceptsGzip(acceptEncoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), "gzip") {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if value, err := strconv.ParseFloat(q, 64); err == nil && value == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"fmt"
+	"time"
+)
+
+const tushareDateLayout = "20060102"
+
+// checkDateRange 拒绝 start_date ~ end_date 跨度超过接口上限的请求，
+// 上限优先使用策略文件，没有 start_date 或接口未配置上限时不检查，end_date 缺省按当天算
+func checkDateRange(preparedRequest *PreparedRequest, now time.Time) *proxyError {
+	maxDays, ok := proxyConfig.DateRange.MaxDays[preparedRequest.APIName]
+	if policy := policyFor(preparedRequest.APIName); policy != nil && policy.MaxDays > 0 {
+		maxDays, ok = policy.MaxDays, true
+	}
+	if !ok || maxDays <= 0 {
+		return nil
+	}
+
+	start, ok := preparedRequest.Params["start_date"].(string)
+	if !ok || start == "" {
+		return nil
+	}
+	startDate, err := time.Parse(tushareDateLayout, start)
+	if err != nil {
+		return &proxyError{Code: CodeBadRequest, Msg: fmt.Sprintf("start_date 格式错误，应为 YYYYMMDD: %s", start)}
+	}
+
+	endDate := clockAdjusted(now)
+	if end, ok := preparedRequest.Params["end_date"].(string); ok && end != "" {
+		if endDate, err = time.Parse(tushareDateLayout, end); err != nil {
+			return &proxyError{Code: CodeBadRequest, Msg: fmt.Sprintf("end_date 格式错误，应为 YYYYMMDD: %s", end)}
+		}
+	}
+
+	if days := int(endDate.Sub(startDate).Hours() / 24); days > maxDays {
+		return &proxyError{
+			Code: CodeBadRequest,
+			Msg:  fmt.Sprintf("接口 %s 单次请求日期跨度不能超过 %d 天，当前 %d 天，请拆分请求", preparedRequest.APIName, maxDays, days),
+		}
+	}
+	return nil
+}
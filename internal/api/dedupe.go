@@ -0,0 +1,111 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/cache"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// dedupeCall 一次上游请求的结果，窗口期内完全相同的请求共用
+type dedupeCall struct {
+	done chan struct{}
+
+	// data 为 nil 且 perr 为 nil 表示结果不能共用（落盘或流式响应）
+	data       []byte
+	statusCode int
+	header     http.Header
+	summary    *tushareResultSummary
+	fetchedAt  time.Time
+	integrity  *cache.Integrity
+	perr       *proxyError
+}
+
+// dedupeGroup 合并窗口期内字节完全相同的未命中请求，只访问一次 tushare
+type dedupeGroup struct {
+	mu     sync.Mutex
+	calls  map[string]*dedupeCall
+	window time.Duration
+}
+
+// 全局请求去重，未开启时为 nil
+var requestDedupe *dedupeGroup
+
+func newDedupeGroup(window time.Duration) *dedupeGroup {
+	return &dedupeGroup{
+		calls:  make(map[string]*dedupeCall),
+		window: window,
+	}
+}
+
+// fetchDeduped 请求 tushare，请求进行中或结束后窗口期内的相同请求直接共用结果
+func fetchDeduped(
+	ctx context.Context,
+	preparedRequest *PreparedRequest,
+	streamer *streamingResponse,
+) (*upstreamBody, int, *tushareResultSummary, *proxyError) {
+	g := requestDedupe
+	if g == nil {
+		return fetchFromTushare(ctx, preparedRequest, streamer)
+	}
+
+	key := string(preparedRequest.ForwardBody)
+	g.mu.Lock()
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, 0, nil, &proxyError{Code: CodeClientClosed, Msg: "等待相同请求结果时客户端已断开"}
+		}
+
+		if call.perr != nil || call.data != nil {
+			logger.Info("共用相同请求的上游结果", zap.String("api_name", preparedRequest.APIName), requestIDField(preparedRequest))
+			if call.perr != nil {
+				return nil, 0, nil, call.perr
+			}
+			body := newBufferedBody(call.data)
+			body.fetchedAt = call.fetchedAt
+			body.header = call.header
+			body.integrity = call.integrity
+			return body, call.statusCode, call.summary, nil
+		}
+		return fetchFromTushare(ctx, preparedRequest, streamer)
+	}
+
+	call := &dedupeCall{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	upstream, statusCode, summary, perr := fetchFromTushare(ctx, preparedRequest, streamer)
+	call.statusCode = statusCode
+	call.summary = summary
+	// 发起方客户端断开不代表其他请求也失败，让它们各自重新请求
+	if perr != nil && perr.Code != CodeClientClosed {
+		call.perr = perr
+	}
+	if upstream != nil && !upstream.Spooled() {
+		// 内存响应体只读，可以直接共用底层数据
+		call.data, _ = upstream.Bytes()
+		call.fetchedAt = upstream.FetchedAt()
+		call.header = upstream.header
+		call.integrity = upstream.integrity
+	}
+	close(call.done)
+
+	time.AfterFunc(g.window, func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if g.calls[key] == call {
+			delete(g.calls, key)
+		}
+	})
+
+	return upstream, statusCode, summary, perr
+}
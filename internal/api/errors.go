@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// 代理自身的错误码。所有代理错误都以 HTTP 200 + {"code": ..., "msg": ...} 返回，
+// 取值沿用 HTTP 状态码的语义，与 tushare 自己的错误码（如 40101、40203）不冲突，
+// 客户端可以按 code 区分代理错误和 tushare 错误
+const (
+	CodeBadRequest       = 400 // 请求体、_cache 或参数不合法
+	CodeUnauthorized     = 401 // 管理接口鉴权失败
+	CodeForbidden        = 403 // 不在允许的访问时间窗口内
+	CodeNotFound         = 404 // 未知路径，或离线/回放模式下没有数据
+	CodeMethodNotAllowed = 405 // HTTP 方法不支持
+	CodeResponseTooLarge = 413 // tushare 响应超过 max_response_mb
+	CodeClientClosed     = 499 // 等待期间客户端已断开
+	CodeInternal         = 500 // 代理内部错误
+	CodeUpstreamError    = 502 // 无法连接 tushare，或 tushare 返回非 200
+	CodeBusy             = 503 // 接口并发已满，等待超时
+	CodeUpstreamTimeout  = 504 // 请求 tushare 超时
+
+	// 限流沿用 tushare 的错误码，本地限流和 tushare 限流客户端可以统一处理
+	CodeRateLimited = tushareCodeRateLimited
+)
+
+// SendError 以 tushare 格式返回代理错误，HTTP 状态码固定为 200
+func SendError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	sendErrorResponse(w, message, code)
+}
+
+// NotFoundHandler 未知路径统一返回 CodeNotFound
+func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	SendError(w, CodeNotFound, "未知接口: "+r.URL.Path)
+}
+
+// upstreamErrorCode 区分 tushare 请求超时和其他连接错误
+func upstreamErrorCode(err error) int {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return CodeUpstreamTimeout
+	}
+	return CodeUpstreamError
+}
+
+// sendErrorResponse 发送错误响应，带上请求 ID，用户只贴错误 JSON 时也能在日志里找到请求
+func sendErrorResponse(w http.ResponseWriter, message string, code int) {
+	w.WriteHeader(http.StatusOK) // 状态码固定为200
+
+	errorResp := TushareAPIResult{
+		Code:      code,
+		Msg:       message,
+		RequestID: requestIDOf(w),
+	}
+
+	response, _ := json.Marshal(errorResp)
+	w.Write(response)
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// 录制/回放产生的缓存状态
+const cacheStatusReplay = "REPLAY"
+
+// replayFixture 用录制数据应答，没有录制时返回错误
+func replayFixture(preparedRequest *PreparedRequest) (*proxyResult, *proxyError) {
+	recorded, found, err := fixtureStore.Load(preparedRequest.APIName, preparedRequest.ForwardBody)
+	if err != nil {
+		logger.Error("读取录制数据失败", zap.Error(err), zap.String("api_name", preparedRequest.APIName), requestIDField(preparedRequest))
+		return nil, &proxyError{Code: CodeInternal, Msg: "读取录制数据失败"}
+	}
+	if !found {
+		logger.Warn("回放模式，没有录制数据", zap.String("api_name", preparedRequest.APIName), requestIDField(preparedRequest))
+		return nil, &proxyError{Code: CodeNotFound, Msg: "回放模式：没有该请求的录制数据"}
+	}
+
+	logger.Info("使用录制响应", zap.String("api_name", preparedRequest.APIName), requestIDField(preparedRequest))
+	return &proxyResult{
+		StatusCode:  recorded.StatusCode,
+		Body:        newBufferedBody(recorded.Response),
+		CacheStatus: cacheStatusReplay,
+	}, nil
+}
+
+// recordFixture 录制一次请求与响应，失败不影响响应
+func recordFixture(preparedRequest *PreparedRequest, result *proxyResult) {
+	if result.StatusCode != http.StatusOK {
+		return
+	}
+
+	response, err := result.Body.Bytes()
+	if err == nil {
+		err = fixtureStore.Save(preparedRequest.APIName, preparedRequest.ForwardBody, result.StatusCode, response)
+	}
+	if err != nil {
+		logger.Warn("录制请求失败", zap.Error(err), zap.String("api_name", preparedRequest.APIName), requestIDField(preparedRequest))
+		return
+	}
+
+	logger.Debug("请求已录制", zap.String("api_name", preparedRequest.APIName), requestIDField(preparedRequest))
+}
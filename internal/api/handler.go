@@ -2,13 +2,23 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"sync/atomic"
 	"time"
 
+	"github.com/roowe/tushareproxy/internal/alert"
 	"github.com/roowe/tushareproxy/internal/cache"
+	"github.com/roowe/tushareproxy/internal/config"
+	"github.com/roowe/tushareproxy/internal/fixture"
+	"github.com/roowe/tushareproxy/internal/history"
+	"github.com/roowe/tushareproxy/internal/paramstats"
+	"github.com/roowe/tushareproxy/internal/slo"
+	"github.com/roowe/tushareproxy/internal/tokencheck"
 	"github.com/roowe/tushareproxy/pkg/logger"
 
 	"go.uber.org/zap"
@@ -19,31 +29,174 @@ type TushareAPIResult struct {
 	Code int             `json:"code"`
 	Msg  string          `json:"msg"`
 	Data *TushareAPIData `json:"data,omitempty"`
+	// RequestID 代理自身错误响应中的请求 ID，tushare 响应体自带的 request_id 是 tushare 的请求 ID
+	RequestID string `json:"proxy_request_id,omitempty"`
 }
 
 type TushareAPIData struct {
 	Items []json.RawMessage `json:"items"`
 }
 
-const (
-	TushareAPIURL = "http://api.waditu.com/dataapi"
-)
+// errResponseTooLarge 上游响应超过 max_response_mb
+var errResponseTooLarge = errors.New("tushare 响应超过大小上限")
 
 const (
 	cacheStatusHit      = "HIT"
 	cacheStatusMiss     = "MISS"
 	cacheStatusBypass   = "BYPASS"
 	cacheStatusDisabled = "DISABLED"
+	cacheStatusRefresh  = "REFRESH"
+	// 命中缓存的错误响应或空结果
+	cacheStatusNegative = "NEGATIVE"
+	// 缓存存储连续出错，暂时不读写缓存
+	cacheStatusDegraded = "DEGRADED"
 )
 
-// 全局缓存管理器
-var cacheManager *cache.CacheManager
+// 全局缓存
+var cacheManager cache.Cache
+
+// 缓存键和默认 TTL 的生成规则，由 SetConfig 按配置创建
+var cacheKeys *cache.KeyPolicy
+
+// 全局代理配置
+var proxyConfig *config.Config
+
+// 全局命中率 SLO 跟踪器
+var sloTracker *slo.Tracker
+
+// 全局上游错误率跟踪器，未开启时为 nil
+var upstreamErrors *alert.UpstreamErrorTracker
+
+// 全局 token 巡检器，未配置时为 nil
+var tokenMonitor *tokencheck.Monitor
+
+// 全局请求参数统计
+var paramCollector *paramstats.Collector
+
+// 全局请求历史记录器，未开启时为 nil
+var historyRecorder *history.Recorder
+
+// 全局录制/回放存储
+var fixtureStore *fixture.Store
+
+// 离线模式开关，可通过管理接口运行时切换
+var offlineMode atomic.Bool
 
-// SetCacheManager 设置缓存管理器
-func SetCacheManager(cm *cache.CacheManager) {
+// SetCacheManager 设置缓存，可以是内置的 CacheManager，也可以是实现了 cache.Cache 的其他存储
+func SetCacheManager(cm cache.Cache) {
 	cacheManager = cm
 }
 
+// SetSLOTracker 设置命中率 SLO 跟踪器
+func SetSLOTracker(t *slo.Tracker) {
+	sloTracker = t
+}
+
+// SetUpstreamErrorTracker 设置上游错误率跟踪器
+func SetUpstreamErrorTracker(t *alert.UpstreamErrorTracker) {
+	upstreamErrors = t
+}
+
+// SetTokenMonitor 设置 token 巡检器
+func SetTokenMonitor(m *tokencheck.Monitor) {
+	tokenMonitor = m
+}
+
+// SetParamCollector 设置请求参数统计收集器
+func SetParamCollector(c *paramstats.Collector) {
+	paramCollector = c
+}
+
+// SetHistoryRecorder 设置请求历史记录器
+func SetHistoryRecorder(r *history.Recorder) {
+	historyRecorder = r
+}
+
+// SetFixtureStore 设置录制/回放存储
+func SetFixtureStore(store *fixture.Store) {
+	fixtureStore = store
+}
+
+// SetConfig 设置代理配置，同时按配置重建上游 HTTP 客户端
+func SetConfig(cfg *config.Config) {
+	proxyConfig = cfg
+	upstreamClient = newUpstreamClient(&cfg.Tushare)
+	upstreamRoutes = newUpstreamRoutes(cfg.Tushare.Routes)
+	upstreamBulkheads = newBulkheads(&cfg.Bulkhead)
+	accessControl = newAccessWindows(&cfg.Access)
+	requestSigner = newRequestSigner(&cfg.Tushare.Signing)
+	bypassRules = newSourceBypass(&cfg.Cache)
+	canarySem = make(chan struct{}, max(cfg.Cache.CanaryConcurrency, 1))
+	cacheKeys = cache.NewKeyPolicy(cfg.Cache.DefaultTTLSeconds, cfg.Cache.DefaultNamespace)
+	cacheKeys.SetTTLOverrides(cfg.Cache.TTLOverrides)
+	cacheKeys.SetRealtimeTTLs(cfg.Cache.RealtimeTTLs)
+	cacheKeys.SetLegacyKeys(cfg.Cache.LegacyCacheKey)
+	cacheKeys.SetKeyVersion(cfg.Cache.KeyVersion)
+	cacheShadow = nil
+	if cfg.Cache.Shadow {
+		cacheShadow = newShadowCache()
+	}
+	resetCacheability()
+	requestDedupe = nil
+	if cfg.Tushare.DedupeWindowSeconds > 0 {
+		requestDedupe = newDedupeGroup(time.Duration(cfg.Tushare.DedupeWindowSeconds * float64(time.Second)))
+	}
+	tier := config.RateLimitTiers[cfg.Tushare.PointsTier]
+	localLimiter = nil
+	// 开启了策略文件限流时，策略文件可以随时加上限流，总是创建限流器
+	policyRateLimit = cfg.Policy.RateLimit
+	if cfg.Tushare.LocalRateLimit || tier.PerMinute > 0 || len(cfg.Tushare.MinuteLimits) > 0 || policyRateLimit {
+		localLimiter = newMinuteLimiter(tier.PerMinute, cfg.Tushare.MinuteLimits)
+	}
+	dailyLimiter = nil
+	if tier.PerDay > 0 || len(cfg.Tushare.DailyLimits) > 0 || policyRateLimit {
+		dailyLimiter = newDayLimiter(tier.PerDay, cfg.Tushare.DailyLimits)
+	}
+	offlineMode.Store(cfg.Tushare.Offline)
+}
+
+// SetOfflineMode 切换离线模式
+func SetOfflineMode(offline bool) {
+	if offlineMode.Swap(offline) != offline {
+		logger.Info("离线模式已切换", zap.Bool("offline", offline))
+	}
+}
+
+// IsOfflineMode 是否处于离线模式
+func IsOfflineMode() bool {
+	return offlineMode.Load()
+}
+
+// proxyResult 单个请求的处理结果
+type proxyResult struct {
+	StatusCode  int
+	Body        *upstreamBody
+	FromCache   bool
+	CacheStatus string
+	Namespace   string
+	CacheKey    string
+	// 命中缓存时为写入缓存的时间
+	CachedAt time.Time
+	// 命中或刚写入缓存时为缓存的过期时间，客户端可以据此在本地缓存
+	ExpiresAt time.Time
+	// tushare 每分钟限流时，建议客户端等待的时长
+	RetryAfter time.Duration
+	// 需要透传给客户端的 tushare 响应头
+	Header http.Header
+}
+
+// proxyError 代理自身产生的错误，以 tushare 格式返回给客户端
+type proxyError struct {
+	Code int
+	Msg  string
+	// 限流、并发已满等稍后重试可以成功的错误，建议客户端等待的时长
+	RetryAfter time.Duration
+}
+
+func (e *proxyError) Error() string {
+	return e.Msg
+}
+
 // DataAPIHandler 处理/dataapi请求
 func DataAPIHandler(w http.ResponseWriter, r *http.Request) {
 	startTime := time.Now()
@@ -54,7 +207,8 @@ func DataAPIHandler(w http.ResponseWriter, r *http.Request) {
 	// 只允许POST方法
 	if r.Method != http.MethodPost {
 		logger.Warn("不支持的HTTP方法", zap.String("method", r.Method))
-		sendErrorResponse(w, "只支持POST方法", http.StatusMethodNotAllowed)
+		recordAccessError(r.Context(), CodeMethodNotAllowed)
+		sendErrorResponse(w, "只支持POST方法", CodeMethodNotAllowed)
 		return
 	}
 
@@ -62,7 +216,8 @@ func DataAPIHandler(w http.ResponseWriter, r *http.Request) {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		logger.Error("读取请求体失败", zap.Error(err))
-		sendErrorResponse(w, "读取请求体失败", http.StatusBadRequest)
+		recordAccessError(r.Context(), CodeBadRequest)
+		sendErrorResponse(w, "读取请求体失败", CodeBadRequest)
 		return
 	}
 	defer r.Body.Close()
@@ -70,188 +225,611 @@ func DataAPIHandler(w http.ResponseWriter, r *http.Request) {
 	preparedRequest, err := parseIncomingRequest(body)
 	if err != nil {
 		logger.Warn("解析请求体失败", zap.Error(err))
-		sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		recordAccessError(r.Context(), CodeBadRequest)
+		sendErrorResponse(w, err.Error(), CodeBadRequest)
 		return
 	}
+	applySourceBypass(preparedRequest, r)
+	preparedRequest.Header = passthroughHeaders(r.Header)
+	preparedRequest.Refresh = wantsRefresh(r)
+	preparedRequest.RequestID = requestIDOf(w)
+
+	if perr := checkAccessWindow(preparedRequest, r, startTime); perr != nil {
+		recordAccessResult(r.Context(), preparedRequest, nil, perr)
+		logger.Warn("请求不在允许的访问时间窗口内",
+			zap.String("api_name", preparedRequest.APIName),
+			zap.String("remote_addr", r.RemoteAddr),
+			zap.String("msg", perr.Msg),
+			requestIDField(preparedRequest))
+		sendErrorResponse(w, perr.Msg, perr.Code)
+		return
+	}
+
+	// 客户端要求异步时，在限流窗口排队的请求先返回 202 和轮询地址
+	if wantsAsync(r) {
+		handleAsync(w, r, preparedRequest, startTime)
+		return
+	}
+
+	// 大响应边读边返回
+	var streamer *streamingResponse
+	if proxyConfig.Spool.Stream {
+		streamer = newStreamingResponse(w, r)
+	}
+
+	result, perr := executeRequest(r.Context(), preparedRequest, streamer, startTime)
+	recordAccessResult(r.Context(), preparedRequest, result, perr)
+	if perr != nil {
+		if streamer != nil && streamer.Started() {
+			// 已经开始返回数据，无法再发送错误响应。直接断开连接，客户端会读到不完整的响应而不是截断的 JSON
+			logger.Error("流式响应中途出错，断开连接",
+				zap.String("api_name", preparedRequest.APIName),
+				zap.Int("code", perr.Code),
+				zap.String("msg", perr.Msg),
+				requestIDField(preparedRequest))
+			panic(http.ErrAbortHandler)
+		}
+		logger.Info("请求返回错误",
+			zap.Duration("duration", time.Since(startTime)),
+			zap.String("api_name", preparedRequest.APIName),
+			zap.Int("code", perr.Code),
+			zap.String("msg", perr.Msg),
+			requestIDField(preparedRequest))
+		setRetryAfter(w.Header(), perr.RetryAfter)
+		sendErrorResponse(w, perr.Msg, perr.Code)
+		return
+	}
+	writeProxyResult(w, r, preparedRequest, result, startTime)
+}
+
+// writeProxyResult 返回处理结果并关闭响应体，流式响应的数据已经在处理过程中写出
+func writeProxyResult(
+	w http.ResponseWriter,
+	r *http.Request,
+	preparedRequest *PreparedRequest,
+	result *proxyResult,
+	startTime time.Time,
+) {
+	defer result.Body.Close()
+
+	// 流式响应的完整性校验头通过 trailer 发送
+	setIntegrityHeaders(w.Header(), result.Body)
+	setCacheHeaders(w.Header(), result, time.Now())
+	setRetryAfter(w.Header(), result.RetryAfter)
+	if !result.Body.Streamed() {
+		copyResponseHeaders(w.Header(), result.Header)
+	}
+
+	// 使用tushare返回的状态码
+	if !result.Body.Streamed() {
+		if err := writeResponseBody(w, r, result.StatusCode, result.Body.Reader(), result.Body.Size()); err != nil {
+			logger.Error("写入响应失败", zap.Error(err))
+		}
+	}
+
+	logger.Info("请求处理完成",
+		zap.Duration("duration", time.Since(startTime)),
+		zap.Bool("from_cache", result.FromCache),
+		zap.String("cache_status", result.CacheStatus),
+		zap.String("namespace", result.Namespace),
+		zap.String("cache_key", result.CacheKey),
+		zap.String("api_name", preparedRequest.APIName),
+		requestIDField(preparedRequest))
+}
+
+// executeRequest 处理单个请求：查缓存，未命中时转发 tushare 并按需写缓存。
+// streamer 非空时大响应会直接流式写给客户端，调用方需检查 Body.Streamed()
+func executeRequest(
+	ctx context.Context,
+	preparedRequest *PreparedRequest,
+	streamer *streamingResponse,
+	now time.Time,
+) (*proxyResult, *proxyError) {
+	paramCollector.Record(preparedRequest.APIName, preparedRequest.Params)
+	historyRecorder.Record(preparedRequest.APIName, preparedRequest.Params, preparedRequest.Fields)
+
+	result, perr := dispatchRequest(ctx, preparedRequest, streamer, now)
+	recordRequest(perr)
+	return result, perr
+}
+
+// dispatchRequest 按交易日历改写、按年拆分后执行请求，不计入参数统计和请求历史，
+// 供预热等代理自己发起的请求使用
+func dispatchRequest(
+	ctx context.Context,
+	preparedRequest *PreparedRequest,
+	streamer *streamingResponse,
+	now time.Time,
+) (*proxyResult, *proxyError) {
+	// 非交易日的按日请求直接应答或改到前一交易日，不消耗 tushare 额度
+	result, preparedRequest := applyTradeCalendar(preparedRequest)
+	if result != nil {
+		return result, nil
+	}
+
+	// 跨年的长区间请求按自然年拆分后合并
+	if chunks := splitByYear(preparedRequest, now); len(chunks) > 1 {
+		return executeSplit(ctx, preparedRequest, chunks, proxyConfig.Split.Concurrency, now)
+	}
+
+	return executeSingle(ctx, preparedRequest, streamer, now)
+}
+
+// executeSingle 处理不需要拆分的请求：日期跨度检查、回放/录制、区间拼接、查缓存或转发
+func executeSingle(
+	ctx context.Context,
+	preparedRequest *PreparedRequest,
+	streamer *streamingResponse,
+	now time.Time,
+) (*proxyResult, *proxyError) {
+	if perr := checkDateRange(preparedRequest, now); perr != nil {
+		logger.Warn("请求日期跨度超过上限",
+			zap.String("api_name", preparedRequest.APIName),
+			zap.String("msg", perr.Msg),
+			requestIDField(preparedRequest))
+		return nil, perr
+	}
+
+	// 回放模式只用录制数据应答
+	if fixtureStore.Replaying() {
+		return replayFixture(preparedRequest)
+	}
+
+	// 已缓存的子区间能覆盖部分请求区间时，拼接缓存并只请求缺少的部分
+	if chunks := planStitch(preparedRequest, now); len(chunks) > 1 {
+		return executeSplit(ctx, preparedRequest, chunks, proxyConfig.Stitch.Concurrency, now)
+	}
+
+	result, perr := lookupOrFetch(ctx, preparedRequest, streamer, now)
+	if perr == nil && fixtureStore.Recording() {
+		recordFixture(preparedRequest, result)
+	}
+	return result, perr
+}
+
+// lookupOrFetch 查缓存，未命中时转发 tushare 并按需写缓存
+func lookupOrFetch(
+	ctx context.Context,
+	preparedRequest *PreparedRequest,
+	streamer *streamingResponse,
+	now time.Time,
+) (*proxyResult, *proxyError) {
+	result := &proxyResult{CacheStatus: cacheStatusDisabled}
+
+	// 实时行情等不可缓存的请求不生成缓存键，直接转发
+	useCache := cacheManager != nil
+	if useCache && cacheHealth() != nil {
+		useCache = false
+		result.CacheStatus = cacheStatusDegraded
+	}
+	if useCache {
+		if reason := uncacheableReason(preparedRequest, now); reason != "" {
+			useCache = false
+			result.CacheStatus = cacheStatusUncacheable
+			logger.Debug("请求不可缓存，跳过缓存",
+				zap.String("api_name", preparedRequest.APIName),
+				zap.String("reason", reason),
+				requestIDField(preparedRequest))
+		}
+	}
 
 	// 生成缓存键
-	var cacheKey string
-	var namespace string
-	var response []byte
-	var statusCode int
-	var isFromCache bool
-	var cacheStatus = cacheStatusDisabled
-
-	if cacheManager != nil {
-		if err := preparedRequest.Policy.Validate(cacheManager.DefaultNamespace(), startTime); err != nil {
+	if useCache {
+		if err := preparedRequest.Policy.Validate(cacheKeys.DefaultNamespace(), now); err != nil {
 			logger.Warn("缓存策略校验失败", zap.Error(err))
-			sendErrorResponse(w, err.Error(), http.StatusBadRequest)
-			return
+			return nil, &proxyError{Code: CodeBadRequest, Msg: err.Error()}
 		}
 
-		namespace = preparedRequest.Policy.ResolvedNamespace(cacheManager.DefaultNamespace())
-		cacheKey = cacheManager.GenerateKey(namespace, preparedRequest.ForwardBody)
-		cacheStatus = cacheStatusMiss
+		result.Namespace = preparedRequest.Policy.ResolvedNamespace(cacheKeys.DefaultNamespace())
+		result.CacheKey = cacheKeys.GenerateKey(result.Namespace, preparedRequest.ForwardBody)
+		result.CacheStatus = cacheStatusMiss
 
 		if preparedRequest.Policy.NoCache {
-			cacheStatus = cacheStatusBypass
-		} else if entry, found := cacheManager.Get(cacheKey); found {
-			response = entry.ResponseBody
-			statusCode = entry.StatusCode
-			isFromCache = true
-			cacheStatus = cacheStatusHit
+			result.CacheStatus = cacheStatusBypass
+		} else if preparedRequest.Refresh && !IsOfflineMode() {
+			// 离线模式无法回源，忽略强制刷新
+			result.CacheStatus = cacheStatusRefresh
+		} else if entry, found := cacheManager.Get(result.CacheKey); found {
+			recordLookup(preparedRequest.APIName, true)
+			result.Body = newBufferedBody(entry.ResponseBody)
+			result.Body.integrity = entryIntegrity(entry)
+			result.StatusCode = entry.StatusCode
+			result.Header = entry.Header
+			result.FromCache = true
+			result.CacheStatus = cacheStatusHit
+			result.CachedAt = time.Unix(entry.Timestamp, 0)
+			result.ExpiresAt = entryExpiresAt(entry)
+			maybeExtendTTL(result.CacheKey, entry, preparedRequest, now)
+			recordHotKey(result.CacheKey, preparedRequest, result.ExpiresAt)
+			maybeCanaryCheck(result.CacheKey, entry, preparedRequest)
 			logger.Info("使用缓存响应",
 				zap.String("api_name", preparedRequest.APIName),
-				zap.String("cache_key", cacheKey),
-				zap.String("namespace", namespace),
-				zap.Int("status_code", statusCode))
+				zap.String("cache_key", result.CacheKey),
+				zap.String("namespace", result.Namespace),
+				zap.Int("status_code", result.StatusCode),
+				requestIDField(preparedRequest))
+			return result, nil
+		} else if entry, found := lookupNegative(result.CacheKey, preparedRequest); found {
+			recordLookup(preparedRequest.APIName, true)
+			result.Body = newBufferedBody(entry.ResponseBody)
+			result.Body.integrity = entryIntegrity(entry)
+			result.StatusCode = entry.StatusCode
+			result.Header = entry.Header
+			result.FromCache = true
+			result.CacheStatus = cacheStatusNegative
+			result.CachedAt = time.Unix(entry.Timestamp, 0)
+			result.ExpiresAt = entryExpiresAt(entry)
+			logger.Info("使用缓存的错误响应",
+				zap.String("api_name", preparedRequest.APIName),
+				zap.String("cache_key", result.CacheKey),
+				zap.String("namespace", result.Namespace),
+				requestIDField(preparedRequest))
+			return result, nil
+		}
+
+		if result.CacheStatus == cacheStatusMiss {
+			if projected := lookupProjection(preparedRequest, result.Namespace); projected != nil {
+				recordLookup(preparedRequest.APIName, true)
+				return projected, nil
+			}
+			recordLookup(preparedRequest.APIName, false)
+		}
+	}
+
+	// 影子模式只记录开启缓存时会不会命中，响应和 X-Cache 与缓存关闭时相同
+	var shadowKey string
+	if cacheManager == nil && cacheShadow != nil {
+		shadowKey = shadowLookup(preparedRequest, now)
+	}
+
+	// 离线模式不访问 tushare
+	if IsOfflineMode() {
+		logger.Info("离线模式，缓存未命中",
+			zap.String("api_name", preparedRequest.APIName),
+			zap.String("namespace", result.Namespace),
+			zap.String("cache_status", result.CacheStatus),
+			requestIDField(preparedRequest))
+		return nil, &proxyError{Code: CodeNotFound, Msg: "离线模式：缓存中没有该请求的数据"}
+	}
+	if perr := checkLoadShedding(preparedRequest); perr != nil {
+		return nil, perr
+	}
+
+	// 缓存未命中，转发请求
+	logger.Info("转发tushare API请求",
+		zap.String("api_name", preparedRequest.APIName),
+		zap.String("namespace", result.Namespace),
+		zap.String("cache_status", result.CacheStatus),
+		zap.Bool("no_cache", preparedRequest.Policy.NoCache),
+		zap.Bool("refresh", preparedRequest.Refresh),
+		requestIDField(preparedRequest))
+
+	// 流式响应开始写数据时就会发出响应头，提前设置缓存状态
+	if streamer != nil {
+		setCacheHeaders(streamer.w.Header(), result, now)
+	}
+
+	upstream, statusCode, summary, perr := fetchDeduped(ctx, preparedRequest, streamer)
+	if perr != nil {
+		return nil, perr
+	}
+	result.Body = upstream
+	result.StatusCode = statusCode
+	result.Header = upstream.header
+
+	// 先结束流式响应，客户端无需等待缓存写入
+	if upstream.Streamed() {
+		if err := streamer.Close(); err != nil {
+			logger.Error("结束流式响应失败", zap.Error(err))
+		}
+	}
+
+	// 检查响应是否成功
+	var shouldCache bool
+	if summary != nil {
+		if summary.Code == 0 {
+			if summary.ItemCount > 0 {
+				shouldCache = true
+				logger.Debug("tushare API响应成功，可以缓存",
+					zap.Int("code", summary.Code),
+					zap.Int("item_count", summary.ItemCount))
+			} else {
+				logger.Info("tushare API响应成功但无数据，不缓存",
+					zap.Int("code", summary.Code),
+					zap.Int("item_count", summary.ItemCount))
+			}
+		} else {
+			logger.Warn("tushare API返回错误码，不缓存",
+				zap.Int("code", summary.Code),
+				zap.String("msg", summary.Msg))
+			if isMinuteRateLimited(summary) {
+				result.RetryAfter = untilNextMinute(time.Now())
+			}
 		}
 	}
 
-	// 如果缓存未命中，转发请求
-	if !isFromCache {
-		logger.Info("转发tushare API请求",
+	// 落盘的大响应超过缓存上限时不缓存，避免整体读入内存
+	if shouldCache && upstream.Spooled() && upstream.Size() > int64(proxyConfig.Spool.MaxCacheMB)<<20 {
+		shouldCache = false
+		logger.Warn("响应超过落盘缓存上限，不缓存",
 			zap.String("api_name", preparedRequest.APIName),
-			zap.String("namespace", namespace),
-			zap.String("cache_status", cacheStatus),
-			zap.Bool("no_cache", preparedRequest.Policy.NoCache))
+			zap.Int64("size", upstream.Size()),
+			zap.Int("max_cache_mb", proxyConfig.Spool.MaxCacheMB),
+			requestIDField(preparedRequest))
+	}
+
+	if shadowKey != "" && shouldCache {
+		shadowStore(shadowKey, preparedRequest, upstream, now)
+	}
 
-		// 直接转发请求到tushare API
-		var err error
-		response, statusCode, err = forwardRawRequestToTushareAPI(preparedRequest.ForwardBody)
+	// 只有在响应成功且code=0时才缓存
+	if useCache && shouldCache && !preparedRequest.Policy.NoCache {
+		cacheExpiresAt, err := resolveCacheExpiration(
+			preparedRequest.Policy,
+			cacheTTLFor(preparedRequest, now),
+			time.Now(),
+		)
 		if err != nil {
-			logger.Error("转发请求到tushare API失败", zap.Error(err))
-			sendErrorResponse(w, "请求tushare API失败", http.StatusInternalServerError)
-			return
+			logger.Error("解析缓存过期时间失败", zap.Error(err))
+		} else if response, err := upstream.Bytes(); err != nil {
+			logger.Error("读取响应体失败", zap.Error(err))
+		} else {
+			// 异步写入时响应先返回，过期时间只说明数据的有效期，与是否写入成功无关
+			result.ExpiresAt = cacheExpiresAt
+			storeCacheEntry(cacheWrite{
+				apiName:     preparedRequest.APIName,
+				key:         result.CacheKey,
+				namespace:   result.Namespace,
+				requestBody: preparedRequest.ForwardBody,
+				response:    response,
+				statusCode:  statusCode,
+				header:      upstream.header.Clone(),
+				expiresAt:   cacheExpiresAt,
+				fetchedAt:   upstream.FetchedAt(),
+				integrity:   upstream.storedIntegrity(),
+				onStored: func() {
+					registerRangeSegment(preparedRequest, summary, cacheExpiresAt, now)
+				},
+			})
 		}
+	} else if useCache && !preparedRequest.Policy.NoCache && negativeCacheable(statusCode, summary) {
+		storeNegative(result, preparedRequest, upstream)
+	}
 
-		//logger.Info("tushare API响应", zap.Int("status_code", statusCode), zap.String("response", string(response)))
-
-		// 解析响应，检查是否成功
-		var shouldCache bool
-		if statusCode == http.StatusOK && len(response) > 0 {
-			var result TushareAPIResult
-			if err := json.Unmarshal(response, &result); err == nil {
-				if result.Code == 0 {
-					itemCount := result.itemCount()
-					if itemCount > 0 {
-						shouldCache = true
-						logger.Debug("tushare API响应成功，可以缓存",
-							zap.Int("code", result.Code),
-							zap.Int("item_count", itemCount))
-					} else {
-						logger.Info("tushare API响应成功但无数据，不缓存",
-							zap.Int("code", result.Code),
-							zap.Int("item_count", itemCount))
-					}
-				} else {
-					logger.Warn("tushare API返回错误码，不缓存",
-						zap.Int("code", result.Code),
-						zap.String("msg", result.Msg))
+	return result, nil
+}
+
+// fetchFromTushare 请求 tushare 并解析响应摘要，非 200 或解析失败时摘要为 nil。
+// 开启限流重试时，遇到每分钟限流会等到下一分钟窗口再透明重试；
+// 开启本地限流时，超过每分钟上限的请求在本地等待或直接拒绝，超过每天上限的直接拒绝，不再打到 tushare
+func fetchFromTushare(
+	ctx context.Context,
+	preparedRequest *PreparedRequest,
+	streamer *streamingResponse,
+) (*upstreamBody, int, *tushareResultSummary, *proxyError) {
+	for attempt := 0; ; attempt++ {
+		if wait := localLimiter.Reserve(preparedRequest.APIName, time.Now()); wait > 0 {
+			limit, _ := localLimiter.Limit(preparedRequest.APIName)
+			if !canWaitForRateLimit(attempt, wait) {
+				return nil, 0, nil, &proxyError{
+					Code:       CodeRateLimited,
+					Msg:        fmt.Sprintf("本地限流：接口 %s 每分钟最多访问 %d 次", preparedRequest.APIName, limit),
+					RetryAfter: wait,
 				}
-			} else {
-				logger.Error("解析tushare API响应失败", zap.Error(err))
+			}
+
+			logger.Warn("达到本地每分钟限流，等待下一分钟",
+				zap.String("api_name", preparedRequest.APIName),
+				zap.Int("limit", limit),
+				zap.Int("attempt", attempt+1),
+				zap.Duration("wait", wait),
+				requestIDField(preparedRequest))
+			if perr := waitForRateLimit(ctx, preparedRequest.APIName, wait); perr != nil {
+				return nil, 0, nil, perr
+			}
+			continue
+		}
+		if limit, ok := dailyLimiter.Reserve(preparedRequest.APIName, time.Now()); !ok {
+			logger.Warn("达到本地每天访问上限", zap.String("api_name", preparedRequest.APIName), zap.Int("limit", limit), requestIDField(preparedRequest))
+			return nil, 0, nil, &proxyError{
+				Code:       CodeRateLimited,
+				Msg:        fmt.Sprintf("本地限流：接口 %s 每天最多访问 %d 次", preparedRequest.APIName, limit),
+				RetryAfter: dailyLimiter.UntilReset(time.Now()),
 			}
 		}
 
-		// 只有在响应成功且code=0时才缓存
-		if cacheManager != nil && shouldCache && !preparedRequest.Policy.NoCache {
-			cacheExpiresAt, err := resolveCacheExpiration(
-				preparedRequest.Policy,
-				cacheManager.DefaultTTL(),
-				time.Now(),
-			)
+		// 按接口隔离并发，慢接口排队不占用其他接口的名额
+		release, perr := upstreamBulkheads.acquire(ctx, preparedRequest.APIName)
+		if perr != nil {
+			return nil, 0, nil, perr
+		}
+		upstream, statusCode, err := forwardRawRequestToTushareAPI(preparedRequest, streamer)
+		release()
+		if errors.Is(err, errResponseTooLarge) {
+			logger.Error("tushare API响应超过大小上限，已中止读取",
+				zap.String("api_name", preparedRequest.APIName),
+				zap.Int("max_response_mb", proxyConfig.Tushare.MaxResponseMB),
+				requestIDField(preparedRequest))
+			return nil, 0, nil, &proxyError{
+				Code: CodeResponseTooLarge,
+				Msg:  fmt.Sprintf("tushare API响应超过 %d MB 上限，已中止读取，请缩小查询范围", proxyConfig.Tushare.MaxResponseMB),
+			}
+		}
+		if err != nil {
+			logger.Error("转发请求到tushare API失败", zap.Error(err))
+			recordUpstream(preparedRequest.APIName, err.Error())
+			code := upstreamErrorCode(err)
+			if code == CodeUpstreamTimeout {
+				return nil, 0, nil, &proxyError{Code: code, Msg: "请求tushare API超时"}
+			}
+			return nil, 0, nil, &proxyError{Code: code, Msg: "请求tushare API失败"}
+		}
+
+		// 解析响应摘要
+		var summary *tushareResultSummary
+		if statusCode == http.StatusOK && upstream.Size() > 0 {
+			summary, err = inspectTushareResult(upstream.Reader())
 			if err != nil {
-				logger.Error("解析缓存过期时间失败", zap.Error(err))
-			} else if err := cacheManager.Set(
-				cacheKey,
-				namespace,
-				preparedRequest.ForwardBody,
-				response,
-				statusCode,
-				cacheExpiresAt,
-			); err != nil {
-				logger.Error("设置缓存失败", zap.Error(err))
-				// 缓存失败不影响响应
-			} else {
-				logger.Debug("响应已缓存",
-					zap.String("cache_key", cacheKey),
-					zap.String("namespace", namespace),
-					zap.Int64("expires_at", cacheExpiresAt.Unix()))
+				logger.Error("解析tushare API响应失败", zap.Error(err))
+				summary = nil
 			}
 		}
+		upstream.sealIntegrity(summary)
+
+		if !isMinuteRateLimited(summary) {
+			recordUpstream(preparedRequest.APIName, upstreamResultError(statusCode, summary))
+			return upstream, statusCode, summary, nil
+		}
+		if limit, ok := parseMinuteLimit(summary.Msg); ok {
+			localLimiter.Learn(preparedRequest.APIName, limit, time.Now())
+		}
+
+		wait := untilNextMinute(time.Now())
+		if upstream.Streamed() || !canWaitForRateLimit(attempt, wait) {
+			recordUpstream(preparedRequest.APIName, summary.Msg)
+			return upstream, statusCode, summary, nil
+		}
+
+		logger.Warn("tushare 每分钟限流，等待下一分钟重试",
+			zap.String("api_name", preparedRequest.APIName),
+			zap.String("msg", summary.Msg),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("wait", wait),
+			requestIDField(preparedRequest))
+		upstream.Close()
+
+		if perr := waitForRateLimit(ctx, preparedRequest.APIName, wait); perr != nil {
+			return nil, 0, nil, perr
+		}
 	}
+}
 
-	// 使用tushare返回的状态码
-	w.WriteHeader(statusCode)
-	if _, err := w.Write(response); err != nil {
-		logger.Error("写入响应失败", zap.Error(err))
+// upstreamResultError 上游响应的错误描述，成功时返回空字符串
+func upstreamResultError(statusCode int, summary *tushareResultSummary) string {
+	switch {
+	case statusCode != http.StatusOK:
+		return fmt.Sprintf("tushare API返回HTTP %d", statusCode)
+	case summary != nil && summary.Code != 0:
+		return fmt.Sprintf("%d %s", summary.Code, summary.Msg)
 	}
+	return ""
+}
 
-	logger.Info("请求处理完成",
-		zap.Duration("duration", time.Since(startTime)),
-		zap.Bool("from_cache", isFromCache),
-		zap.String("cache_status", cacheStatus),
-		zap.String("namespace", namespace),
-		zap.String("cache_key", cacheKey),
-		zap.String("api_name", preparedRequest.APIName))
+// canWaitForRateLimit 是否还能等待下一分钟重试
+func canWaitForRateLimit(attempt int, wait time.Duration) bool {
+	return attempt < proxyConfig.Tushare.RateLimitRetries &&
+		wait <= time.Duration(proxyConfig.Tushare.RateLimitMaxWaitSeconds)*time.Second
 }
 
-// forwardRawRequestToTushareAPI 直接转发原始请求到tushare API
-func forwardRawRequestToTushareAPI(body []byte) ([]byte, int, error) {
+// waitForRateLimit 等待限流窗口，客户端断开时返回错误。
+// 等待期间登记在排队队列里，异步请求据此返回排队位置
+func waitForRateLimit(ctx context.Context, apiName string, wait time.Duration) *proxyError {
+	until := time.Now().Add(wait)
+	ticket := waitQueue.enter(apiName, until)
+	defer waitQueue.leave(apiName, ticket)
+
+	progress := progressFromContext(ctx)
+	progress.enter(apiName, ticket, until)
+	defer progress.leave(ticket)
+
+	select {
+	case <-ctx.Done():
+		return &proxyError{Code: CodeClientClosed, Msg: "等待限流重试时客户端已断开"}
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+// forwardRawRequestToTushareAPI 直接转发原始请求到接口对应的上游地址，并透传客户端请求头。
+// streamer 非空时，超过内存阈值的响应会同时流式写给客户端
+func forwardRawRequestToTushareAPI(preparedRequest *PreparedRequest, streamer *streamingResponse) (*upstreamBody, int, error) {
 	// 创建HTTP请求
-	req, err := http.NewRequest("POST", TushareAPIURL, bytes.NewBuffer(body))
+	reqBody := upstreamRequestBody(preparedRequest)
+	req, err := http.NewRequest("POST", upstreamURL(preparedRequest.APIName), bytes.NewBuffer(reqBody))
 	if err != nil {
 		return nil, 0, fmt.Errorf("创建HTTP请求失败: %w", err)
 	}
 
 	// 设置请求头
+	setUpstreamHeaders(req.Header, preparedRequest.Header)
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("User-Agent", "tushareproxy/1.0")
-
-	// 发送请求
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+	if proxyConfig.Replica.Enabled && preparedRequest.Refresh {
+		// 让主代理同样跳过缓存并覆盖
+		req.Header.Set("X-Cache-Refresh", "true")
+	}
+	if preparedRequest.RequestID != "" {
+		// 主代理沿用同一个请求 ID，前面有网关时也能按它对上两边的日志
+		req.Header.Set(HeaderRequestID, preparedRequest.RequestID)
+	}
+	if !proxyConfig.Compression.UpstreamGzip {
+		// 显式声明 identity，阻止 Transport 自动请求 gzip
+		req.Header.Set("Accept-Encoding", "identity")
+	}
+	// 签名放在最后，覆盖同名的透传请求头
+	if requestSigner != nil {
+		if err := requestSigner.Sign(req, reqBody); err != nil {
+			return nil, 0, fmt.Errorf("请求签名失败: %w", err)
+		}
 	}
 
+	// 发送请求，策略文件为接口单独配置了超时时使用独立的超时时间，连接池共用
+	client := upstreamClient
+	if policy := policyFor(preparedRequest.APIName); policy != nil && policy.TimeoutSeconds > 0 {
+		withTimeout := *upstreamClient
+		withTimeout.Timeout = time.Duration(policy.TimeoutSeconds) * time.Second
+		client = &withTimeout
+	}
+	sentAt := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, 0, fmt.Errorf("发送HTTP请求失败: %w", err)
 	}
 	defer resp.Body.Close()
+	observeUpstreamClock(resp.Header.Get("Date"), sentAt, time.Now())
 
-	// 读取响应
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, resp.StatusCode, fmt.Errorf("读取响应失败: %w", err)
+	// 响应大小上限，多读一个字节用来判断是否超限
+	reader := io.Reader(resp.Body)
+	if limit := int64(proxyConfig.Tushare.MaxResponseMB) << 20; limit > 0 {
+		if resp.ContentLength > limit {
+			return nil, resp.StatusCode, errResponseTooLarge
+		}
+		reader = io.LimitReader(resp.Body, limit+1)
 	}
 
-	// 记录非200状态码
-	if resp.StatusCode != http.StatusOK {
-		logger.Warn("tushare API返回非200状态码",
-			zap.Int("status_code", resp.StatusCode),
-			zap.String("response", string(respBody)))
+	// 读取响应，超过内存阈值的部分落盘
+	body := newUpstreamBody(int64(proxyConfig.Spool.MemoryThresholdMB)<<20, proxyConfig.Spool.Dir)
+	body.fetchedAt = time.Now()
+	body.header = forwardedResponseHeaders(resp.Header)
+	// 有大小上限时只流式返回已知大小的响应，否则超限时已经发出了 200 和部分数据
+	if streamer != nil && (proxyConfig.Tushare.MaxResponseMB <= 0 || resp.ContentLength >= 0) {
+		streamer.statusCode = resp.StatusCode
+		streamer.header = body.header
+		body.stream = streamer
 	}
-
-	return respBody, resp.StatusCode, nil
-}
-
-// sendErrorResponse 发送错误响应
-func sendErrorResponse(w http.ResponseWriter, message string, statusCode int) {
-	w.WriteHeader(http.StatusOK) // 状态码固定为200
-
-	errorResp := TushareAPIResult{
-		Code: statusCode,
-		Msg:  message,
+	if _, err := io.Copy(body, reader); err != nil {
+		body.Close()
+		return nil, resp.StatusCode, fmt.Errorf("读取响应失败: %w", err)
+	}
+	if limit := int64(proxyConfig.Tushare.MaxResponseMB) << 20; limit > 0 && body.Size() > limit {
+		body.Close()
+		return nil, resp.StatusCode, errResponseTooLarge
 	}
 
-	response, _ := json.Marshal(errorResp)
-	w.Write(response)
-}
+	if body.Spooled() {
+		logger.Info("tushare API响应超过内存阈值，已落盘",
+			zap.Int64("size", body.Size()),
+			zap.Int("memory_threshold_mb", proxyConfig.Spool.MemoryThresholdMB))
+	}
 
-func (r TushareAPIResult) itemCount() int {
-	if r.Data == nil {
-		return 0
+	// 记录非200状态码
+	if resp.StatusCode != http.StatusOK {
+		fields := []zap.Field{zap.Int("status_code", resp.StatusCode)}
+		if !body.Spooled() {
+			respBody, _ := body.Bytes()
+			fields = append(fields, zap.String("response", string(respBody)))
+		}
+		logger.Warn("tushare API返回非200状态码", fields...)
 	}
-	return len(r.Data.Items)
+
+	return body, resp.StatusCode, nil
 }
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/roowe/tushareproxy/internal/config"
+)
+
+// passthroughHeaders 挑出配置里允许透传给 tushare 的客户端请求头
+func passthroughHeaders(clientHeader http.Header) http.Header {
+	if len(proxyConfig.Tushare.PassthroughHeaders) == 0 {
+		return nil
+	}
+
+	header := make(http.Header)
+	for _, name := range proxyConfig.Tushare.PassthroughHeaders {
+		if values := clientHeader.Values(name); len(values) > 0 {
+			header[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+		}
+	}
+	return header
+}
+
+// forwardedResponseHeaders 挑出配置里允许透传给客户端的 tushare 响应头
+func forwardedResponseHeaders(upstreamHeader http.Header) http.Header {
+	if len(proxyConfig.Tushare.ForwardResponseHeaders) == 0 {
+		return nil
+	}
+
+	var header http.Header
+	for _, name := range proxyConfig.Tushare.ForwardResponseHeaders {
+		if values := upstreamHeader.Values(name); len(values) > 0 {
+			if header == nil {
+				header = make(http.Header)
+			}
+			header[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+		}
+	}
+	return header
+}
+
+// copyResponseHeaders 把透传的 tushare 响应头写到客户端响应
+func copyResponseHeaders(dst http.Header, src http.Header) {
+	for name, values := range src {
+		dst[name] = values
+	}
+}
+
+// setUpstreamHeaders 按优先级设置上游请求头：User-Agent、额外请求头、客户端透传请求头
+func setUpstreamHeaders(dst http.Header, passthrough http.Header) {
+	if proxyConfig.Tushare.UserAgent != "" {
+		dst.Set("User-Agent", proxyConfig.Tushare.UserAgent)
+	}
+	for name, value := range proxyConfig.Tushare.Headers {
+		dst.Set(name, value)
+	}
+	for name, values := range passthrough {
+		if config.IsReservedUpstreamHeader(name) {
+			continue
+		}
+		dst[name] = values
+	}
+}
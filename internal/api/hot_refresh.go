@@ -0,0 +1,236 @@
+package api
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/jobs"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// 每个热点名额最多跟踪的候选键数，超过时检查后只保留计数最高的一半
+const hotKeyCandidatesPerSlot = 4
+
+// hotKeys 按近期命中次数记录的缓存键，每轮检查后计数减半，近期命中多的排在前面
+type hotKeys struct {
+	mu   sync.Mutex
+	keys map[string]*hotKey
+	// 最多跟踪的键数
+	capacity int
+
+	refreshed atomic.Int64
+	failed    atomic.Int64
+	// 因为剩余限流额度不足推迟的次数
+	deferred atomic.Int64
+}
+
+type hotKey struct {
+	// 命中时的请求，刷新时原样回源，已去掉请求 ID
+	request   PreparedRequest
+	score     float64
+	expiresAt time.Time
+	// 当前过期时间（条目本次写入）以来的命中次数，没有再被命中的键不刷新，避免一直刷新已经不用的数据
+	hits int
+	// 当前过期时间已经刷新过一次，失败后不再重试，等条目过期后由请求同步回源
+	attempted bool
+}
+
+// hotRefreshStats /admin/cache/stats 中的热点键提前刷新统计
+type hotRefreshStats struct {
+	Tracked   int   `json:"tracked"`
+	Refreshed int64 `json:"refreshed"`
+	Failed    int64 `json:"failed"`
+	Deferred  int64 `json:"deferred"`
+}
+
+// 开启热点键提前刷新时非 nil，由 StartHotRefresh 设置
+var hotRefresh *hotKeys
+
+// StartHotRefresh 开始记录命中的缓存键，按间隔在后台刷新快要过期的热点键。需在缓存初始化之后调用
+func StartHotRefresh() {
+	cfg := proxyConfig.HotRefresh
+	if cfg.TopN <= 0 || cacheManager == nil {
+		return
+	}
+
+	hotRefresh = &hotKeys{
+		keys:     make(map[string]*hotKey),
+		capacity: cfg.TopN * hotKeyCandidatesPerSlot,
+	}
+	jobs.Register(jobs.HotRefresh)
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.CheckIntervalSeconds) * time.Second)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if !jobs.Paused(jobs.HotRefresh) && !IsOfflineMode() {
+				hotRefresh.refreshDue(time.Now())
+			}
+		}
+	}()
+	logger.Info("热点键提前刷新已启用",
+		zap.Int("top_n", cfg.TopN),
+		zap.Int("refresh_before_seconds", cfg.RefreshBeforeSeconds))
+}
+
+// recordHotKey 记录一次缓存命中，未开启时不做任何事
+func recordHotKey(key string, preparedRequest *PreparedRequest, expiresAt time.Time) {
+	h := hotRefresh
+	if h == nil || expiresAt.IsZero() {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	entry, ok := h.keys[key]
+	if !ok {
+		if len(h.keys) >= h.capacity {
+			return
+		}
+		entry = &hotKey{request: *preparedRequest}
+		entry.request.RequestID = ""
+		h.keys[key] = entry
+	}
+	if !entry.expiresAt.Equal(expiresAt) {
+		// 条目已被重新写入，新的过期时间可以再刷新一次
+		entry.expiresAt = expiresAt
+		entry.attempted = false
+		entry.hits = 0
+	}
+	entry.score++
+	entry.hits++
+}
+
+// refreshDue 选出计数最高的 top_n 个键，刷新其中快要过期的，然后衰减计数并清理候选
+func (h *hotKeys) refreshDue(now time.Time) {
+	cfg := proxyConfig.HotRefresh
+	before := time.Duration(cfg.RefreshBeforeSeconds) * time.Second
+
+	type candidate struct {
+		key   string
+		entry *hotKey
+	}
+	h.mu.Lock()
+	ranked := make([]candidate, 0, len(h.keys))
+	for key, entry := range h.keys {
+		ranked = append(ranked, candidate{key, entry})
+	}
+	sort.Slice(ranked, func(i, j int) bool { return ranked[i].entry.score > ranked[j].entry.score })
+
+	var due []candidate
+	for i, c := range ranked {
+		if i >= cfg.TopN {
+			break
+		}
+		if !c.entry.attempted && c.entry.hits > 0 && c.entry.expiresAt.Sub(now) <= before {
+			c.entry.attempted = true
+			due = append(due, candidate{c.key, &hotKey{request: c.entry.request, expiresAt: c.entry.expiresAt}})
+		}
+	}
+	for i, c := range ranked {
+		c.entry.score /= 2
+		// 已过期、刷新失败的键和排在后一半的候选不再跟踪
+		if (c.entry.attempted && !now.Before(c.entry.expiresAt)) || (len(ranked) >= h.capacity && i >= h.capacity/2) {
+			delete(h.keys, c.key)
+		}
+	}
+	h.mu.Unlock()
+
+	if len(due) == 0 {
+		return
+	}
+	sem := make(chan struct{}, cfg.Concurrency)
+	var wg sync.WaitGroup
+	for _, c := range due {
+		if jobs.Paused(jobs.HotRefresh) {
+			break
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			h.refresh(c.key, &c.entry.request)
+		}()
+	}
+	wg.Wait()
+}
+
+// refresh 回源刷新一个热点键。剩余限流额度不到上限的一半时推迟到下一轮，把额度留给客户端请求
+func (h *hotKeys) refresh(key string, request *PreparedRequest) {
+	now := time.Now()
+	if !hasRefreshHeadroom(request.APIName, now) {
+		h.deferred.Add(1)
+		h.mu.Lock()
+		if entry, ok := h.keys[key]; ok {
+			entry.attempted = false
+		}
+		h.mu.Unlock()
+		logger.Debug("限流额度不足，推迟刷新热点键", zap.String("api_name", request.APIName), zap.String("cache_key", key))
+		return
+	}
+
+	refreshRequest := *request
+	refreshRequest.Refresh = true
+	result, perr := lookupOrFetch(context.Background(), &refreshRequest, nil, now)
+	if perr != nil {
+		h.failed.Add(1)
+		logger.Warn("刷新热点键失败",
+			zap.String("api_name", request.APIName),
+			zap.String("cache_key", key),
+			zap.Int("code", perr.Code),
+			zap.String("msg", perr.Msg))
+		return
+	}
+	result.Body.Close()
+	// 错误响应和空结果不会写入缓存，没有新的过期时间
+	if result.ExpiresAt.IsZero() {
+		h.failed.Add(1)
+		logger.Warn("刷新热点键未写入缓存",
+			zap.String("api_name", request.APIName),
+			zap.String("cache_key", key),
+			zap.Int("status_code", result.StatusCode))
+		return
+	}
+
+	h.refreshed.Add(1)
+	h.mu.Lock()
+	if entry, ok := h.keys[key]; ok {
+		entry.expiresAt = result.ExpiresAt
+		entry.attempted = false
+		entry.hits = 0
+	}
+	h.mu.Unlock()
+	logger.Info("已提前刷新热点键",
+		zap.String("api_name", request.APIName),
+		zap.String("cache_key", key),
+		zap.Time("expires_at", result.ExpiresAt))
+}
+
+// hasRefreshHeadroom 接口当前分钟和当天的本地限流额度都剩一半以上
+func hasRefreshHeadroom(apiName string, now time.Time) bool {
+	if remaining, limit, limited := localLimiter.Headroom(apiName, now); limited && remaining*2 < limit {
+		return false
+	}
+	if remaining, limit, limited := dailyLimiter.Headroom(apiName, now); limited && remaining*2 < limit {
+		return false
+	}
+	return true
+}
+
+func (h *hotKeys) stats() *hotRefreshStats {
+	h.mu.Lock()
+	tracked := len(h.keys)
+	h.mu.Unlock()
+	return &hotRefreshStats{
+		Tracked:   tracked,
+		Refreshed: h.refreshed.Load(),
+		Failed:    h.failed.Load(),
+		Deferred:  h.deferred.Load(),
+	}
+}
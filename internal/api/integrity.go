@@ -0,0 +1,79 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/roowe/tushareproxy/internal/cache"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// 响应完整性校验头：items 行数和未压缩响应体的 SHA-256。
+// 普通响应放在响应头里，流式响应在开始时还不知道结果，放在 HTTP trailer 里
+const (
+	headerRowCount   = "X-Row-Count"
+	headerBodySHA256 = "X-Body-SHA256"
+)
+
+// setIntegrityHeaders 设置完整性校验头，响应不是 tushare JSON 时只设置校验和。
+// 回源和命中缓存时校验值已经算好；投影、拼接的结果和旧缓存条目没有校验值，现算
+func setIntegrityHeaders(header http.Header, body *upstreamBody) {
+	integrity := body.integrity
+	if integrity == nil {
+		integrity = computeIntegrity(body)
+		if integrity == nil {
+			return
+		}
+	}
+	header.Set(headerBodySHA256, integrity.BodySHA256)
+	if integrity.RowCount != nil {
+		header.Set(headerRowCount, strconv.Itoa(*integrity.RowCount))
+	}
+}
+
+// computeIntegrity 扫描整个响应体计算校验值
+func computeIntegrity(body *upstreamBody) *cache.Integrity {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, body.Reader()); err != nil {
+		logger.Error("计算响应校验和失败", zap.Error(err))
+		return nil
+	}
+	integrity := &cache.Integrity{BodySHA256: hex.EncodeToString(hash.Sum(nil))}
+	if summary, err := inspectTushareResult(body.Reader()); err == nil {
+		integrity.RowCount = &summary.ItemCount
+	}
+	return integrity
+}
+
+// entryIntegrity 缓存条目保存的校验值，旧条目没有时返回 nil
+func entryIntegrity(entry *cache.CacheEntry) *cache.Integrity {
+	if entry.BodySHA256 == "" {
+		return nil
+	}
+	return &entry.Integrity
+}
+
+// sealIntegrity 上游响应读完后记下校验值：SHA-256 在读取时已经算好，行数取自解析好的响应摘要
+func (b *upstreamBody) sealIntegrity(summary *tushareResultSummary) {
+	if b.hash == nil {
+		return
+	}
+	b.integrity = &cache.Integrity{BodySHA256: hex.EncodeToString(b.hash.Sum(nil))}
+	if summary != nil {
+		rowCount := summary.ItemCount
+		b.integrity.RowCount = &rowCount
+	}
+}
+
+// storedIntegrity 随缓存条目保存的校验值，没有时为空，命中时再现算
+func (b *upstreamBody) storedIntegrity() cache.Integrity {
+	if b.integrity == nil {
+		return cache.Integrity{}
+	}
+	return *b.integrity
+}
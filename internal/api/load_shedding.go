@@ -0,0 +1,130 @@
+package api
+
+import (
+	"bytes"
+	"expvar"
+	"os"
+	"runtime/metrics"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// 内存降到阈值的该比例以下才恢复，避免在阈值附近反复切换
+const sheddingRecoverRatio = 0.9
+
+// Go 堆上对象占用的内存，包括还没被回收的垃圾
+const heapObjectsMetric = "/memory/classes/heap/objects:bytes"
+
+// loadShedding 内存压力降级的状态
+var loadShedding struct {
+	active   atomic.Bool
+	heap     atomic.Uint64
+	rss      atomic.Uint64
+	rejected atomic.Int64
+}
+
+func init() {
+	expvar.Publish("tushareproxy_load_shedding", expvar.Func(func() interface{} {
+		return map[string]interface{}{
+			"shedding": loadShedding.active.Load(),
+			"heap_mb":  loadShedding.heap.Load() >> 20,
+			"rss_mb":   loadShedding.rss.Load() >> 20,
+			"rejected": loadShedding.rejected.Load(),
+		}
+	}))
+}
+
+// StartLoadShedding 按间隔检查内存，超过 load_shedding 配置的阈值时拒绝需要访问 tushare 的新请求，
+// 让代理在回补大量数据时可预期地降级，而不是被 OOM 杀掉
+func StartLoadShedding() {
+	cfg := proxyConfig.Shedding
+	if cfg.HeapLimitMB <= 0 && cfg.RSSLimitMB <= 0 {
+		return
+	}
+	if cfg.RSSLimitMB > 0 && readRSS() == 0 {
+		logger.Warn("当前系统无法读取进程 RSS，只按堆内存判断", zap.Int("rss_limit_mb", cfg.RSSLimitMB))
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.CheckIntervalMs) * time.Millisecond)
+		defer ticker.Stop()
+
+		sample := []metrics.Sample{{Name: heapObjectsMetric}}
+		for range ticker.C {
+			metrics.Read(sample)
+			heap := sample[0].Value.Uint64()
+			rss := readRSS()
+			loadShedding.heap.Store(heap)
+			loadShedding.rss.Store(rss)
+			updateLoadShedding(heap, rss)
+		}
+	}()
+	logger.Info("内存压力降级已启用",
+		zap.Int("heap_limit_mb", cfg.HeapLimitMB),
+		zap.Int("rss_limit_mb", cfg.RSSLimitMB))
+}
+
+// updateLoadShedding 按本次采样切换降级状态
+func updateLoadShedding(heap, rss uint64) {
+	cfg := proxyConfig.Shedding
+	over := func(value uint64, limitMB int, ratio float64) bool {
+		return limitMB > 0 && float64(value) >= float64(uint64(limitMB)<<20)*ratio
+	}
+
+	if !loadShedding.active.Load() {
+		if over(heap, cfg.HeapLimitMB, 1) || over(rss, cfg.RSSLimitMB, 1) {
+			loadShedding.active.Store(true)
+			logger.Warn("内存超过阈值，开始拒绝需要访问 tushare 的新请求",
+				zap.Uint64("heap_mb", heap>>20),
+				zap.Uint64("rss_mb", rss>>20),
+				zap.Int("heap_limit_mb", cfg.HeapLimitMB),
+				zap.Int("rss_limit_mb", cfg.RSSLimitMB))
+		}
+		return
+	}
+	if !over(heap, cfg.HeapLimitMB, sheddingRecoverRatio) && !over(rss, cfg.RSSLimitMB, sheddingRecoverRatio) {
+		loadShedding.active.Store(false)
+		logger.Info("内存已回落，恢复访问 tushare",
+			zap.Uint64("heap_mb", heap>>20),
+			zap.Uint64("rss_mb", rss>>20),
+			zap.Int64("rejected", loadShedding.rejected.Load()))
+	}
+}
+
+// checkLoadShedding 内存压力降级期间拒绝需要访问 tushare 的请求，缓存命中不经过这里
+func checkLoadShedding(preparedRequest *PreparedRequest) *proxyError {
+	if !loadShedding.active.Load() {
+		return nil
+	}
+	loadShedding.rejected.Add(1)
+	logger.Warn("内存压力降级中，拒绝回源请求",
+		zap.String("api_name", preparedRequest.APIName),
+		requestIDField(preparedRequest))
+	return &proxyError{
+		Code:       CodeBusy,
+		Msg:        "代理内存紧张，暂时只返回已缓存的数据，请稍后重试",
+		RetryAfter: 5 * time.Second,
+	}
+}
+
+// readRSS 从 /proc/self/statm 读取进程 RSS，不支持的系统返回 0
+func readRSS() uint64 {
+	data, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0
+	}
+	fields := bytes.Fields(data)
+	if len(fields) < 2 {
+		return 0
+	}
+	pages, err := strconv.ParseUint(string(fields[1]), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return pages * uint64(os.Getpagesize())
+}
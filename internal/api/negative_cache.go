@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/cache"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// negativeCacheable 是否短暂缓存该响应：tushare 的错误响应和空结果，
+// 每分钟限流由限流重试和本地限流处理，不缓存
+func negativeCacheable(statusCode int, summary *tushareResultSummary) bool {
+	if proxyConfig.Cache.NegativeTTLSeconds <= 0 || statusCode != http.StatusOK || summary == nil {
+		return false
+	}
+	if isMinuteRateLimited(summary) {
+		return false
+	}
+	return summary.Code != 0 || summary.ItemCount == 0
+}
+
+// lookupNegative 查找缓存的错误响应或空结果
+func lookupNegative(key string, preparedRequest *PreparedRequest) (*cache.CacheEntry, bool) {
+	if proxyConfig.Cache.NegativeTTLSeconds <= 0 {
+		return nil, false
+	}
+	return cacheManager.Get(cacheKeys.NegativeKey(key, preparedRequest.Token))
+}
+
+// storeNegative 按 negative_ttl_seconds 缓存错误响应或空结果，失败不影响响应
+func storeNegative(result *proxyResult, preparedRequest *PreparedRequest, upstream *upstreamBody) {
+	response, err := upstream.Bytes()
+	if err != nil {
+		logger.Error("读取响应体失败", zap.Error(err))
+		return
+	}
+
+	key := cacheKeys.NegativeKey(result.CacheKey, preparedRequest.Token)
+	expiresAt := time.Now().Add(time.Duration(proxyConfig.Cache.NegativeTTLSeconds) * time.Second)
+	if err := cacheManager.Set(
+		key,
+		result.Namespace,
+		preparedRequest.ForwardBody,
+		response,
+		result.StatusCode,
+		upstream.header,
+		expiresAt,
+		upstream.FetchedAt(),
+		upstream.storedIntegrity(),
+	); err != nil {
+		logger.Error("缓存错误响应失败", zap.Error(err))
+		return
+	}
+	logger.Debug("错误响应已缓存",
+		zap.String("cache_key", key),
+		zap.String("api_name", preparedRequest.APIName),
+		zap.Int64("expires_at", expiresAt.Unix()),
+		requestIDField(preparedRequest))
+}
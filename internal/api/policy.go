@@ -0,0 +1,217 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/config"
+	"github.com/roowe/tushareproxy/internal/jobs"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// policySet 生效中的接口策略文件
+type policySet struct {
+	version  int
+	revision string
+	modTime  time.Time
+	loadedAt time.Time
+	// 按模式长度降序排列，长度相同时不含通配符的优先，与 ttl_overrides 的匹配顺序一致
+	entries []policyEntry
+}
+
+type policyEntry struct {
+	pattern string
+	policy  config.APIPolicy
+}
+
+// 当前生效的策略，未配置策略文件时为 nil
+var apiPolicies atomic.Pointer[policySet]
+
+// 最近一次加载失败的情况，同一个修改时间的文件只报告一次
+var policyReloadState struct {
+	mu            sync.Mutex
+	lastError     string
+	failedAt      time.Time
+	failedModTime time.Time
+}
+
+func newPolicySet(policies *config.PolicyFile, modTime time.Time) *policySet {
+	set := &policySet{
+		version:  policies.Version,
+		revision: policies.Revision,
+		modTime:  modTime,
+		loadedAt: time.Now(),
+		entries:  make([]policyEntry, 0, len(policies.APIs)),
+	}
+	for pattern, policy := range policies.APIs {
+		set.entries = append(set.entries, policyEntry{pattern: pattern, policy: policy})
+	}
+	sort.Slice(set.entries, func(i, j int) bool {
+		a, b := set.entries[i].pattern, set.entries[j].pattern
+		if len(a) != len(b) {
+			return len(a) > len(b)
+		}
+		wildA, wildB := strings.ContainsAny(a, "*?["), strings.ContainsAny(b, "*?[")
+		if wildA != wildB {
+			return wildB
+		}
+		return a < b
+	})
+	return set
+}
+
+// policyFor 返回接口的策略，多个模式匹配时只使用最具体的一条，没有匹配时返回 nil
+func policyFor(apiName string) *config.APIPolicy {
+	set := apiPolicies.Load()
+	if set == nil {
+		return nil
+	}
+	for i := range set.entries {
+		// 模式已在加载时检查过
+		if ok, _ := path.Match(set.entries[i].pattern, apiName); ok {
+			return &set.entries[i].policy
+		}
+	}
+	return nil
+}
+
+// StartPolicyReload 加载接口策略文件，之后按间隔检查文件是否修改，修改后重新加载。
+// 新文件有错误时记录日志并继续使用当前策略
+func StartPolicyReload() {
+	cfg := proxyConfig.Policy
+	if cfg.File == "" {
+		return
+	}
+	if err := reloadPolicies(true); err != nil {
+		logger.Error("加载接口策略文件失败", zap.Error(err))
+	}
+
+	if cfg.ReloadIntervalSeconds <= 0 {
+		return
+	}
+	jobs.Register(jobs.PolicyReload)
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.ReloadIntervalSeconds) * time.Second)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if jobs.Paused(jobs.PolicyReload) {
+				continue
+			}
+			reloadPolicies(false)
+		}
+	}()
+}
+
+// reloadPolicies 策略文件的修改时间变化时重新加载，force 为 true 时总是加载
+func reloadPolicies(force bool) error {
+	file := proxyConfig.Policy.File
+	info, err := os.Stat(file)
+	if err != nil {
+		return recordPolicyError(err, time.Time{}, force)
+	}
+	modTime := info.ModTime()
+	if current := apiPolicies.Load(); !force && current != nil && modTime.Equal(current.modTime) {
+		return nil
+	}
+
+	policies, err := config.LoadPolicyFile(file)
+	if err != nil {
+		return recordPolicyError(err, modTime, force)
+	}
+
+	previous := apiPolicies.Swap(newPolicySet(policies, modTime))
+	resetCacheability()
+	policyReloadState.mu.Lock()
+	policyReloadState.lastError = ""
+	policyReloadState.failedModTime = time.Time{}
+	policyReloadState.mu.Unlock()
+
+	fields := []zap.Field{
+		zap.String("file", file),
+		zap.String("revision", policies.Revision),
+		zap.Int("apis", len(policies.APIs)),
+	}
+	if previous != nil {
+		fields = append(fields, zap.String("previous_revision", previous.revision))
+	}
+	logger.Info("接口策略已加载", fields...)
+	return nil
+}
+
+// recordPolicyError 记录加载失败，同一个修改时间的文件只在第一次失败时输出日志
+func recordPolicyError(err error, modTime time.Time, force bool) error {
+	policyReloadState.mu.Lock()
+	repeated := !force && policyReloadState.lastError != "" && modTime.Equal(policyReloadState.failedModTime)
+	policyReloadState.lastError = err.Error()
+	if !repeated {
+		policyReloadState.failedAt = time.Now()
+	}
+	policyReloadState.failedModTime = modTime
+	policyReloadState.mu.Unlock()
+
+	if !repeated && !force {
+		logger.Error("接口策略文件有错误，继续使用当前策略", zap.Error(err))
+	}
+	return err
+}
+
+// policyStatus /admin/policies 的响应
+type policyStatus struct {
+	File string `json:"file"`
+	// 当前生效策略的格式版本和策略版本号，没有加载成功过时为空
+	Version  int    `json:"version,omitempty"`
+	Revision string `json:"revision,omitempty"`
+	LoadedAt string `json:"loaded_at,omitempty"`
+	// 最近一次加载失败的原因，之后加载成功时清空
+	LastError string                      `json:"last_error,omitempty"`
+	FailedAt  string                      `json:"failed_at,omitempty"`
+	APIs      map[string]config.APIPolicy `json:"apis"`
+}
+
+// AdminPoliciesHandler GET 返回当前生效的接口策略，POST 立即重新加载策略文件
+func AdminPoliciesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if proxyConfig.Policy.File == "" {
+		sendErrorResponse(w, "未配置接口策略文件", CodeNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if err := reloadPolicies(true); err != nil {
+			sendErrorResponse(w, err.Error(), CodeBadRequest)
+			return
+		}
+	default:
+		sendErrorResponse(w, "只支持GET和POST方法", CodeMethodNotAllowed)
+		return
+	}
+
+	status := policyStatus{File: proxyConfig.Policy.File, APIs: map[string]config.APIPolicy{}}
+	if set := apiPolicies.Load(); set != nil {
+		status.Version = set.version
+		status.Revision = set.revision
+		status.LoadedAt = set.loadedAt.Format(time.RFC3339)
+		for _, entry := range set.entries {
+			status.APIs[entry.pattern] = entry.policy
+		}
+	}
+	policyReloadState.mu.Lock()
+	if policyReloadState.lastError != "" {
+		status.LastError = policyReloadState.lastError
+		status.FailedAt = policyReloadState.failedAt.Format(time.RFC3339)
+	}
+	policyReloadState.mu.Unlock()
+
+	sendAdminResponse(w, status)
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/config"
+	"github.com/roowe/tushareproxy/internal/jobs"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// StartPrefetchScheduler 按配置的时刻定时预取数据写入缓存，每个任务一个 goroutine。
+// 需在缓存和交易日历初始化之后调用
+func StartPrefetchScheduler() {
+	cfg := proxyConfig.Prefetch
+	if len(cfg.Jobs) == 0 || cacheManager == nil {
+		return
+	}
+
+	// 配置校验阶段已经检查过，这里不会出错
+	location, _ := time.LoadLocation(cfg.Timezone)
+	jobs.Register(jobs.Prefetch)
+	for i, job := range cfg.Jobs {
+		name := job.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		minute, _ := config.ParseClock(job.At)
+		go runPrefetchJob(name, job, minute, location)
+
+		logger.Info("定时预取任务已启动",
+			zap.String("job", name),
+			zap.String("at", job.At),
+			zap.String("timezone", cfg.Timezone),
+			zap.Bool("every_day", job.EveryDay),
+			zap.Int("requests", len(job.Requests)))
+	}
+}
+
+func runPrefetchJob(name string, job config.PrefetchJob, minute int, location *time.Location) {
+	for {
+		// 本机时钟偏差过大且开启补偿时，按上游时间的整点触发
+		current := clockAdjusted(time.Now()).In(location)
+		timer := time.NewTimer(nextClock(current, minute).Sub(current))
+		<-timer.C
+
+		if jobs.Paused(jobs.Prefetch) {
+			continue
+		}
+		now := time.Now().In(location)
+		exchange := cmp.Or(strings.ToUpper(job.Exchange), defaultCalendarExchange)
+		if today := exchangeToday(exchange, clockAdjusted(now)); !job.EveryDay && !isTradeDay(exchange, today) {
+			logger.Info("非交易日，跳过定时预取",
+				zap.String("job", name),
+				zap.String("exchange", exchange),
+				zap.String("date", today.Format(tushareDateLayout)))
+			continue
+		}
+
+		runPreload(context.Background(), preloadBatch{
+			name:        "prefetch:" + name,
+			token:       proxyConfig.Prefetch.Token,
+			concurrency: proxyConfig.Prefetch.Concurrency,
+			requests:    job.Requests,
+			refresh:     job.Refresh,
+		}, now)
+	}
+}
+
+// nextClock 返回 now 之后下一次到达一天中第 minute 分钟的时间
+func nextClock(now time.Time, minute int) time.Time {
+	year, month, day := now.Date()
+	next := time.Date(year, month, day, minute/60, minute%60, 0, 0, now.Location())
+	if !next.After(now) {
+		next = time.Date(year, month, day+1, minute/60, minute%60, 0, 0, now.Location())
+	}
+	return next
+}
+
+// exchangeToday 交易所当地时间的当前时刻，美股在北京时间早上仍是前一天
+func exchangeToday(exchange string, now time.Time) time.Time {
+	source, ok := config.CalendarSources[exchange]
+	if !ok {
+		return now
+	}
+	location, err := time.LoadLocation(source.Timezone)
+	if err != nil {
+		return now
+	}
+	return now.In(location)
+}
+
+// isTradeDay 按交易所的日历判断 day 是否交易日，没有该交易所的日历时按周一到周五判断，日历中没有的日期按交易日处理
+func isTradeDay(exchange string, day time.Time) bool {
+	c := tradeCalendars[exchange]
+	if c == nil {
+		return day.Weekday() != time.Saturday && day.Weekday() != time.Sunday
+	}
+	open, known := c.calendar.IsOpen(day.Format(tushareDateLayout))
+	return open || !known
+}
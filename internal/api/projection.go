@@ -0,0 +1,147 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// projectionSource 请求指定了 fields 时，不带 fields 的同一请求的缓存键；不适合裁剪时返回空
+func projectionSource(preparedRequest *PreparedRequest, namespace string) (string, []string) {
+	if !slices.Contains(proxyConfig.Projection.APIs, preparedRequest.APIName) {
+		return "", nil
+	}
+	fields := splitFields(preparedRequest.Fields)
+	if len(fields) == 0 {
+		return "", nil
+	}
+
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(preparedRequest.ForwardBody, &payload); err != nil {
+		return "", nil
+	}
+	delete(payload, "fields")
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", nil
+	}
+	return cacheKeys.GenerateKey(namespace, body), fields
+}
+
+// splitFields 拆分逗号分隔的字段列表，去掉空白和重复的字段
+func splitFields(fields string) []string {
+	var names []string
+	for _, name := range strings.Split(fields, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// lookupProjection 请求的 fields 都在不带 fields 的同一请求的缓存结果中时，从缓存结果中取出这些列返回，
+// 不再请求 tushare。缓存结果缺少任一字段时返回 nil
+func lookupProjection(preparedRequest *PreparedRequest, namespace string) *proxyResult {
+	key, fields := projectionSource(preparedRequest, namespace)
+	if key == "" {
+		return nil
+	}
+	entry, found := cacheManager.Get(key)
+	if !found || entry.StatusCode != http.StatusOK {
+		return nil
+	}
+
+	projected, err := projectFields(entry.ResponseBody, fields)
+	if err != nil {
+		logger.Debug("缓存结果不能按字段裁剪",
+			zap.String("api_name", preparedRequest.APIName),
+			zap.String("cache_key", key),
+			zap.Error(err),
+			requestIDField(preparedRequest))
+		return nil
+	}
+
+	logger.Info("按已缓存的全字段结果裁剪字段",
+		zap.String("api_name", preparedRequest.APIName),
+		zap.String("cache_key", key),
+		zap.String("fields", preparedRequest.Fields),
+		requestIDField(preparedRequest))
+	return &proxyResult{
+		Body:        newBufferedBody(projected),
+		StatusCode:  entry.StatusCode,
+		Header:      entry.Header,
+		FromCache:   true,
+		CacheStatus: cacheStatusHit,
+		CacheKey:    key,
+		Namespace:   namespace,
+		CachedAt:    time.Unix(entry.Timestamp, 0),
+		ExpiresAt:   entryExpiresAt(entry),
+	}
+}
+
+// projectFields 按 fields 的顺序从 tushare 响应中取出对应的列，保留响应的其他字段。
+// 响应 code 非 0 或缺少任一字段时返回错误
+func projectFields(raw []byte, fields []string) ([]byte, error) {
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &top); err != nil {
+		return nil, err
+	}
+	var code int
+	if err := json.Unmarshal(top["code"], &code); err != nil || code != 0 {
+		return nil, fmt.Errorf("响应不是成功的 tushare 结果")
+	}
+	var dataTop map[string]json.RawMessage
+	if err := json.Unmarshal(top["data"], &dataTop); err != nil || dataTop == nil {
+		return nil, fmt.Errorf("响应缺少 data")
+	}
+
+	var cachedFields []string
+	if err := json.Unmarshal(dataTop["fields"], &cachedFields); err != nil {
+		return nil, fmt.Errorf("解析 fields 失败: %w", err)
+	}
+	columns := make([]int, len(fields))
+	for i, name := range fields {
+		if columns[i] = slices.Index(cachedFields, name); columns[i] < 0 {
+			return nil, fmt.Errorf("缓存结果中没有字段 %s", name)
+		}
+	}
+
+	var items [][]json.RawMessage
+	if len(dataTop["items"]) > 0 && !bytes.Equal(dataTop["items"], []byte("null")) {
+		if err := json.Unmarshal(dataTop["items"], &items); err != nil {
+			return nil, fmt.Errorf("解析 items 失败: %w", err)
+		}
+	}
+	projected := make([][]json.RawMessage, len(items))
+	for i, item := range items {
+		if len(item) != len(cachedFields) {
+			return nil, fmt.Errorf("第 %d 行的列数与 fields 不一致", i)
+		}
+		row := make([]json.RawMessage, len(columns))
+		for j, column := range columns {
+			row[j] = item[column]
+		}
+		projected[i] = row
+	}
+
+	var err error
+	if dataTop["fields"], err = marshalRaw(fields); err != nil {
+		return nil, err
+	}
+	if dataTop["items"], err = marshalRaw(projected); err != nil {
+		return nil, err
+	}
+	if top["data"], err = marshalRaw(dataTop); err != nil {
+		return nil, err
+	}
+	return marshalRaw(top)
+}
@@ -0,0 +1,337 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// AsyncPollPath 异步排队请求的轮询地址前缀，后接请求 ID
+const AsyncPollPath = "/dataapi/queue/"
+
+// rateQueue 记录正在等待限流窗口的请求，按进入顺序计算排队位置
+type rateQueue struct {
+	mu   sync.Mutex
+	next uint64
+	// api_name -> 排队号 -> 预计放行时间
+	waiting map[string]map[uint64]time.Time
+}
+
+// 全局排队队列
+var waitQueue = &rateQueue{waiting: make(map[string]map[uint64]time.Time)}
+
+// enter 登记一次等待，返回排队号
+func (q *rateQueue) enter(apiName string, until time.Time) uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.next++
+	if q.waiting[apiName] == nil {
+		q.waiting[apiName] = make(map[uint64]time.Time)
+	}
+	q.waiting[apiName][q.next] = until
+	return q.next
+}
+
+// leave 结束等待
+func (q *rateQueue) leave(apiName string, ticket uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.waiting[apiName], ticket)
+	if len(q.waiting[apiName]) == 0 {
+		delete(q.waiting, apiName)
+	}
+}
+
+// position 返回排队位置，从 1 开始；不在队列中返回 0
+func (q *rateQueue) position(apiName string, ticket uint64) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.waiting[apiName][ticket]; !ok {
+		return 0
+	}
+	position := 1
+	for other := range q.waiting[apiName] {
+		if other < ticket {
+			position++
+		}
+	}
+	return position
+}
+
+// queueProgress 异步请求当前的排队状态，通过 context 传给 waitForRateLimit
+type queueProgress struct {
+	// 第一次进入排队时关闭
+	queued chan struct{}
+	once   sync.Once
+
+	mu      sync.Mutex
+	apiName string
+	ticket  uint64
+	until   time.Time
+}
+
+type queueProgressKey struct{}
+
+func newQueueProgress() *queueProgress {
+	return &queueProgress{queued: make(chan struct{})}
+}
+
+// progressFromContext 取出异步请求的排队状态，同步请求返回 nil
+func progressFromContext(ctx context.Context) *queueProgress {
+	progress, _ := ctx.Value(queueProgressKey{}).(*queueProgress)
+	return progress
+}
+
+func (p *queueProgress) enter(apiName string, ticket uint64, until time.Time) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	p.apiName, p.ticket, p.until = apiName, ticket, until
+	p.mu.Unlock()
+	p.once.Do(func() { close(p.queued) })
+}
+
+func (p *queueProgress) leave(ticket uint64) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// 拆分的子请求可能同时排队，只清理自己登记的状态
+	if p.ticket == ticket {
+		p.apiName, p.ticket, p.until = "", 0, time.Time{}
+	}
+}
+
+// snapshot 返回当前排队位置和预计剩余等待时间，不在排队时位置为 0
+func (p *queueProgress) snapshot(now time.Time) (int, time.Duration) {
+	p.mu.Lock()
+	apiName, ticket, until := p.apiName, p.ticket, p.until
+	p.mu.Unlock()
+
+	if ticket == 0 {
+		return 0, 0
+	}
+	eta := until.Sub(now)
+	if eta < 0 {
+		eta = 0
+	}
+	return waitQueue.position(apiName, ticket), eta
+}
+
+// asyncJob 一个异步处理中的请求
+type asyncJob struct {
+	id              string
+	preparedRequest *PreparedRequest
+	startTime       time.Time
+	progress        *queueProgress
+	done            chan struct{}
+
+	result *proxyResult
+	err    *proxyError
+}
+
+// asyncJobStore 已返回 202、等待客户端轮询的请求
+type asyncJobStore struct {
+	mu   sync.Mutex
+	jobs map[string]*asyncJob
+}
+
+// 全局异步请求表
+var asyncJobs = &asyncJobStore{jobs: make(map[string]*asyncJob)}
+
+func (s *asyncJobStore) add(job *asyncJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.id] = job
+}
+
+func (s *asyncJobStore) get(id string) *asyncJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jobs[id]
+}
+
+// take 取走请求，结果只能被取走一次
+func (s *asyncJobStore) take(id string) *asyncJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := s.jobs[id]
+	delete(s.jobs, id)
+	return job
+}
+
+// expire 丢弃超时未取走的结果
+func (s *asyncJobStore) expire(id string) {
+	job := s.take(id)
+	if job == nil {
+		return
+	}
+	if job.result != nil {
+		job.result.Body.Close()
+	}
+	logger.Info("异步请求结果超时未取走，已丢弃",
+		zap.String("id", id),
+		zap.String("api_name", job.preparedRequest.APIName),
+		requestIDField(job.preparedRequest))
+}
+
+// wantsAsync 客户端是否通过 Prefer: respond-async 要求异步排队
+func wantsAsync(r *http.Request) bool {
+	if !proxyConfig.Async.Enabled {
+		return false
+	}
+	for _, value := range r.Header.Values("Prefer") {
+		for _, pref := range strings.Split(value, ",") {
+			token, _, _ := strings.Cut(pref, ";")
+			if strings.EqualFold(strings.TrimSpace(token), "respond-async") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// handleAsync 在后台处理请求：没有排队就直接返回结果，
+// 进入限流排队后先返回 202 和轮询地址，请求继续在后台等待
+func handleAsync(w http.ResponseWriter, r *http.Request, preparedRequest *PreparedRequest, startTime time.Time) {
+	job := &asyncJob{
+		id:              newAsyncJobID(),
+		preparedRequest: preparedRequest,
+		startTime:       startTime,
+		progress:        newQueueProgress(),
+		done:            make(chan struct{}),
+	}
+
+	// 返回 202 后客户端会断开，后台处理不能跟着取消
+	ctx := context.WithValue(context.WithoutCancel(r.Context()), queueProgressKey{}, job.progress)
+	go func() {
+		job.result, job.err = executeRequest(ctx, preparedRequest, nil, startTime)
+		close(job.done)
+	}()
+
+	select {
+	case <-job.done:
+		writeAsyncResult(w, r, job)
+		return
+	case <-job.progress.queued:
+	}
+
+	asyncJobs.add(job)
+	go func() {
+		<-job.done
+		time.AfterFunc(time.Duration(proxyConfig.Async.ResultTTLSeconds)*time.Second, func() {
+			asyncJobs.expire(job.id)
+		})
+	}()
+
+	logger.Info("请求进入限流排队，返回轮询地址",
+		zap.String("id", job.id),
+		zap.String("api_name", preparedRequest.APIName),
+		requestIDField(preparedRequest))
+	recordAccessQueued(r.Context(), preparedRequest)
+	sendQueuedResponse(w, job)
+}
+
+// AsyncPollHandler 轮询异步请求：仍在排队时返回 202 和排队进度，完成后返回结果
+func AsyncPollHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		recordAccessError(r.Context(), CodeMethodNotAllowed)
+		sendErrorResponse(w, "只支持GET方法", CodeMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, AsyncPollPath)
+	job := asyncJobs.get(id)
+	if job == nil {
+		recordAccessError(r.Context(), CodeNotFound)
+		sendErrorResponse(w, "排队请求不存在或结果已过期", CodeNotFound)
+		return
+	}
+
+	select {
+	case <-job.done:
+		if job = asyncJobs.take(id); job == nil {
+			recordAccessError(r.Context(), CodeNotFound)
+			sendErrorResponse(w, "排队请求不存在或结果已过期", CodeNotFound)
+			return
+		}
+		writeAsyncResult(w, r, job)
+	default:
+		recordAccessQueued(r.Context(), job.preparedRequest)
+		sendQueuedResponse(w, job)
+	}
+}
+
+// writeAsyncResult 返回已完成的异步请求结果
+func writeAsyncResult(w http.ResponseWriter, r *http.Request, job *asyncJob) {
+	recordAccessResult(r.Context(), job.preparedRequest, job.result, job.err)
+	if job.err != nil {
+		sendErrorResponse(w, job.err.Msg, job.err.Code)
+		return
+	}
+	writeProxyResult(w, r, job.preparedRequest, job.result, job.startTime)
+}
+
+// asyncStatus 排队中的异步请求状态
+type asyncStatus struct {
+	ID         string `json:"id"`
+	PollURL    string `json:"poll_url"`
+	Position   int    `json:"position"`
+	ETASeconds int    `json:"eta_seconds"`
+}
+
+// sendQueuedResponse 以 202 返回排队进度，position 为 0 表示已经出队、正在请求 tushare
+func sendQueuedResponse(w http.ResponseWriter, job *asyncJob) {
+	position, eta := job.progress.snapshot(time.Now())
+	status := asyncStatus{
+		ID:         job.id,
+		PollURL:    AsyncPollPath + job.id,
+		Position:   position,
+		ETASeconds: int((eta + time.Second - 1) / time.Second),
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(map[string]interface{}{
+		"code": 0,
+		"msg":  "请求排队中",
+		"data": status,
+	}); err != nil {
+		logger.Error("序列化排队状态失败", zap.Error(err))
+		sendErrorResponse(w, "序列化响应失败", CodeInternal)
+		return
+	}
+
+	w.Header().Set("Location", status.PollURL)
+	w.Header().Set("Retry-After", strconv.Itoa(max(status.ETASeconds, 1)))
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(buf.Bytes())
+}
+
+// newAsyncJobID 生成随机请求 ID
+func newAsyncJobID() string {
+	var b [12]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
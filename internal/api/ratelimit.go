@@ -0,0 +1,269 @@
+package api
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/config"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// tushare 限流错误码，每分钟和每天的访问次数限制共用该错误码
+const tushareCodeRateLimited = 40203
+
+// 限流消息里的每分钟次数，例如“抱歉，您每分钟最多访问该接口500次”
+var minuteLimitPattern = regexp.MustCompile(`每分钟最多访问该接口(\d+)次`)
+
+// 全局本地限流器，未开启时为 nil
+var localLimiter *minuteLimiter
+
+// 是否使用策略文件中的限流上限，对应 policy.rate_limit
+var policyRateLimit bool
+
+// rateLimitPolicyFor 返回接口的策略，没有开启策略文件限流时返回 nil
+func rateLimitPolicyFor(apiName string) *config.APIPolicy {
+	if !policyRateLimit {
+		return nil
+	}
+	return policyFor(apiName)
+}
+
+// isMinuteRateLimited 是否为每分钟访问次数限流，每天的限制等待也没有意义
+func isMinuteRateLimited(summary *tushareResultSummary) bool {
+	return summary != nil &&
+		summary.Code == tushareCodeRateLimited &&
+		strings.Contains(summary.Msg, "每分钟最多访问")
+}
+
+// parseMinuteLimit 从限流消息中解析每分钟访问次数上限
+func parseMinuteLimit(msg string) (int, bool) {
+	match := minuteLimitPattern.FindStringSubmatch(msg)
+	if match == nil {
+		return 0, false
+	}
+	limit, err := strconv.Atoi(match[1])
+	if err != nil || limit <= 0 {
+		return 0, false
+	}
+	return limit, true
+}
+
+// untilNextMinute 距离下一分钟窗口的等待时间，多等一秒避免本地与服务端时钟误差
+func untilNextMinute(now time.Time) time.Duration {
+	return now.Truncate(time.Minute).Add(time.Minute).Sub(now) + time.Second
+}
+
+// minuteLimiter 按接口的每分钟本地限流。上限优先使用从 tushare 限流消息中学到的值，
+// 其次是策略文件、minute_limits 和积分档位的预设，都没有的接口不限制
+type minuteLimiter struct {
+	mu      sync.Mutex
+	limits  map[string]int
+	windows map[string]*minuteWindow
+
+	// 按配置预设的上限，0 表示不限制
+	configured   map[string]int
+	defaultLimit int
+}
+
+type minuteWindow struct {
+	start time.Time
+	count int
+}
+
+func newMinuteLimiter(defaultLimit int, configured map[string]int) *minuteLimiter {
+	return &minuteLimiter{
+		limits:       make(map[string]int),
+		windows:      make(map[string]*minuteWindow),
+		configured:   configured,
+		defaultLimit: defaultLimit,
+	}
+}
+
+// limitFor 返回接口当前生效的每分钟上限，调用方需持有锁
+func (l *minuteLimiter) limitFor(apiName string) (int, bool) {
+	if limit, ok := l.limits[apiName]; ok {
+		return limit, true
+	}
+	if policy := rateLimitPolicyFor(apiName); policy != nil && policy.MinuteLimit > 0 {
+		return policy.MinuteLimit, true
+	}
+	if limit, ok := l.configured[apiName]; ok {
+		return limit, limit > 0
+	}
+	return l.defaultLimit, l.defaultLimit > 0
+}
+
+// window 返回接口当前分钟的计数窗口，调用方需持有锁
+func (l *minuteLimiter) window(apiName string, now time.Time) *minuteWindow {
+	start := now.Truncate(time.Minute)
+	w := l.windows[apiName]
+	if w == nil || !w.start.Equal(start) {
+		w = &minuteWindow{start: start}
+		l.windows[apiName] = w
+	}
+	return w
+}
+
+// Reserve 占用一次访问额度，返回 0 表示可以访问，否则返回到下一分钟的等待时间
+func (l *minuteLimiter) Reserve(apiName string, now time.Time) time.Duration {
+	if l == nil {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	w := l.window(apiName, now)
+	if limit, ok := l.limitFor(apiName); ok && w.count >= limit {
+		return untilNextMinute(now)
+	}
+	w.count++
+	return 0
+}
+
+// Headroom 返回接口当前分钟剩余的额度和上限，不占用额度；没有上限时 limited 为 false
+func (l *minuteLimiter) Headroom(apiName string, now time.Time) (remaining, limit int, limited bool) {
+	if l == nil {
+		return 0, 0, false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if limit, limited = l.limitFor(apiName); !limited {
+		return 0, 0, false
+	}
+	return max(limit-l.window(apiName, now).count, 0), limit, true
+}
+
+// Learn 记录 tushare 返回的每分钟上限，并把当前分钟的额度视为用尽
+func (l *minuteLimiter) Learn(apiName string, limit int, now time.Time) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limits[apiName] != limit {
+		logger.Info("从 tushare 限流消息学习到接口每分钟上限",
+			zap.String("api_name", apiName),
+			zap.Int("limit", limit),
+			zap.Int("previous", l.limits[apiName]))
+		l.limits[apiName] = limit
+	}
+	w := l.window(apiName, now)
+	if w.count < limit {
+		w.count = limit
+	}
+}
+
+// Limit 返回接口当前生效的每分钟上限
+func (l *minuteLimiter) Limit(apiName string) (int, bool) {
+	if l == nil {
+		return 0, false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.limitFor(apiName)
+}
+
+// 全局每天访问次数限流器，未配置每天上限时为 nil
+var dailyLimiter *dayLimiter
+
+// dayLimiter 按接口的每天本地限流，按北京时间的自然日计数。
+// 计数只保存在内存中，重启后从 0 开始
+type dayLimiter struct {
+	mu       sync.Mutex
+	location *time.Location
+	day      string
+	counts   map[string]int
+
+	configured   map[string]int
+	defaultLimit int
+}
+
+func newDayLimiter(defaultLimit int, configured map[string]int) *dayLimiter {
+	location, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		location = time.Local
+	}
+	return &dayLimiter{
+		location:     location,
+		counts:       make(map[string]int),
+		configured:   configured,
+		defaultLimit: defaultLimit,
+	}
+}
+
+// Reserve 占用当天的一次访问额度，额度用尽时返回 false 和上限
+func (l *dayLimiter) Reserve(apiName string, now time.Time) (int, bool) {
+	if l == nil {
+		return 0, true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limit := l.limitFor(apiName)
+	if limit <= 0 {
+		return 0, true
+	}
+
+	l.rollover(now)
+	if l.counts[apiName] >= limit {
+		return limit, false
+	}
+	l.counts[apiName]++
+	return limit, true
+}
+
+// Headroom 返回接口当天剩余的额度和上限，不占用额度；没有上限时 limited 为 false
+func (l *dayLimiter) Headroom(apiName string, now time.Time) (remaining, limit int, limited bool) {
+	if l == nil {
+		return 0, 0, false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if limit = l.limitFor(apiName); limit <= 0 {
+		return 0, 0, false
+	}
+	l.rollover(now)
+	return max(limit-l.counts[apiName], 0), limit, true
+}
+
+// limitFor 返回接口每天的上限，0 表示不限制，调用方需持有锁
+func (l *dayLimiter) limitFor(apiName string) int {
+	limit := l.defaultLimit
+	if configured, ok := l.configured[apiName]; ok {
+		limit = configured
+	}
+	if policy := rateLimitPolicyFor(apiName); policy != nil && policy.DailyLimit > 0 {
+		limit = policy.DailyLimit
+	}
+	return limit
+}
+
+// rollover 进入新的自然日时清空计数，调用方需持有锁
+func (l *dayLimiter) rollover(now time.Time) {
+	if day := clockAdjusted(now).In(l.location).Format(tushareDateLayout); day != l.day {
+		l.day = day
+		clear(l.counts)
+	}
+}
+
+// UntilReset 距离按北京时间的下一个自然日开始计数的时长
+func (l *dayLimiter) UntilReset(now time.Time) time.Duration {
+	local := clockAdjusted(now).In(l.location)
+	year, month, day := local.Date()
+	return time.Date(year, month, day+1, 0, 0, 0, 0, l.location).Sub(local)
+}
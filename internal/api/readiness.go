@@ -0,0 +1,222 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/cache"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// readinessState 关键接口的缓存条目数，与启动以来的缓存命中率一起用于判断缓存是否已预热
+type readinessState struct {
+	mu        sync.Mutex
+	entries   map[string]int
+	countedAt time.Time
+
+	// 达到预热标准后一直保持就绪，避免流量波动时实例被反复摘除
+	warm atomic.Bool
+
+	// 最近一次探测 tushare 的错误，为空表示可达或未开启探测
+	upstreamError string
+}
+
+var readiness = &readinessState{}
+
+// entryProgress 关键接口的缓存条目数
+type entryProgress struct {
+	Count int `json:"count"`
+	Min   int `json:"min"`
+}
+
+// readinessReport /readyz 的响应
+type readinessReport struct {
+	Ready       bool                     `json:"ready"`
+	Hits        int64                    `json:"hits"`
+	Requests    int64                    `json:"requests"`
+	HitRate     float64                  `json:"hit_rate"`
+	MinHitRate  float64                  `json:"min_hit_rate,omitempty"`
+	MinRequests int                      `json:"min_requests,omitempty"`
+	Entries     map[string]entryProgress `json:"entries,omitempty"`
+	CountedAt   string                   `json:"counted_at,omitempty"`
+	// 缓存存储不可用时的最近一次错误，此时始终未就绪
+	CacheError string `json:"cache_error,omitempty"`
+	// 开启上游探测且最近一次探测失败时的错误，此时始终未就绪
+	UpstreamError string `json:"upstream_error,omitempty"`
+}
+
+// StartReadinessCheck 配置了关键接口的最少缓存条目数时，定期统计条目数直到达到标准；
+// 开启上游探测时定期检查 tushare 是否可达
+func StartReadinessCheck() {
+	cfg := proxyConfig.Readiness
+	if cfg.UpstreamProbeIntervalSeconds > 0 {
+		go readiness.probeUpstreamLoop(time.Duration(cfg.UpstreamProbeIntervalSeconds) * time.Second)
+	}
+	if len(cfg.MinEntries) == 0 || cacheManager == nil {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.CheckIntervalSeconds) * time.Second)
+		defer ticker.Stop()
+
+		for {
+			readiness.countEntries(cfg.MinEntries)
+			if readiness.report().Ready {
+				return
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// probeUpstreamLoop 按间隔用空 token 请求一次 trade_cal，收到 tushare 格式的响应就算可达，
+// 不消耗任何 token 的额度。离线模式下不探测
+func (s *readinessState) probeUpstreamLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		errMsg := ""
+		if !IsOfflineMode() {
+			if _, _, err := ProbeToken(""); err != nil {
+				errMsg = err.Error()
+			}
+		}
+
+		s.mu.Lock()
+		previous := s.upstreamError
+		s.upstreamError = errMsg
+		s.mu.Unlock()
+		if errMsg != "" && previous == "" {
+			logger.Warn("探测 tushare 失败，实例未就绪", zap.String("error", errMsg))
+		} else if errMsg == "" && previous != "" {
+			logger.Info("tushare 恢复可达")
+		}
+		<-ticker.C
+	}
+}
+
+// countEntries 遍历缓存统计关键接口的条目数
+func (s *readinessState) countEntries(minEntries map[string]int) {
+	counts := make(map[string]int, len(minEntries))
+	err := cacheManager.ForEachEntry(func(key string, entry *cache.CacheEntry, hitCount uint64) error {
+		if apiName := entry.APIName(); minEntries[apiName] > 0 {
+			counts[apiName]++
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Warn("统计缓存条目数失败", zap.Error(err))
+		return
+	}
+
+	s.mu.Lock()
+	s.entries = counts
+	s.countedAt = time.Now()
+	s.mu.Unlock()
+}
+
+// report 按配置的预热标准判断是否就绪，没有配置标准时始终就绪
+func (s *readinessState) report() *readinessReport {
+	cfg := proxyConfig.Readiness
+	report := &readinessReport{
+		Ready:       true,
+		MinHitRate:  cfg.MinHitRate,
+		MinRequests: cfg.MinRequests,
+	}
+	report.Hits, report.Requests = lookupStats.totals()
+	if report.Requests > 0 {
+		report.HitRate = float64(report.Hits) / float64(report.Requests)
+	}
+
+	if cfg.MinHitRate > 0 && (report.Requests < int64(cfg.MinRequests) || report.HitRate < cfg.MinHitRate) {
+		report.Ready = false
+	}
+
+	if len(cfg.MinEntries) > 0 {
+		s.mu.Lock()
+		report.Entries = make(map[string]entryProgress, len(cfg.MinEntries))
+		for apiName, min := range cfg.MinEntries {
+			count := s.entries[apiName]
+			report.Entries[apiName] = entryProgress{Count: count, Min: min}
+			if count < min {
+				report.Ready = false
+			}
+		}
+		if !s.countedAt.IsZero() {
+			report.CountedAt = s.countedAt.Format(time.RFC3339)
+		}
+		s.mu.Unlock()
+	}
+
+	if s.warm.Load() {
+		report.Ready = true
+	} else if report.Ready && s.warm.CompareAndSwap(false, true) {
+		logger.Info("缓存已达到预热标准，实例就绪",
+			zap.Int64("requests", report.Requests),
+			zap.Float64("hit_rate", report.HitRate))
+	}
+	if err := cacheHealth(); err != nil {
+		report.Ready = false
+		report.CacheError = err.Error()
+	}
+	s.mu.Lock()
+	if s.upstreamError != "" {
+		report.Ready = false
+		report.UpstreamError = s.upstreamError
+	}
+	s.mu.Unlock()
+	return report
+}
+
+// ReadyzHandler 就绪检查，缓存未达到预热标准时返回 503，供编排系统决定何时把流量切过来
+func ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		sendErrorResponse(w, "只支持GET方法", CodeMethodNotAllowed)
+		return
+	}
+
+	report := readiness.report()
+	statusCode, msg := http.StatusOK, ""
+	if report.CacheError != "" {
+		statusCode, msg = http.StatusServiceUnavailable, "缓存存储不可用，请求直接转发 tushare"
+	} else if report.UpstreamError != "" {
+		statusCode, msg = http.StatusServiceUnavailable, "无法访问 tushare"
+	} else if !report.Ready {
+		statusCode, msg = http.StatusServiceUnavailable, "缓存尚未达到预热标准"
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"code": 0,
+		"msg":  msg,
+		"data": report,
+	})
+	if err != nil {
+		sendErrorResponse(w, "序列化响应失败", CodeInternal)
+		return
+	}
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
+
+// HealthzHandler 存活检查，进程能处理请求就返回 200，不检查缓存和上游，供编排系统判断是否需要重启
+func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		sendErrorResponse(w, "只支持GET方法", CodeMethodNotAllowed)
+		return
+	}
+	sendAdminResponse(w, map[string]interface{}{
+		"status":         "ok",
+		"uptime_seconds": int64(time.Since(runStats.startedAt) / time.Second),
+	})
+}
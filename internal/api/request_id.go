@@ -0,0 +1,62 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// HeaderRequestID 每个请求的唯一 ID，写在响应头、代理错误响应的 proxy_request_id 字段、访问日志和该请求的
+// 代理日志里，并随请求转发给上游，客户端反馈问题时凭它在日志中找到对应的请求。
+// 响应头不用 X-Request-Id，避免和透传的 tushare 响应头冲突
+const HeaderRequestID = "X-Proxy-Request-Id"
+
+// 客户端或网关常用的请求 ID 请求头，请求没有带 X-Proxy-Request-Id 时沿用它
+const headerClientRequestID = "X-Request-Id"
+
+// 客户端自带请求 ID 的最大长度
+const maxRequestIDLength = 64
+
+// NewRequestID 返回请求 ID。客户端或前一级代理已经带了合法的 ID 时沿用，方便端到端串起同一个请求
+func NewRequestID(r *http.Request) string {
+	if id := r.Header.Get(HeaderRequestID); validRequestID(id) {
+		return id
+	}
+	if id := r.Header.Get(headerClientRequestID); validRequestID(id) {
+		return id
+	}
+
+	var buf [8]byte
+	rand.Read(buf[:])
+	return hex.EncodeToString(buf[:])
+}
+
+// validRequestID 只接受字母、数字和 -_.，避免客户端借请求 ID 往日志里注入内容
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range []byte(id) {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// requestIDOf 当前响应的请求 ID，由访问日志中间件在处理请求前写入响应头
+func requestIDOf(w http.ResponseWriter) string {
+	return w.Header().Get(HeaderRequestID)
+}
+
+// requestIDField 日志中的请求 ID 字段，预热、预取等代理自己发起的请求没有请求 ID，不输出该字段
+func requestIDField(preparedRequest *PreparedRequest) zap.Field {
+	if preparedRequest.RequestID == "" {
+		return zap.Skip()
+	}
+	return zap.String("request_id", preparedRequest.RequestID)
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// tushareResultSummary tushare 响应的摘要信息
+type tushareResultSummary struct {
+	Code      int
+	Msg       string
+	ItemCount int
+	// 结果被 tushare 截断，还有更多数据
+	HasMore bool
+}
+
+// inspectTushareResult 流式解析 tushare 响应，只提取 code、msg、数据行数和 has_more，
+// 避免为大响应构造完整的 items
+func inspectTushareResult(r io.Reader) (*tushareResultSummary, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+
+	if err := expectDelim(decoder, '{'); err != nil {
+		return nil, err
+	}
+
+	summary := &tushareResultSummary{}
+	for decoder.More() {
+		key, err := readObjectKey(decoder)
+		if err != nil {
+			return nil, err
+		}
+
+		switch key {
+		case "code":
+			var code json.Number
+			if err := decoder.Decode(&code); err != nil {
+				return nil, fmt.Errorf("解析 code 失败: %w", err)
+			}
+			value, err := code.Int64()
+			if err != nil {
+				return nil, fmt.Errorf("code 不是整数: %w", err)
+			}
+			summary.Code = int(value)
+		case "msg":
+			var msg *string
+			if err := decoder.Decode(&msg); err != nil {
+				return nil, fmt.Errorf("解析 msg 失败: %w", err)
+			}
+			if msg != nil {
+				summary.Msg = *msg
+			}
+		case "data":
+			if err := inspectData(decoder, summary); err != nil {
+				return nil, err
+			}
+		default:
+			if err := skipValue(decoder); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return summary, nil
+}
+
+// inspectData 统计 data.items 的行数并读取 data.has_more
+func inspectData(decoder *json.Decoder, summary *tushareResultSummary) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return fmt.Errorf("解析 data 失败: %w", err)
+	}
+	if token == nil {
+		return nil
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("data 必须是 JSON 对象")
+	}
+
+	for decoder.More() {
+		key, err := readObjectKey(decoder)
+		if err != nil {
+			return err
+		}
+		switch key {
+		case "items":
+		case "has_more":
+			var hasMore *bool
+			if err := decoder.Decode(&hasMore); err != nil {
+				return fmt.Errorf("解析 has_more 失败: %w", err)
+			}
+			summary.HasMore = hasMore != nil && *hasMore
+			continue
+		default:
+			if err := skipValue(decoder); err != nil {
+				return err
+			}
+			continue
+		}
+
+		token, err := decoder.Token()
+		if err != nil {
+			return fmt.Errorf("解析 items 失败: %w", err)
+		}
+		if token == nil {
+			continue
+		}
+		if delim, ok := token.(json.Delim); !ok || delim != '[' {
+			return fmt.Errorf("items 必须是 JSON 数组")
+		}
+		for decoder.More() {
+			if err := skipValue(decoder); err != nil {
+				return err
+			}
+			summary.ItemCount++
+		}
+		if err := expectDelim(decoder, ']'); err != nil {
+			return err
+		}
+	}
+
+	return expectDelim(decoder, '}')
+}
+
+func readObjectKey(decoder *json.Decoder) (string, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return "", fmt.Errorf("解析 JSON 失败: %w", err)
+	}
+	key, ok := token.(string)
+	if !ok {
+		return "", fmt.Errorf("JSON 对象键必须是字符串")
+	}
+	return key, nil
+}
+
+func expectDelim(decoder *json.Decoder, want json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return fmt.Errorf("解析 JSON 失败: %w", err)
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != want {
+		return fmt.Errorf("JSON 格式错误: 期望 %q", want)
+	}
+	return nil
+}
+
+func skipValue(decoder *json.Decoder) error {
+	var raw json.RawMessage
+	if err := decoder.Decode(&raw); err != nil {
+		return fmt.Errorf("解析 JSON 失败: %w", err)
+	}
+	return nil
+}
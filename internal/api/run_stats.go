@@ -0,0 +1,74 @@
+package api
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/alert"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// 进程启动以来的请求计数，关闭时输出运行统计
+var runStats = struct {
+	startedAt time.Time
+	// 客户端请求数（不含预热、预取等代理自己发起的请求）和其中返回代理错误的次数
+	requests atomic.Int64
+	errors   atomic.Int64
+	// 访问 tushare 的次数和其中失败的次数（网络错误、非 200、tushare 返回非 0 code）
+	upstreamCalls  atomic.Int64
+	upstreamErrors atomic.Int64
+}{startedAt: time.Now()}
+
+// recordRequest 记录一次客户端请求的结果
+func recordRequest(perr *proxyError) {
+	runStats.requests.Add(1)
+	if perr != nil {
+		runStats.errors.Add(1)
+	}
+}
+
+// recordUpstream 记录一次 tushare 请求的结果，errMsg 为空表示成功，同时用于上游错误率告警
+func recordUpstream(apiName string, errMsg string) {
+	upstreamErrors.Record(apiName, errMsg)
+	runStats.upstreamCalls.Add(1)
+	if errMsg != "" {
+		runStats.upstreamErrors.Add(1)
+	}
+}
+
+// ReportRunSummary 输出启动以来的运行统计，notifier 非空时同步发送到告警 webhook。
+// 在关闭流程中 HTTP 服务停止之后调用，统计不会再变化
+func ReportRunSummary(notifier *alert.Notifier) error {
+	hits, lookups := lookupStats.totals()
+	uptime := time.Since(runStats.startedAt).Round(time.Second)
+	details := map[string]interface{}{
+		"started_at":      runStats.startedAt.Unix(),
+		"uptime_seconds":  int64(uptime / time.Second),
+		"requests":        runStats.requests.Load(),
+		"errors":          runStats.errors.Load(),
+		"cache_lookups":   lookups,
+		"cache_hits":      hits,
+		"hit_rate":        hitRatio(hits, lookups-hits),
+		"upstream_calls":  runStats.upstreamCalls.Load(),
+		"upstream_errors": runStats.upstreamErrors.Load(),
+	}
+
+	fields := make([]zap.Field, 0, len(details))
+	for _, name := range []string{"started_at", "uptime_seconds", "requests", "errors", "cache_lookups", "cache_hits", "hit_rate", "upstream_calls", "upstream_errors"} {
+		fields = append(fields, zap.Any(name, details[name]))
+	}
+	logger.Info("运行统计", fields...)
+
+	if notifier == nil {
+		return nil
+	}
+	return notifier.Send(alert.Event{
+		Type: "shutdown_summary",
+		Message: fmt.Sprintf("代理关闭，运行 %s，请求 %d 次，缓存命中率 %.1f%%，上游错误 %d 次",
+			uptime, details["requests"], details["hit_rate"].(float64)*100, details["upstream_errors"]),
+		Details: details,
+	})
+}
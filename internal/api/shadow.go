@@ -0,0 +1,258 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/cache"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// 影子模式最多记录的键数，超过后不再记录新键，避免内存无限增长
+const shadowMaxEntries = 1000000
+
+// 清理已过期影子条目的最小间隔
+const shadowSweepInterval = time.Minute
+
+// shadowCache 缓存影子模式：缓存关闭时照常生成缓存键，只在内存中记录每个键的过期时间和条目大小，
+// 统计假如开启缓存会命中还是未命中，用来在生产环境开启缓存前估算命中率和磁盘占用
+type shadowCache struct {
+	mu      sync.Mutex
+	entries map[string]shadowEntry
+	perAPI  map[string]*shadowAPIStats
+	since   time.Time
+
+	hits        int64
+	misses      int64
+	bypass      int64
+	uncacheable int64
+	// 超过 shadowMaxEntries 后没有记录的写入次数
+	dropped   int64
+	lastSweep time.Time
+}
+
+type shadowEntry struct {
+	apiName string
+	// 响应体大小和按 cache.compression 压缩后写入存储的大小
+	size       int64
+	storedSize int64
+	expiresAt  int64
+}
+
+// shadowAPIStats 单个 api_name 的影子统计，条目数和大小在生成报告时填充
+type shadowAPIStats struct {
+	APIName     string  `json:"api_name"`
+	Hits        int64   `json:"hits"`
+	Misses      int64   `json:"misses"`
+	HitRatio    float64 `json:"hit_ratio"`
+	Entries     int     `json:"entries"`
+	EntryBytes  int64   `json:"entry_bytes"`
+	StoredBytes int64   `json:"stored_bytes"`
+}
+
+// shadowReport /admin/cache/shadow 的响应
+type shadowReport struct {
+	Since       string  `json:"since"`
+	Hits        int64   `json:"hits"`
+	Misses      int64   `json:"misses"`
+	HitRatio    float64 `json:"hit_ratio"`
+	Bypass      int64   `json:"bypass"`
+	Uncacheable int64   `json:"uncacheable"`
+	Entries     int     `json:"entries"`
+	// 未过期条目的响应体大小之和，以及压缩后估算的存储占用（不含存储自身的开销）
+	EntryBytes  int64            `json:"entry_bytes"`
+	StoredBytes int64            `json:"stored_bytes"`
+	Dropped     int64            `json:"dropped"`
+	APIs        []shadowAPIStats `json:"apis"`
+}
+
+// cacheShadow 开启缓存影子模式时非 nil，由 SetConfig 设置
+var cacheShadow *shadowCache
+
+func newShadowCache() *shadowCache {
+	now := time.Now()
+	return &shadowCache{
+		entries:   make(map[string]shadowEntry),
+		perAPI:    make(map[string]*shadowAPIStats),
+		since:     now,
+		lastSweep: now,
+	}
+}
+
+func (s *shadowCache) apiStats(apiName string) *shadowAPIStats {
+	stats, ok := s.perAPI[apiName]
+	if !ok {
+		stats = &shadowAPIStats{APIName: apiName}
+		s.perAPI[apiName] = stats
+	}
+	return stats
+}
+
+// shadowLookup 按开启缓存时的规则判断请求会不会命中，返回未命中后需要记录的缓存键；
+// 不可缓存、no_cache 和会命中的请求返回空
+func shadowLookup(preparedRequest *PreparedRequest, now time.Time) string {
+	s := cacheShadow
+	if reason := uncacheableReason(preparedRequest, now); reason != "" {
+		s.mu.Lock()
+		s.uncacheable++
+		s.mu.Unlock()
+		return ""
+	}
+	// 开启缓存时会被拒绝的请求，影子模式照常转发，不计入统计
+	if preparedRequest.Policy.Validate(cacheKeys.DefaultNamespace(), now) != nil {
+		return ""
+	}
+	namespace := preparedRequest.Policy.ResolvedNamespace(cacheKeys.DefaultNamespace())
+	key := cacheKeys.GenerateKey(namespace, preparedRequest.ForwardBody)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if preparedRequest.Policy.NoCache {
+		s.bypass++
+		return ""
+	}
+	if preparedRequest.Refresh {
+		return key
+	}
+
+	stats := s.apiStats(preparedRequest.APIName)
+	entry, ok := s.entries[key]
+	if ok && now.Unix() < entry.expiresAt {
+		s.hits++
+		stats.Hits++
+		logger.Info("缓存影子模式：会命中缓存",
+			zap.String("api_name", preparedRequest.APIName),
+			zap.String("cache_key", key),
+			zap.Int64("size", entry.size),
+			requestIDField(preparedRequest))
+		return ""
+	}
+	s.misses++
+	stats.Misses++
+	logger.Info("缓存影子模式：缓存未命中",
+		zap.String("api_name", preparedRequest.APIName),
+		zap.String("cache_key", key),
+		requestIDField(preparedRequest))
+	return key
+}
+
+// shadowStore 记录开启缓存时会写入的条目，只保存大小和过期时间
+func shadowStore(key string, preparedRequest *PreparedRequest, upstream *upstreamBody, now time.Time) {
+	expiresAt, err := resolveCacheExpiration(preparedRequest.Policy, cacheTTLFor(preparedRequest, now), time.Now())
+	if err != nil {
+		return
+	}
+	response, err := upstream.Bytes()
+	if err != nil {
+		return
+	}
+	storedSize := cache.EncodedSize(proxyConfig.Cache.Compression, proxyConfig.Cache.CompressionMinBytes, response)
+
+	s := cacheShadow
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.lastSweep) >= shadowSweepInterval {
+		s.sweep(time.Now())
+	}
+	if _, ok := s.entries[key]; !ok && len(s.entries) >= shadowMaxEntries {
+		s.dropped++
+		return
+	}
+	s.entries[key] = shadowEntry{
+		apiName:    preparedRequest.APIName,
+		size:       int64(len(response)),
+		storedSize: int64(storedSize),
+		expiresAt:  expiresAt.Unix(),
+	}
+	logger.Info("缓存影子模式：会写入缓存",
+		zap.String("api_name", preparedRequest.APIName),
+		zap.String("cache_key", key),
+		zap.Int("size", len(response)),
+		zap.Int("stored_size", storedSize),
+		zap.Time("expires_at", expiresAt),
+		requestIDField(preparedRequest))
+}
+
+// sweep 删除已过期的条目，调用方持有锁
+func (s *shadowCache) sweep(now time.Time) {
+	for key, entry := range s.entries {
+		if now.Unix() >= entry.expiresAt {
+			delete(s.entries, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+func (s *shadowCache) report(now time.Time) *shadowReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := &shadowReport{
+		Since:       s.since.Format(time.RFC3339),
+		Hits:        s.hits,
+		Misses:      s.misses,
+		HitRatio:    hitRatio(s.hits, s.misses),
+		Bypass:      s.bypass,
+		Uncacheable: s.uncacheable,
+		Dropped:     s.dropped,
+	}
+	perAPI := make(map[string]*shadowAPIStats, len(s.perAPI))
+	for apiName, stats := range s.perAPI {
+		copied := *stats
+		copied.HitRatio = hitRatio(copied.Hits, copied.Misses)
+		perAPI[apiName] = &copied
+	}
+	for _, entry := range s.entries {
+		if now.Unix() >= entry.expiresAt {
+			continue
+		}
+		stats, ok := perAPI[entry.apiName]
+		if !ok {
+			stats = &shadowAPIStats{APIName: entry.apiName}
+			perAPI[entry.apiName] = stats
+		}
+		stats.Entries++
+		stats.EntryBytes += entry.size
+		stats.StoredBytes += entry.storedSize
+		report.Entries++
+		report.EntryBytes += entry.size
+		report.StoredBytes += entry.storedSize
+	}
+
+	report.APIs = make([]shadowAPIStats, 0, len(perAPI))
+	for _, stats := range perAPI {
+		report.APIs = append(report.APIs, *stats)
+	}
+	// 按请求次数降序，次数相同时按条目数降序
+	sort.Slice(report.APIs, func(i, j int) bool {
+		a, b := report.APIs[i], report.APIs[j]
+		if a.Hits+a.Misses != b.Hits+b.Misses {
+			return a.Hits+a.Misses > b.Hits+b.Misses
+		}
+		if a.Entries != b.Entries {
+			return a.Entries > b.Entries
+		}
+		return a.APIName < b.APIName
+	})
+	return report
+}
+
+// AdminCacheShadowHandler 返回缓存影子模式启动以来会命中/未命中的次数、命中率，
+// 以及会写入的条目数和估算的存储占用，总数和按 api_name 分别统计
+func AdminCacheShadowHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		sendErrorResponse(w, "只支持GET方法", CodeMethodNotAllowed)
+		return
+	}
+	if cacheShadow == nil {
+		sendErrorResponse(w, "缓存影子模式未开启", CodeNotFound)
+		return
+	}
+	sendAdminResponse(w, cacheShadow.report(time.Now()))
+}
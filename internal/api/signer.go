@@ -0,0 +1,62 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/config"
+)
+
+// RequestSigner 给发往 tushare 的请求添加签名等计算出来的请求头，
+// 在其他请求头都设置好之后调用，body 为请求体
+type RequestSigner interface {
+	Sign(req *http.Request, body []byte) error
+}
+
+// 全局出站请求签名，未配置时为 nil
+var requestSigner RequestSigner
+
+// SetRequestSigner 替换出站请求签名，需要配置之外的签名算法时在启动时调用，
+// 传 nil 关闭签名。SetConfig 会按配置重新设置，需在其后调用
+func SetRequestSigner(signer RequestSigner) {
+	requestSigner = signer
+}
+
+// hmacSigner 按 tushare.signing 配置做 HMAC-SHA256 签名
+type hmacSigner struct {
+	cfg config.SigningConfig
+}
+
+func newRequestSigner(cfg *config.SigningConfig) RequestSigner {
+	if cfg.Secret == "" {
+		return nil
+	}
+	return &hmacSigner{cfg: *cfg}
+}
+
+// Sign 实现 RequestSigner
+func (s *hmacSigner) Sign(req *http.Request, body []byte) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	bodyHash := sha256.Sum256(body)
+
+	mac := hmac.New(sha256.New, []byte(s.cfg.Secret))
+	mac.Write([]byte(req.Method + "\n" + req.URL.EscapedPath() + "\n" + timestamp + "\n" +
+		hex.EncodeToString(nonce) + "\n" + hex.EncodeToString(bodyHash[:])))
+
+	if s.cfg.KeyID != "" {
+		req.Header.Set(s.cfg.KeyIDHeader, s.cfg.KeyID)
+	}
+	req.Header.Set(s.cfg.TimestampHeader, timestamp)
+	req.Header.Set(s.cfg.NonceHeader, hex.EncodeToString(nonce))
+	req.Header.Set(s.cfg.SignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+	return nil
+}
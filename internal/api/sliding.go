@@ -0,0 +1,51 @@
+package api
+
+import (
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/cache"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// maybeExtendTTL 高频命中的历史数据在访问时顺延过期时间（滑动过期），
+// 剩余时间不足顺延时长一半时才重写，避免每次命中都写库
+func maybeExtendTTL(key string, entry *cache.CacheEntry, preparedRequest *PreparedRequest, now time.Time) {
+	cfg := proxyConfig.Cache
+	if cfg.SlidingMinHits <= 0 || entry.HitCount < uint64(cfg.SlidingMinHits) {
+		return
+	}
+	if !isHistoricalRequest(preparedRequest, now) {
+		return
+	}
+
+	extendBy := time.Duration(cfg.SlidingTTLSeconds) * time.Second
+	if entry.ExpiresAt > 0 && time.Unix(entry.ExpiresAt, 0).Sub(now) > extendBy/2 {
+		return
+	}
+
+	expiresAt := now.Add(extendBy)
+	if err := cacheManager.Extend(key, entry, expiresAt); err == nil {
+		logger.Debug("高频历史数据缓存已顺延",
+			zap.String("api_name", preparedRequest.APIName),
+			zap.String("cache_key", key),
+			zap.Uint64("hit_count", entry.HitCount),
+			zap.Int64("expires_at", expiresAt.Unix()),
+			requestIDField(preparedRequest))
+	}
+}
+
+// isHistoricalRequest 请求的数据日期（trade_date 或 end_date）早于今天，不会再变化
+func isHistoricalRequest(preparedRequest *PreparedRequest, now time.Time) bool {
+	today := clockAdjusted(now).Format(tushareDateLayout)
+	for _, name := range []string{"trade_date", "end_date"} {
+		if date, ok := preparedRequest.Params[name].(string); ok && date != "" {
+			if _, err := time.Parse(tushareDateLayout, date); err != nil {
+				return false
+			}
+			return date < today
+		}
+	}
+	return false
+}
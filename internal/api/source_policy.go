@@ -0,0 +1,94 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+
+	"github.com/roowe/tushareproxy/internal/config"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// sourceBypass 按请求来源强制绕过缓存的规则
+type sourceBypass struct {
+	tokens   map[string]struct{}
+	prefixes []netip.Prefix
+}
+
+// 全局来源绕过规则
+var bypassRules *sourceBypass
+
+func newSourceBypass(cfg *config.CacheConfig) *sourceBypass {
+	// 配置校验阶段已经解析过一次，这里不会出错
+	prefixes, _ := config.ParseIPRanges(cfg.BypassIPs)
+	if len(cfg.BypassTokens) == 0 && len(prefixes) == 0 {
+		return nil
+	}
+
+	rules := &sourceBypass{
+		tokens:   make(map[string]struct{}, len(cfg.BypassTokens)),
+		prefixes: prefixes,
+	}
+	for _, token := range cfg.BypassTokens {
+		if token != "" {
+			rules.tokens[token] = struct{}{}
+		}
+	}
+	return rules
+}
+
+// matches 判断请求来源是否命中绕过规则
+func (b *sourceBypass) matches(token string, r *http.Request) bool {
+	if b == nil {
+		return false
+	}
+	if _, ok := b.tokens[token]; ok && token != "" {
+		return true
+	}
+	return matchRemoteAddr(b.prefixes, r)
+}
+
+// matchRemoteAddr 请求的来源地址是否落在任一网段内
+func matchRemoteAddr(prefixes []netip.Prefix, r *http.Request) bool {
+	if len(prefixes) == 0 {
+		return false
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// applySourceBypass 命中来源规则的请求强制 no_cache，不依赖客户端自己传
+func applySourceBypass(preparedRequest *PreparedRequest, r *http.Request) {
+	if preparedRequest.Policy.NoCache || !bypassRules.matches(preparedRequest.Token, r) {
+		return
+	}
+	preparedRequest.Policy.NoCache = true
+	logger.Debug("请求来源命中缓存绕过规则",
+		zap.String("api_name", preparedRequest.APIName),
+		zap.String("remote_addr", r.RemoteAddr),
+		requestIDField(preparedRequest))
+}
+
+// wantsRefresh 客户端是否通过 X-Cache-Refresh 要求强制刷新缓存，
+// 用于已知 tushare 修正了数据（如财报重述）的场景
+func wantsRefresh(r *http.Request) bool {
+	refresh, _ := strconv.ParseBool(r.Header.Get("X-Cache-Refresh"))
+	return refresh
+}
@@ -0,0 +1,256 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// dateChunk 拆分后的子区间，End 为空表示沿用原请求不带 end_date
+type dateChunk struct {
+	Start string
+	End   string
+}
+
+// splitByYear 把跨年的请求按自然年拆分，按年份倒序排列，与 tushare 按日期倒序返回一致。
+// 按自然年对齐后，不同起止日期的请求可以共用中间整年的子请求缓存
+func splitByYear(preparedRequest *PreparedRequest, now time.Time) []dateChunk {
+	if !slices.Contains(proxyConfig.Split.APIs, preparedRequest.APIName) {
+		return nil
+	}
+
+	start, ok := preparedRequest.Params["start_date"].(string)
+	if !ok || start == "" {
+		return nil
+	}
+	startDate, err := time.Parse(tushareDateLayout, start)
+	if err != nil {
+		return nil
+	}
+
+	end, _ := preparedRequest.Params["end_date"].(string)
+	endDate := clockAdjusted(now)
+	if end != "" {
+		if endDate, err = time.Parse(tushareDateLayout, end); err != nil {
+			return nil
+		}
+	}
+	if endDate.Year() <= startDate.Year() {
+		return nil
+	}
+
+	chunks := make([]dateChunk, 0, endDate.Year()-startDate.Year()+1)
+	for year := endDate.Year(); year >= startDate.Year(); year-- {
+		chunk := dateChunk{
+			Start: fmt.Sprintf("%d0101", year),
+			End:   fmt.Sprintf("%d1231", year),
+		}
+		if year == startDate.Year() {
+			chunk.Start = start
+		}
+		if year == endDate.Year() {
+			chunk.End = end
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// newChunkRequest 生成替换了起止日期的子请求
+func newChunkRequest(preparedRequest *PreparedRequest, chunk dateChunk) (*PreparedRequest, error) {
+	overrides := map[string]interface{}{"start_date": chunk.Start}
+	if chunk.End != "" {
+		overrides["end_date"] = chunk.End
+	}
+	return preparedRequest.withParams(overrides)
+}
+
+// executeSplit 最多 concurrency 个并发执行子请求并合并结果，任一子请求失败时返回该失败
+func executeSplit(
+	ctx context.Context,
+	preparedRequest *PreparedRequest,
+	chunks []dateChunk,
+	concurrency int,
+	now time.Time,
+) (*proxyResult, *proxyError) {
+	results := make([]*proxyResult, len(chunks))
+	errs := make([]*proxyError, len(chunks))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, chunk := range chunks {
+		sub, err := newChunkRequest(preparedRequest, chunk)
+		if err != nil {
+			errs[i] = &proxyError{Code: CodeInternal, Msg: "生成拆分请求失败"}
+			logger.Error("生成拆分请求失败", zap.Error(err))
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, sub *PreparedRequest) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i], errs[i] = executeSingle(ctx, sub, nil, now)
+		}(i, sub)
+	}
+	wg.Wait()
+
+	defer func() {
+		for _, result := range results {
+			if result != nil {
+				result.Body.Close()
+			}
+		}
+	}()
+
+	for _, perr := range errs {
+		if perr != nil {
+			return nil, perr
+		}
+	}
+
+	merged, failed, err := mergeChunkResults(results)
+	if err != nil {
+		logger.Error("合并拆分请求结果失败", zap.Error(err), zap.String("api_name", preparedRequest.APIName), requestIDField(preparedRequest))
+		return nil, &proxyError{Code: CodeInternal, Msg: "合并拆分请求结果失败"}
+	}
+	if failed != nil {
+		// 子请求的错误原样返回，避免被外层 defer 关闭
+		results[slices.Index(results, failed)] = nil
+		return failed, nil
+	}
+
+	result := &proxyResult{
+		StatusCode:  http.StatusOK,
+		Body:        newBufferedBody(merged),
+		FromCache:   true,
+		CacheStatus: cacheStatusHit,
+		Namespace:   results[0].Namespace,
+	}
+	expiresKnown := true
+	for _, r := range results {
+		if !r.FromCache {
+			result.FromCache = false
+			result.CacheStatus = r.CacheStatus
+		}
+		// 全部命中缓存时，缓存年龄按最早写入的分片计算
+		if result.CachedAt.IsZero() || r.CachedAt.Before(result.CachedAt) {
+			result.CachedAt = r.CachedAt
+		}
+		// 合并结果在最早过期的分片过期后就不完整了，有分片没有写入缓存时不给出过期时间
+		if r.ExpiresAt.IsZero() {
+			expiresKnown = false
+		} else if result.ExpiresAt.IsZero() || r.ExpiresAt.Before(result.ExpiresAt) {
+			result.ExpiresAt = r.ExpiresAt
+		}
+	}
+	if !expiresKnown {
+		result.ExpiresAt = time.Time{}
+	}
+
+	logger.Info("拆分请求已合并",
+		zap.String("api_name", preparedRequest.APIName),
+		zap.Int("chunks", len(chunks)),
+		zap.Int("size", len(merged)),
+		zap.String("cache_status", result.CacheStatus),
+		requestIDField(preparedRequest))
+	return result, nil
+}
+
+// chunkData 子请求响应中需要合并的 data 部分
+type chunkData struct {
+	Fields  json.RawMessage   `json:"fields"`
+	Items   []json.RawMessage `json:"items"`
+	HasMore bool              `json:"has_more"`
+}
+
+// mergeChunkResults 按顺序合并子请求的 items，保留第一个响应的其他字段。
+// 子请求 HTTP 非 200 或 tushare code 非 0 时返回该子请求结果
+func mergeChunkResults(results []*proxyResult) ([]byte, *proxyResult, error) {
+	var top map[string]json.RawMessage
+	var dataTop map[string]json.RawMessage
+	var fields json.RawMessage
+	items := make([]json.RawMessage, 0)
+	hasMore := false
+
+	for i, result := range results {
+		if result.StatusCode != http.StatusOK {
+			return nil, result, nil
+		}
+		raw, err := result.Body.Bytes()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var resp struct {
+			Code int             `json:"code"`
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(raw, &resp); err != nil {
+			return nil, nil, fmt.Errorf("解析子请求响应失败: %w", err)
+		}
+		if resp.Code != 0 {
+			return nil, result, nil
+		}
+
+		var data chunkData
+		if len(resp.Data) > 0 && !bytes.Equal(resp.Data, []byte("null")) {
+			if err := json.Unmarshal(resp.Data, &data); err != nil {
+				return nil, nil, fmt.Errorf("解析子请求 data 失败: %w", err)
+			}
+		}
+
+		if i == 0 {
+			if err := json.Unmarshal(raw, &top); err != nil {
+				return nil, nil, err
+			}
+			if err := json.Unmarshal(resp.Data, &dataTop); err != nil || dataTop == nil {
+				dataTop = make(map[string]json.RawMessage)
+			}
+		}
+		if len(fields) == 0 && len(data.Fields) > 0 && !bytes.Equal(data.Fields, []byte("null")) {
+			fields = data.Fields
+		}
+		items = append(items, data.Items...)
+		hasMore = hasMore || data.HasMore
+	}
+
+	var err error
+	if len(fields) > 0 {
+		dataTop["fields"] = fields
+	}
+	if dataTop["items"], err = marshalRaw(items); err != nil {
+		return nil, nil, err
+	}
+	if dataTop["has_more"], err = marshalRaw(hasMore); err != nil {
+		return nil, nil, err
+	}
+	if top["data"], err = marshalRaw(dataTop); err != nil {
+		return nil, nil, err
+	}
+
+	merged, err := marshalRaw(top)
+	return merged, nil, err
+}
+
+// marshalRaw 序列化时不转义 HTML 字符，保持 tushare 原始数据不变
+func marshalRaw(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/cache"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// upstreamBody 上游响应体，小响应保存在内存，超过阈值后落盘
+type upstreamBody struct {
+	buf       bytes.Buffer
+	file      *os.File
+	size      int64
+	threshold int64
+	dir       string
+	fetchedAt time.Time
+	// 需要透传给客户端的 tushare 响应头
+	header http.Header
+
+	// stream 非空时，落盘后的数据同时写给客户端
+	stream    io.Writer
+	streaming bool
+
+	// 读取上游响应时同时计算 SHA-256，避免返回时再扫描一遍
+	hash hash.Hash
+	// 完整性校验值，还没有算出时为 nil
+	integrity *cache.Integrity
+}
+
+func newUpstreamBody(threshold int64, dir string) *upstreamBody {
+	return &upstreamBody{
+		threshold: threshold,
+		dir:       dir,
+		hash:      sha256.New(),
+	}
+}
+
+// newBufferedBody 用已有数据构造内存响应体
+func newBufferedBody(data []byte) *upstreamBody {
+	body := &upstreamBody{size: int64(len(data))}
+	body.buf = *bytes.NewBuffer(data)
+	return body
+}
+
+// Write 实现 io.Writer，内存部分超过阈值时切换到临时文件
+func (b *upstreamBody) Write(p []byte) (int, error) {
+	if b.file == nil && b.threshold > 0 && int64(b.buf.Len()+len(p)) > b.threshold {
+		if err := b.spill(); err != nil {
+			return 0, err
+		}
+	}
+
+	var n int
+	var err error
+	if b.file != nil {
+		n, err = b.file.Write(p)
+	} else {
+		n, err = b.buf.Write(p)
+	}
+	b.size += int64(n)
+	if b.hash != nil {
+		b.hash.Write(p[:n])
+	}
+
+	if b.streaming && n > 0 {
+		b.writeStream(p[:n])
+	}
+	return n, err
+}
+
+// writeStream 写给客户端，客户端断开后停止转发但继续读取上游，保证缓存完整
+func (b *upstreamBody) writeStream(p []byte) {
+	if _, err := b.stream.Write(p); err != nil {
+		logger.Warn("流式写入客户端失败，停止转发", zap.Error(err))
+		b.streaming = false
+	}
+}
+
+// spill 把已缓冲的数据写入临时文件
+func (b *upstreamBody) spill() error {
+	if err := os.MkdirAll(b.dir, 0755); err != nil {
+		return fmt.Errorf("创建落盘目录失败: %w", err)
+	}
+
+	file, err := os.CreateTemp(b.dir, "upstream-*.spool")
+	if err != nil {
+		return fmt.Errorf("创建落盘文件失败: %w", err)
+	}
+	if _, err := file.Write(b.buf.Bytes()); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return fmt.Errorf("写入落盘文件失败: %w", err)
+	}
+
+	b.file = file
+	activeSpoolFiles.Store(file.Name(), struct{}{})
+	if b.stream != nil {
+		b.streaming = true
+		b.writeStream(b.buf.Bytes())
+	}
+	b.buf = bytes.Buffer{}
+	return nil
+}
+
+// Spooled 是否已落盘
+func (b *upstreamBody) Spooled() bool {
+	return b.file != nil
+}
+
+// Streamed 是否已经流式写给客户端
+func (b *upstreamBody) Streamed() bool {
+	return b.stream != nil && b.file != nil
+}
+
+// FetchedAt 收到上游响应的时间
+func (b *upstreamBody) FetchedAt() time.Time {
+	return b.fetchedAt
+}
+
+// Size 响应体字节数
+func (b *upstreamBody) Size() int64 {
+	return b.size
+}
+
+// Reader 返回从头读取响应体的 Reader
+func (b *upstreamBody) Reader() io.Reader {
+	if b.file == nil {
+		return bytes.NewReader(b.buf.Bytes())
+	}
+	return io.NewSectionReader(b.file, 0, b.size)
+}
+
+// Bytes 返回完整响应体，落盘时会把文件读入内存
+func (b *upstreamBody) Bytes() ([]byte, error) {
+	if b.file == nil {
+		return b.buf.Bytes(), nil
+	}
+
+	data := make([]byte, b.size)
+	if _, err := b.file.ReadAt(data, 0); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("读取落盘文件失败: %w", err)
+	}
+	return data, nil
+}
+
+// Close 释放响应体，删除临时文件
+func (b *upstreamBody) Close() error {
+	if b.file == nil {
+		return nil
+	}
+
+	name := b.file.Name()
+	b.file.Close()
+	b.file = nil
+	defer activeSpoolFiles.Delete(name)
+	return os.Remove(name)
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/jobs"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// keyLister 能只遍历缓存键的缓存，内置的 CacheManager 实现了该接口
+type keyLister interface {
+	ForEachKey(fn func(key string) error) error
+}
+
+// StartStaleKeyCleanup 在后台删除其他版本缓存键规则写入的条目，启动后先清理一次，之后按间隔定期清理。
+// 这些条目已经不会被查询，只是占用空间；负载均衡后面还有旧版本实例在写入时，定期清理会持续删除它们写入的条目
+func StartStaleKeyCleanup() {
+	interval := proxyConfig.Cache.StaleKeyCleanupIntervalSeconds
+	if interval <= 0 || cacheManager == nil {
+		return
+	}
+	if _, ok := cacheManager.(keyLister); !ok {
+		return
+	}
+
+	jobs.Register(jobs.StaleKeyCleanup)
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+
+		for {
+			if !jobs.Paused(jobs.StaleKeyCleanup) {
+				cleanupStaleKeys()
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// cleanupStaleKeys 先收集其他版本的键再逐个删除，不在遍历过程中修改存储
+func cleanupStaleKeys() {
+	var stale []string
+	err := cacheManager.(keyLister).ForEachKey(func(key string) error {
+		if cacheKeys.StaleKey(key) {
+			stale = append(stale, key)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("遍历缓存键失败", zap.Error(err))
+		return
+	}
+	if len(stale) == 0 {
+		return
+	}
+
+	deleted := 0
+	for _, key := range stale {
+		// 关闭过程中会暂停后台任务，及时停下
+		if jobs.Paused(jobs.StaleKeyCleanup) {
+			break
+		}
+		if err := cacheManager.Delete(key); err != nil {
+			break
+		}
+		deleted++
+	}
+	logger.Info("已清理旧版本缓存键",
+		zap.Int("key_version", cacheKeys.KeyVersion()),
+		zap.Int("stale", len(stale)),
+		zap.Int("deleted", deleted))
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// 区间索引的记录键前缀，按 命名空间 + api_name + 除起止日期外的参数 + fields 分组
+const rangeIndexPrefix = "!range/"
+
+// 每组最多记录的已缓存子区间数，超过时丢弃最早过期的
+const maxRangeSegments = 64
+
+// recordStore 能保存辅助记录的缓存，内置的 CacheManager 实现了该接口
+type recordStore interface {
+	GetRecord(key string) ([]byte, bool, error)
+	PutRecord(key string, data []byte, ttl time.Duration) error
+}
+
+// rangeSegment 已缓存的日期区间，首尾都包含
+type rangeSegment struct {
+	Start     string `json:"start"`
+	End       string `json:"end"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// 同一进程内区间索引的读改写互斥，多实例共用 redis 时偶尔丢失的子区间只影响拼接命中
+var rangeIndexMu sync.Mutex
+
+// stitchRange 返回请求的起止日期，请求不适合拼接时 ok 为 false
+func stitchRange(preparedRequest *PreparedRequest, now time.Time) (start, end string, ok bool) {
+	if !slices.Contains(proxyConfig.Stitch.APIs, preparedRequest.APIName) {
+		return "", "", false
+	}
+	if _, supported := cacheManager.(recordStore); !supported {
+		return "", "", false
+	}
+	if preparedRequest.Policy.NoCache || preparedRequest.Refresh || uncacheableReason(preparedRequest, now) != "" {
+		return "", "", false
+	}
+
+	start, _ = preparedRequest.Params["start_date"].(string)
+	end, _ = preparedRequest.Params["end_date"].(string)
+	if _, err := time.Parse(tushareDateLayout, start); err != nil {
+		return "", "", false
+	}
+	if _, err := time.Parse(tushareDateLayout, end); err != nil {
+		return "", "", false
+	}
+	return start, end, start <= end
+}
+
+// rangeIndexKey 区间索引的记录键
+func rangeIndexKey(preparedRequest *PreparedRequest) string {
+	params := make(map[string]interface{}, len(preparedRequest.Params))
+	for name, value := range preparedRequest.Params {
+		if name != "start_date" && name != "end_date" {
+			params[name] = value
+		}
+	}
+
+	// json.Marshal 对 map 按键名排序，参数顺序不同的请求属于同一组
+	identity := map[string]interface{}{
+		"namespace": preparedRequest.Policy.ResolvedNamespace(cacheKeys.DefaultNamespace()),
+		"api_name":  preparedRequest.APIName,
+		"params":    params,
+		"fields":    preparedRequest.Fields,
+	}
+	// 缓存键版本变化后分段对应的条目都已失效，索引也随之换一个。版本 1 不加，与之前的索引兼容
+	if version := cacheKeys.KeyVersion(); version > 1 {
+		identity["key_version"] = version
+	}
+	encoded, _ := json.Marshal(identity)
+	hash := sha256.Sum256(encoded)
+	return rangeIndexPrefix + hex.EncodeToString(hash[:16])
+}
+
+// loadRangeSegments 读取未过期的已缓存子区间
+func loadRangeSegments(store recordStore, key string, now time.Time) []rangeSegment {
+	data, found, err := store.GetRecord(key)
+	if err != nil {
+		logger.Warn("读取区间索引失败", zap.String("key", key), zap.Error(err))
+		return nil
+	}
+	if !found {
+		return nil
+	}
+
+	var segments []rangeSegment
+	if err := json.Unmarshal(data, &segments); err != nil {
+		logger.Warn("解析区间索引失败", zap.String("key", key), zap.Error(err))
+		return nil
+	}
+	return slices.DeleteFunc(segments, func(s rangeSegment) bool {
+		return s.ExpiresAt <= now.Unix()
+	})
+}
+
+// registerRangeSegment 记录刚写入缓存的区间请求，供之后覆盖该区间的请求拼接。
+// 被 tushare 截断（has_more）的结果不完整，不记录
+func registerRangeSegment(preparedRequest *PreparedRequest, summary *tushareResultSummary, expiresAt time.Time, now time.Time) {
+	start, end, ok := stitchRange(preparedRequest, now)
+	if !ok || summary.HasMore {
+		return
+	}
+	store := cacheManager.(recordStore)
+	key := rangeIndexKey(preparedRequest)
+
+	rangeIndexMu.Lock()
+	defer rangeIndexMu.Unlock()
+
+	segments := slices.DeleteFunc(loadRangeSegments(store, key, now), func(s rangeSegment) bool {
+		return s.Start == start && s.End == end
+	})
+	segments = append(segments, rangeSegment{Start: start, End: end, ExpiresAt: expiresAt.Unix()})
+	if len(segments) > maxRangeSegments {
+		sort.Slice(segments, func(i, j int) bool { return segments[i].ExpiresAt > segments[j].ExpiresAt })
+		segments = segments[:maxRangeSegments]
+	}
+
+	latest := int64(0)
+	for _, s := range segments {
+		latest = max(latest, s.ExpiresAt)
+	}
+	data, err := json.Marshal(segments)
+	if err != nil {
+		return
+	}
+	if err := store.PutRecord(key, data, time.Unix(latest, 0).Sub(now)); err != nil {
+		logger.Warn("写入区间索引失败", zap.String("key", key), zap.Error(err))
+	}
+}
+
+// planStitch 用已缓存的子区间覆盖请求区间，返回按日期倒序排列的子请求区间，
+// 与 tushare 按日期倒序返回一致。没有可用的子区间或请求本身已缓存时返回 nil
+func planStitch(preparedRequest *PreparedRequest, now time.Time) []dateChunk {
+	start, end, ok := stitchRange(preparedRequest, now)
+	if !ok {
+		return nil
+	}
+	segments := loadRangeSegments(cacheManager.(recordStore), rangeIndexKey(preparedRequest), now)
+
+	// 只使用完全落在请求区间内的子区间，按开始日期升序、同一开始日期较长的优先
+	segments = slices.DeleteFunc(segments, func(s rangeSegment) bool {
+		return s.Start < start || s.End > end
+	})
+	sort.Slice(segments, func(i, j int) bool {
+		if segments[i].Start != segments[j].Start {
+			return segments[i].Start < segments[j].Start
+		}
+		return segments[i].End > segments[j].End
+	})
+
+	var chunks []dateChunk
+	cached := 0
+	cursor := start
+	for _, s := range segments {
+		if cached >= proxyConfig.Stitch.MaxSegments {
+			break
+		}
+		if s.Start < cursor {
+			continue
+		}
+		if s.Start == start && s.End == end {
+			// 请求本身已缓存，直接按缓存键命中
+			return nil
+		}
+		if s.Start > cursor {
+			chunks = append(chunks, dateChunk{Start: cursor, End: shiftDate(s.Start, -1)})
+		}
+		chunks = append(chunks, dateChunk{Start: s.Start, End: s.End})
+		cached++
+		cursor = shiftDate(s.End, 1)
+	}
+	if cached == 0 {
+		return nil
+	}
+	if cursor <= end {
+		chunks = append(chunks, dateChunk{Start: cursor, End: end})
+	}
+	slices.Reverse(chunks)
+
+	logger.Info("按已缓存的子区间拼接请求",
+		zap.String("api_name", preparedRequest.APIName),
+		zap.String("start_date", start),
+		zap.String("end_date", end),
+		zap.Int("cached_segments", cached),
+		zap.Int("missing_segments", len(chunks)-cached),
+		requestIDField(preparedRequest))
+	return chunks
+}
+
+// shiftDate 把 YYYYMMDD 日期前后移动若干天，调用方保证日期合法
+func shiftDate(date string, days int) string {
+	t, _ := time.Parse(tushareDateLayout, date)
+	return t.AddDate(0, 0, days).Format(tushareDateLayout)
+}
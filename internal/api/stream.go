@@ -0,0 +1,67 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+)
+
+// streamingResponse 首次写入时才发送响应头，用于边读上游边返回给客户端
+type streamingResponse struct {
+	w          http.ResponseWriter
+	r          *http.Request
+	statusCode int
+	out        io.Writer
+	gz         *gzip.Writer
+
+	// 需要透传给客户端的 tushare 响应头
+	header http.Header
+}
+
+func newStreamingResponse(w http.ResponseWriter, r *http.Request) *streamingResponse {
+	return &streamingResponse{
+		w: w,
+		r: r,
+	}
+}
+
+// Write 实现 io.Writer
+func (s *streamingResponse) Write(p []byte) (int, error) {
+	if s.out == nil {
+		s.start()
+	}
+	return s.out.Write(p)
+}
+
+// start 发送响应头，流式响应大小未知，客户端支持时直接压缩
+func (s *streamingResponse) start() {
+	s.out = s.w
+	copyResponseHeaders(s.w.Header(), s.header)
+	// 完整性校验头要等响应读完才能算出来
+	s.w.Header().Set("Trailer", headerRowCount+", "+headerBodySHA256)
+	if proxyConfig.Compression.Enabled && acceptsGzip(s.r.Header.Get("Accept-Encoding")) {
+		s.w.Header().Set("Content-Encoding", "gzip")
+		s.w.Header().Add("Vary", "Accept-Encoding")
+		s.gz = gzipWriterPool.Get().(*gzip.Writer)
+		s.gz.Reset(s.w)
+		s.out = s.gz
+	}
+	s.w.WriteHeader(s.statusCode)
+}
+
+// Started 是否已经开始向客户端写响应
+func (s *streamingResponse) Started() bool {
+	return s.out != nil
+}
+
+// Close 结束流式响应
+func (s *streamingResponse) Close() error {
+	if s.gz == nil {
+		return nil
+	}
+
+	err := s.gz.Close()
+	gzipWriterPool.Put(s.gz)
+	s.gz = nil
+	return err
+}
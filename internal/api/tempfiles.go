@@ -0,0 +1,131 @@
+package api
+
+import (
+	"expvar"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/jobs"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// 定期清理时只删除修改时间早于该时长的文件，避免误删刚创建、还没登记的文件
+const tempFileGrace = time.Minute
+
+// 正在使用的落盘文件，定期清理时跳过
+var activeSpoolFiles sync.Map
+
+// 启动以来清理掉的临时文件数和字节数
+var (
+	removedTempFiles atomic.Int64
+	removedTempBytes atomic.Int64
+)
+
+func init() {
+	expvar.Publish("tushareproxy_temp_files", expvar.Func(func() interface{} {
+		active := 0
+		activeSpoolFiles.Range(func(_, _ interface{}) bool {
+			active++
+			return true
+		})
+		return map[string]int64{
+			"active_spool_files": int64(active),
+			"removed_files":      removedTempFiles.Load(),
+			"removed_bytes":      removedTempBytes.Load(),
+		}
+	}))
+}
+
+// StartTempFileCleanup 启动时清理上次进程遗留的落盘文件和录制临时文件，之后按间隔定期清理
+func StartTempFileCleanup() {
+	cleanupTempFiles(true)
+
+	interval := proxyConfig.Spool.CleanupIntervalSeconds
+	if interval <= 0 {
+		return
+	}
+	jobs.Register(jobs.TempCleanup)
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if jobs.Paused(jobs.TempCleanup) {
+				continue
+			}
+			cleanupTempFiles(false)
+		}
+	}()
+}
+
+// cleanupTempFiles 删除没有在使用的临时文件。启动时目录中的临时文件都属于上次进程，全部删除
+func cleanupTempFiles(startup bool) {
+	cutoff := time.Now().Add(-tempFileGrace)
+	if startup {
+		cutoff = time.Now()
+	}
+
+	var files, size int64
+	remove := func(path string, info fs.FileInfo) {
+		if info.ModTime().After(cutoff) {
+			return
+		}
+		if err := os.Remove(path); err != nil {
+			if !os.IsNotExist(err) {
+				logger.Warn("删除临时文件失败", zap.String("path", path), zap.Error(err))
+			}
+			return
+		}
+		files++
+		size += info.Size()
+	}
+
+	// 落盘文件直接放在落盘目录下
+	entries, err := os.ReadDir(proxyConfig.Spool.Dir)
+	if err != nil && !os.IsNotExist(err) {
+		logger.Warn("读取落盘目录失败", zap.String("dir", proxyConfig.Spool.Dir), zap.Error(err))
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, "upstream-") || !strings.HasSuffix(name, ".spool") {
+			continue
+		}
+		path := filepath.Join(proxyConfig.Spool.Dir, name)
+		if _, active := activeSpoolFiles.Load(path); active {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			remove(path, info)
+		}
+	}
+
+	// 录制文件先写 <hash>.json.tmp 再改名，写到一半退出会留下 .tmp
+	if fixtureStore != nil {
+		filepath.WalkDir(proxyConfig.Fixture.Dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() || !strings.HasSuffix(path, ".json.tmp") {
+				return nil
+			}
+			if info, err := entry.Info(); err == nil {
+				remove(path, info)
+			}
+			return nil
+		})
+	}
+
+	if files == 0 {
+		return
+	}
+	removedTempFiles.Add(files)
+	removedTempBytes.Add(size)
+	logger.Info("已清理遗留的临时文件",
+		zap.Bool("startup", startup),
+		zap.Int64("files", files),
+		zap.Int64("bytes", size))
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ProbeToken 用 token 查询当天的 trade_cal，检查 token 是否可用。
+// 不走缓存和本地限流，返回 tushare 的 code 和 msg
+func ProbeToken(token string) (int, string, error) {
+	today := clockAdjusted(time.Now()).Format(tushareDateLayout)
+	body, err := json.Marshal(map[string]interface{}{
+		"api_name": "trade_cal",
+		"token":    token,
+		"params": map[string]string{
+			"start_date": today,
+			"end_date":   today,
+		},
+		"fields": "cal_date,is_open",
+	})
+	if err != nil {
+		return 0, "", err
+	}
+
+	preparedRequest, err := parseIncomingRequest(body)
+	if err != nil {
+		return 0, "", err
+	}
+	// 转发给主代理时也不能用缓存应答
+	preparedRequest.Policy.NoCache = true
+
+	upstream, statusCode, err := forwardRawRequestToTushareAPI(preparedRequest, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	defer upstream.Close()
+
+	if statusCode != http.StatusOK {
+		return 0, "", fmt.Errorf("tushare API返回HTTP %d", statusCode)
+	}
+	summary, err := inspectTushareResult(upstream.Reader())
+	if err != nil {
+		return 0, "", fmt.Errorf("解析tushare API响应失败: %w", err)
+	}
+	return summary.Code, summary.Msg, nil
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/config"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// StartWarmup 在后台依次执行预热清单，已缓存的请求直接命中，不重复访问 tushare。
+// 需在缓存和交易日历初始化之后调用，不阻塞服务启动
+func StartWarmup() {
+	cfg := proxyConfig.Warmup
+	if len(cfg.Requests) == 0 || cacheManager == nil {
+		return
+	}
+
+	go runPreload(context.Background(), preloadBatch{
+		name:        "warmup",
+		token:       cfg.Token,
+		concurrency: cfg.Concurrency,
+		requests:    cfg.Requests,
+	}, time.Now())
+	logger.Info("启动预热已开始",
+		zap.Int("requests", len(cfg.Requests)),
+		zap.Int("concurrency", cfg.Concurrency))
+}
+
+// preloadBatch 一组由代理自己发起、只为写入缓存的请求，启动预热和定时预取共用
+type preloadBatch struct {
+	name        string
+	token       string
+	concurrency int
+	requests    []config.PreloadRequest
+	// 跳过缓存读取，回源后覆盖已有条目
+	refresh bool
+}
+
+func runPreload(ctx context.Context, batch preloadBatch, now time.Time) {
+	var hit, fetched, failed atomic.Int64
+	sem := make(chan struct{}, batch.concurrency)
+	var wg sync.WaitGroup
+
+	for _, request := range batch.requests {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			cacheStatus, err := preloadRequest(ctx, batch, request, now)
+			switch {
+			case err != nil:
+				failed.Add(1)
+				logger.Warn("预热请求失败",
+					zap.String("batch", batch.name),
+					zap.String("api_name", request.APIName),
+					zap.Error(err))
+			case cacheStatus == cacheStatusHit || cacheStatus == cacheStatusCalendar:
+				hit.Add(1)
+			default:
+				fetched.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	logger.Info("预热完成",
+		zap.String("batch", batch.name),
+		zap.Int("requests", len(batch.requests)),
+		zap.Int64("already_cached", hit.Load()),
+		zap.Int64("fetched", fetched.Load()),
+		zap.Int64("failed", failed.Load()),
+		zap.Duration("duration", time.Since(now)))
+}
+
+// preloadRequest 执行单个预热请求，返回缓存状态
+func preloadRequest(ctx context.Context, batch preloadBatch, request config.PreloadRequest, now time.Time) (string, error) {
+	payload := map[string]interface{}{
+		"api_name": request.APIName,
+		"token":    batch.token,
+		"params":   expandPreloadParams(request.Params, now),
+	}
+	if request.Fields != "" {
+		payload["fields"] = request.Fields
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	preparedRequest, err := parseIncomingRequest(body)
+	if err != nil {
+		return "", err
+	}
+	preparedRequest.Refresh = batch.refresh
+
+	result, perr := dispatchRequest(ctx, preparedRequest, nil, now)
+	if perr != nil {
+		return "", perr
+	}
+	defer result.Body.Close()
+
+	// 返回错误码的请求不会写入缓存，按失败统计
+	if result.CacheStatus != cacheStatusHit && result.CacheStatus != cacheStatusCalendar {
+		summary, err := inspectTushareResult(result.Body.Reader())
+		if err != nil {
+			return "", err
+		}
+		if summary.Code != 0 {
+			return "", &proxyError{Code: summary.Code, Msg: summary.Msg}
+		}
+	}
+
+	logger.Debug("预热请求完成",
+		zap.String("batch", batch.name),
+		zap.String("api_name", preparedRequest.APIName),
+		zap.String("cache_key", result.CacheKey),
+		zap.String("cache_status", result.CacheStatus))
+	return result.CacheStatus, nil
+}
+
+// expandPreloadParams 替换参数中的日期占位符
+func expandPreloadParams(params map[string]interface{}, now time.Time) map[string]interface{} {
+	now = clockAdjusted(now)
+	replacer := strings.NewReplacer(
+		"{today}", now.Format(tushareDateLayout),
+		"{yesterday}", now.AddDate(0, 0, -1).Format(tushareDateLayout),
+	)
+
+	expanded := make(map[string]interface{}, len(params))
+	for name, value := range params {
+		if s, ok := value.(string); ok {
+			value = replacer.Replace(s)
+		}
+		expanded[name] = value
+	}
+	return expanded
+}
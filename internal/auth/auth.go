@@ -0,0 +1,119 @@
+// Package auth 客户端鉴权。内置 static（固定 API key）、htpasswd（密码文件）和
+// oidc（token introspection）三种方式，接入其他身份系统时实现 Provider 即可
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/roowe/tushareproxy/internal/config"
+)
+
+// ErrUnauthenticated 没有携带凭证或凭证无效
+var ErrUnauthenticated = errors.New("客户端鉴权失败")
+
+// Identity 鉴权通过的调用方
+type Identity struct {
+	Provider string
+	Subject  string
+}
+
+// Provider 客户端鉴权方式
+type Provider interface {
+	Name() string
+	// Authenticate 校验请求携带的凭证。凭证缺失或无效时返回 ErrUnauthenticated，
+	// 鉴权服务本身不可用时返回其他错误
+	Authenticate(r *http.Request) (*Identity, error)
+}
+
+// New 按配置创建鉴权方式，provider 为 none 时返回 nil
+func New(cfg *config.AuthConfig) (Provider, error) {
+	switch cfg.Provider {
+	case config.AuthProviderNone, "":
+		return nil, nil
+	case config.AuthProviderStatic:
+		return newStaticProvider(cfg.Keys), nil
+	case config.AuthProviderHtpasswd:
+		return newHtpasswdProvider(cfg.HtpasswdFile)
+	case config.AuthProviderOIDC:
+		return newOIDCProvider(&cfg.OIDC), nil
+	default:
+		return nil, fmt.Errorf("不支持的客户端鉴权方式: %q", cfg.Provider)
+	}
+}
+
+type identityKey struct{}
+
+// WithIdentity 把调用方放入请求上下文
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFrom 取出请求上下文中的调用方，未鉴权时返回 nil
+func IdentityFrom(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(identityKey{}).(*Identity)
+	return identity
+}
+
+// bearerToken 读取 Authorization: Bearer <token> 或 X-Api-Key
+func bearerToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return strings.TrimSpace(r.Header.Get("X-Api-Key"))
+}
+
+// maskKey 日志和调用方标识中只保留 key 的前 4 位
+func maskKey(key string) string {
+	if len(key) <= 4 {
+		return "****"
+	}
+	return key[:4] + "****"
+}
+
+// staticProvider 固定 API key 鉴权
+type staticProvider struct {
+	// 比较 key 的摘要，各 key 长度不同时比较耗时也一样
+	digests [][sha256.Size]byte
+	keys    []string
+}
+
+func newStaticProvider(keys []string) *staticProvider {
+	p := &staticProvider{}
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		p.digests = append(p.digests, sha256.Sum256([]byte(key)))
+		p.keys = append(p.keys, key)
+	}
+	return p
+}
+
+// Name 实现 Provider
+func (p *staticProvider) Name() string {
+	return config.AuthProviderStatic
+}
+
+// Authenticate 实现 Provider，逐个比较所有 key，不因提前匹配泄露耗时
+func (p *staticProvider) Authenticate(r *http.Request) (*Identity, error) {
+	token := bearerToken(r)
+	if token == "" {
+		return nil, ErrUnauthenticated
+	}
+
+	digest := sha256.Sum256([]byte(token))
+	matched := -1
+	for i := range p.digests {
+		if subtle.ConstantTimeCompare(digest[:], p.digests[i][:]) == 1 {
+			matched = i
+		}
+	}
+	if matched < 0 {
+		return nil, ErrUnauthenticated
+	}
+	return &Identity{Provider: p.Name(), Subject: maskKey(p.keys[matched])}, nil
+}
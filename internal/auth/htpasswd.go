@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/config"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// htpasswdProvider Apache htpasswd 密码文件鉴权，使用 HTTP Basic 认证。
+// 支持 bcrypt（htpasswd -B）、apr1 MD5（htpasswd 默认）和 {SHA}，文件修改后自动重新加载
+type htpasswdProvider struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	users   map[string]string
+	// 校验通过的密码摘要，bcrypt 每次校验要几十毫秒，同一个密码不重复计算；文件重新加载时清空
+	verified map[string][sha256.Size]byte
+}
+
+func newHtpasswdProvider(path string) (*htpasswdProvider, error) {
+	p := &htpasswdProvider{path: path}
+	if err := p.reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Name 实现 Provider
+func (p *htpasswdProvider) Name() string {
+	return config.AuthProviderHtpasswd
+}
+
+// Authenticate 实现 Provider
+func (p *htpasswdProvider) Authenticate(r *http.Request) (*Identity, error) {
+	user, password, ok := r.BasicAuth()
+	if !ok || user == "" {
+		return nil, ErrUnauthenticated
+	}
+
+	if err := p.reload(); err != nil {
+		// 保留上次加载的内容继续使用
+		logger.Warn("重新加载 htpasswd 文件失败", zap.String("path", p.path), zap.Error(err))
+	}
+
+	digest := sha256.Sum256([]byte(password))
+
+	p.mu.Lock()
+	hash, found := p.users[user]
+	cached, hasCached := p.verified[user]
+	p.mu.Unlock()
+
+	if !found {
+		return nil, ErrUnauthenticated
+	}
+	if hasCached && subtle.ConstantTimeCompare(cached[:], digest[:]) == 1 {
+		return &Identity{Provider: p.Name(), Subject: user}, nil
+	}
+	if !verifyHtpasswd(hash, password) {
+		return nil, ErrUnauthenticated
+	}
+
+	p.mu.Lock()
+	// 期间文件可能已经重新加载，只在用户的哈希没变时记录
+	if p.users[user] == hash {
+		p.verified[user] = digest
+	}
+	p.mu.Unlock()
+	return &Identity{Provider: p.Name(), Subject: user}, nil
+}
+
+// reload 文件修改时间变化时重新加载
+func (p *htpasswdProvider) reload() error {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return fmt.Errorf("读取 htpasswd 文件失败: %w", err)
+	}
+
+	p.mu.Lock()
+	unchanged := p.users != nil && info.ModTime().Equal(p.modTime)
+	p.mu.Unlock()
+	if unchanged {
+		return nil
+	}
+
+	users, err := loadHtpasswd(p.path)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.users = users
+	p.verified = make(map[string][sha256.Size]byte)
+	p.modTime = info.ModTime()
+	p.mu.Unlock()
+
+	logger.Info("htpasswd 文件已加载", zap.String("path", p.path), zap.Int("users", len(users)))
+	return nil
+}
+
+// loadHtpasswd 解析 user:hash 格式的密码文件，忽略空行和 # 开头的注释
+func loadHtpasswd(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取 htpasswd 文件失败: %w", err)
+	}
+	defer f.Close()
+
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" || hash == "" {
+			return nil, fmt.Errorf("htpasswd 文件第 %d 行格式错误", lineNo)
+		}
+		if !supportedHtpasswdHash(hash) {
+			return nil, fmt.Errorf("htpasswd 文件第 %d 行（用户 %s）的密码格式不支持，请使用 bcrypt、apr1 或 SHA", lineNo, user)
+		}
+		users[user] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取 htpasswd 文件失败: %w", err)
+	}
+	return users, nil
+}
+
+func supportedHtpasswdHash(hash string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$", "$apr1$", "{SHA}"} {
+		if strings.HasPrefix(hash, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyHtpasswd 按哈希格式校验密码
+func verifyHtpasswd(hash, password string) bool {
+	switch {
+	case strings.HasPrefix(hash, "$2"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	case strings.HasPrefix(hash, "$apr1$"):
+		salt, _, _ := strings.Cut(strings.TrimPrefix(hash, "$apr1$"), "$")
+		return subtle.ConstantTimeCompare([]byte(apr1Crypt(password, salt)), []byte(hash)) == 1
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		expected := "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+		return subtle.ConstantTimeCompare([]byte(expected), []byte(hash)) == 1
+	}
+	return false
+}
+
+// apr1Crypt Apache 的 MD5 crypt 变体，与 htpasswd -m 的结果一致
+func apr1Crypt(password, salt string) string {
+	const magic = "$apr1$"
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	pw := []byte(password)
+	s := []byte(salt)
+
+	alt := md5.New()
+	alt.Write(pw)
+	alt.Write(s)
+	alt.Write(pw)
+	altSum := alt.Sum(nil)
+
+	h := md5.New()
+	h.Write(pw)
+	h.Write([]byte(magic))
+	h.Write(s)
+	for i := len(pw); i > 0; i -= 16 {
+		h.Write(altSum[:min(i, 16)])
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 == 1 {
+			h.Write([]byte{0})
+		} else {
+			h.Write(pw[:1])
+		}
+	}
+	sum := h.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		round := md5.New()
+		if i&1 == 1 {
+			round.Write(pw)
+		} else {
+			round.Write(sum)
+		}
+		if i%3 != 0 {
+			round.Write(s)
+		}
+		if i%7 != 0 {
+			round.Write(pw)
+		}
+		if i&1 == 1 {
+			round.Write(sum)
+		} else {
+			round.Write(pw)
+		}
+		sum = round.Sum(nil)
+	}
+
+	const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	out := make([]byte, 0, 22)
+	encode := func(a, b, c byte, n int) {
+		v := uint(a)<<16 | uint(b)<<8 | uint(c)
+		for ; n > 0; n-- {
+			out = append(out, itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+	encode(sum[0], sum[6], sum[12], 4)
+	encode(sum[1], sum[7], sum[13], 4)
+	encode(sum[2], sum[8], sum[14], 4)
+	encode(sum[3], sum[9], sum[15], 4)
+	encode(sum[4], sum[10], sum[5], 4)
+	encode(0, 0, sum[11], 2)
+
+	return magic + salt + "$" + string(out)
+}
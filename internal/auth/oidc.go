@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/config"
+)
+
+// 校验结果缓存的最大条目数，超过时先清理过期条目，仍超过则清空
+const oidcCacheMaxEntries = 10000
+
+// oidcProvider 通过 OAuth2 token introspection（RFC 7662）校验 Bearer 令牌，
+// 校验结果按令牌摘要缓存，避免每个请求都访问身份服务
+type oidcProvider struct {
+	cfg    *config.OIDCConfig
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]oidcCacheEntry
+}
+
+type oidcCacheEntry struct {
+	identity  *Identity
+	expiresAt time.Time
+}
+
+// introspectionResponse RFC 7662 响应中用到的字段
+type introspectionResponse struct {
+	Active   bool   `json:"active"`
+	Subject  string `json:"sub"`
+	Username string `json:"username"`
+	ClientID string `json:"client_id"`
+	Scope    string `json:"scope"`
+	Exp      int64  `json:"exp"`
+}
+
+func newOIDCProvider(cfg *config.OIDCConfig) *oidcProvider {
+	return &oidcProvider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: time.Duration(cfg.TimeoutSeconds) * time.Second},
+		cache:  make(map[[sha256.Size]byte]oidcCacheEntry),
+	}
+}
+
+// Name 实现 Provider
+func (p *oidcProvider) Name() string {
+	return config.AuthProviderOIDC
+}
+
+// Authenticate 实现 Provider。只缓存有效的令牌，无效令牌每次都重新校验
+func (p *oidcProvider) Authenticate(r *http.Request) (*Identity, error) {
+	token := bearerToken(r)
+	if token == "" {
+		return nil, ErrUnauthenticated
+	}
+
+	digest := sha256.Sum256([]byte(token))
+	now := time.Now()
+
+	p.mu.Lock()
+	entry, ok := p.cache[digest]
+	p.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.identity, nil
+	}
+
+	result, err := p.introspect(r, token)
+	if err != nil {
+		return nil, err
+	}
+	if !result.Active {
+		return nil, ErrUnauthenticated
+	}
+	if result.Exp > 0 && !now.Before(time.Unix(result.Exp, 0)) {
+		return nil, ErrUnauthenticated
+	}
+	if p.cfg.RequiredScope != "" && !slices.Contains(strings.Fields(result.Scope), p.cfg.RequiredScope) {
+		return nil, ErrUnauthenticated
+	}
+
+	subject := result.Subject
+	if subject == "" {
+		subject = result.Username
+	}
+	if subject == "" {
+		subject = result.ClientID
+	}
+	identity := &Identity{Provider: p.Name(), Subject: subject}
+
+	expiresAt := now.Add(time.Duration(p.cfg.CacheSeconds) * time.Second)
+	if result.Exp > 0 && time.Unix(result.Exp, 0).Before(expiresAt) {
+		expiresAt = time.Unix(result.Exp, 0)
+	}
+	if expiresAt.After(now) {
+		p.store(digest, oidcCacheEntry{identity: identity, expiresAt: expiresAt}, now)
+	}
+	return identity, nil
+}
+
+// introspect 调用身份服务校验令牌，身份服务不可用时返回的错误不是 ErrUnauthenticated
+func (p *oidcProvider) introspect(r *http.Request, token string) (*introspectionResponse, error) {
+	form := url.Values{
+		"token":           {token},
+		"token_type_hint": {"access_token"},
+	}
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, p.cfg.IntrospectionURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("创建 introspection 请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求 introspection 接口失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("读取 introspection 响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection 接口返回状态码 %d", resp.StatusCode)
+	}
+
+	var result introspectionResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("解析 introspection 响应失败: %w", err)
+	}
+	return &result, nil
+}
+
+func (p *oidcProvider) store(digest [sha256.Size]byte, entry oidcCacheEntry, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.cache) >= oidcCacheMaxEntries {
+		for key, cached := range p.cache {
+			if !now.Before(cached.expiresAt) {
+				delete(p.cache, key)
+			}
+		}
+		if len(p.cache) >= oidcCacheMaxEntries {
+			clear(p.cache)
+		}
+	}
+	p.cache[digest] = entry
+}
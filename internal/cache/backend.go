@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// 缓存存储类型
+const (
+	BackendBadger = "badger"
+	BackendRedis  = "redis"
+)
+
+var (
+	// errNotFound 条目不存在或已过期
+	errNotFound = errors.New("缓存条目不存在")
+	// errTombstoned 键处于手动失效的墓碑期，跳过写入
+	errTombstoned = errors.New("缓存键处于墓碑期")
+	// errStale 已缓存的条目比要写入的更新，跳过写入
+	errStale = errors.New("已有更新的缓存条目")
+	// errCorrupt 条目的响应体与校验和不一致或无法解压
+	errCorrupt = errors.New("缓存条目已损坏")
+)
+
+// entryAccess 条目的访问情况，与条目同时过期
+type entryAccess struct {
+	hits uint64
+	// 最近一次命中的时间（unix 秒），写入后还没有命中过为 0
+	lastAccess int64
+}
+
+// backend 缓存条目的底层存储，保存序列化后的 CacheEntry。
+// 命中计数和墓碑由各存储自己保存，命中计数与条目同时过期
+type backend interface {
+	name() string
+	// get 读取条目，不存在时返回 errNotFound
+	get(key string) ([]byte, error)
+	// set 写入条目并把命中计数归零。墓碑期内返回 errTombstoned，
+	// 已缓存条目的上游响应时间比 fetchedAtMs 晚时返回 errStale
+	set(key string, data []byte, fetchedAtMs int64, ttl time.Duration) error
+	// extend 已缓存条目的上游响应时间仍为 fetchedAtMs 时重新写入，命中计数随之延长；
+	// 条目已被重新写入时不处理
+	extend(key string, data []byte, fetchedAtMs int64, ttl time.Duration) error
+	// delete 删除条目和命中计数
+	delete(key string) error
+	// invalidate 删除条目和命中计数，并写入 ttl 时长的墓碑
+	invalidate(key string, ttl time.Duration) error
+	// addHits 批量累加命中次数并记录最近命中时间，条目已不存在的键跳过
+	addHits(batch []hitDelta) error
+	// inspect 读取条目的访问情况和墓碑剩余时长（不在墓碑期时为 0），不累加命中次数
+	inspect(key string) (access entryAccess, tombstoneTTL time.Duration, err error)
+	// forEach 遍历所有条目，跳过命中计数、墓碑等以 ! 开头的内部键
+	forEach(fn func(key string, data []byte, access entryAccess) error) error
+	// putRecord 写入不参与缓存逻辑的辅助记录，键以 ! 开头，读取用 get
+	putRecord(key string, data []byte, ttl time.Duration) error
+	// scanRecords 遍历指定前缀的辅助记录
+	scanRecords(prefix string, fn func(key string, data []byte) error) error
+	close() error
+}
+
+// decodeFetchedAtMs 只解析条目的上游响应时间
+func decodeFetchedAtMs(data []byte) (int64, error) {
+	var meta struct {
+		FetchedAtMs int64 `json:"fetched_at_ms"`
+	}
+	err := json.Unmarshal(data, &meta)
+	return meta.FetchedAtMs, err
+}
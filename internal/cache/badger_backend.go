@@ -0,0 +1,358 @@
+package cache
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// badgerBackend 本地 Badger 存储
+type badgerBackend struct {
+	// 只读副本会定期重新打开快照目录，用原子指针切换
+	db atomic.Pointer[badger.DB]
+}
+
+func newBadgerBackend(db *badger.DB) *badgerBackend {
+	b := &badgerBackend{}
+	if db != nil {
+		b.db.Store(db)
+	}
+	return b
+}
+
+// 开启静态加密时的索引缓存大小，Badger 建议加密时设置，避免每次读取都解密索引
+const encryptedIndexCacheSize = 100 << 20
+
+// openDB 打开 Badger，encryptionKey 非空时开启静态加密。
+// 数据用按周期轮换的数据密钥加密，数据密钥再用 encryptionKey 加密保存在 KEYREGISTRY 文件中
+func openDB(dbPath string, encryptionKey []byte) (*badger.DB, error) {
+	// 配置BadgerDB选项
+	opts := badger.DefaultOptions(dbPath)
+	opts.Logger = nil // 禁用BadgerDB的默认日志输出
+	if len(encryptionKey) > 0 {
+		opts = opts.WithEncryptionKey(encryptionKey).WithIndexCacheSize(encryptedIndexCacheSize)
+	}
+
+	// 打开数据库
+	db, err := badger.Open(opts)
+	if errors.Is(err, badger.ErrEncryptionKeyMismatch) {
+		return nil, fmt.Errorf("打开BadgerDB失败: 加密密钥与缓存不匹配，开启、关闭或更换密钥前需要先执行 cache rotate-key")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("打开BadgerDB失败: %w", err)
+	}
+	return db, nil
+}
+
+// RotateEncryptionKey 用新密钥重新加密 Badger 的数据密钥，数据本身不用重写。
+// oldKey 为空表示原来没有加密，newKey 为空表示取消加密；执行前需要停止使用该目录的代理。
+// 取消加密后，已经加密写入的数据仍由数据密钥解密读取，之后写入的数据不再加密
+func RotateEncryptionKey(dbPath string, oldKey, newKey []byte) error {
+	opts := badger.KeyRegistryOptions{
+		Dir:           dbPath,
+		ReadOnly:      true,
+		EncryptionKey: oldKey,
+	}
+	registry, err := badger.OpenKeyRegistry(opts)
+	if errors.Is(err, badger.ErrEncryptionKeyMismatch) {
+		return fmt.Errorf("旧密钥与缓存不匹配")
+	}
+	if err != nil {
+		return fmt.Errorf("读取 KEYREGISTRY 失败: %w", err)
+	}
+
+	opts.EncryptionKey = newKey
+	if err := badger.WriteKeyRegistry(registry, opts); err != nil {
+		return fmt.Errorf("写入 KEYREGISTRY 失败: %w", err)
+	}
+	return nil
+}
+
+func (b *badgerBackend) name() string {
+	return BackendBadger
+}
+
+func (b *badgerBackend) get(key string) ([]byte, error) {
+	var data []byte
+	err := b.db.Load().View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+		data, err = item.ValueCopy(nil)
+		return err
+	})
+	if err == badger.ErrKeyNotFound {
+		return nil, errNotFound
+	}
+	return data, err
+}
+
+func (b *badgerBackend) set(key string, data []byte, fetchedAtMs int64, ttl time.Duration) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = b.db.Load().Update(func(txn *badger.Txn) error {
+			blocked, err := hasTombstone(txn, key)
+			if err != nil {
+				return err
+			}
+			if blocked {
+				return errTombstoned
+			}
+			existingFetchedAt, err := readFetchedAtMs(txn, key)
+			if err != nil {
+				return err
+			}
+			if existingFetchedAt > fetchedAtMs {
+				return errStale
+			}
+
+			e := badger.NewEntry([]byte(key), data).WithTTL(ttl)
+			if err := txn.SetEntry(e); err != nil {
+				return err
+			}
+			// 重新写入时命中计数归零，计数与条目同时过期
+			return txn.SetEntry(badger.NewEntry(hitCountKey(key), encodeAccess(entryAccess{})).WithTTL(ttl))
+		})
+		if err != badger.ErrConflict || attempt >= maxSetConflictRetries {
+			return err
+		}
+		logger.Debug("缓存写入冲突，重试", zap.String("key", key), zap.Int("attempt", attempt+1))
+	}
+}
+
+func (b *badgerBackend) extend(key string, data []byte, fetchedAtMs int64, ttl time.Duration) error {
+	err := b.db.Load().Update(func(txn *badger.Txn) error {
+		existingFetchedAt, err := readFetchedAtMs(txn, key)
+		if err != nil {
+			return err
+		}
+		if existingFetchedAt != fetchedAtMs {
+			return nil
+		}
+
+		if err := txn.SetEntry(badger.NewEntry([]byte(key), data).WithTTL(ttl)); err != nil {
+			return err
+		}
+		access, err := readAccess(txn, key)
+		if err != nil {
+			return err
+		}
+		return txn.SetEntry(badger.NewEntry(hitCountKey(key), encodeAccess(access)).WithTTL(ttl))
+	})
+	// 并发写入时以另一方为准
+	if err == badger.ErrConflict {
+		return nil
+	}
+	return err
+}
+
+func (b *badgerBackend) delete(key string) error {
+	err := b.db.Load().Update(func(txn *badger.Txn) error {
+		if err := txn.Delete([]byte(key)); err != nil {
+			return err
+		}
+		return txn.Delete(hitCountKey(key))
+	})
+	if err == badger.ErrKeyNotFound {
+		return nil
+	}
+	return err
+}
+
+func (b *badgerBackend) invalidate(key string, ttl time.Duration) error {
+	return b.db.Load().Update(func(txn *badger.Txn) error {
+		if err := txn.Delete([]byte(key)); err != nil {
+			return err
+		}
+		if err := txn.Delete(hitCountKey(key)); err != nil {
+			return err
+		}
+		return txn.SetEntry(badger.NewEntry(tombstoneKey(key), nil).WithTTL(ttl))
+	})
+}
+
+func (b *badgerBackend) addHits(batch []hitDelta) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = b.db.Load().Update(func(txn *badger.Txn) error {
+			for _, delta := range batch {
+				if _, err := txn.Get([]byte(delta.key)); err == badger.ErrKeyNotFound {
+					continue
+				} else if err != nil {
+					return err
+				}
+				access, err := readAccess(txn, delta.key)
+				if err != nil {
+					return err
+				}
+				access.hits += delta.hits
+				access.lastAccess = max(access.lastAccess, delta.lastAccess)
+				e := badger.NewEntry(hitCountKey(delta.key), encodeAccess(access)).WithTTL(delta.ttl)
+				if err := txn.SetEntry(e); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		// 同时有条目写入时冲突，整批重试
+		if err != badger.ErrConflict || attempt >= maxSetConflictRetries {
+			return err
+		}
+	}
+}
+
+func (b *badgerBackend) inspect(key string) (entryAccess, time.Duration, error) {
+	var (
+		access       entryAccess
+		tombstoneTTL time.Duration
+	)
+	err := b.db.Load().View(func(txn *badger.Txn) error {
+		var err error
+		if access, err = readAccess(txn, key); err != nil {
+			return err
+		}
+		item, err := txn.Get(tombstoneKey(key))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		tombstoneTTL = time.Until(time.Unix(int64(item.ExpiresAt()), 0))
+		return nil
+	})
+	return access, tombstoneTTL, err
+}
+
+func (b *badgerBackend) forEach(fn func(key string, data []byte, access entryAccess) error) error {
+	return b.db.Load().View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			key := string(item.Key())
+			if strings.HasPrefix(key, "!") {
+				continue
+			}
+
+			data, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			access, err := readAccess(txn, key)
+			if err != nil {
+				return err
+			}
+
+			if err := fn(key, data, access); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *badgerBackend) putRecord(key string, data []byte, ttl time.Duration) error {
+	return b.db.Load().Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(badger.NewEntry([]byte(key), data).WithTTL(ttl))
+	})
+}
+
+func (b *badgerBackend) scanRecords(prefix string, fn func(key string, data []byte) error) error {
+	return b.db.Load().View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(prefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			data, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if err := fn(string(item.Key()), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *badgerBackend) close() error {
+	if db := b.db.Load(); db != nil {
+		return db.Close()
+	}
+	return nil
+}
+
+// readFetchedAtMs 读取已缓存条目的上游响应时间，不存在时返回 0
+func readFetchedAtMs(txn *badger.Txn, key string) (int64, error) {
+	item, err := txn.Get([]byte(key))
+	if err == badger.ErrKeyNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var fetchedAtMs int64
+	err = item.Value(func(val []byte) error {
+		fetchedAtMs, err = decodeFetchedAtMs(val)
+		return err
+	})
+	return fetchedAtMs, err
+}
+
+func hitCountKey(key string) []byte {
+	return []byte(hitCountKeyPrefix + key)
+}
+
+// encodeAccess 命中次数和最近命中时间各 8 字节，旧版本只写了命中次数
+func encodeAccess(access entryAccess) []byte {
+	buf := make([]byte, 16)
+	binary.BigEndian.PutUint64(buf, access.hits)
+	binary.BigEndian.PutUint64(buf[8:], uint64(access.lastAccess))
+	return buf
+}
+
+func readAccess(txn *badger.Txn, key string) (entryAccess, error) {
+	var access entryAccess
+	item, err := txn.Get(hitCountKey(key))
+	if err == badger.ErrKeyNotFound {
+		return access, nil
+	}
+	if err != nil {
+		return access, err
+	}
+
+	err = item.Value(func(val []byte) error {
+		if len(val) >= 8 {
+			access.hits = binary.BigEndian.Uint64(val)
+		}
+		if len(val) >= 16 {
+			access.lastAccess = int64(binary.BigEndian.Uint64(val[8:]))
+		}
+		return nil
+	})
+	return access, err
+}
+
+// hasTombstone 键是否处于手动失效的墓碑期
+func hasTombstone(txn *badger.Txn, key string) (bool, error) {
+	_, err := txn.Get(tombstoneKey(key))
+	if err == badger.ErrKeyNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -4,48 +4,174 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/dgraph-io/badger/v4"
+	"github.com/roowe/tushareproxy/internal/jobs"
 	"github.com/roowe/tushareproxy/pkg/logger"
 	"go.uber.org/zap"
 )
 
+// 命中计数键前缀，使用 namespace 不允许的字符避免与缓存键冲突
+const hitCountKeyPrefix = "!hits/"
+
+// 最近命中时间键前缀，只有 Redis 存储单独保存，Badger 与命中计数存在一起
+const lastAccessKeyPrefix = "!atime/"
+
 // CacheManager 缓存管理器
 type CacheManager struct {
-	db               *badger.DB
+	// 底层存储：本地 Badger 或多个实例共享的 Redis
+	backend  backend
+	dbPath   string
+	readOnly bool
+	// 只读副本的工作目录和当前快照签名
+	workDir          string
+	snapshotSig      string
 	defaultTTL       time.Duration
 	defaultNamespace string
 	gcInterval       time.Duration
+	gcOptions        GCOptions
+	// 底层存储前面的内存 LRU，未开启时为 nil
+	memory *memoryCache
+	// 写入时响应体的压缩算法，为空不压缩
+	compression      string
+	compressMinBytes int
+	// Badger 静态加密密钥，只读副本重新打开快照时使用
+	encryptionKey []byte
+	// 对象存储冷存储，未开启时为 nil
+	cold *coldTier
+	// 条目总大小上限和淘汰策略，未开启时为 nil
+	retention *retention
+	// 连续存储错误的计数，未开启时为 nil
+	health *health
+	// 响应体按内容哈希去重，未开启时为 nil
+	dedup *dedup
+	// 读取时发现的损坏条目数
+	corrupted atomic.Int64
+	// 读取时发现已过期并删除的条目数
+	expired atomic.Int64
+	// 垃圾回收的累计统计
+	gcStats gcCounters
+	// 尚未写入存储的命中计数，只读副本为 nil
+	hits *hitBuffer
 }
 
 // CacheEntry 缓存条目
 type CacheEntry struct {
+	// Version 条目格式版本，见 EntryVersion。加入版本号之前写入的条目为 0，读取后已升级到当前版本
+	Version      int    `json:"version,omitempty"`
 	RequestBody  []byte `json:"request_body"`
 	ResponseBody []byte `json:"response_body"`
 	StatusCode   int    `json:"status_code"`
-	Timestamp    int64  `json:"timestamp"`
-	ExpiresAt    int64  `json:"expires_at,omitempty"`
-	Namespace    string `json:"namespace,omitempty"`
+	// Header 按 tushare.forward_response_headers 保存的上游响应头
+	Header      http.Header `json:"header,omitempty"`
+	Timestamp   int64       `json:"timestamp"`
+	ExpiresAt   int64       `json:"expires_at,omitempty"`
+	Namespace   string      `json:"namespace,omitempty"`
+	FetchedAtMs int64       `json:"fetched_at_ms,omitempty"`
+	// Encoding 落盘时响应体的压缩算法，为空表示未压缩。读取后已解压，该字段为空；
+	// 条目本体在冷存储中时为 cold，见 Cold；响应体按内容哈希单独存放时为 ref
+	Encoding string `json:"encoding,omitempty"`
+	// ColdObject 条目本体在冷存储中的对象名
+	ColdObject string `json:"cold_object,omitempty"`
+	// BodyRef 单独存放的响应体的内容哈希，读取后已填回响应体，该字段为空
+	BodyRef string `json:"body_ref,omitempty"`
+	// Checksum 未压缩响应体的 CRC-32C（十六进制），读取时校验，不一致的条目按损坏处理。
+	// 加入校验和之前写入的条目为空，不校验
+	Checksum string `json:"checksum,omitempty"`
+	// Integrity 返回给客户端的完整性校验值，写入时由调用方给出，命中时直接使用
+	Integrity
+
+	// HitCount 本次命中后的累计命中次数，只在 Get 时填充，不落盘
+	HitCount uint64 `json:"-"`
+	// LastAccessAt 最近一次命中的时间（unix 秒），写入后没有命中过为 0，只在 ForEachEntry 时填充，不落盘
+	LastAccessAt int64 `json:"-"`
+}
+
+// Integrity 响应体的完整性校验值（X-Body-SHA256、X-Row-Count），回源时算好随条目保存，
+// 命中时不用再扫描响应体。加入该字段之前写入的条目为空
+type Integrity struct {
+	// BodySHA256 未压缩响应体的 SHA-256（十六进制）
+	BodySHA256 string `json:"body_sha256,omitempty"`
+	// RowCount 响应中 items 的行数，响应不是 tushare JSON 时为 nil
+	RowCount *int `json:"row_count,omitempty"`
 }
 
-// NewCacheManager 创建新的缓存管理器
+// 并发写入冲突时的最大重试次数
+const maxSetConflictRetries = 3
+
+// 只读副本重新加载后，旧句柄延迟关闭的时间
+const reloadCloseDelay = time.Minute
+
+// NewCacheManager 创建新的缓存管理器，encryptionKey 非空时开启静态加密
 func NewCacheManager(
 	dbPath string,
 	defaultTTLSeconds int,
 	defaultNamespace string,
 	gcInterval time.Duration,
+	encryptionKey []byte,
+) (*CacheManager, error) {
+	return newCacheManager(dbPath, defaultTTLSeconds, defaultNamespace, gcInterval, encryptionKey)
+}
+
+// NewReadOnlyCacheManager 用其他实例 rsync 过来的缓存快照创建只读副本。
+// 快照复制到 workDir 下再打开，避免 rsync 改动正在使用的文件；
+// 只读时不记录命中次数、不写入、不删除过期条目，也不运行垃圾回收。
+// 主代理开启了静态加密时，encryptionKey 需要与主代理一致
+func NewReadOnlyCacheManager(
+	snapshotDir string,
+	workDir string,
+	defaultTTLSeconds int,
+	defaultNamespace string,
+	encryptionKey []byte,
 ) (*CacheManager, error) {
-	// 配置BadgerDB选项
-	opts := badger.DefaultOptions(dbPath)
-	opts.Logger = nil // 禁用BadgerDB的默认日志输出
+	// 清理上次运行留下的工作副本
+	if err := os.RemoveAll(workDir); err != nil {
+		return nil, fmt.Errorf("清理快照工作目录失败: %w", err)
+	}
+
+	cm := &CacheManager{
+		backend:          newBadgerBackend(nil),
+		dbPath:           snapshotDir,
+		workDir:          workDir,
+		readOnly:         true,
+		defaultTTL:       time.Duration(defaultTTLSeconds) * time.Second,
+		defaultNamespace: defaultNamespace,
+		encryptionKey:    encryptionKey,
+	}
+	if cm.defaultNamespace == "" {
+		cm.defaultNamespace = "default"
+	}
+	if err := cm.Reload(); err != nil {
+		return nil, err
+	}
 
-	// 打开数据库
-	db, err := badger.Open(opts)
+	logger.Info("只读缓存副本初始化成功",
+		zap.String("snapshot_dir", snapshotDir),
+		zap.String("work_dir", workDir),
+		zap.Int("default_ttl_seconds", defaultTTLSeconds),
+		zap.String("default_namespace", cm.defaultNamespace))
+	return cm, nil
+}
+
+func newCacheManager(
+	dbPath string,
+	defaultTTLSeconds int,
+	defaultNamespace string,
+	gcInterval time.Duration,
+	encryptionKey []byte,
+) (*CacheManager, error) {
+	db, err := openDB(dbPath, encryptionKey)
 	if err != nil {
-		return nil, fmt.Errorf("打开BadgerDB失败: %w", err)
+		return nil, err
 	}
 
 	defaultTTL := time.Duration(defaultTTLSeconds) * time.Second
@@ -60,25 +186,200 @@ func NewCacheManager(
 		zap.String("db_path", dbPath),
 		zap.Int("default_ttl_seconds", defaultTTLSeconds),
 		zap.String("default_namespace", defaultNamespace),
-		zap.Duration("gc_interval", gcInterval))
+		zap.Duration("gc_interval", gcInterval),
+		zap.Bool("encrypted", len(encryptionKey) > 0))
 
+	backend := newBadgerBackend(db)
 	return &CacheManager{
-		db:               db,
+		backend:          backend,
+		dbPath:           dbPath,
 		defaultTTL:       defaultTTL,
 		defaultNamespace: defaultNamespace,
 		gcInterval:       gcInterval,
+		gcOptions:        GCOptions{DiscardRatio: DefaultGCDiscardRatio, Location: time.Local},
+		hits:             newHitBuffer(backend),
 	}, nil
 }
 
-// Close 关闭缓存管理器
-func (cm *CacheManager) Close() error {
-	if cm.db != nil {
-		logger.Info("正在关闭缓存数据库")
-		return cm.db.Close()
+// NewRedisCacheManager 创建使用 Redis 存储的缓存管理器，多个代理实例可以共享同一份缓存。
+// 过期条目由 Redis 自行清理，不需要垃圾回收
+func NewRedisCacheManager(
+	opts RedisOptions,
+	defaultTTLSeconds int,
+	defaultNamespace string,
+) (*CacheManager, error) {
+	rb, err := newRedisBackend(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if defaultNamespace == "" {
+		defaultNamespace = "default"
+	}
+
+	logger.Info("缓存管理器初始化成功",
+		zap.String("backend", BackendRedis),
+		zap.String("redis_addr", opts.Addr),
+		zap.Int("redis_db", opts.DB),
+		zap.String("key_prefix", opts.KeyPrefix),
+		zap.Int("default_ttl_seconds", defaultTTLSeconds),
+		zap.String("default_namespace", defaultNamespace))
+
+	return &CacheManager{
+		backend:          rb,
+		defaultTTL:       time.Duration(defaultTTLSeconds) * time.Second,
+		defaultNamespace: defaultNamespace,
+		hits:             newHitBuffer(rb),
+	}, nil
+}
+
+// Backend 返回底层存储类型
+func (cm *CacheManager) Backend() string {
+	return cm.backend.name()
+}
+
+// badgerDB 返回 Badger 句柄，使用 Redis 存储时返回 nil
+func (cm *CacheManager) badgerDB() *badger.DB {
+	if b, ok := cm.backend.(*badgerBackend); ok {
+		return b.db.Load()
 	}
 	return nil
 }
 
+// ReadOnly 是否为只读副本
+func (cm *CacheManager) ReadOnly() bool {
+	return cm.readOnly
+}
+
+// Reload 快照有变化时复制一份新的工作副本并切换过去。
+// 旧句柄延迟关闭，让进行中的读取完成
+func (cm *CacheManager) Reload() error {
+	if !cm.readOnly {
+		return fmt.Errorf("只有只读副本可以重新加载")
+	}
+
+	signature, err := snapshotSignature(cm.dbPath)
+	if err != nil {
+		return err
+	}
+	if signature == cm.snapshotSig {
+		return nil
+	}
+
+	workPath := filepath.Join(cm.workDir, fmt.Sprintf("snapshot-%d", time.Now().UnixNano()))
+	if err := copyDir(cm.dbPath, workPath); err != nil {
+		os.RemoveAll(workPath)
+		return fmt.Errorf("复制缓存快照失败: %w", err)
+	}
+	db, err := openDB(workPath, cm.encryptionKey)
+	if err != nil {
+		os.RemoveAll(workPath)
+		return err
+	}
+
+	old := cm.backend.(*badgerBackend).db.Swap(db)
+	cm.snapshotSig = signature
+	cm.memory.purge()
+	if old != nil {
+		time.AfterFunc(reloadCloseDelay, func() {
+			oldPath := old.Opts().Dir
+			if err := old.Close(); err != nil {
+				logger.Warn("关闭旧的缓存快照失败", zap.Error(err))
+			}
+			os.RemoveAll(oldPath)
+		})
+	}
+
+	logger.Info("缓存快照已重新加载", zap.String("snapshot_dir", cm.dbPath), zap.String("work_path", workPath))
+	return nil
+}
+
+// snapshotSignature 用文件名、大小和修改时间判断快照是否有变化
+func snapshotSignature(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("读取快照目录失败: %w", err)
+	}
+
+	hash := sha256.New()
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(hash, "%s:%d:%d\n", entry.Name(), info.Size(), info.ModTime().UnixNano())
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// copyDir 复制快照目录下的文件，快照目录不含子目录
+func copyDir(src, dst string) error {
+	if err := os.MkdirAll(dst, 0o755); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || entry.Name() == "LOCK" {
+			continue
+		}
+		if err := copyFile(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// StartReloadRoutine 启动定期重新加载快照的后台例程
+func (cm *CacheManager) StartReloadRoutine(interval time.Duration) {
+	jobs.Register(jobs.ReplicaReload)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if jobs.Paused(jobs.ReplicaReload) {
+				continue
+			}
+			if err := cm.Reload(); err != nil {
+				logger.Error("重新加载缓存快照失败，继续使用旧快照", zap.Error(err))
+			}
+		}
+	}()
+
+	logger.Info("缓存快照重新加载例程已启动", zap.Duration("interval", interval))
+}
+
+// Close 关闭缓存管理器
+func (cm *CacheManager) Close() error {
+	logger.Info("正在关闭缓存数据库", zap.String("backend", cm.backend.name()))
+	// 关闭存储前写入剩余的命中计数
+	cm.hits.close()
+	return cm.backend.close()
+}
+
 // DefaultTTL 返回默认TTL
 func (cm *CacheManager) DefaultTTL() time.Duration {
 	return cm.defaultTTL
@@ -91,37 +392,30 @@ func (cm *CacheManager) DefaultNamespace() string {
 
 // ResolveNamespace 解析命名空间
 func (cm *CacheManager) ResolveNamespace(namespace string) string {
-	namespace = strings.TrimSpace(namespace)
-	if namespace == "" {
-		return cm.defaultNamespace
-	}
-	return namespace
+	return resolveNamespace(namespace, cm.defaultNamespace)
 }
 
-// GenerateKey 根据请求体和命名空间生成缓存键
-func (cm *CacheManager) GenerateKey(namespace string, requestBody []byte) string {
-	resolvedNamespace := cm.ResolveNamespace(namespace)
-	hash := sha256.Sum256(requestBody)
-	return fmt.Sprintf("%s:%s", resolvedNamespace, hex.EncodeToString(hash[:]))
+// SetMemoryCache 在底层存储前面加一层内存 LRU，maxEntries 为 0 时不开启，maxBytes 为 0 时不限字节数
+func (cm *CacheManager) SetMemoryCache(maxEntries int, maxBytes int64) {
+	if maxEntries <= 0 {
+		cm.memory = nil
+		return
+	}
+	cm.memory = newMemoryCache(maxEntries, maxBytes)
 }
 
-// Get 从缓存中获取数据
+// Get 从缓存中获取数据，先查内存 LRU，未命中时读底层存储并放入内存。
+// 条目本体在冷存储中时先取回本地
 func (cm *CacheManager) Get(key string) (*CacheEntry, bool) {
-	var entry *CacheEntry
-
-	err := cm.db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte(key))
-		if err != nil {
-			return err
-		}
-
-		return item.Value(func(val []byte) error {
-			return json.Unmarshal(val, &entry)
-		})
-	})
+	if entry, expiresAt, ok := cm.memory.get(key, time.Now()); ok {
+		return cm.hit(key, entry, expiresAt), true
+	}
+	generation := cm.memory.currentGeneration()
 
+	data, err := cm.backend.get(key)
+	cm.observe(err)
 	if err != nil {
-		if err == badger.ErrKeyNotFound {
+		if err == errNotFound {
 			logger.Debug("缓存未命中", zap.String("key", key))
 		} else {
 			logger.Error("从缓存读取数据失败", zap.Error(err), zap.String("key", key))
@@ -129,26 +423,69 @@ func (cm *CacheManager) Get(key string) (*CacheEntry, bool) {
 		return nil, false
 	}
 
+	entry, err := cm.loadEntry(data)
+	if errors.Is(err, errCorrupt) {
+		cm.corrupted.Add(1)
+		logger.Error("缓存条目已损坏，删除并按未命中处理", zap.Error(err), zap.String("key", key))
+		if !cm.readOnly {
+			cm.Delete(key)
+		}
+		return nil, false
+	}
+	if err != nil {
+		logger.Error("解析缓存条目失败", zap.Error(err), zap.String("key", key))
+		return nil, false
+	}
+
 	expiresAt := entry.resolveExpiresAt(cm.defaultTTL)
 	if expiresAt.IsZero() || !time.Now().Before(expiresAt) {
 		logger.Debug("缓存已过期", zap.String("key", key))
-		cm.Delete(key) // 异步删除过期的条目
+		if !cm.readOnly {
+			cm.expired.Add(1)
+			cm.Delete(key) // 异步删除过期的条目
+		}
 		return nil, false
 	}
 
+	if entry.Cold() {
+		if entry, err = cm.thaw(key, entry, expiresAt); err != nil {
+			logger.Error("从冷存储取回缓存条目失败", zap.Error(err), zap.String("key", key))
+			return nil, false
+		}
+	}
+
+	cm.memory.add(key, entry, expiresAt, generation)
+	return cm.hit(key, entry, expiresAt), true
+}
+
+// hit 返回命中条目的副本并累加命中次数，内存中的条目由所有读者共享
+func (cm *CacheManager) hit(key string, entry *CacheEntry, expiresAt time.Time) *CacheEntry {
+	hit := *entry
+	if !cm.readOnly {
+		hit.HitCount = cm.hits.record(key, expiresAt, time.Now())
+	}
+
 	logger.Debug("缓存命中", zap.String("key", key))
-	return entry, true
+	return &hit
 }
 
-// Set 设置缓存数据
+// Set 设置缓存数据。fetchedAt 为上游响应时间，已缓存的条目比它更新时跳过写入，
+// 避免并发未命中时较旧的响应覆盖较新的响应。只读副本直接跳过
 func (cm *CacheManager) Set(
 	key string,
 	namespace string,
 	requestBody,
 	responseBody []byte,
 	statusCode int,
+	header http.Header,
 	expiresAt time.Time,
+	fetchedAt time.Time,
+	integrity Integrity,
 ) error {
+	if cm.readOnly {
+		return nil
+	}
+
 	ttl := time.Until(expiresAt)
 	if ttl <= 0 {
 		return fmt.Errorf("缓存过期时间必须晚于当前时间")
@@ -158,22 +495,35 @@ func (cm *CacheManager) Set(
 		RequestBody:  requestBody,
 		ResponseBody: responseBody,
 		StatusCode:   statusCode,
+		Header:       header,
 		Timestamp:    time.Now().Unix(),
 		ExpiresAt:    expiresAt.Unix(),
 		Namespace:    cm.ResolveNamespace(namespace),
+		FetchedAtMs:  fetchedAt.UnixMilli(),
+		Integrity:    integrity,
 	}
 
-	data, err := json.Marshal(entry)
+	data, err := cm.encodeEntry(entry)
 	if err != nil {
 		return fmt.Errorf("序列化缓存条目失败: %w", err)
 	}
 
-	err = cm.db.Update(func(txn *badger.Txn) error {
-		e := badger.NewEntry([]byte(key), data).WithTTL(ttl)
-		return txn.SetEntry(e)
-	})
-
-	if err != nil {
+	err = cm.backend.set(key, data, entry.FetchedAtMs, ttl)
+	cm.memory.invalidate(key)
+	cm.hits.forget(key)
+	cm.observe(err)
+
+	switch err {
+	case nil:
+	case errTombstoned:
+		logger.Info("缓存键已被手动失效，墓碑过期前不写入", zap.String("key", key))
+		return nil
+	case errStale:
+		logger.Debug("已有更新的缓存条目，跳过写入",
+			zap.String("key", key),
+			zap.Int64("fetched_at_ms", entry.FetchedAtMs))
+		return nil
+	default:
 		logger.Error("设置缓存失败", zap.Error(err), zap.String("key", key))
 		return fmt.Errorf("设置缓存失败: %w", err)
 	}
@@ -188,62 +538,90 @@ func (cm *CacheManager) Set(
 	return nil
 }
 
-// Delete 删除缓存条目
-func (cm *CacheManager) Delete(key string) error {
-	err := cm.db.Update(func(txn *badger.Txn) error {
-		return txn.Delete([]byte(key))
-	})
-
-	if err != nil && err != badger.ErrKeyNotFound {
-		logger.Error("删除缓存失败", zap.Error(err), zap.String("key", key))
-		return fmt.Errorf("删除缓存失败: %w", err)
+// Restore 按原样写入导入的条目，保留缓存时间、命名空间和上游响应时间。
+// 已有条目的上游响应时间更新时跳过，返回是否写入。旧版本导出的条目先升级到当前格式
+func (cm *CacheManager) Restore(key string, entry *CacheEntry) (bool, error) {
+	if cm.readOnly {
+		return false, fmt.Errorf("只读副本不能导入缓存")
 	}
+	restored := *entry
+	if err := migrateEntry(&restored); err != nil {
+		return false, err
+	}
+	entry = &restored
 
-	return nil
-}
-
-// GetStats 获取缓存统计信息
-func (cm *CacheManager) GetStats() map[string]interface{} {
-	lsm, vlog := cm.db.Size()
+	expiresAt := entry.resolveExpiresAt(cm.defaultTTL)
+	ttl := time.Until(expiresAt)
+	if expiresAt.IsZero() || ttl <= 0 {
+		return false, nil
+	}
 
-	stats := map[string]interface{}{
-		"lsm_size":   lsm,
-		"vlog_size":  vlog,
-		"total_size": lsm + vlog,
+	data, err := cm.encodeEntry(entry)
+	if err != nil {
+		return false, fmt.Errorf("序列化缓存条目失败: %w", err)
 	}
 
-	return stats
+	err = cm.backend.set(key, data, entry.FetchedAtMs, ttl)
+	cm.memory.invalidate(key)
+	cm.hits.forget(key)
+	cm.observe(err)
+
+	switch err {
+	case nil:
+		return true, nil
+	case errTombstoned, errStale:
+		return false, nil
+	default:
+		return false, fmt.Errorf("设置缓存失败: %w", err)
+	}
 }
 
-// RunGC 运行垃圾回收
-func (cm *CacheManager) RunGC() error {
-	logger.Info("开始运行缓存垃圾回收")
-	logger.Info("缓存 stats", zap.Any("stats", cm.GetStats()))
+// Extend 把条目的过期时间延长到 expiresAt，条目已被重新写入或已经更晚过期时不处理。
+// 命中计数随条目一起延长
+func (cm *CacheManager) Extend(key string, entry *CacheEntry, expiresAt time.Time) error {
+	if cm.readOnly {
+		return nil
+	}
 
-	err := cm.db.RunValueLogGC(0.5)
-	if err != nil && err != badger.ErrNoRewrite {
-		logger.Error("垃圾回收失败", zap.Error(err))
-		return err
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 || expiresAt.Unix() <= entry.ExpiresAt {
+		return nil
 	}
 
-	logger.Info("缓存垃圾回收完成")
-	logger.Info("缓存 stats", zap.Any("stats", cm.GetStats()))
+	extended := *entry
+	extended.ExpiresAt = expiresAt.Unix()
+	data, err := cm.encodeEntry(&extended)
+	if err != nil {
+		return fmt.Errorf("序列化缓存条目失败: %w", err)
+	}
 
+	err = cm.backend.extend(key, data, entry.FetchedAtMs, ttl)
+	cm.observe(err)
+	if err != nil {
+		logger.Warn("延长缓存过期时间失败", zap.Error(err), zap.String("key", key))
+		return fmt.Errorf("延长缓存过期时间失败: %w", err)
+	}
+	cm.memory.invalidate(key)
 	return nil
 }
 
-// StartGCRoutine 启动后台垃圾回收例程
-func (cm *CacheManager) StartGCRoutine() {
-	go func() {
-		ticker := time.NewTicker(cm.gcInterval)
-		defer ticker.Stop()
+// Delete 删除缓存条目
+func (cm *CacheManager) Delete(key string) error {
+	if cm.readOnly {
+		return fmt.Errorf("只读副本不能删除缓存")
+	}
 
-		for range ticker.C {
-			cm.RunGC()
-		}
-	}()
+	err := cm.backend.delete(key)
+	cm.memory.invalidate(key)
+	cm.hits.forget(key)
+	cm.observe(err)
 
-	logger.Info("缓存垃圾回收例程已启动")
+	if err != nil {
+		logger.Error("删除缓存失败", zap.Error(err), zap.String("key", key))
+		return fmt.Errorf("删除缓存失败: %w", err)
+	}
+
+	return nil
 }
 
 func (e *CacheEntry) resolveExpiresAt(defaultTTL time.Duration) time.Time {
@@ -255,3 +633,111 @@ func (e *CacheEntry) resolveExpiresAt(defaultTTL time.Duration) time.Time {
 	}
 	return time.Time{}
 }
+
+// ForEachEntry 遍历所有未过期的缓存条目，旧条目缺少的过期时间按默认 TTL 补全。
+// 本体在冷存储中的条目没有响应体，需要时用 LoadCold 读取
+func (cm *CacheManager) ForEachEntry(fn func(key string, entry *CacheEntry, hitCount uint64) error) error {
+	now := time.Now()
+
+	return cm.backend.forEach(func(key string, data []byte, access entryAccess) error {
+		entry, err := cm.loadEntry(data)
+		if err != nil {
+			logger.Warn("解析缓存条目失败，跳过", zap.Error(err), zap.String("key", key))
+			return nil
+		}
+
+		expiresAt := entry.resolveExpiresAt(cm.defaultTTL)
+		if expiresAt.IsZero() || !now.Before(expiresAt) {
+			return nil
+		}
+		entry.ExpiresAt = expiresAt.Unix()
+		entry.LastAccessAt = access.lastAccess
+		return fn(key, entry, access.hits)
+	})
+}
+
+// ForEachKey 遍历所有缓存条目的键，不解析条目内容，已过期但还没被清理的条目也包括在内
+func (cm *CacheManager) ForEachKey(fn func(key string) error) error {
+	return cm.backend.forEach(func(key string, data []byte, access entryAccess) error {
+		return fn(key)
+	})
+}
+
+// EntryInfo 单个缓存键的诊断信息，用于排查为什么拿到的是旧数据
+type EntryInfo struct {
+	// Entry 存储中的条目，不存在时为 nil；已过期但还没被清理的条目也会返回
+	Entry     *CacheEntry
+	ExpiresAt time.Time
+	Expired   bool
+	HitCount  uint64
+	// LastAccess 最近一次命中的时间，写入后没有命中过时为零值
+	LastAccess time.Time
+	// TombstoneTTL 手动失效墓碑的剩余时长，不在墓碑期时为 0
+	TombstoneTTL time.Duration
+}
+
+// Inspect 读取缓存键的诊断信息，直接读底层存储，不累加命中次数也不删除过期条目
+func (cm *CacheManager) Inspect(key string) (*EntryInfo, error) {
+	info := &EntryInfo{}
+	access, tombstoneTTL, err := cm.backend.inspect(key)
+	if err != nil {
+		return nil, fmt.Errorf("读取缓存键信息失败: %w", err)
+	}
+	bufferedHits, bufferedAccess := cm.hits.pendingFor(key)
+	info.HitCount, info.TombstoneTTL = access.hits+bufferedHits, tombstoneTTL
+	access.lastAccess = max(access.lastAccess, bufferedAccess)
+	if access.lastAccess > 0 {
+		info.LastAccess = time.Unix(access.lastAccess, 0)
+	}
+
+	data, err := cm.backend.get(key)
+	if err == errNotFound {
+		return info, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取缓存条目失败: %w", err)
+	}
+	if info.Entry, err = cm.loadEntry(data); err != nil {
+		return nil, fmt.Errorf("解析缓存条目失败: %w", err)
+	}
+	info.ExpiresAt = info.Entry.resolveExpiresAt(cm.defaultTTL)
+	info.Expired = info.ExpiresAt.IsZero() || !time.Now().Before(info.ExpiresAt)
+	return info, nil
+}
+
+// APIName 从请求体中取出 api_name，解析失败时返回空
+func (e *CacheEntry) APIName() string {
+	var request struct {
+		APIName string `json:"api_name"`
+	}
+	json.Unmarshal(e.RequestBody, &request)
+	return request.APIName
+}
+
+// GetRecord 读取请求历史等辅助记录，不存在时 ok 为 false
+func (cm *CacheManager) GetRecord(key string) ([]byte, bool, error) {
+	data, err := cm.backend.get(key)
+	if err == errNotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// PutRecord 写入辅助记录。键必须以 ! 开头，和缓存条目区分开，遍历缓存条目时会跳过
+func (cm *CacheManager) PutRecord(key string, data []byte, ttl time.Duration) error {
+	if cm.readOnly {
+		return fmt.Errorf("只读副本不能写入记录")
+	}
+	if !strings.HasPrefix(key, "!") {
+		return fmt.Errorf("辅助记录的键必须以 ! 开头: %s", key)
+	}
+	return cm.backend.putRecord(key, data, ttl)
+}
+
+// ScanRecords 按键前缀遍历辅助记录
+func (cm *CacheManager) ScanRecords(prefix string, fn func(key string, data []byte) error) error {
+	return cm.backend.scanRecords(prefix, fn)
+}
@@ -0,0 +1,262 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/jobs"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// encodingCold 条目本体已移到对象存储，本地只保留元数据和对象名。
+// 旧版本程序不认识该编码，按未命中处理
+const encodingCold = "cold"
+
+// 从冷存储取回的键记录前缀，记录有效期内不再移出
+const thawedKeyPrefix = "!thawed/"
+
+// 剩余有效期不足该时长的条目不移到冷存储，很快就会过期，移走不划算
+const coldMinRemaining = 24 * time.Hour
+
+// ColdOptions 冷存储配置
+type ColdOptions struct {
+	S3 S3Options
+	// 写入超过该时长的条目移到对象存储
+	After time.Duration
+	// 检查并移动条目的间隔
+	MoveInterval time.Duration
+}
+
+// coldTier 把很久没有写入的条目移到对象存储，访问时再取回本地
+type coldTier struct {
+	store    *s3Store
+	after    time.Duration
+	interval time.Duration
+
+	moved  atomic.Int64
+	thawed atomic.Int64
+	failed atomic.Int64
+}
+
+// ColdStats 冷存储的累计移出、取回和失败次数
+type ColdStats struct {
+	Moved  int64 `json:"moved"`
+	Thawed int64 `json:"thawed"`
+	Failed int64 `json:"failed"`
+}
+
+// SetColdTier 开启冷存储，只支持 Badger 存储
+func (cm *CacheManager) SetColdTier(opts ColdOptions) error {
+	if cm.badgerDB() == nil {
+		return fmt.Errorf("冷存储只支持 Badger 存储")
+	}
+	store, err := newS3Store(opts.S3)
+	if err != nil {
+		return err
+	}
+	cm.cold = &coldTier{store: store, after: opts.After, interval: opts.MoveInterval}
+	logger.Info("缓存冷存储已启用",
+		zap.String("endpoint", opts.S3.Endpoint),
+		zap.String("bucket", opts.S3.Bucket),
+		zap.String("prefix", opts.S3.Prefix),
+		zap.Duration("after", opts.After))
+	return nil
+}
+
+// Cold 条目本体是否在冷存储中。ForEachEntry 遍历到的这类条目没有响应体
+func (e *CacheEntry) Cold() bool {
+	return e.Encoding == encodingCold
+}
+
+// LoadCold 从冷存储读取条目本体，不取回本地；条目不在冷存储中时原样返回
+func (cm *CacheManager) LoadCold(entry *CacheEntry) (*CacheEntry, error) {
+	if !entry.Cold() {
+		return entry, nil
+	}
+	if cm.cold == nil {
+		return nil, fmt.Errorf("条目在冷存储中，但没有配置冷存储")
+	}
+	data, err := cm.cold.store.get(entry.ColdObject)
+	if err != nil {
+		return nil, fmt.Errorf("从冷存储读取条目失败: %w", err)
+	}
+	full, err := decodeEntry(data)
+	if err != nil {
+		return nil, fmt.Errorf("解析冷存储中的条目失败: %w", err)
+	}
+	if full.FetchedAtMs != entry.FetchedAtMs {
+		return nil, fmt.Errorf("冷存储中的条目与本地记录不一致")
+	}
+	// 过期时间以本地记录为准
+	full.ExpiresAt = entry.ExpiresAt
+	return full, nil
+}
+
+// thaw 取回冷存储中的条目并写回本地，之后 after 时长内不再移出。
+// 取回后删除对象，写回失败时保留对象，下次访问再取
+func (cm *CacheManager) thaw(key string, entry *CacheEntry, expiresAt time.Time) (*CacheEntry, error) {
+	full, err := cm.LoadCold(entry)
+	if err != nil {
+		cm.coldFailed()
+		return nil, err
+	}
+	if cm.readOnly {
+		return full, nil
+	}
+
+	data, err := cm.encodeEntry(full)
+	if err != nil {
+		return full, nil
+	}
+	ttl := time.Until(expiresAt)
+	if err := cm.backend.extend(key, data, entry.FetchedAtMs, ttl); err != nil {
+		logger.Warn("冷存储条目写回本地失败", zap.Error(err), zap.String("key", key))
+		return full, nil
+	}
+	cm.memory.invalidate(key)
+	cm.backend.putRecord(thawedKeyPrefix+key, []byte(strconv.FormatInt(time.Now().Unix(), 10)), min(ttl, cm.cold.after))
+	cm.cold.thawed.Add(1)
+
+	object := entry.ColdObject
+	go func() {
+		if err := cm.cold.store.delete(object); err != nil {
+			logger.Warn("删除冷存储对象失败", zap.Error(err), zap.String("object", object))
+		}
+	}()
+	logger.Debug("已从冷存储取回缓存条目", zap.String("key", key))
+	return full, nil
+}
+
+func (cm *CacheManager) coldFailed() {
+	if cm.cold != nil {
+		cm.cold.failed.Add(1)
+	}
+}
+
+// StartColdTierRoutine 按间隔把写入超过 after 时长的条目移到对象存储，启动后先检查一次
+func (cm *CacheManager) StartColdTierRoutine() {
+	if cm.cold == nil || cm.readOnly {
+		return
+	}
+
+	jobs.Register(jobs.ColdTier)
+	go func() {
+		ticker := time.NewTicker(cm.cold.interval)
+		defer ticker.Stop()
+
+		for {
+			if !jobs.Paused(jobs.ColdTier) {
+				cm.moveToColdTier()
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// moveToColdTier 先收集要移出的键再逐个移动，不在遍历过程中修改存储
+func (cm *CacheManager) moveToColdTier() {
+	now := time.Now()
+	cutoff := now.Add(-cm.cold.after).Unix()
+
+	var candidates []string
+	err := cm.backend.forEach(func(key string, data []byte, access entryAccess) error {
+		var meta struct {
+			Timestamp int64  `json:"timestamp"`
+			ExpiresAt int64  `json:"expires_at"`
+			Encoding  string `json:"encoding"`
+		}
+		if json.Unmarshal(data, &meta) != nil || meta.Encoding == encodingCold {
+			return nil
+		}
+		if meta.Timestamp == 0 || meta.Timestamp > cutoff {
+			return nil
+		}
+		if meta.ExpiresAt > 0 && time.Unix(meta.ExpiresAt, 0).Sub(now) < coldMinRemaining {
+			return nil
+		}
+		candidates = append(candidates, key)
+		return nil
+	})
+	if err != nil {
+		logger.Error("遍历缓存条目失败", zap.Error(err))
+		return
+	}
+	if len(candidates) == 0 {
+		return
+	}
+
+	moved, bytes := 0, 0
+	for _, key := range candidates {
+		// 关闭过程中会暂停后台任务，及时停下
+		if jobs.Paused(jobs.ColdTier) {
+			break
+		}
+		size, err := cm.moveEntry(key)
+		if err != nil {
+			cm.cold.failed.Add(1)
+			logger.Warn("缓存条目移到冷存储失败", zap.Error(err), zap.String("key", key))
+			// 对象存储不可用时不再继续，等下次检查
+			break
+		}
+		if size > 0 {
+			moved++
+			bytes += size
+		}
+	}
+	logger.Info("已把缓存条目移到冷存储",
+		zap.Int("candidates", len(candidates)),
+		zap.Int("moved", moved),
+		zap.Int("bytes", bytes))
+}
+
+// moveEntry 上传条目后把本地条目替换为只有元数据的占位条目，返回上传的字节数，跳过时返回 0。
+// 替换前条目已被重新写入时保留新条目，上传的对象留给对象存储的生命周期规则清理
+func (cm *CacheManager) moveEntry(key string) (int, error) {
+	if _, err := cm.backend.get(thawedKeyPrefix + key); err == nil {
+		return 0, nil
+	}
+	data, err := cm.backend.get(key)
+	if err == errNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	// 不解压响应体，原样上传
+	var entry CacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return 0, nil
+	}
+	// 响应体单独存放的条目留在本地，只上传条目本身取回时会缺少响应体
+	if err := migrateEntry(&entry); err != nil || entry.Cold() || entry.BodyRef != "" {
+		return 0, nil
+	}
+	ttl := time.Until(entry.resolveExpiresAt(cm.defaultTTL))
+	if ttl <= 0 {
+		return 0, nil
+	}
+
+	object := cm.cold.store.objectName(key)
+	if err := cm.cold.store.put(object, data); err != nil {
+		return 0, err
+	}
+
+	stub := entry
+	stub.ResponseBody = nil
+	stub.Encoding = encodingCold
+	stub.ColdObject = object
+	stubData, err := cm.encodeEntry(&stub)
+	if err != nil {
+		return 0, err
+	}
+	if err := cm.backend.extend(key, stubData, entry.FetchedAtMs, ttl); err != nil {
+		return 0, err
+	}
+	cm.cold.moved.Add(1)
+	return len(data), nil
+}
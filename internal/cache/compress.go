@@ -0,0 +1,146 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// 响应体压缩算法，记录在每个条目的 encoding 字段，未压缩的条目为空
+const (
+	CompressionNone   = "none"
+	CompressionZstd   = "zstd"
+	CompressionSnappy = "snappy"
+)
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// SetCompression 设置写入时响应体的压缩算法，响应体小于 minBytes 时不压缩。
+// 读取时按条目记录的算法解压，与当前配置无关，切换算法不影响已有条目
+func (cm *CacheManager) SetCompression(algorithm string, minBytes int) {
+	if algorithm == CompressionNone {
+		algorithm = ""
+	}
+	cm.compression = algorithm
+	cm.compressMinBytes = minBytes
+}
+
+// encodeEntry 按配置压缩响应体后按当前格式版本序列化，不修改传入的条目。
+// 开启去重且响应体足够大时先按内容哈希写入响应体，条目只记录哈希
+func (cm *CacheManager) encodeEntry(entry *CacheEntry) ([]byte, error) {
+	stored := *entry
+	stored.Version = EntryVersion
+	if !stored.Cold() {
+		stored.Checksum = bodyChecksum(stored.ResponseBody)
+	}
+	if cm.dedup != nil && stored.Encoding == "" && len(stored.ResponseBody) >= cm.dedup.minBytes {
+		if expiresAt := stored.resolveExpiresAt(cm.defaultTTL); !expiresAt.IsZero() {
+			hash, err := cm.storeBody(stored.ResponseBody, expiresAt)
+			if err != nil {
+				return nil, err
+			}
+			stored.ResponseBody = nil
+			stored.Encoding = encodingBodyRef
+			stored.BodyRef = hash
+			return json.Marshal(&stored)
+		}
+	}
+	if cm.compression != "" && stored.Encoding == "" && len(stored.ResponseBody) >= cm.compressMinBytes {
+		compressed := compressBody(cm.compression, stored.ResponseBody)
+		// 压缩后没有变小的直接存原文
+		if len(compressed) < len(stored.ResponseBody) {
+			stored.ResponseBody = compressed
+			stored.Encoding = cm.compression
+		}
+	}
+	return json.Marshal(&stored)
+}
+
+// decodeEntry 反序列化条目、解压响应体，并把旧版本的条目升级到当前格式
+func decodeEntry(data []byte) (*CacheEntry, error) {
+	var entry *CacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("缓存条目为空")
+	}
+	if err := migrateEntry(entry); err != nil {
+		return nil, err
+	}
+	if entry.Cold() || entry.Encoding == encodingBodyRef {
+		return entry, nil
+	}
+	if entry.Encoding == "" {
+		return entry, verifyChecksum(entry)
+	}
+
+	body, err := decompressBody(entry.Encoding, entry.ResponseBody)
+	if err != nil {
+		return nil, err
+	}
+	entry.ResponseBody = body
+	entry.Encoding = ""
+	return entry, verifyChecksum(entry)
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// bodyChecksum 响应体的 CRC-32C
+func bodyChecksum(body []byte) string {
+	return fmt.Sprintf("%08x", crc32.Checksum(body, castagnoli))
+}
+
+// verifyChecksum 校验已解压的响应体，条目没有记录校验和时不校验
+func verifyChecksum(entry *CacheEntry) error {
+	if entry.Checksum == "" {
+		return nil
+	}
+	if sum := bodyChecksum(entry.ResponseBody); sum != entry.Checksum {
+		return fmt.Errorf("%w: 响应体校验和 %s 与记录的 %s 不一致", errCorrupt, sum, entry.Checksum)
+	}
+	return nil
+}
+
+// EncodedSize 按 algorithm 和 minBytes 压缩后响应体的大小，与写入存储时的规则相同；压缩后没有变小时返回原大小
+func EncodedSize(algorithm string, minBytes int, body []byte) int {
+	if algorithm == "" || algorithm == CompressionNone || len(body) < minBytes {
+		return len(body)
+	}
+	return min(len(compressBody(algorithm, body)), len(body))
+}
+
+func compressBody(algorithm string, body []byte) []byte {
+	switch algorithm {
+	case CompressionZstd:
+		return zstdEncoder.EncodeAll(body, make([]byte, 0, len(body)/4))
+	case CompressionSnappy:
+		return s2.EncodeSnappy(nil, body)
+	}
+	return body
+}
+
+func decompressBody(algorithm string, body []byte) ([]byte, error) {
+	switch algorithm {
+	case CompressionZstd:
+		decoded, err := zstdDecoder.DecodeAll(body, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%w: zstd 解压响应体失败: %v", errCorrupt, err)
+		}
+		return decoded, nil
+	case CompressionSnappy:
+		decoded, err := s2.Decode(nil, body)
+		if err != nil {
+			return nil, fmt.Errorf("%w: snappy 解压响应体失败: %v", errCorrupt, err)
+		}
+		return decoded, nil
+	}
+	// 新版本写入的未知算法按未命中处理
+	return nil, fmt.Errorf("不支持的响应体压缩算法: %s", algorithm)
+}
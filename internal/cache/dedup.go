@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// 按内容哈希存放的响应体记录前缀
+const bodyKeyPrefix = "!body/"
+
+// encodingBodyRef 响应体按内容哈希单独存放，条目只记录哈希。
+// 旧版本程序不认识该编码，按未命中处理
+const encodingBodyRef = "ref"
+
+// bodyRecord 多个条目共用的响应体，过期时间不早于引用它的条目
+type bodyRecord struct {
+	ExpiresAt int64  `json:"expires_at"`
+	Encoding  string `json:"encoding,omitempty"`
+	Body      []byte `json:"body"`
+}
+
+// dedup 响应体去重的配置和统计
+type dedup struct {
+	minBytes int
+
+	// 写入时已有相同响应体的次数和因此少写的字节数（解压后）
+	hits       atomic.Int64
+	savedBytes atomic.Int64
+}
+
+// DedupStats 响应体去重的统计
+type DedupStats struct {
+	Hits       int64 `json:"hits"`
+	SavedBytes int64 `json:"saved_bytes"`
+}
+
+// SetDedup 响应体不小于 minBytes 时按内容哈希单独存放，多个条目的响应体完全相同时只存一份；0 表示不去重
+func (cm *CacheManager) SetDedup(minBytes int) {
+	if minBytes <= 0 {
+		cm.dedup = nil
+		return
+	}
+	cm.dedup = &dedup{minBytes: minBytes}
+}
+
+// storeBody 按内容哈希写入响应体，返回哈希。已有相同响应体且过期时间不早于 expiresAt 时不重复写入。
+// 并发写入时记录可能以较短的过期时间为准，之后引用它的条目读不到响应体时按未命中处理并重新写入
+func (cm *CacheManager) storeBody(body []byte, expiresAt time.Time) (string, error) {
+	hash := sha256Hex(body)
+	key := bodyKeyPrefix + hash
+
+	if data, err := cm.backend.get(key); err == nil {
+		var existing bodyRecord
+		if json.Unmarshal(data, &existing) == nil {
+			cm.dedup.hits.Add(1)
+			cm.dedup.savedBytes.Add(int64(len(body)))
+			if existing.ExpiresAt >= expiresAt.Unix() {
+				return hash, nil
+			}
+			// 相同响应体已存在但会先过期，按较晚的过期时间重写一份替换它
+		}
+	}
+
+	record := bodyRecord{ExpiresAt: expiresAt.Unix(), Body: body}
+	if cm.compression != "" && len(body) >= cm.compressMinBytes {
+		if compressed := compressBody(cm.compression, body); len(compressed) < len(body) {
+			record.Body = compressed
+			record.Encoding = cm.compression
+		}
+	}
+	data, err := json.Marshal(&record)
+	if err != nil {
+		return "", err
+	}
+	if err := cm.backend.putRecord(key, data, time.Until(expiresAt)); err != nil {
+		return "", fmt.Errorf("写入响应体失败: %w", err)
+	}
+	return hash, nil
+}
+
+// loadEntry 解析条目，响应体按内容哈希单独存放时一并读出，返回的条目与普通条目相同
+func (cm *CacheManager) loadEntry(data []byte) (*CacheEntry, error) {
+	entry, err := decodeEntry(data)
+	if err != nil || entry.Encoding != encodingBodyRef {
+		return entry, err
+	}
+
+	recordData, err := cm.backend.get(bodyKeyPrefix + entry.BodyRef)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应体 %s 失败: %w", entry.BodyRef, err)
+	}
+	var record bodyRecord
+	if err := json.Unmarshal(recordData, &record); err != nil {
+		return nil, fmt.Errorf("解析响应体 %s 失败: %w", entry.BodyRef, err)
+	}
+	body := record.Body
+	if record.Encoding != "" {
+		body, err = decompressBody(record.Encoding, body)
+	}
+	if err == nil {
+		entry.ResponseBody = body
+		err = verifyChecksum(entry)
+	}
+	if err != nil {
+		// 损坏的响应体不能再被其他条目复用
+		if errors.Is(err, errCorrupt) && !cm.readOnly {
+			cm.backend.delete(bodyKeyPrefix + entry.BodyRef)
+		}
+		return nil, err
+	}
+	entry.Encoding = ""
+	entry.BodyRef = ""
+	return entry, nil
+}
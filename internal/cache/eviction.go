@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"encoding/json"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/jobs"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// 超过容量上限时的淘汰策略
+const (
+	// EvictionLRU 先淘汰最久没有命中的条目
+	EvictionLRU = "lru"
+	// EvictionLFU 先淘汰命中次数最少的条目，次数相同时先淘汰最久没有命中的
+	EvictionLFU = "lfu"
+)
+
+// 超过上限时淘汰到上限的该比例以下，避免每次检查都只删掉一点
+const evictTargetRatio = 0.9
+
+// 写入不久的条目还没有机会被命中，放到最后淘汰
+const evictionGracePeriod = time.Hour
+
+// retention 条目总大小上限和淘汰策略
+type retention struct {
+	maxBytes int64
+	policy   string
+
+	evicted      atomic.Int64
+	evictedBytes atomic.Int64
+}
+
+// evictionCandidate 遍历时收集的条目访问情况
+type evictionCandidate struct {
+	key  string
+	size int64
+	hits uint64
+	// 最近一次命中的时间，没有命中过时为写入时间
+	lastUsed int64
+	young    bool
+}
+
+// SetRetention 设置条目总大小上限（按存储中的条目字节数计算，不含 Badger 自身的开销和去重后单独存放的响应体）和淘汰策略，
+// maxBytes 为 0 时不限制
+func (cm *CacheManager) SetRetention(maxBytes int64, policy string) {
+	if maxBytes <= 0 {
+		cm.retention = nil
+		return
+	}
+	if policy == "" {
+		policy = EvictionLRU
+	}
+	cm.retention = &retention{maxBytes: maxBytes, policy: policy}
+}
+
+// StartEvictionRoutine 按垃圾回收的间隔检查条目总大小，超过上限时按淘汰策略删除条目
+func (cm *CacheManager) StartEvictionRoutine() {
+	if cm.retention == nil || cm.readOnly {
+		return
+	}
+
+	jobs.Register(jobs.CacheEviction)
+	go func() {
+		ticker := time.NewTicker(cm.gcInterval)
+		defer ticker.Stop()
+
+		for {
+			if !jobs.Paused(jobs.CacheEviction) {
+				cm.evict()
+			}
+			<-ticker.C
+		}
+	}()
+	logger.Info("缓存容量上限已启用",
+		zap.Int64("max_mb", cm.retention.maxBytes>>20),
+		zap.String("policy", cm.retention.policy))
+}
+
+// evict 先收集所有条目的访问情况，超过上限时排序后逐个删除，不在遍历过程中修改存储
+func (cm *CacheManager) evict() {
+	graceCutoff := time.Now().Add(-evictionGracePeriod).Unix()
+
+	var (
+		candidates []evictionCandidate
+		total      int64
+	)
+	err := cm.backend.forEach(func(key string, data []byte, access entryAccess) error {
+		var meta struct {
+			Timestamp int64 `json:"timestamp"`
+		}
+		json.Unmarshal(data, &meta)
+		candidate := evictionCandidate{
+			key:      key,
+			size:     int64(len(data)),
+			hits:     access.hits,
+			lastUsed: max(access.lastAccess, meta.Timestamp),
+			young:    meta.Timestamp > graceCutoff,
+		}
+		candidates = append(candidates, candidate)
+		total += candidate.size
+		return nil
+	})
+	if err != nil {
+		logger.Error("遍历缓存条目失败", zap.Error(err))
+		return
+	}
+	if total <= cm.retention.maxBytes {
+		return
+	}
+
+	lfu := cm.retention.policy == EvictionLFU
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.young != b.young {
+			return !a.young
+		}
+		if lfu && a.hits != b.hits {
+			return a.hits < b.hits
+		}
+		return a.lastUsed < b.lastUsed
+	})
+
+	target := int64(float64(cm.retention.maxBytes) * evictTargetRatio)
+	before, evicted := total, 0
+	for _, candidate := range candidates {
+		if total <= target || jobs.Paused(jobs.CacheEviction) {
+			break
+		}
+		if err := cm.backend.delete(candidate.key); err != nil {
+			logger.Warn("淘汰缓存条目失败", zap.Error(err), zap.String("key", candidate.key))
+			break
+		}
+		cm.memory.invalidate(candidate.key)
+		cm.hits.forget(candidate.key)
+		total -= candidate.size
+		evicted++
+	}
+	cm.retention.evicted.Add(int64(evicted))
+	cm.retention.evictedBytes.Add(before - total)
+	logger.Info("缓存超过容量上限，已淘汰条目",
+		zap.String("event", "cache_eviction"),
+		zap.String("policy", cm.retention.policy),
+		zap.Int64("before_bytes", before),
+		zap.Int64("after_bytes", total),
+		zap.Int64("max_bytes", cm.retention.maxBytes),
+		zap.Int("evicted", evicted))
+}
@@ -0,0 +1,201 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/roowe/tushareproxy/internal/jobs"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// DefaultGCDiscardRatio 值日志文件中可回收数据的默认比例
+const DefaultGCDiscardRatio = 0.5
+
+// 一次垃圾回收最多重写的值日志文件数，避免长时间占用磁盘 IO
+const gcMaxRewrites = 16
+
+// GCWindow 一天中允许定时垃圾回收的时间窗口，单位为分钟；Start 大于 End 表示跨零点
+type GCWindow struct {
+	Start int
+	End   int
+}
+
+func (w GCWindow) contains(minute int) bool {
+	if w.Start <= w.End {
+		return minute >= w.Start && minute < w.End
+	}
+	return minute >= w.Start || minute < w.End
+}
+
+// GCOptions 值日志垃圾回收的参数
+type GCOptions struct {
+	// 值日志文件中可回收数据的比例达到该值才重写，越小回收越积极，重写的数据也越多
+	DiscardRatio float64
+	// 只在这些时间窗口内定时回收，为空表示不限制；手动触发不受限制
+	Windows  []GCWindow
+	Location *time.Location
+}
+
+// GCResult 一次垃圾回收的结果
+type GCResult struct {
+	// 开始时间（unix 秒）
+	RunAt        int64   `json:"run_at"`
+	DiscardRatio float64 `json:"discard_ratio"`
+	// 重写的值日志文件数，0 表示没有达到回收比例的文件
+	Rewrites   int `json:"rewrites"`
+	VlogBefore int `json:"vlog_files_before"`
+	VlogAfter  int `json:"vlog_files_after"`
+	// 回收前后除正在写入的文件之外的值日志总大小，以及回收的字节数（回收期间有写入时可能偏小）
+	VlogBytesBefore int64 `json:"vlog_bytes_before"`
+	VlogBytesAfter  int64 `json:"vlog_bytes_after"`
+	ReclaimedBytes  int64 `json:"reclaimed_bytes"`
+	DurationMs      int64 `json:"duration_ms"`
+}
+
+// GCStats 启动以来垃圾回收的累计统计和最近一次的结果
+type GCStats struct {
+	Runs           int64     `json:"runs"`
+	Rewrites       int64     `json:"rewrites"`
+	ReclaimedBytes int64     `json:"reclaimed_bytes"`
+	Last           *GCResult `json:"last,omitempty"`
+}
+
+// gcCounters 垃圾回收的累计统计
+type gcCounters struct {
+	runs      atomic.Int64
+	rewrites  atomic.Int64
+	reclaimed atomic.Int64
+
+	mu   sync.Mutex
+	last *GCResult
+}
+
+func (c *gcCounters) record(result *GCResult) {
+	c.runs.Add(1)
+	c.rewrites.Add(int64(result.Rewrites))
+	c.reclaimed.Add(result.ReclaimedBytes)
+	c.mu.Lock()
+	c.last = result
+	c.mu.Unlock()
+}
+
+func (c *gcCounters) stats() *GCStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &GCStats{
+		Runs:           c.runs.Load(),
+		Rewrites:       c.rewrites.Load(),
+		ReclaimedBytes: c.reclaimed.Load(),
+		Last:           c.last,
+	}
+}
+
+// SetGCOptions 设置垃圾回收的回收比例和定时回收的时间窗口
+func (cm *CacheManager) SetGCOptions(opts GCOptions) {
+	if opts.DiscardRatio <= 0 || opts.DiscardRatio >= 1 {
+		opts.DiscardRatio = DefaultGCDiscardRatio
+	}
+	if opts.Location == nil {
+		opts.Location = time.Local
+	}
+	cm.gcOptions = opts
+}
+
+// RunGC 运行 Badger 值日志垃圾回收，discardRatio 为 0 时使用配置的比例。
+// 一次最多重写 gcMaxRewrites 个文件，没有可回收的文件时结束
+func (cm *CacheManager) RunGC(discardRatio float64) (*GCResult, error) {
+	db := cm.badgerDB()
+	if db == nil {
+		return nil, fmt.Errorf("只有 Badger 存储需要垃圾回收")
+	}
+	if cm.readOnly {
+		return nil, fmt.Errorf("只读副本不能运行垃圾回收")
+	}
+	if discardRatio <= 0 {
+		discardRatio = cm.gcOptions.DiscardRatio
+	}
+
+	start := time.Now()
+	result := &GCResult{RunAt: start.Unix(), DiscardRatio: discardRatio}
+	result.VlogBefore, result.VlogBytesBefore = vlogUsage(db.Opts().ValueDir)
+	logger.Info("开始运行缓存垃圾回收", zap.Float64("discard_ratio", discardRatio))
+
+	var err error
+	for result.Rewrites < gcMaxRewrites {
+		if err = db.RunValueLogGC(discardRatio); err != nil {
+			break
+		}
+		result.Rewrites++
+	}
+	result.VlogAfter, result.VlogBytesAfter = vlogUsage(db.Opts().ValueDir)
+	result.ReclaimedBytes = max(result.VlogBytesBefore-result.VlogBytesAfter, 0)
+	result.DurationMs = time.Since(start).Milliseconds()
+
+	switch err {
+	case nil, badger.ErrNoRewrite:
+	case badger.ErrRejected:
+		return nil, fmt.Errorf("已有垃圾回收在进行")
+	default:
+		logger.Error("垃圾回收失败", zap.Error(err))
+		return nil, err
+	}
+
+	cm.gcStats.record(result)
+	logger.Info("缓存垃圾回收完成",
+		zap.String("event", "cache_gc"),
+		zap.Float64("discard_ratio", discardRatio),
+		zap.Int("rewrites", result.Rewrites),
+		zap.Int("vlog_files_before", result.VlogBefore),
+		zap.Int("vlog_files_after", result.VlogAfter),
+		zap.Int64("vlog_bytes_before", result.VlogBytesBefore),
+		zap.Int64("vlog_bytes_after", result.VlogBytesAfter),
+		zap.Int64("reclaimed_bytes", result.ReclaimedBytes),
+		zap.Int64("duration_ms", result.DurationMs))
+	return result, nil
+}
+
+// inGCWindow 当前时间是否允许定时垃圾回收
+func (cm *CacheManager) inGCWindow(now time.Time) bool {
+	if len(cm.gcOptions.Windows) == 0 {
+		return true
+	}
+	local := now.In(cm.gcOptions.Location)
+	minute := local.Hour()*60 + local.Minute()
+	for _, window := range cm.gcOptions.Windows {
+		if window.contains(minute) {
+			return true
+		}
+	}
+	return false
+}
+
+// StartGCRoutine 启动后台垃圾回收例程，配置了时间窗口时只在窗口内回收
+func (cm *CacheManager) StartGCRoutine() {
+	if cm.readOnly || cm.badgerDB() == nil {
+		return
+	}
+
+	jobs.Register(jobs.CacheGC)
+
+	go func() {
+		ticker := time.NewTicker(cm.gcInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if jobs.Paused(jobs.CacheGC) || !cm.inGCWindow(time.Now()) {
+				continue
+			}
+			cm.RunGC(0)
+		}
+	}()
+
+	logger.Info("缓存垃圾回收例程已启动",
+		zap.Duration("interval", cm.gcInterval),
+		zap.Float64("discard_ratio", cm.gcOptions.DiscardRatio),
+		zap.Int("windows", len(cm.gcOptions.Windows)))
+}
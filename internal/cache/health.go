@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// 探测存储是否恢复时写入的辅助记录
+const healthProbeKey = "!health/probe"
+
+// health 连续的存储错误次数，达到阈值后判定存储不可用，之后只有探测成功才恢复
+type health struct {
+	threshold int64
+	failures  atomic.Int64
+	down      atomic.Bool
+
+	mu      sync.Mutex
+	lastErr error
+}
+
+// SetHealthThreshold 存储连续出错 threshold 次后判定为不可用，0 表示不判断
+func (cm *CacheManager) SetHealthThreshold(threshold int) {
+	if threshold <= 0 {
+		cm.health = nil
+		return
+	}
+	cm.health = &health{threshold: int64(threshold)}
+}
+
+// Healthy 存储可用时返回 nil，不可用时返回最近一次错误
+func (cm *CacheManager) Healthy() error {
+	if cm.health == nil || !cm.health.down.Load() {
+		return nil
+	}
+	cm.health.mu.Lock()
+	defer cm.health.mu.Unlock()
+	return cm.health.lastErr
+}
+
+// Probe 写入并读回一条辅助记录，检查存储是否恢复。成功时清除不可用状态
+func (cm *CacheManager) Probe() error {
+	value := []byte(strconv.FormatInt(time.Now().UnixNano(), 10))
+	err := cm.backend.putRecord(healthProbeKey, value, time.Minute)
+	if err == nil {
+		var data []byte
+		data, err = cm.backend.get(healthProbeKey)
+		if err == nil && string(data) != string(value) {
+			err = fmt.Errorf("读回的探测记录与写入的不一致")
+		}
+	}
+	if err != nil {
+		cm.observe(err)
+		return err
+	}
+	if h := cm.health; h != nil {
+		h.failures.Store(0)
+		if h.down.CompareAndSwap(true, false) {
+			logger.Info("缓存存储已恢复，重新使用缓存")
+		}
+	}
+	return nil
+}
+
+// observe 记录一次存储操作的结果。条目不存在、墓碑期和已有更新条目都不算错误；
+// 不可用期间成功的操作不清除状态，以 Probe 的结果为准
+func (cm *CacheManager) observe(err error) {
+	h := cm.health
+	if h == nil {
+		return
+	}
+	switch err {
+	case nil, errNotFound, errTombstoned, errStale:
+		if !h.down.Load() {
+			h.failures.Store(0)
+		}
+		return
+	}
+
+	h.mu.Lock()
+	h.lastErr = err
+	h.mu.Unlock()
+	if h.failures.Add(1) >= h.threshold && h.down.CompareAndSwap(false, true) {
+		logger.Error("缓存存储连续出错，暂停使用缓存，请求直接转发 tushare",
+			zap.Int64("failures", h.failures.Load()),
+			zap.Error(err))
+	}
+}
@@ -0,0 +1,169 @@
+package cache
+
+import (
+	"sync"
+	"time"
+
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// 命中计数在内存中累积，每隔该间隔批量写入存储，读缓存时不再写存储
+const hitFlushInterval = 10 * time.Second
+
+// 每个写事务最多写入的命中计数条数，避免 Badger 事务过大
+const hitFlushBatchSize = 500
+
+// hitDelta 一个缓存键待写入的命中次数
+type hitDelta struct {
+	key        string
+	hits       uint64
+	lastAccess int64
+	ttl        time.Duration
+}
+
+// pendingHits 上次写入以来一个缓存键的命中情况
+type pendingHits struct {
+	// 开始累积时存储中已有的命中次数，只用于返回近似的累计次数
+	base       uint64
+	hits       uint64
+	lastAccess int64
+	expiresAt  time.Time
+}
+
+// hitBuffer 在内存中累积命中计数并定期写入存储。进程异常退出时最多丢失一个间隔的计数
+type hitBuffer struct {
+	backend backend
+
+	mu      sync.Mutex
+	pending map[string]*pendingHits
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newHitBuffer(b backend) *hitBuffer {
+	h := &hitBuffer{
+		backend: b,
+		pending: make(map[string]*pendingHits),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go h.flushLoop()
+	return h
+}
+
+// record 累加一次命中，返回近似的累计命中次数（存储中的次数加上尚未写入的次数）
+func (h *hitBuffer) record(key string, expiresAt time.Time, now time.Time) uint64 {
+	if h == nil {
+		return 0
+	}
+
+	h.mu.Lock()
+	_, ok := h.pending[key]
+	h.mu.Unlock()
+	var base uint64
+	if !ok {
+		// 每个间隔内每个键只读一次存储中的次数，不在锁内读
+		access, _, err := h.backend.inspect(key)
+		if err != nil {
+			logger.Debug("读取缓存命中计数失败", zap.Error(err), zap.String("key", key))
+		}
+		base = access.hits
+	}
+
+	// 查找和累加在同一次加锁内完成，避免累加到 flush 已经取走的记录上
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	p, ok := h.pending[key]
+	if !ok {
+		p = &pendingHits{base: base}
+		h.pending[key] = p
+	}
+	p.hits++
+	p.lastAccess = now.Unix()
+	p.expiresAt = expiresAt
+	return p.base + p.hits
+}
+
+// pendingFor 尚未写入存储的命中次数和最近命中时间
+func (h *hitBuffer) pendingFor(key string) (uint64, int64) {
+	if h == nil {
+		return 0, 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if p, ok := h.pending[key]; ok {
+		return p.hits, p.lastAccess
+	}
+	return 0, 0
+}
+
+// forget 条目被重新写入或删除时丢弃尚未写入的计数，重新写入的条目从 0 开始计数
+func (h *hitBuffer) forget(key string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	delete(h.pending, key)
+	h.mu.Unlock()
+}
+
+func (h *hitBuffer) flushLoop() {
+	defer close(h.done)
+	ticker := time.NewTicker(hitFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			h.flush()
+		case <-h.stop:
+			h.flush()
+			return
+		}
+	}
+}
+
+// flush 把累积的命中计数批量写入存储，写入失败的计数丢弃
+func (h *hitBuffer) flush() {
+	h.mu.Lock()
+	pending := h.pending
+	h.pending = make(map[string]*pendingHits, len(pending))
+	h.mu.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+
+	now := time.Now()
+	batch := make([]hitDelta, 0, min(len(pending), hitFlushBatchSize))
+	write := func() {
+		if err := h.backend.addHits(batch); err != nil {
+			logger.Warn("写入缓存命中计数失败", zap.Error(err), zap.Int("keys", len(batch)))
+		}
+		batch = batch[:0]
+	}
+	for key, p := range pending {
+		ttl := p.expiresAt.Sub(now)
+		if ttl <= 0 {
+			continue
+		}
+		batch = append(batch, hitDelta{key: key, hits: p.hits, lastAccess: p.lastAccess, ttl: ttl})
+		if len(batch) >= hitFlushBatchSize {
+			write()
+		}
+	}
+	if len(batch) > 0 {
+		write()
+	}
+}
+
+// close 停止定期写入并写入剩余的计数
+func (h *hitBuffer) close() {
+	if h == nil {
+		return
+	}
+	close(h.stop)
+	<-h.done
+}
@@ -0,0 +1,28 @@
+package cache
+
+import (
+	"net/http"
+	"time"
+)
+
+// Cache api 包使用的缓存接口。CacheManager（Badger/Redis 存储加可选的内存 LRU）是内置实现，
+// 接入其他存储时实现该接口并通过 api.SetCacheManager 设置即可。缓存键由 KeyPolicy 生成，
+// 实现只负责按键存取
+type Cache interface {
+	// Get 读取未过期的条目，返回的是副本，调用方可以修改其字段
+	Get(key string) (*CacheEntry, bool)
+	// Set 写入条目，header 为需要随条目返回的上游响应头，integrity 为回源时算好的校验值。
+	// 已缓存的条目比 fetchedAt 更新，或键处于手动失效的墓碑期时跳过写入
+	Set(key, namespace string, requestBody, responseBody []byte, statusCode int, header http.Header, expiresAt, fetchedAt time.Time, integrity Integrity) error
+	// Extend 把条目的过期时间延长到 expiresAt，条目已被重新写入时不处理
+	Extend(key string, entry *CacheEntry, expiresAt time.Time) error
+	Delete(key string) error
+	// Invalidate 删除条目，ttl 时长内不再写入该键
+	Invalidate(key string, ttl time.Duration) error
+	// ForEachEntry 遍历所有未过期的条目，供管理接口列出和批量删除
+	ForEachEntry(fn func(key string, entry *CacheEntry, hitCount uint64) error) error
+	Stats() *Stats
+	Close() error
+}
+
+var _ Cache = (*CacheManager)(nil)
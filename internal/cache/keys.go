@@ -0,0 +1,226 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 错误响应和空结果的缓存键前缀，遍历缓存条目时与命中计数一样跳过
+const negativeKeyPrefix = "!neg/"
+
+// KeyVersion 缓存键规则的版本。去掉 token、参数归一化这类会改变缓存键含义的调整要加 1，
+// 旧规则生成的键不再被查询，也就不会把不兼容的旧条目当成命中返回，之后由后台清理删除。
+// 版本 1 以后的版本在命名空间后加上 #v<N>（namespace#v2:hash），命名空间不允许出现 #，不会混淆。
+// 版本 2 去掉 token 并按键名排序后再哈希
+const KeyVersion = 2
+
+// legacyKeyVersion 加入版本之前的规则：直接哈希原始请求体（含 token），键不带版本标记（namespace:hash）。
+// 开启 legacy_cache_key 时使用
+const legacyKeyVersion = 1
+
+// KeyPolicy 缓存键和默认 TTL 的生成规则，与缓存存储无关，api 包按配置创建
+type KeyPolicy struct {
+	defaultTTL       time.Duration
+	defaultNamespace string
+	// 按 api_name 覆盖默认 TTL，按模式长度降序排列
+	ttlOverrides []ttlOverride
+	// 实时类接口当天数据的短 TTL，按模式长度降序排列
+	realtimeTTLs []ttlOverride
+	// 兼容旧版本：直接哈希原始请求体生成缓存键
+	legacyKeys bool
+	// 生成缓存键使用的规则版本，不低于 KeyVersion；兼容旧版本时为 legacyKeyVersion
+	keyVersion int
+}
+
+// ttlOverride 按 api_name 通配模式覆盖的 TTL
+type ttlOverride struct {
+	pattern string
+	ttl     time.Duration
+}
+
+// NewKeyPolicy 创建缓存键规则
+func NewKeyPolicy(defaultTTLSeconds int, defaultNamespace string) *KeyPolicy {
+	if defaultNamespace == "" {
+		defaultNamespace = "default"
+	}
+	return &KeyPolicy{
+		defaultTTL:       time.Duration(defaultTTLSeconds) * time.Second,
+		defaultNamespace: defaultNamespace,
+		keyVersion:       KeyVersion,
+	}
+}
+
+// SetTTLOverrides 设置按 api_name 覆盖的 TTL（秒），多个模式匹配时最长的模式优先
+func (p *KeyPolicy) SetTTLOverrides(overrides map[string]int) {
+	p.ttlOverrides = sortTTLOverrides(overrides)
+}
+
+// SetRealtimeTTLs 设置实时类接口的短 TTL（秒），多个模式匹配时最长的模式优先，0 表示不按实时接口处理
+func (p *KeyPolicy) SetRealtimeTTLs(ttls map[string]int) {
+	p.realtimeTTLs = sortTTLOverrides(ttls)
+}
+
+// sortTTLOverrides 按模式长度降序排列，长度相同时不含通配符的优先（rt_k 优先于 rt_*），
+// 再按字典序，保证匹配结果稳定
+func sortTTLOverrides(overrides map[string]int) []ttlOverride {
+	sorted := make([]ttlOverride, 0, len(overrides))
+	for pattern, seconds := range overrides {
+		sorted = append(sorted, ttlOverride{pattern: pattern, ttl: time.Duration(seconds) * time.Second})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if len(sorted[i].pattern) != len(sorted[j].pattern) {
+			return len(sorted[i].pattern) > len(sorted[j].pattern)
+		}
+		wildI := strings.ContainsAny(sorted[i].pattern, "*?[")
+		wildJ := strings.ContainsAny(sorted[j].pattern, "*?[")
+		if wildI != wildJ {
+			return wildJ
+		}
+		return sorted[i].pattern < sorted[j].pattern
+	})
+	return sorted
+}
+
+// SetLegacyKeys 切换到旧版本（版本 1）的缓存键：直接哈希原始请求体，token 不同的相同查询不共用缓存。
+// 此时新规则写入的条目算作其他版本，由后台清理删除
+func (p *KeyPolicy) SetLegacyKeys(legacy bool) {
+	p.legacyKeys = legacy
+	if legacy {
+		p.keyVersion = legacyKeyVersion
+	} else {
+		p.keyVersion = max(p.keyVersion, KeyVersion)
+	}
+}
+
+// SetKeyVersion 手动调高缓存键版本，让现有缓存整体失效并由后台清理，不高于 KeyVersion 或兼容旧版本时不生效
+func (p *KeyPolicy) SetKeyVersion(version int) {
+	if p.legacyKeys {
+		return
+	}
+	p.keyVersion = max(version, KeyVersion)
+}
+
+// KeyVersion 当前生成缓存键使用的版本
+func (p *KeyPolicy) KeyVersion() int {
+	return p.keyVersion
+}
+
+// StaleKey 是否为其他版本规则生成的缓存键。无法识别的键（例如外部写入的）不算
+func (p *KeyPolicy) StaleKey(key string) bool {
+	version := KeyVersionOf(key)
+	return version != 0 && version != p.keyVersion
+}
+
+// KeyVersionOf 解析缓存键的版本，不是 GenerateKey 生成的键时返回 0
+func KeyVersionOf(key string) int {
+	rest, hash, ok := cutLast(key, ":")
+	if !ok || len(hash) != sha256.Size*2 {
+		return 0
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return 0
+	}
+	if _, marker, ok := cutLast(rest, "#v"); ok {
+		version, err := strconv.Atoi(marker)
+		if err != nil || version <= 1 {
+			return 0
+		}
+		return version
+	}
+	return 1
+}
+
+// cutLast 在最后一个 sep 处切分
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// TTLFor 返回接口的默认 TTL，没有覆盖时使用全局默认值
+func (p *KeyPolicy) TTLFor(apiName string) time.Duration {
+	if ttl, ok := matchTTLOverride(p.ttlOverrides, apiName); ok {
+		return ttl
+	}
+	return p.defaultTTL
+}
+
+// RealtimeTTLFor 返回实时类接口的短 TTL，不是实时类接口时 ok 为 false
+func (p *KeyPolicy) RealtimeTTLFor(apiName string) (ttl time.Duration, ok bool) {
+	if ttl, matched := matchTTLOverride(p.realtimeTTLs, apiName); matched && ttl > 0 {
+		return ttl, true
+	}
+	return 0, false
+}
+
+// matchTTLOverride 返回第一个匹配的覆盖值
+func matchTTLOverride(overrides []ttlOverride, apiName string) (time.Duration, bool) {
+	for _, override := range overrides {
+		// 模式已在配置校验时检查过
+		if ok, _ := path.Match(override.pattern, apiName); ok {
+			return override.ttl, true
+		}
+	}
+	return 0, false
+}
+
+// DefaultNamespace 返回默认命名空间
+func (p *KeyPolicy) DefaultNamespace() string {
+	return p.defaultNamespace
+}
+
+// GenerateKey 根据请求体和命名空间生成缓存键。请求体去掉 token、按键名排序后再哈希，
+// token 不同或字段顺序不同的相同查询共用缓存；兼容旧版本时直接哈希原始请求体
+func (p *KeyPolicy) GenerateKey(namespace string, requestBody []byte) string {
+	resolvedNamespace := resolveNamespace(namespace, p.defaultNamespace)
+	if p.legacyKeys {
+		hash := sha256.Sum256(requestBody)
+		return fmt.Sprintf("%s:%s", resolvedNamespace, hex.EncodeToString(hash[:]))
+	}
+	hash := sha256.Sum256(normalizeKeyBody(requestBody))
+	return fmt.Sprintf("%s#v%d:%s", resolvedNamespace, p.keyVersion, hex.EncodeToString(hash[:]))
+}
+
+// NegativeKey 错误响应和空结果的缓存键。权限、额度类错误因 token 而异，
+// 即使正常缓存键不含 token，也按 token 分开缓存
+func (p *KeyPolicy) NegativeKey(key string, token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return negativeKeyPrefix + key + "/" + hex.EncodeToString(hash[:8])
+}
+
+// resolveNamespace 去掉首尾空白，为空时使用默认命名空间
+func resolveNamespace(namespace, defaultNamespace string) string {
+	namespace = strings.TrimSpace(namespace)
+	if namespace == "" {
+		return defaultNamespace
+	}
+	return namespace
+}
+
+// normalizeKeyBody 去掉 token 并重新序列化，json.Marshal 对 map 按键名排序，
+// params 等嵌套对象也随之排序。解析失败时原样返回
+func normalizeKeyBody(body []byte) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var payload map[string]interface{}
+	if err := decoder.Decode(&payload); err != nil || payload == nil {
+		return body
+	}
+	delete(payload, "token")
+
+	normalized, err := json.Marshal(payload)
+	if err != nil {
+		return body
+	}
+	return normalized
+}
@@ -0,0 +1,153 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// 每个内存条目除键和请求/响应体之外的估算开销
+const memoryItemOverhead = 128
+
+// memoryCache 底层存储前面的进程内 LRU，热点键直接从内存返回，不读存储也不反序列化。
+// 条目数和总字节数任一超限时淘汰最久未访问的条目
+type memoryCache struct {
+	maxEntries int
+	maxBytes   int64
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+	bytes int64
+	// 每次写入失效时递增，读底层存储期间发生过写入的条目不放入内存，避免缓存旧数据
+	generation uint64
+	hits       int64
+	misses     int64
+}
+
+type memoryItem struct {
+	key       string
+	entry     *CacheEntry
+	expiresAt time.Time
+	size      int64
+}
+
+func newMemoryCache(maxEntries int, maxBytes int64) *memoryCache {
+	return &memoryCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+// get 返回未过期的条目，条目由所有读者共享，不能修改
+func (m *memoryCache) get(key string, now time.Time) (*CacheEntry, time.Time, bool) {
+	if m == nil {
+		return nil, time.Time{}, false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	elem, ok := m.items[key]
+	if !ok {
+		m.misses++
+		return nil, time.Time{}, false
+	}
+	item := elem.Value.(*memoryItem)
+	if !now.Before(item.expiresAt) {
+		m.removeElement(elem)
+		m.misses++
+		return nil, time.Time{}, false
+	}
+	m.ll.MoveToFront(elem)
+	m.hits++
+	return item.entry, item.expiresAt, true
+}
+
+// currentGeneration 读底层存储之前记录，放入内存时用来判断期间是否发生过写入
+func (m *memoryCache) currentGeneration() uint64 {
+	if m == nil {
+		return 0
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.generation
+}
+
+// add 放入从底层存储读到的条目，generation 已变化或条目超过总字节上限时跳过
+func (m *memoryCache) add(key string, entry *CacheEntry, expiresAt time.Time, generation uint64) {
+	if m == nil {
+		return
+	}
+
+	size := int64(len(key)+len(entry.RequestBody)+len(entry.ResponseBody)+len(entry.Namespace)) + memoryItemOverhead
+	if m.maxBytes > 0 && size > m.maxBytes {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if generation != m.generation {
+		return
+	}
+	if elem, ok := m.items[key]; ok {
+		m.removeElement(elem)
+	}
+	m.items[key] = m.ll.PushFront(&memoryItem{key: key, entry: entry, expiresAt: expiresAt, size: size})
+	m.bytes += size
+
+	for m.ll.Len() > m.maxEntries || (m.maxBytes > 0 && m.bytes > m.maxBytes) {
+		m.removeElement(m.ll.Back())
+	}
+}
+
+// invalidate 键被写入或删除后从内存中移除
+func (m *memoryCache) invalidate(key string) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.generation++
+	if elem, ok := m.items[key]; ok {
+		m.removeElement(elem)
+	}
+}
+
+// purge 清空内存，只读副本切换快照时使用
+func (m *memoryCache) purge() {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.generation++
+	m.ll.Init()
+	m.items = make(map[string]*list.Element)
+	m.bytes = 0
+}
+
+func (m *memoryCache) removeElement(elem *list.Element) {
+	item := m.ll.Remove(elem).(*memoryItem)
+	delete(m.items, item.key)
+	m.bytes -= item.size
+}
+
+// stats 返回条目数、字节数和命中/未命中次数
+func (m *memoryCache) stats() (int, int64, int64, int64) {
+	if m == nil {
+		return 0, 0, 0, 0
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ll.Len(), m.bytes, m.hits, m.misses
+}
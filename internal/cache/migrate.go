@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// EntryVersion 当前的缓存条目格式版本，写入时记录在条目的 version 字段。
+// 条目格式变化时加 1，并在 entryMigrations 末尾补上从上一版本升级的函数
+const EntryVersion = 1
+
+// entryMigrations[v] 把版本 v 的条目升级到 v+1，读取时按顺序执行，旧数据不用清空
+var entryMigrations = []func(entry *CacheEntry){
+	// 0 → 1：加入版本号之前写入的条目。最早的条目没有上游响应时间，按写入时间补上，
+	// 避免并发写入时被误判为更旧的数据
+	func(entry *CacheEntry) {
+		if entry.FetchedAtMs == 0 && entry.Timestamp > 0 {
+			entry.FetchedAtMs = entry.Timestamp * 1000
+		}
+	},
+}
+
+// migrateEntry 把解码后的条目升级到当前版本。更新版本的程序写入的条目无法识别，按读取失败处理
+func migrateEntry(entry *CacheEntry) error {
+	if entry.Version > EntryVersion {
+		return fmt.Errorf("缓存条目格式版本 %d 高于当前程序支持的 %d，请升级程序", entry.Version, EntryVersion)
+	}
+	for entry.Version < EntryVersion {
+		entryMigrations[entry.Version](entry)
+		entry.Version++
+	}
+	return nil
+}
+
+// decodeEntryVersion 只解析条目的格式版本
+func decodeEntryVersion(data []byte) (int, error) {
+	var meta struct {
+		Version int `json:"version"`
+	}
+	err := json.Unmarshal(data, &meta)
+	return meta.Version, err
+}
+
+// MigrationResult 批量升级缓存条目的结果
+type MigrationResult struct {
+	// 检查的条目数和其中升级了的条目数
+	Scanned  int
+	Migrated int
+	// 格式版本高于当前程序或无法解析的条目
+	Skipped int
+}
+
+// MigrateEntries 把存储中的旧版本条目按当前格式重写，保留过期时间和命中次数。
+// 读取时会自动升级，不执行也能正常使用；执行后省去每次读取时的升级，也便于之后删除过旧的升级函数
+func (cm *CacheManager) MigrateEntries() (*MigrationResult, error) {
+	if cm.readOnly {
+		return nil, fmt.Errorf("只读副本不能升级缓存条目")
+	}
+
+	// 先收集需要升级的键，避免边遍历边写入
+	result := &MigrationResult{}
+	var keys []string
+	err := cm.backend.forEach(func(key string, data []byte, access entryAccess) error {
+		result.Scanned++
+		version, err := decodeEntryVersion(data)
+		if err != nil || version > EntryVersion {
+			result.Skipped++
+			return nil
+		}
+		if version < EntryVersion {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("遍历缓存失败: %w", err)
+	}
+
+	now := time.Now()
+	for _, key := range keys {
+		data, err := cm.backend.get(key)
+		if err == errNotFound {
+			continue
+		}
+		if err != nil {
+			return result, fmt.Errorf("读取缓存条目 %s 失败: %w", key, err)
+		}
+		// 升级前的上游响应时间，写入时用来确认条目没有被重新写入
+		fetchedAtMs, err := decodeFetchedAtMs(data)
+		if err != nil {
+			result.Skipped++
+			continue
+		}
+		entry, err := cm.loadEntry(data)
+		if err != nil {
+			logger.Warn("解析缓存条目失败，跳过", zap.Error(err), zap.String("key", key))
+			result.Skipped++
+			continue
+		}
+
+		expiresAt := entry.resolveExpiresAt(cm.defaultTTL)
+		ttl := expiresAt.Sub(now)
+		if expiresAt.IsZero() || ttl <= 0 {
+			continue
+		}
+		entry.ExpiresAt = expiresAt.Unix()
+		encoded, err := cm.encodeEntry(entry)
+		if err != nil {
+			return result, fmt.Errorf("序列化缓存条目 %s 失败: %w", key, err)
+		}
+		if err := cm.backend.extend(key, encoded, fetchedAtMs, ttl); err != nil {
+			return result, fmt.Errorf("写入缓存条目 %s 失败: %w", key, err)
+		}
+		cm.memory.invalidate(key)
+		result.Migrated++
+	}
+
+	logger.Info("缓存条目格式升级完成",
+		zap.Int("version", EntryVersion),
+		zap.Int("scanned", result.Scanned),
+		zap.Int("migrated", result.Migrated),
+		zap.Int("skipped", result.Skipped))
+	return result, nil
+}
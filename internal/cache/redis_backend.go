@@ -0,0 +1,367 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// 遍历缓存条目时每批 SCAN 的键数
+const redisScanCount = 1000
+
+// RedisOptions Redis 缓存存储的连接参数
+type RedisOptions struct {
+	Addr     string
+	Username string
+	Password string
+	DB       int
+	// 所有键的前缀，多个代理集群共用一个 Redis 时用来区分
+	KeyPrefix string
+}
+
+// redisBackend Redis 存储，多个代理实例共享同一份缓存。
+// 条目、命中计数和墓碑都是带过期时间的普通键，过期由 Redis 自行清理
+type redisBackend struct {
+	client *redis.Client
+	prefix string
+}
+
+func newRedisBackend(opts RedisOptions) (*redisBackend, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     opts.Addr,
+		Username: opts.Username,
+		Password: opts.Password,
+		DB:       opts.DB,
+		// Redis 不可用时尽快按未命中处理并回源，不在重试上耽误请求
+		MaxRetries:    1,
+		DialerRetries: 1,
+		DialTimeout:   2 * time.Second,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("连接 Redis 失败: %w", err)
+	}
+	return &redisBackend{client: client, prefix: opts.KeyPrefix}, nil
+}
+
+func (b *redisBackend) name() string {
+	return BackendRedis
+}
+
+func (b *redisBackend) entryKey(key string) string {
+	return b.prefix + key
+}
+
+func (b *redisBackend) hitCountKey(key string) string {
+	return b.prefix + hitCountKeyPrefix + key
+}
+
+// lastAccessKey 最近命中时间单独保存，命中计数仍用 INCR 累加
+func (b *redisBackend) lastAccessKey(key string) string {
+	return b.prefix + lastAccessKeyPrefix + key
+}
+
+func (b *redisBackend) tombstoneKey(key string) string {
+	return b.prefix + tombstoneKeyPrefix + key
+}
+
+func (b *redisBackend) get(key string) ([]byte, error) {
+	data, err := b.client.Get(context.Background(), b.entryKey(key)).Bytes()
+	if err == redis.Nil {
+		return nil, errNotFound
+	}
+	return data, err
+}
+
+// set 用 WATCH 实现与 Badger 事务相同的检查：墓碑和上游响应时间在写入前被改动时重试
+func (b *redisBackend) set(key string, data []byte, fetchedAtMs int64, ttl time.Duration) error {
+	ctx := context.Background()
+	entryKey, tombKey := b.entryKey(key), b.tombstoneKey(key)
+
+	txf := func(tx *redis.Tx) error {
+		blocked, err := tx.Exists(ctx, tombKey).Result()
+		if err != nil {
+			return err
+		}
+		if blocked > 0 {
+			return errTombstoned
+		}
+		existingFetchedAt, err := b.readFetchedAtMs(ctx, tx, entryKey)
+		if err != nil {
+			return err
+		}
+		if existingFetchedAt > fetchedAtMs {
+			return errStale
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, entryKey, data, ttl)
+			// 重新写入时命中计数归零，计数与条目同时过期
+			pipe.Set(ctx, b.hitCountKey(key), 0, ttl)
+			pipe.Del(ctx, b.lastAccessKey(key))
+			return nil
+		})
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := b.client.Watch(ctx, txf, entryKey, tombKey)
+		if !errors.Is(err, redis.TxFailedErr) || attempt >= maxSetConflictRetries {
+			return err
+		}
+		logger.Debug("缓存写入冲突，重试", zap.String("key", key), zap.Int("attempt", attempt+1))
+	}
+}
+
+func (b *redisBackend) extend(key string, data []byte, fetchedAtMs int64, ttl time.Duration) error {
+	ctx := context.Background()
+	entryKey := b.entryKey(key)
+
+	err := b.client.Watch(ctx, func(tx *redis.Tx) error {
+		existingFetchedAt, err := b.readFetchedAtMs(ctx, tx, entryKey)
+		if err != nil {
+			return err
+		}
+		if existingFetchedAt != fetchedAtMs {
+			return nil
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, entryKey, data, ttl)
+			pipe.PExpire(ctx, b.hitCountKey(key), ttl)
+			pipe.PExpire(ctx, b.lastAccessKey(key), ttl)
+			return nil
+		})
+		return err
+	}, entryKey)
+	// 并发写入时以另一方为准
+	if errors.Is(err, redis.TxFailedErr) {
+		return nil
+	}
+	return err
+}
+
+func (b *redisBackend) delete(key string) error {
+	return b.client.Del(context.Background(), b.entryKey(key), b.hitCountKey(key), b.lastAccessKey(key)).Err()
+}
+
+func (b *redisBackend) invalidate(key string, ttl time.Duration) error {
+	ctx := context.Background()
+	_, err := b.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, b.entryKey(key), b.hitCountKey(key), b.lastAccessKey(key))
+		pipe.Set(ctx, b.tombstoneKey(key), "", ttl)
+		return nil
+	})
+	return err
+}
+
+func (b *redisBackend) addHits(batch []hitDelta) error {
+	ctx := context.Background()
+	exists := make([]*redis.IntCmd, len(batch))
+	_, err := b.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, delta := range batch {
+			exists[i] = pipe.Exists(ctx, b.entryKey(delta.key))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// 多个实例共享计数，用 INCRBY 累加；检查存在和累加之间被删除的条目会留下计数，随 TTL 过期
+	_, err = b.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, delta := range batch {
+			if exists[i].Val() == 0 {
+				continue
+			}
+			pipe.IncrBy(ctx, b.hitCountKey(delta.key), int64(delta.hits))
+			pipe.PExpire(ctx, b.hitCountKey(delta.key), delta.ttl)
+			pipe.Set(ctx, b.lastAccessKey(delta.key), delta.lastAccess, delta.ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+func (b *redisBackend) inspect(key string) (entryAccess, time.Duration, error) {
+	ctx := context.Background()
+	var (
+		hits, lastAccess *redis.StringCmd
+		ttl              *redis.DurationCmd
+	)
+	_, err := b.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		hits = pipe.Get(ctx, b.hitCountKey(key))
+		lastAccess = pipe.Get(ctx, b.lastAccessKey(key))
+		ttl = pipe.PTTL(ctx, b.tombstoneKey(key))
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return entryAccess{}, 0, err
+	}
+
+	access, err := readRedisAccess(hits, lastAccess)
+	if err != nil {
+		return entryAccess{}, 0, err
+	}
+	// 键不存在时 PTTL 返回负数
+	return access, max(ttl.Val(), 0), nil
+}
+
+// readRedisAccess 解析命中次数和最近命中时间，键不存在时为 0
+func readRedisAccess(hits, lastAccess *redis.StringCmd) (entryAccess, error) {
+	var access entryAccess
+	var err error
+	if access.hits, err = hits.Uint64(); err != nil && err != redis.Nil {
+		return access, err
+	}
+	if access.lastAccess, err = lastAccess.Int64(); err != nil && err != redis.Nil {
+		return access, err
+	}
+	return access, nil
+}
+
+// forEach 用 SCAN 分批遍历，遍历期间过期或删除的条目直接跳过
+func (b *redisBackend) forEach(fn func(key string, data []byte, access entryAccess) error) error {
+	ctx := context.Background()
+	match := escapeRedisPattern(b.prefix) + "*"
+
+	var cursor uint64
+	for {
+		keys, next, err := b.client.Scan(ctx, cursor, match, redisScanCount).Result()
+		if err != nil {
+			return err
+		}
+
+		var entryKeys []string
+		for _, redisKey := range keys {
+			key := strings.TrimPrefix(redisKey, b.prefix)
+			if !strings.HasPrefix(key, "!") {
+				entryKeys = append(entryKeys, key)
+			}
+		}
+		if err := b.forEachBatch(ctx, entryKeys, fn); err != nil {
+			return err
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+func (b *redisBackend) forEachBatch(ctx context.Context, keys []string, fn func(key string, data []byte, access entryAccess) error) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	values := make([]*redis.StringCmd, len(keys))
+	hits := make([]*redis.StringCmd, len(keys))
+	lastAccess := make([]*redis.StringCmd, len(keys))
+	_, err := b.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			values[i] = pipe.Get(ctx, b.entryKey(key))
+			hits[i] = pipe.Get(ctx, b.hitCountKey(key))
+			lastAccess[i] = pipe.Get(ctx, b.lastAccessKey(key))
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	for i, key := range keys {
+		data, err := values[i].Bytes()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		access, err := readRedisAccess(hits[i], lastAccess[i])
+		if err != nil {
+			return err
+		}
+		if err := fn(key, data, access); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *redisBackend) putRecord(key string, data []byte, ttl time.Duration) error {
+	return b.client.Set(context.Background(), b.entryKey(key), data, ttl).Err()
+}
+
+func (b *redisBackend) scanRecords(prefix string, fn func(key string, data []byte) error) error {
+	ctx := context.Background()
+	match := escapeRedisPattern(b.prefix+prefix) + "*"
+
+	var cursor uint64
+	for {
+		keys, next, err := b.client.Scan(ctx, cursor, match, redisScanCount).Result()
+		if err != nil {
+			return err
+		}
+
+		if len(keys) > 0 {
+			values, err := b.client.MGet(ctx, keys...).Result()
+			if err != nil {
+				return err
+			}
+			for i, value := range values {
+				// 遍历期间过期的记录为 nil
+				data, ok := value.(string)
+				if !ok {
+					continue
+				}
+				if err := fn(strings.TrimPrefix(keys[i], b.prefix), []byte(data)); err != nil {
+					return err
+				}
+			}
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+func (b *redisBackend) close() error {
+	return b.client.Close()
+}
+
+// readFetchedAtMs 读取已缓存条目的上游响应时间，不存在时返回 0
+func (b *redisBackend) readFetchedAtMs(ctx context.Context, tx *redis.Tx, entryKey string) (int64, error) {
+	data, err := tx.Get(ctx, entryKey).Bytes()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return decodeFetchedAtMs(data)
+}
+
+// escapeRedisPattern 转义 SCAN MATCH 的通配字符
+func escapeRedisPattern(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
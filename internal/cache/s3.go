@@ -0,0 +1,203 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Options S3 兼容对象存储的连接参数
+type S3Options struct {
+	// 服务地址，例如 https://s3.amazonaws.com 或 MinIO 的 http://10.0.0.5:9000
+	Endpoint string
+	Region   string
+	Bucket   string
+	// 对象名前缀，多个代理共用一个桶时用来区分
+	Prefix          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// 路径风格（endpoint/bucket/object），MinIO 等自建服务通常需要；否则用虚拟主机风格（bucket.endpoint/object）
+	PathStyle bool
+	Timeout   time.Duration
+}
+
+// s3Store 只实现冷存储用到的读、写、删单个对象，请求按 AWS Signature V4 签名
+type s3Store struct {
+	opts     S3Options
+	endpoint *url.URL
+	client   *http.Client
+}
+
+func newS3Store(opts S3Options) (*s3Store, error) {
+	endpoint, err := url.Parse(strings.TrimRight(opts.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+		return nil, fmt.Errorf("对象存储地址无效: %q", opts.Endpoint)
+	}
+	if opts.Bucket == "" {
+		return nil, fmt.Errorf("未配置对象存储的桶名")
+	}
+	if opts.AccessKeyID == "" || opts.SecretAccessKey == "" {
+		return nil, fmt.Errorf("未配置对象存储的访问密钥")
+	}
+	return &s3Store{
+		opts:     opts,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: opts.Timeout},
+	}, nil
+}
+
+// objectName 缓存键对应的对象名
+func (s *s3Store) objectName(key string) string {
+	return s.opts.Prefix + key
+}
+
+func (s *s3Store) put(object string, data []byte) error {
+	resp, err := s.do(http.MethodPut, object, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+// get 读取对象，不存在时返回 errNotFound
+func (s *s3Store) get(object string) ([]byte, error) {
+	resp, err := s.do(http.MethodGet, object, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return io.ReadAll(resp.Body)
+	case http.StatusNotFound:
+		return nil, errNotFound
+	}
+	return nil, s3Error(resp)
+}
+
+func (s *s3Store) delete(object string) error {
+	resp, err := s.do(http.MethodDelete, object, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+func (s *s3Store) do(method, object string, body []byte) (*http.Response, error) {
+	u := *s.endpoint
+	path := "/" + escapeS3Path(object)
+	if s.opts.PathStyle {
+		path = "/" + escapeS3Path(s.opts.Bucket) + path
+	} else {
+		u.Host = s.opts.Bucket + "." + u.Host
+	}
+	u.Path, _ = url.PathUnescape(path)
+	u.RawPath = path
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, body, time.Now())
+	return s.client.Do(req)
+}
+
+// sign 按 AWS Signature V4 给请求签名，签名覆盖 host 和请求中已设置的所有请求头
+func (s *s3Store) sign(req *http.Request, body []byte, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + s.opts.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.opts.SecretAccessKey), day)
+	signingKey = hmacSHA256(signingKey, s.opts.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.opts.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// escapeS3Path 按 S3 的规则编码对象名：只保留字母、数字、-_.~ 和 /
+func escapeS3Path(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func s3Error(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("对象存储返回 HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
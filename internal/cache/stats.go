@@ -0,0 +1,176 @@
+package cache
+
+import (
+	"expvar"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Badger 通过 expvar 导出的内部指标
+const (
+	badgerPendingWritesVar    = "badger_write_pending_num_memtable"
+	badgerCompactionTablesVar = "badger_compaction_current_num_lsm"
+)
+
+// Stats 缓存统计信息，包括 Badger 内部指标，用于把缓存延迟抖动和 LSM 活动对应起来。
+// 使用 Redis 存储时只有存储类型和内存 LRU 的统计
+type Stats struct {
+	Backend string `json:"backend"`
+
+	LSMSize   int64 `json:"lsm_size"`
+	VlogSize  int64 `json:"vlog_size"`
+	TotalSize int64 `json:"total_size"`
+	// 值日志文件数，垃圾回收跟不上时会持续增长
+	VlogFiles int `json:"vlog_files"`
+
+	// L0 表数达到 L0StallTables 时写入会被阻塞，直到压缩完成
+	L0Tables      int  `json:"l0_tables"`
+	L0StallTables int  `json:"l0_stall_tables"`
+	WritesStalled bool `json:"writes_stalled"`
+	// 需要压缩的层数（score >= 1）和正在压缩的表数
+	PendingCompactions int   `json:"pending_compactions"`
+	CompactingTables   int64 `json:"compacting_tables"`
+	// 等待写入 memtable 的请求数
+	PendingWrites int64 `json:"pending_writes"`
+
+	Levels []LevelStats `json:"levels,omitempty"`
+
+	// 内存 LRU 的条目数、字节数和命中/未命中次数，未开启时为 0
+	MemoryEntries int   `json:"memory_entries"`
+	MemoryBytes   int64 `json:"memory_bytes"`
+	MemoryHits    int64 `json:"memory_hits"`
+	MemoryMisses  int64 `json:"memory_misses"`
+
+	// 冷存储的移出、取回次数，未开启时为 nil
+	Cold *ColdStats `json:"cold_tier,omitempty"`
+
+	// 条目总大小上限、淘汰策略和启动以来淘汰的条目数，未设置上限时为空
+	MaxBytes       int64  `json:"max_bytes,omitempty"`
+	EvictionPolicy string `json:"eviction_policy,omitempty"`
+	Evicted        int64  `json:"evicted,omitempty"`
+	EvictedBytes   int64  `json:"evicted_bytes,omitempty"`
+
+	// 启动以来读取时发现的损坏条目数，损坏条目已删除并按未命中处理
+	Corrupted int64 `json:"corrupted"`
+	// 启动以来读取时发现已过期并删除的条目数。存储按 TTL 自行清理、没有被读到的过期条目不计入，
+	// 它们占用的空间在垃圾回收时释放，见 GC
+	Expired int64 `json:"expired"`
+	// 值日志垃圾回收的统计，只有 Badger 存储有
+	GC *GCStats `json:"gc,omitempty"`
+
+	// 响应体去重的统计，未开启时为 nil
+	Dedup *DedupStats `json:"dedup,omitempty"`
+}
+
+// LevelStats LSM 单层的统计
+type LevelStats struct {
+	Level      int     `json:"level"`
+	Tables     int     `json:"tables"`
+	Size       int64   `json:"size"`
+	TargetSize int64   `json:"target_size"`
+	Score      float64 `json:"score"`
+}
+
+// Stats 获取缓存统计信息
+func (cm *CacheManager) Stats() *Stats {
+	stats := &Stats{Backend: cm.backend.name()}
+	stats.MemoryEntries, stats.MemoryBytes, stats.MemoryHits, stats.MemoryMisses = cm.memory.stats()
+	stats.Corrupted = cm.corrupted.Load()
+	stats.Expired = cm.expired.Load()
+	if cm.retention != nil {
+		stats.MaxBytes = cm.retention.maxBytes
+		stats.EvictionPolicy = cm.retention.policy
+		stats.Evicted = cm.retention.evicted.Load()
+		stats.EvictedBytes = cm.retention.evictedBytes.Load()
+	}
+	if cm.dedup != nil {
+		stats.Dedup = &DedupStats{
+			Hits:       cm.dedup.hits.Load(),
+			SavedBytes: cm.dedup.savedBytes.Load(),
+		}
+	}
+	if cm.cold != nil {
+		stats.Cold = &ColdStats{
+			Moved:  cm.cold.moved.Load(),
+			Thawed: cm.cold.thawed.Load(),
+			Failed: cm.cold.failed.Load(),
+		}
+	}
+
+	db := cm.badgerDB()
+	if db == nil {
+		return stats
+	}
+	opts := db.Opts()
+	if !cm.readOnly {
+		stats.GC = cm.gcStats.stats()
+	}
+
+	lsm, vlog := db.Size()
+	stats.LSMSize = lsm
+	stats.VlogSize = vlog
+	stats.TotalSize = lsm + vlog
+	stats.VlogFiles, _ = vlogUsage(opts.ValueDir)
+	stats.L0StallTables = opts.NumLevelZeroTablesStall
+
+	for _, level := range db.Levels() {
+		if level.Level == 0 {
+			stats.L0Tables = level.NumTables
+		}
+		if level.Score >= 1 {
+			stats.PendingCompactions++
+		}
+		stats.Levels = append(stats.Levels, LevelStats{
+			Level:      level.Level,
+			Tables:     level.NumTables,
+			Size:       level.Size,
+			TargetSize: level.TargetSize,
+			Score:      level.Score,
+		})
+	}
+	stats.WritesStalled = stats.L0Tables >= stats.L0StallTables
+
+	// Badger 的 expvar 指标是进程级的，压缩表数为所有实例之和，待写入数按目录区分
+	if v, ok := expvar.Get(badgerCompactionTablesVar).(*expvar.Int); ok {
+		stats.CompactingTables = v.Value()
+	}
+	if m, ok := expvar.Get(badgerPendingWritesVar).(*expvar.Map); ok {
+		if v, ok := m.Get(opts.Dir).(*expvar.Int); ok {
+			stats.PendingWrites = v.Value()
+		}
+	}
+
+	return stats
+}
+
+// vlogUsage 统计值日志文件数，以及除正在写入的文件之外的值日志总大小，读目录失败时返回 0。
+// 正在写入的文件由 Badger 预先分配了空间，文件大小不反映实际数据量，垃圾回收也不会回收它
+func vlogUsage(dir string) (int, int64) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, 0
+	}
+
+	// 文件名是补零的序号，ReadDir 按文件名排序，最后一个就是正在写入的文件
+	var sizes []int64
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".vlog") {
+			continue
+		}
+		var size int64
+		if info, err := entry.Info(); err == nil {
+			size = info.Size()
+		}
+		sizes = append(sizes, size)
+	}
+	if len(sizes) == 0 {
+		return 0, 0
+	}
+
+	var total int64
+	for _, size := range sizes[:len(sizes)-1] {
+		total += size
+	}
+	return len(sizes), total
+}
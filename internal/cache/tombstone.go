@@ -0,0 +1,39 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// 手动失效墓碑键前缀，遍历缓存条目时与命中计数一样跳过
+const tombstoneKeyPrefix = "!tomb/"
+
+func tombstoneKey(key string) []byte {
+	return []byte(tombstoneKeyPrefix + key)
+}
+
+// Invalidate 手动失效缓存条目，同时写入 ttl 时长的墓碑。墓碑过期前该键的所有写入都会跳过，
+// 避免后台任务或下一次未命中立刻把同样有问题的上游数据重新写回缓存
+func (cm *CacheManager) Invalidate(key string, ttl time.Duration) error {
+	if cm.readOnly {
+		return fmt.Errorf("只读副本不能失效缓存")
+	}
+	if ttl <= 0 {
+		return fmt.Errorf("墓碑时长必须大于 0")
+	}
+
+	err := cm.backend.invalidate(key, ttl)
+	cm.memory.invalidate(key)
+	cm.hits.forget(key)
+	if err != nil {
+		logger.Error("失效缓存失败", zap.Error(err), zap.String("key", key))
+		return fmt.Errorf("失效缓存失败: %w", err)
+	}
+
+	logger.Info("缓存已手动失效", zap.String("key", key), zap.Duration("tombstone_ttl", ttl))
+	return nil
+}
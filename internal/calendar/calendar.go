@@ -0,0 +1,91 @@
+package calendar
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const dateLayout = "20060102"
+
+// 向前查找交易日的最大天数，覆盖春节、国庆等长假
+const maxLookbackDays = 30
+
+// Calendar 本地交易日历，日期格式为 YYYYMMDD
+type Calendar struct {
+	mu    sync.RWMutex
+	days  map[string]bool
+	first string
+	last  string
+}
+
+// New 创建空日历，Update 之前所有日期都视为未知
+func New() *Calendar {
+	return &Calendar{days: make(map[string]bool)}
+}
+
+// Update 用 cal_date -> is_open 整体替换日历
+func (c *Calendar) Update(days map[string]bool) {
+	dates := make([]string, 0, len(days))
+	for date := range days {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.days = days
+	c.first, c.last = "", ""
+	if len(dates) > 0 {
+		c.first, c.last = dates[0], dates[len(dates)-1]
+	}
+}
+
+// Len 日历覆盖的天数
+func (c *Calendar) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return len(c.days)
+}
+
+// Range 日历覆盖的起止日期
+func (c *Calendar) Range() (string, string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.first, c.last
+}
+
+// IsOpen 返回日期是否为交易日，日期不在日历范围内时 known 为 false
+func (c *Calendar) IsOpen(date string) (open bool, known bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	open, known = c.days[date]
+	return open, known
+}
+
+// PreviousOpen 返回 date 之前（不含）最近的交易日
+func (c *Calendar) PreviousOpen(date string) (string, bool) {
+	day, err := time.Parse(dateLayout, date)
+	if err != nil {
+		return "", false
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for i := 0; i < maxLookbackDays; i++ {
+		day = day.AddDate(0, 0, -1)
+		open, known := c.days[day.Format(dateLayout)]
+		if !known {
+			return "", false
+		}
+		if open {
+			return day.Format(dateLayout), true
+		}
+	}
+	return "", false
+}
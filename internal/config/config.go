@@ -2,9 +2,18 @@
 package config
 
 import (
+	"encoding/hex"
 	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/roowe/tushareproxy/pkg/logger"
 
@@ -12,11 +21,44 @@ import (
 	"go.uber.org/zap"
 )
 
+// DefaultTushareAPIURL tushare 默认接口地址
+const DefaultTushareAPIURL = "http://api.waditu.com/dataapi"
+
 // 主配置结构体
 type Config struct {
-	Server ServerConfig `mapstructure:"server"`
-	Cache  CacheConfig  `mapstructure:"cache"`
-	Log    LogConfig    `mapstructure:"log"`
+	Server      ServerConfig      `mapstructure:"server"`
+	Cache       CacheConfig       `mapstructure:"cache"`
+	Tushare     TushareConfig     `mapstructure:"tushare"`
+	Spool       SpoolConfig       `mapstructure:"spool"`
+	Compression CompressionConfig `mapstructure:"compression"`
+	Batch       BatchConfig       `mapstructure:"batch"`
+	Async       AsyncConfig       `mapstructure:"async"`
+	Split       SplitConfig       `mapstructure:"split"`
+	Stitch      StitchConfig      `mapstructure:"stitch"`
+	Projection  ProjectionConfig  `mapstructure:"projection"`
+	Bulkhead    BulkheadConfig    `mapstructure:"bulkhead"`
+	Access      AccessConfig      `mapstructure:"access"`
+	Auth        AuthConfig        `mapstructure:"auth"`
+	Alert       AlertConfig       `mapstructure:"alert"`
+	SLO         SLOConfig         `mapstructure:"slo"`
+	Admin       AdminConfig       `mapstructure:"admin"`
+	ParamStats  ParamStatsConfig  `mapstructure:"param_stats"`
+	History     HistoryConfig     `mapstructure:"history"`
+	Fixture     FixtureConfig     `mapstructure:"fixture"`
+	DateRange   DateRangeConfig   `mapstructure:"date_range"`
+	Replica     ReplicaConfig     `mapstructure:"replica"`
+	Calendar    CalendarConfig    `mapstructure:"calendar"`
+	Warmup      WarmupConfig      `mapstructure:"warmup"`
+	Prefetch    PrefetchConfig    `mapstructure:"prefetch"`
+	HotRefresh  HotRefreshConfig  `mapstructure:"hot_refresh"`
+	Readiness   ReadinessConfig   `mapstructure:"readiness"`
+	TokenCheck  TokenCheckConfig  `mapstructure:"token_check"`
+	Policy      PolicyConfig      `mapstructure:"policy"`
+	Clock       ClockConfig       `mapstructure:"clock"`
+	Shedding    SheddingConfig    `mapstructure:"load_shedding"`
+	Cluster     ClusterConfig     `mapstructure:"cluster"`
+	Log         LogConfig         `mapstructure:"log"`
+	AccessLog   AccessLogConfig   `mapstructure:"access_log"`
 }
 
 // 服务器配置
@@ -25,6 +67,23 @@ type ServerConfig struct {
 	Port         int    `mapstructure:"port"`
 	ReadTimeout  int    `mapstructure:"read_timeout"`
 	WriteTimeout int    `mapstructure:"write_timeout"`
+	// 加在 /dataapi 等数据接口每个响应上的固定响应头，例如数据授权声明
+	ResponseHeaders map[string]string `mapstructure:"response_headers"`
+	// 配置证书后直接提供 HTTPS
+	TLS TLSConfig `mapstructure:"tls"`
+}
+
+// TLSConfig HTTPS 配置，cert_file 和 key_file 为空时使用 HTTP。收到 SIGHUP 时重新读取证书和客户端 CA
+type TLSConfig struct {
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+	// 配置后要求客户端出示由该 CA 签发的证书（双向 TLS）
+	ClientCAFile string `mapstructure:"client_ca_file"`
+}
+
+// Enabled 是否配置了证书
+func (c *TLSConfig) Enabled() bool {
+	return c.CertFile != ""
 }
 
 // 缓存配置
@@ -34,11 +93,573 @@ type CacheConfig struct {
 	DefaultTTLSeconds int    `mapstructure:"default_ttl_seconds"`
 	DefaultNamespace  string `mapstructure:"default_namespace"`
 	GCIntervalSeconds int    `mapstructure:"gc_interval_seconds"`
+	// 值日志文件中可回收数据的比例达到 gc_discard_ratio 才重写；配置 gc_windows（"HH:MM-HH:MM"，按 gc_timezone）后
+	// 只在这些时间窗口内定时回收，手动触发不受限制
+	GCDiscardRatio float64  `mapstructure:"gc_discard_ratio"`
+	GCWindows      []string `mapstructure:"gc_windows"`
+	GCTimezone     string   `mapstructure:"gc_timezone"`
+
+	// 影子模式：缓存关闭时照常生成缓存键，只在内存中记录假如开启缓存会不会命中和条目大小，不写存储
+	Shadow bool `mapstructure:"shadow"`
+
+	// 缓存存储：badger（本地目录 db_path）或 redis（多个代理实例共享）
+	Backend string      `mapstructure:"backend"`
+	Redis   RedisConfig `mapstructure:"redis"`
+
+	// 命中次数达到 sliding_min_hits 的历史数据在访问时把过期时间顺延 sliding_ttl_seconds，0 表示不顺延
+	SlidingMinHits    int `mapstructure:"sliding_min_hits"`
+	SlidingTTLSeconds int `mapstructure:"sliding_ttl_seconds"`
+
+	// 缓存命中后按该比例在后台重新请求 tushare 比对，0 表示不抽检
+	CanaryRate float64 `mapstructure:"canary_rate"`
+	// 同时进行的抽检请求上限，超过时跳过本次抽检
+	CanaryConcurrency int `mapstructure:"canary_concurrency"`
+
+	// 兼容旧版本的缓存键：直接哈希原始请求体（含 token），升级后想继续使用旧缓存时开启
+	LegacyCacheKey bool `mapstructure:"legacy_cache_key"`
+	// 缓存键版本，调高后现有缓存整体失效，0 表示使用程序内置的版本；只能调高
+	KeyVersion int `mapstructure:"key_version"`
+	// 清理其他版本缓存键的间隔（秒），启动后先清理一次，0 表示不清理
+	StaleKeyCleanupIntervalSeconds int `mapstructure:"stale_key_cleanup_interval_seconds"`
+
+	// 按 api_name（支持通配符）覆盖默认 TTL（秒），请求自带 _cache.ttl/expires_at 时以请求为准
+	TTLOverrides map[string]int `mapstructure:"ttl_overrides"`
+
+	// tushare 错误响应（每分钟限流除外）和空结果按 token 缓存的秒数，0 表示不缓存
+	NegativeTTLSeconds int `mapstructure:"negative_ttl_seconds"`
+
+	// Badger 前面的内存 LRU：最多条目数（0 表示不开启）和总大小上限（0 表示不限）
+	MemoryMaxEntries int `mapstructure:"memory_max_entries"`
+	MemoryMaxMB      int `mapstructure:"memory_max_mb"`
+
+	// 响应体写入存储前的压缩算法：zstd、snappy 或 none，小于 compression_min_bytes 的不压缩。
+	// 读取时按条目记录的算法解压，修改后已有条目仍可读取
+	Compression         string `mapstructure:"compression"`
+	CompressionMinBytes int    `mapstructure:"compression_min_bytes"`
+
+	// 不小于该字节数的响应体按内容哈希单独存放，不同请求返回完全相同的响应体时只存一份；0 表示不去重
+	DedupMinBytes int `mapstructure:"dedup_min_bytes"`
+
+	// 手动失效缓存后墓碑的默认时长（秒），期间该键不会被重新写入
+	TombstoneTTLSeconds int `mapstructure:"tombstone_ttl_seconds"`
+
+	// 异步写缓存的队列长度，0 表示在请求中同步写入；队列满时丢弃写入并记录日志
+	AsyncWriteQueue   int `mapstructure:"async_write_queue"`
+	AsyncWriteWorkers int `mapstructure:"async_write_workers"`
+
+	// 不缓存的接口（api_name 通配模式），例如实时行情，请求直接转发，不生成缓存键也不查询缓存
+	UncacheableAPIs []string `mapstructure:"uncacheable_apis"`
+	// 只缓存历史数据的接口：数据日期（trade_date 或 end_date）不早于今天或没有指定日期的请求不缓存
+	IntradayAPIs []string `mapstructure:"intraday_apis"`
+	// 历史数据不再变化的接口：数据日期（trade_date 或 end_date）早于今天的请求永久缓存，
+	// 包含今天或没有指定日期的请求仍按正常 TTL 缓存
+	ImmutableAPIs []string `mapstructure:"immutable_apis"`
+	// 实时类接口（api_name 通配模式）的短 TTL（秒）：数据日期不早于今天或没有指定日期的请求
+	// 按该 TTL 缓存，优先于 ttl_overrides；内置常见实时接口，设为 0 可取消
+	RealtimeTTLs map[string]int `mapstructure:"realtime_ttls"`
+	// 缓存规则，按顺序匹配，第一条匹配的规则决定请求是否缓存和缓存时长，优先于上面的接口列表；
+	// 都不匹配时按上面的配置处理
+	Rules []CacheRule `mapstructure:"rules"`
+
+	// 本地 Badger 的静态加密密钥（AES，16、24 或 32 字节），从文件或环境变量读取，都为空时不加密。
+	// 已有数据的缓存开启、关闭或更换密钥需要先执行 cache rotate-key
+	EncryptionKeyFile string `mapstructure:"encryption_key_file"`
+	EncryptionKeyEnv  string `mapstructure:"encryption_key_env"`
+
+	// 存储连续出错 health_error_threshold 次后暂停使用缓存、请求直接转发，/readyz 返回 503；
+	// 之后每隔 health_probe_interval_seconds 探测一次，恢复后重新使用。0 表示不判断
+	HealthErrorThreshold       int `mapstructure:"health_error_threshold"`
+	HealthProbeIntervalSeconds int `mapstructure:"health_probe_interval_seconds"`
+
+	// badger 存储中条目总大小的上限（MB），0 表示不限制；超过时按 eviction_policy 淘汰：
+	// lru 先淘汰最久没有命中的条目，lfu 先淘汰命中次数最少的条目
+	MaxSizeMB      int    `mapstructure:"max_size_mb"`
+	EvictionPolicy string `mapstructure:"eviction_policy"`
+
+	// 写入较久的条目移到 S3 兼容的对象存储，访问时再取回本地，只支持 badger 存储
+	ColdTier ColdTierConfig `mapstructure:"cold_tier"`
+
+	// 这些来源的请求始终不读写缓存，直接访问 tushare
+	BypassTokens []string `mapstructure:"bypass_tokens"`
+	// 支持单个 IP 和 CIDR 网段
+	BypassIPs []string `mapstructure:"bypass_ips"`
+}
+
+// 缓存规则：apis 为空时匹配所有接口，params 中的条件全部满足才算匹配
+type CacheRule struct {
+	Name string   `mapstructure:"name"`
+	APIs []string `mapstructure:"apis"`
+	// 参数名到条件：today、before_today、since_today 按日期比较，absent 表示没有该参数，
+	// 其他值作为通配模式匹配参数值
+	Params map[string]string `mapstructure:"params"`
+	// cache 或 no_cache
+	Action string `mapstructure:"action"`
+	// action 为 cache 时的缓存时长（秒），0 表示按默认 TTL 处理；请求自带 _cache.ttl/expires_at 时以请求为准
+	TTLSeconds int `mapstructure:"ttl_seconds"`
+}
+
+// 缓存规则的日期条件
+const (
+	CacheRuleToday       = "today"
+	CacheRuleBeforeToday = "before_today"
+	CacheRuleSinceToday  = "since_today"
+	CacheRuleAbsent      = "absent"
+)
+
+// 缓存冷存储配置
+type ColdTierConfig struct {
+	// 写入超过该天数的条目移到对象存储，0 表示不开启
+	AfterDays int    `mapstructure:"after_days"`
+	Endpoint  string `mapstructure:"endpoint"`
+	Region    string `mapstructure:"region"`
+	Bucket    string `mapstructure:"bucket"`
+	// 对象名前缀，后面接缓存键
+	Prefix string `mapstructure:"prefix"`
+	// 访问密钥，为空时读取环境变量 AWS_ACCESS_KEY_ID 和 AWS_SECRET_ACCESS_KEY
+	AccessKeyID     string `mapstructure:"access_key_id"`
+	SecretAccessKey string `mapstructure:"secret_access_key"`
+	// 使用路径风格的地址（endpoint/bucket/object），MinIO 等自建服务通常需要开启
+	PathStyle           bool `mapstructure:"path_style"`
+	MoveIntervalSeconds int  `mapstructure:"move_interval_seconds"`
+	TimeoutSeconds      int  `mapstructure:"timeout_seconds"`
+}
+
+// Credentials 返回对象存储的访问密钥，配置为空时读取 AWS 的标准环境变量
+func (c *ColdTierConfig) Credentials() (accessKeyID, secretAccessKey string) {
+	accessKeyID, secretAccessKey = c.AccessKeyID, c.SecretAccessKey
+	if accessKeyID == "" {
+		accessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if secretAccessKey == "" {
+		secretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	return accessKeyID, secretAccessKey
+}
+
+// Redis 缓存存储配置
+type RedisConfig struct {
+	Addr     string `mapstructure:"addr"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	DB       int    `mapstructure:"db"`
+	// 所有缓存键的前缀，多个代理集群共用一个 Redis 时用来区分
+	KeyPrefix string `mapstructure:"key_prefix"`
+}
+
+// tushare 上游配置
+type TushareConfig struct {
+	// 离线模式只用缓存应答，不访问 tushare
+	Offline bool `mapstructure:"offline"`
+
+	TimeoutSeconds         int `mapstructure:"timeout_seconds"`
+	DialTimeoutSeconds     int `mapstructure:"dial_timeout_seconds"`
+	KeepAliveSeconds       int `mapstructure:"keep_alive_seconds"`
+	MaxIdleConns           int `mapstructure:"max_idle_conns"`
+	MaxIdleConnsPerHost    int `mapstructure:"max_idle_conns_per_host"`
+	IdleConnTimeoutSeconds int `mapstructure:"idle_conn_timeout_seconds"`
+
+	// tushare 接口地址，例如切换到 http://api.tushare.pro
+	APIURL string `mapstructure:"api_url"`
+	// 按 api_name 通配模式转发到其他地址，多个模式匹配时最长的模式优先
+	Routes map[string]string `mapstructure:"routes"`
+
+	// 访问 tushare 的出站代理，支持 http/https/socks5/socks5h，认证信息写在 URL 里；
+	// 为空时使用 HTTP_PROXY 等环境变量
+	ProxyURL string `mapstructure:"proxy_url"`
+
+	// 发往 tushare 的 User-Agent 和额外请求头
+	UserAgent string            `mapstructure:"user_agent"`
+	Headers   map[string]string `mapstructure:"headers"`
+	// 从客户端请求透传给 tushare 的请求头，例如 User-Agent
+	PassthroughHeaders []string `mapstructure:"passthrough_headers"`
+	// 透传给客户端的 tushare 响应头，随缓存条目保存，命中缓存时同样返回
+	ForwardResponseHeaders []string `mapstructure:"forward_response_headers"`
+
+	// 每分钟限流时等待下一分钟重试
+	RateLimitRetries        int `mapstructure:"rate_limit_retries"`
+	RateLimitMaxWaitSeconds int `mapstructure:"rate_limit_max_wait_seconds"`
+	// 从限流消息中学习各接口每分钟上限，超过时在本地限流
+	LocalRateLimit bool `mapstructure:"local_rate_limit"`
+	// 按 tushare 积分档位预设各接口的每分钟、每天访问上限，0 表示不预设，见 RateLimitTiers。
+	// 设置后自动开启本地限流，从限流消息学到的每分钟上限优先
+	PointsTier int `mapstructure:"points_tier"`
+	// 按 api_name 覆盖档位预设的每分钟、每天访问上限，0 表示不限制
+	MinuteLimits map[string]int `mapstructure:"minute_limits"`
+	DailyLimits  map[string]int `mapstructure:"daily_limits"`
+
+	// 窗口期内字节完全相同的未命中请求只访问一次 tushare，0 表示不合并
+	DedupeWindowSeconds float64 `mapstructure:"dedupe_window_seconds"`
+
+	// 上游响应大小上限，超过时中止读取并返回错误，0 表示不限制。
+	// 设置后只流式返回带 Content-Length 的响应，超限的错误不会变成截断的 200
+	MaxResponseMB int `mapstructure:"max_response_mb"`
+
+	// 出站请求签名，用于 tushare 前面要求签名的网关
+	Signing SigningConfig `mapstructure:"signing"`
+}
+
+// RateLimitTier tushare 积分档位对应的单个接口访问上限，0 表示不限制
+type RateLimitTier struct {
+	PerMinute int
+	PerDay    int
+}
+
+// RateLimitTiers 按 tushare 积分说明整理的各档位常规接口访问上限，
+// 个别接口另有限制时通过 minute_limits、daily_limits 覆盖
+var RateLimitTiers = map[int]RateLimitTier{
+	120:   {PerMinute: 50, PerDay: 8000},
+	2000:  {PerMinute: 200, PerDay: 100000},
+	5000:  {PerMinute: 500},
+	10000: {PerMinute: 1000},
+}
+
+// SigningConfig 出站请求签名配置，签名为
+// HMAC-SHA256(secret, method\npath\ntimestamp\nnonce\nsha256(body)) 的十六进制
+type SigningConfig struct {
+	// 签名密钥，为空时不签名
+	Secret string `mapstructure:"secret"`
+	KeyID  string `mapstructure:"key_id"`
+
+	KeyIDHeader     string `mapstructure:"key_id_header"`
+	TimestampHeader string `mapstructure:"timestamp_header"`
+	NonceHeader     string `mapstructure:"nonce_header"`
+	SignatureHeader string `mapstructure:"signature_header"`
+}
+
+// 大响应落盘配置
+type SpoolConfig struct {
+	Dir               string `mapstructure:"dir"`
+	MemoryThresholdMB int    `mapstructure:"memory_threshold_mb"`
+	MaxCacheMB        int    `mapstructure:"max_cache_mb"`
+	Stream            bool   `mapstructure:"stream"`
+	// 定期清理异常退出遗留的落盘文件和录制临时文件，0 表示只在启动时清理
+	CleanupIntervalSeconds int `mapstructure:"cleanup_interval_seconds"`
+}
+
+// 压缩配置
+type CompressionConfig struct {
+	Enabled      bool `mapstructure:"enabled"`
+	MinSizeKB    int  `mapstructure:"min_size_kb"`
+	UpstreamGzip bool `mapstructure:"upstream_gzip"`
+}
+
+// 批量请求配置
+type BatchConfig struct {
+	MaxRequests int `mapstructure:"max_requests"`
+	Concurrency int `mapstructure:"concurrency"`
+}
+
+// 异步排队配置：客户端带 Prefer: respond-async 时，限流排队的请求先返回 202 和轮询地址
+type AsyncConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// 结果在内存里保留的时长，超时未取走则丢弃
+	ResultTTLSeconds int `mapstructure:"result_ttl_seconds"`
+}
+
+// 长区间请求按自然年拆分配置
+type SplitConfig struct {
+	APIs        []string `mapstructure:"apis"`
+	Concurrency int      `mapstructure:"concurrency"`
+}
+
+// 按日期区间拼接缓存：同时带 start_date 和 end_date 的请求，用已缓存的子区间拼出结果，
+// 只向 tushare 请求缺少的部分
+type StitchConfig struct {
+	APIs []string `mapstructure:"apis"`
+	// 一次拼接最多使用的已缓存子区间数
+	MaxSegments int `mapstructure:"max_segments"`
+	// 拼接时同时执行的子请求数
+	Concurrency int `mapstructure:"concurrency"`
+}
+
+// 按字段裁剪缓存：指定了 fields 的请求未命中时，用不带 fields 的同一请求的缓存结果取出需要的列
+type ProjectionConfig struct {
+	APIs []string `mapstructure:"apis"`
+}
+
+// 按接口隔离访问 tushare 的并发
+type BulkheadConfig struct {
+	// 未归组的接口各自的并发上限，0 表示不限制
+	DefaultConcurrency int `mapstructure:"default_concurrency"`
+	// 等待并发名额的最长时间
+	MaxWaitSeconds int                      `mapstructure:"max_wait_seconds"`
+	Groups         map[string]BulkheadGroup `mapstructure:"groups"`
+}
+
+// 共用一组并发名额的接口
+type BulkheadGroup struct {
+	// api_name 通配模式
+	APIs        []string `mapstructure:"apis"`
+	Concurrency int      `mapstructure:"concurrency"`
+}
+
+// 按时间窗口限制客户端访问
+type AccessConfig struct {
+	// 时间窗口所在时区
+	Timezone string       `mapstructure:"timezone"`
+	Rules    []AccessRule `mapstructure:"rules"`
+}
+
+// 访问时间窗口规则：匹配的请求只能在 allow 列出的时间窗口内访问。
+// tokens 和 ips 都为空时匹配所有客户端，apis 为空时匹配所有接口
+type AccessRule struct {
+	Name   string   `mapstructure:"name"`
+	Tokens []string `mapstructure:"tokens"`
+	IPs    []string `mapstructure:"ips"`
+	APIs   []string `mapstructure:"apis"`
+	// 形如 "18:00-08:00"，结束时间早于开始时间表示跨零点
+	Allow []string `mapstructure:"allow"`
+}
+
+// 告警配置
+type AlertConfig struct {
+	WebhookURL      string `mapstructure:"webhook_url"`
+	TimeoutSeconds  int    `mapstructure:"timeout_seconds"`
+	CooldownSeconds int    `mapstructure:"cooldown_seconds"`
+
+	// 按 api_name 统计滚动窗口内的上游错误率，超过阈值时告警，0 表示不检查
+	UpstreamErrorRate          float64 `mapstructure:"upstream_error_rate"`
+	UpstreamErrorWindowSeconds int     `mapstructure:"upstream_error_window_seconds"`
+	UpstreamErrorMinRequests   int     `mapstructure:"upstream_error_min_requests"`
+
+	// 优雅关闭时把运行统计（运行时长、请求数、命中率、错误数）同时发送到 webhook
+	ShutdownSummary bool `mapstructure:"shutdown_summary"`
+}
+
+// 缓存命中率 SLO 配置
+type SLOConfig struct {
+	WindowSeconds  int                `mapstructure:"window_seconds"`
+	MinRequests    int                `mapstructure:"min_requests"`
+	HitRateTargets map[string]float64 `mapstructure:"hit_rate_targets"`
+}
+
+// 管理接口配置
+type AdminConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Token   string `mapstructure:"token"`
+	// 开启 /admin/debug/pprof/ 性能分析接口，需要配置 token
+	PprofEnabled bool `mapstructure:"pprof_enabled"`
+}
+
+// 客户端鉴权方式
+const (
+	AuthProviderNone     = "none"
+	AuthProviderStatic   = "static"
+	AuthProviderHtpasswd = "htpasswd"
+	AuthProviderOIDC     = "oidc"
+)
+
+// AuthConfig 客户端鉴权配置，作用于 /dataapi 相关接口，管理接口仍使用 admin.token
+type AuthConfig struct {
+	// none、static、htpasswd、oidc
+	Provider string `mapstructure:"provider"`
+	// static：允许的 API key
+	Keys []string `mapstructure:"keys"`
+	// htpasswd：Apache htpasswd 格式的密码文件
+	HtpasswdFile string     `mapstructure:"htpasswd_file"`
+	OIDC         OIDCConfig `mapstructure:"oidc"`
+}
+
+// OIDCConfig 通过 OAuth2 token introspection（RFC 7662）校验访问令牌
+type OIDCConfig struct {
+	IntrospectionURL string `mapstructure:"introspection_url"`
+	ClientID         string `mapstructure:"client_id"`
+	ClientSecret     string `mapstructure:"client_secret"`
+	// 令牌必须包含的 scope，为空时不检查
+	RequiredScope string `mapstructure:"required_scope"`
+	// 校验结果缓存时长，不超过令牌自身的过期时间
+	CacheSeconds   int `mapstructure:"cache_seconds"`
+	TimeoutSeconds int `mapstructure:"timeout_seconds"`
+}
+
+// 请求参数统计配置
+type ParamStatsConfig struct {
+	Enabled       bool    `mapstructure:"enabled"`
+	SampleRate    float64 `mapstructure:"sample_rate"`
+	MaxSignatures int     `mapstructure:"max_signatures"`
+}
+
+// 启动预热配置：启动后在后台依次请求清单中的请求并写入缓存，已缓存的直接跳过
+type WarmupConfig struct {
+	// 预热请求使用的 tushare token
+	Token string `mapstructure:"token"`
+	// 同时进行的预热请求数
+	Concurrency int              `mapstructure:"concurrency"`
+	Requests    []PreloadRequest `mapstructure:"requests"`
+}
+
+// 预热请求，params 中的 {today}、{yesterday} 按执行当天的日期替换为 YYYYMMDD
+type PreloadRequest struct {
+	APIName string                 `mapstructure:"api_name"`
+	Params  map[string]interface{} `mapstructure:"params"`
+	Fields  string                 `mapstructure:"fields"`
+}
+
+// 定时预取配置：在每天固定时间把当天的数据提前写入缓存，供盘后批处理直接命中
+type PrefetchConfig struct {
+	// 预取请求使用的 tushare token
+	Token string `mapstructure:"token"`
+	// 执行时间所在时区
+	Timezone string `mapstructure:"timezone"`
+	// 每个任务同时进行的预取请求数
+	Concurrency int           `mapstructure:"concurrency"`
+	Jobs        []PrefetchJob `mapstructure:"jobs"`
+}
+
+// 定时预取任务
+type PrefetchJob struct {
+	Name string `mapstructure:"name"`
+	// 每天的执行时间，形如 "17:30"
+	At string `mapstructure:"at"`
+	// 默认只在交易日执行（未开启交易日历时按周一到周五判断），true 表示每天执行
+	EveryDay bool `mapstructure:"every_day"`
+	// 按哪个交易所的日历判断交易日，"今天"按该交易所当地时间算，默认 SSE
+	Exchange string `mapstructure:"exchange"`
+	// 忽略已有缓存重新请求 tushare，用于覆盖盘中写入的不完整数据
+	Refresh  bool             `mapstructure:"refresh"`
+	Requests []PreloadRequest `mapstructure:"requests"`
+}
+
+// 热点键提前刷新：记录近期命中最多的缓存键，过期前在后台回源刷新，热点请求不会因为过期而同步等待 tushare
+type HotRefreshConfig struct {
+	// 提前刷新命中最多的前 top_n 个键，0 表示不开启
+	TopN int `mapstructure:"top_n"`
+	// 剩余有效期不足该秒数时刷新
+	RefreshBeforeSeconds int `mapstructure:"refresh_before_seconds"`
+	// 检查间隔（秒），每次检查后命中计数减半，近期命中多的键排在前面
+	CheckIntervalSeconds int `mapstructure:"check_interval_seconds"`
+	// 同时进行的刷新请求数
+	Concurrency int `mapstructure:"concurrency"`
+}
+
+// 就绪检查配置：/readyz 在缓存达到预热标准前返回 503，达到后一直返回 200
+type ReadinessConfig struct {
+	// 启动以来的缓存命中率下限，0 表示不检查；请求数不足 min_requests 时视为未达到
+	MinHitRate  float64 `mapstructure:"min_hit_rate"`
+	MinRequests int     `mapstructure:"min_requests"`
+	// 关键接口至少要有的缓存条目数
+	MinEntries map[string]int `mapstructure:"min_entries"`
+	// 统计缓存条目数的间隔
+	CheckIntervalSeconds int `mapstructure:"check_interval_seconds"`
+	// 探测 tushare 是否可达的间隔，最近一次探测失败时未就绪；0 表示不探测
+	UpstreamProbeIntervalSeconds int `mapstructure:"upstream_probe_interval_seconds"`
+}
+
+// 请求历史配置
+type HistoryConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// 保留最近多少个自然日，含当天
+	RetentionDays int `mapstructure:"retention_days"`
+	// 内存中的汇总写入缓存库的间隔
+	FlushIntervalSeconds int `mapstructure:"flush_interval_seconds"`
+	// 按该时区划分日期
+	Timezone string `mapstructure:"timezone"`
+}
+
+// 录制/回放配置
+type FixtureConfig struct {
+	Mode string `mapstructure:"mode"`
+	Dir  string `mapstructure:"dir"`
+}
+
+// 按接口限制单次请求的日期跨度
+type DateRangeConfig struct {
+	// api_name -> start_date 到 end_date 的最大天数
+	MaxDays map[string]int `mapstructure:"max_days"`
+}
+
+// token 有效性巡检配置
+type TokenCheckConfig struct {
+	// 需要巡检的 tushare token，为空时不巡检
+	Tokens          []string `mapstructure:"tokens"`
+	IntervalSeconds int      `mapstructure:"interval_seconds"`
+}
+
+// 本机时钟偏差检测配置
+type ClockConfig struct {
+	// 按 tushare 响应的 Date 头估算本机时钟偏差，超过该秒数时记录警告，0 表示不检测
+	SkewWarnSeconds int `mapstructure:"skew_warn_seconds"`
+	// 偏差超过 skew_warn_seconds 时，判断"今天"、默认结束日期等日期逻辑按估算的 tushare 时间计算
+	Compensate bool `mapstructure:"compensate"`
+}
+
+// 内存压力下的降级配置
+type SheddingConfig struct {
+	// Go 堆内存和进程 RSS 的上限（MB），超过任一项时拒绝需要访问 tushare 的新请求，缓存命中照常返回；0 表示不检查该项
+	HeapLimitMB int `mapstructure:"heap_limit_mb"`
+	RSSLimitMB  int `mapstructure:"rss_limit_mb"`
+	// 检查内存的间隔（毫秒）
+	CheckIntervalMs int `mapstructure:"check_interval_ms"`
+}
+
+// 缓存集群配置：实例之间互相推送新写入的缓存条目
+type ClusterConfig struct {
+	// 推送目标实例的地址（如 http://10.0.0.2:1155），为空时不推送
+	Peers []string `mapstructure:"peers"`
+	// 实例之间共用的密钥，推送时携带，接收时校验；为空时不接收推送
+	Token string `mapstructure:"token"`
+	// 待推送条目的队列长度，满了之后丢弃新条目
+	QueueSize int `mapstructure:"queue_size"`
+	// 每次推送的最多条目数
+	BatchSize      int `mapstructure:"batch_size"`
+	TimeoutSeconds int `mapstructure:"timeout_seconds"`
+}
+
+// 只读副本配置
+type ReplicaConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// 定期从其他实例 rsync 过来的缓存目录，副本复制到 cache.db_path 下使用
+	SnapshotDir string `mapstructure:"snapshot_dir"`
+	// 未命中时转发到的主代理地址，例如 http://10.0.0.1:1155/dataapi
+	PrimaryURL string `mapstructure:"primary_url"`
+	// 重新打开快照目录、加载 rsync 更新的间隔
+	ReloadIntervalSeconds int `mapstructure:"reload_interval_seconds"`
+}
+
+// 交易日历配置，非交易日的按日请求直接应答或改到前一交易日
+type CalendarConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// 拉取交易日历使用的 tushare token
+	Token string `mapstructure:"token"`
+	// 非交易日处理方式：empty 返回空结果，previous 改成前一个交易日
+	Mode string `mapstructure:"mode"`
+	// 交易所 -> 按 trade_date 查询、需要按该交易所日历检查交易日的接口（支持通配符），交易所见 CalendarSources
+	Exchanges              map[string][]string `mapstructure:"exchanges"`
+	RefreshIntervalSeconds int                 `mapstructure:"refresh_interval_seconds"`
+	// 旧版的单一交易所配置，已改为 exchanges，设置时拒绝启动
+	Exchange string   `mapstructure:"exchange"`
+	APIs     []string `mapstructure:"apis"`
+}
+
+// CalendarSource 交易所日历的拉取接口和所在时区
+type CalendarSource struct {
+	// 拉取日历的接口，trade_cal 按 exchange 参数区分交易所
+	APIName  string
+	Timezone string
+}
+
+// CalendarSources 支持的交易所日历，A 股和期货交易所都用 trade_cal
+var CalendarSources = map[string]CalendarSource{
+	"SSE":    {APIName: "trade_cal", Timezone: "Asia/Shanghai"},
+	"SZSE":   {APIName: "trade_cal", Timezone: "Asia/Shanghai"},
+	"BSE":    {APIName: "trade_cal", Timezone: "Asia/Shanghai"},
+	"CFFEX":  {APIName: "trade_cal", Timezone: "Asia/Shanghai"},
+	"SHFE":   {APIName: "trade_cal", Timezone: "Asia/Shanghai"},
+	"CZCE":   {APIName: "trade_cal", Timezone: "Asia/Shanghai"},
+	"DCE":    {APIName: "trade_cal", Timezone: "Asia/Shanghai"},
+	"INE":    {APIName: "trade_cal", Timezone: "Asia/Shanghai"},
+	"GFEX":   {APIName: "trade_cal", Timezone: "Asia/Shanghai"},
+	"HKEX":   {APIName: "hk_tradecal", Timezone: "Asia/Hong_Kong"},
+	"NYSE":   {APIName: "us_tradecal", Timezone: "America/New_York"},
+	"NASDAQ": {APIName: "us_tradecal", Timezone: "America/New_York"},
 }
 
 // 日志配置 - 直接使用 logger 包中的 Config 类型
 type LogConfig = logger.Config
 
+// 访问日志配置 - 直接使用 logger 包中的 AccessConfig 类型
+type AccessLogConfig = logger.AccessConfig
+
 // 全局变量
 var (
 	globalConfig      *Config
@@ -60,17 +681,241 @@ func setDefaultValues(v *viper.Viper) {
 	v.SetDefault("server.port", 1155)
 	v.SetDefault("server.read_timeout", 30)
 	v.SetDefault("server.write_timeout", 30)
+	v.SetDefault("server.tls.cert_file", "")
+	v.SetDefault("server.tls.key_file", "")
+	v.SetDefault("server.tls.client_ca_file", "")
 
 	// 缓存默认值
 	v.SetDefault("cache.enabled", true)
+	v.SetDefault("cache.backend", "badger")
+	v.SetDefault("cache.redis.addr", "127.0.0.1:6379")
+	v.SetDefault("cache.redis.db", 0)
+	v.SetDefault("cache.redis.key_prefix", "tushareproxy:")
 	v.SetDefault("cache.db_path", "./data/cache")
 	v.SetDefault("cache.default_ttl_seconds", 100*24*60*60)
 	v.SetDefault("cache.default_namespace", "default")
 	v.SetDefault("cache.gc_interval_seconds", 300)
+	v.SetDefault("cache.gc_discard_ratio", 0.5)
+	v.SetDefault("cache.gc_windows", []string{})
+	v.SetDefault("cache.gc_timezone", "Asia/Shanghai")
+	v.SetDefault("cache.sliding_min_hits", 0)
+	v.SetDefault("cache.sliding_ttl_seconds", 7*24*60*60)
+	v.SetDefault("cache.canary_rate", 0.0)
+	v.SetDefault("cache.canary_concurrency", 2)
+	v.SetDefault("cache.legacy_cache_key", false)
+	v.SetDefault("cache.key_version", 0)
+	v.SetDefault("cache.stale_key_cleanup_interval_seconds", 86400)
+	v.SetDefault("cache.negative_ttl_seconds", 0)
+	v.SetDefault("cache.memory_max_entries", 0)
+	v.SetDefault("cache.memory_max_mb", 256)
+	v.SetDefault("cache.tombstone_ttl_seconds", 3600)
+	v.SetDefault("cache.async_write_queue", 0)
+	v.SetDefault("cache.async_write_workers", 2)
+	v.SetDefault("cache.compression", "zstd")
+	v.SetDefault("cache.compression_min_bytes", 1024)
+	v.SetDefault("cache.dedup_min_bytes", 0)
+	v.SetDefault("cache.shadow", false)
+	v.SetDefault("cache.encryption_key_file", "")
+	v.SetDefault("cache.encryption_key_env", "")
+	v.SetDefault("cache.health_error_threshold", 5)
+	v.SetDefault("cache.health_probe_interval_seconds", 10)
+	v.SetDefault("cache.max_size_mb", 0)
+	v.SetDefault("cache.eviction_policy", "lru")
+	v.SetDefault("cache.cold_tier.after_days", 0)
+	v.SetDefault("cache.cold_tier.endpoint", "")
+	v.SetDefault("cache.cold_tier.region", "us-east-1")
+	v.SetDefault("cache.cold_tier.bucket", "")
+	v.SetDefault("cache.cold_tier.prefix", "tushareproxy/")
+	v.SetDefault("cache.cold_tier.access_key_id", "")
+	v.SetDefault("cache.cold_tier.secret_access_key", "")
+	v.SetDefault("cache.cold_tier.path_style", false)
+	v.SetDefault("cache.cold_tier.move_interval_seconds", 3600)
+	v.SetDefault("cache.cold_tier.timeout_seconds", 30)
+	v.SetDefault("cache.uncacheable_apis", []string{})
+	v.SetDefault("cache.intraday_apis", []string{})
+	v.SetDefault("cache.immutable_apis", []string{})
+	// 内置的实时类接口：实时行情几秒内就会变化，分钟线按分钟变化。moneyflow 是盘后数据，按交易日历处理
+	v.SetDefault("cache.realtime_ttls", map[string]interface{}{
+		"rt_*":       5,
+		"realtime_*": 5,
+		"rt_min":     30,
+		"stk_mins":   60,
+	})
+
+	// tushare 上游默认值
+	v.SetDefault("auth.provider", AuthProviderNone)
+	v.SetDefault("auth.keys", []string{})
+	v.SetDefault("auth.htpasswd_file", "")
+	v.SetDefault("auth.oidc.introspection_url", "")
+	v.SetDefault("auth.oidc.client_id", "")
+	v.SetDefault("auth.oidc.client_secret", "")
+	v.SetDefault("auth.oidc.required_scope", "")
+	v.SetDefault("auth.oidc.cache_seconds", 60)
+	v.SetDefault("auth.oidc.timeout_seconds", 5)
+
+	v.SetDefault("tushare.offline", false)
+	v.SetDefault("tushare.timeout_seconds", 30)
+	v.SetDefault("tushare.dial_timeout_seconds", 10)
+	v.SetDefault("tushare.keep_alive_seconds", 30)
+	v.SetDefault("tushare.max_idle_conns", 100)
+	v.SetDefault("tushare.max_idle_conns_per_host", 16)
+	v.SetDefault("tushare.idle_conn_timeout_seconds", 90)
+	v.SetDefault("tushare.api_url", DefaultTushareAPIURL)
+	v.SetDefault("tushare.proxy_url", "")
+	v.SetDefault("tushare.user_agent", "tushareproxy/1.0")
+	v.SetDefault("tushare.passthrough_headers", []string{})
+	v.SetDefault("tushare.rate_limit_retries", 0)
+	v.SetDefault("tushare.rate_limit_max_wait_seconds", 61)
+	v.SetDefault("tushare.local_rate_limit", false)
+	v.SetDefault("tushare.points_tier", 0)
+	v.SetDefault("tushare.max_response_mb", 0)
+	v.SetDefault("tushare.dedupe_window_seconds", 0)
+	v.SetDefault("tushare.signing.secret", "")
+	v.SetDefault("tushare.signing.key_id", "")
+	v.SetDefault("tushare.signing.key_id_header", "X-Key-Id")
+	v.SetDefault("tushare.signing.timestamp_header", "X-Timestamp")
+	v.SetDefault("tushare.signing.nonce_header", "X-Nonce")
+	v.SetDefault("tushare.signing.signature_header", "X-Signature")
+
+	// 落盘默认值
+	v.SetDefault("spool.dir", "./data/spool")
+	v.SetDefault("spool.memory_threshold_mb", 32)
+	v.SetDefault("spool.max_cache_mb", 256)
+	v.SetDefault("spool.stream", true)
+	v.SetDefault("spool.cleanup_interval_seconds", 600)
+
+	// 压缩默认值
+	v.SetDefault("compression.enabled", true)
+	v.SetDefault("compression.min_size_kb", 4)
+	v.SetDefault("compression.upstream_gzip", true)
+
+	// 批量请求默认值
+	v.SetDefault("batch.max_requests", 20)
+	v.SetDefault("batch.concurrency", 4)
+
+	// 异步排队默认值
+	v.SetDefault("async.enabled", false)
+	v.SetDefault("async.result_ttl_seconds", 600)
+
+	// 拆分默认值
+	v.SetDefault("split.apis", []string{})
+	v.SetDefault("split.concurrency", 2)
+
+	// 区间拼接默认值
+	v.SetDefault("stitch.apis", []string{})
+	v.SetDefault("stitch.max_segments", 16)
+	v.SetDefault("stitch.concurrency", 2)
+	v.SetDefault("projection.apis", []string{})
+
+	// 并发隔离默认值
+	v.SetDefault("bulkhead.default_concurrency", 0)
+	v.SetDefault("bulkhead.max_wait_seconds", 30)
+
+	// 访问时间窗口默认值
+	v.SetDefault("access.timezone", "Asia/Shanghai")
+
+	// 告警默认值
+	v.SetDefault("alert.webhook_url", "")
+	v.SetDefault("alert.timeout_seconds", 5)
+	v.SetDefault("alert.cooldown_seconds", 600)
+	v.SetDefault("alert.upstream_error_rate", 0.0)
+	v.SetDefault("alert.upstream_error_window_seconds", 300)
+	v.SetDefault("alert.upstream_error_min_requests", 10)
+	v.SetDefault("alert.shutdown_summary", false)
+
+	// SLO 默认值
+	v.SetDefault("slo.window_seconds", 3600)
+	v.SetDefault("slo.min_requests", 50)
+
+	// 管理接口默认值
+	v.SetDefault("admin.enabled", false)
+	v.SetDefault("admin.token", "")
+	v.SetDefault("admin.pprof_enabled", false)
+
+	// 请求参数统计默认值
+	v.SetDefault("param_stats.enabled", true)
+	v.SetDefault("param_stats.sample_rate", 0.1)
+	v.SetDefault("param_stats.max_signatures", 100)
+
+	// 启动预热默认值
+	v.SetDefault("warmup.concurrency", 2)
+
+	// 定时预取默认值
+	v.SetDefault("prefetch.timezone", "Asia/Shanghai")
+	v.SetDefault("prefetch.concurrency", 2)
+	v.SetDefault("hot_refresh.top_n", 0)
+	v.SetDefault("hot_refresh.refresh_before_seconds", 300)
+	v.SetDefault("hot_refresh.check_interval_seconds", 30)
+	v.SetDefault("hot_refresh.concurrency", 2)
+
+	// 就绪检查默认值
+	v.SetDefault("readiness.min_hit_rate", 0.0)
+	v.SetDefault("readiness.min_requests", 100)
+	v.SetDefault("readiness.check_interval_seconds", 10)
+	v.SetDefault("readiness.upstream_probe_interval_seconds", 0)
+
+	// 请求历史默认值
+	v.SetDefault("history.enabled", false)
+	v.SetDefault("history.retention_days", 7)
+	v.SetDefault("history.flush_interval_seconds", 60)
+	v.SetDefault("history.timezone", "Asia/Shanghai")
+
+	// 录制/回放默认值
+	v.SetDefault("fixture.mode", "off")
+	v.SetDefault("fixture.dir", "./fixtures")
+
+	// 交易日历默认值
+	v.SetDefault("calendar.enabled", false)
+	v.SetDefault("calendar.token", "")
+	v.SetDefault("calendar.mode", "empty")
+	v.SetDefault("calendar.exchanges", map[string]interface{}{
+		"SSE": []string{"daily", "weekly", "monthly", "adj_factor", "daily_basic", "moneyflow", "limit_list_d"},
+	})
+	v.SetDefault("calendar.refresh_interval_seconds", 24*60*60)
+
+	// token 巡检默认值
+	v.SetDefault("token_check.tokens", []string{})
+	v.SetDefault("token_check.interval_seconds", 3600)
+
+	// 接口策略文件默认值
+	v.SetDefault("policy.file", "")
+	v.SetDefault("policy.reload_interval_seconds", 10)
+	v.SetDefault("policy.rate_limit", false)
+
+	// 时钟偏差检测默认值
+	v.SetDefault("clock.skew_warn_seconds", 60)
+	v.SetDefault("clock.compensate", false)
+
+	// 内存压力降级默认值
+	v.SetDefault("load_shedding.heap_limit_mb", 0)
+	v.SetDefault("load_shedding.rss_limit_mb", 0)
+	v.SetDefault("load_shedding.check_interval_ms", 500)
+
+	// 缓存集群默认值
+	v.SetDefault("cluster.peers", []string{})
+	v.SetDefault("cluster.token", "")
+	v.SetDefault("cluster.queue_size", 1000)
+	v.SetDefault("cluster.batch_size", 50)
+	v.SetDefault("cluster.timeout_seconds", 10)
+
+	// 只读副本默认值
+	v.SetDefault("replica.enabled", false)
+	v.SetDefault("replica.snapshot_dir", "")
+	v.SetDefault("replica.primary_url", "")
+	v.SetDefault("replica.reload_interval_seconds", 300)
 
 	// 日志默认值 - 直接使用 logger 包的默认配置
 	logCfg := logger.DefaultConfig()
 	v.SetDefault("log", logCfg)
+
+	// 访问日志默认值
+	accessCfg := logger.DefaultAccessConfig()
+	v.SetDefault("access_log.enabled", accessCfg.Enabled)
+	v.SetDefault("access_log.file_path", accessCfg.FilePath)
+	v.SetDefault("access_log.max_size", accessCfg.MaxSize)
+	v.SetDefault("access_log.max_backups", accessCfg.MaxBackups)
+	v.SetDefault("access_log.max_age", accessCfg.MaxAge)
+	v.SetDefault("access_log.compress", accessCfg.Compress)
 }
 
 // 验证配置
@@ -90,11 +935,31 @@ func validateConfig(config *Config) error {
 	if config.Server.WriteTimeout <= 0 {
 		return fmt.Errorf("写入超时时间必须大于0")
 	}
+	if tlsCfg := config.Server.TLS; (tlsCfg.CertFile == "") != (tlsCfg.KeyFile == "") {
+		return fmt.Errorf("server.tls.cert_file 和 server.tls.key_file 需要同时配置")
+	} else if tlsCfg.ClientCAFile != "" && tlsCfg.CertFile == "" {
+		return fmt.Errorf("配置 server.tls.client_ca_file 时需要同时配置服务端证书")
+	}
 
 	// 验证缓存配置
+	if config.Cache.Shadow && (config.Cache.Enabled || config.Replica.Enabled) {
+		return fmt.Errorf("缓存影子模式只能在缓存关闭时使用，请设置 cache.enabled = false")
+	}
 	if config.Cache.Enabled {
-		if config.Cache.DBPath == "" {
-			return fmt.Errorf("缓存数据库路径不能为空")
+		switch config.Cache.Backend {
+		case "badger":
+			if config.Cache.DBPath == "" {
+				return fmt.Errorf("缓存数据库路径不能为空")
+			}
+		case "redis":
+			if config.Cache.Redis.Addr == "" {
+				return fmt.Errorf("Redis 缓存地址不能为空")
+			}
+			if config.Cache.Redis.DB < 0 {
+				return fmt.Errorf("Redis 数据库编号不能小于 0")
+			}
+		default:
+			return fmt.Errorf("不支持的缓存存储: %q", config.Cache.Backend)
 		}
 		if config.Cache.DefaultTTLSeconds <= 0 {
 			return fmt.Errorf("缓存默认 TTL 必须大于 0 秒")
@@ -105,6 +970,624 @@ func validateConfig(config *Config) error {
 		if config.Cache.GCIntervalSeconds <= 0 {
 			return fmt.Errorf("缓存 GC 间隔必须大于 0 秒")
 		}
+		if config.Cache.GCDiscardRatio <= 0 || config.Cache.GCDiscardRatio >= 1 {
+			return fmt.Errorf("缓存 GC 回收比例必须在 0 到 1 之间")
+		}
+		for _, window := range config.Cache.GCWindows {
+			if _, _, err := ParseTimeWindow(window); err != nil {
+				return fmt.Errorf("缓存 GC 时间窗口: %w", err)
+			}
+		}
+		if _, err := time.LoadLocation(config.Cache.GCTimezone); err != nil {
+			return fmt.Errorf("缓存 GC 的时区无效: %q", config.Cache.GCTimezone)
+		}
+		if config.Cache.KeyVersion < 0 {
+			return fmt.Errorf("缓存键版本不能小于 0")
+		}
+		if config.Cache.LegacyCacheKey && config.Cache.KeyVersion > 0 {
+			return fmt.Errorf("开启 cache.legacy_cache_key 时使用版本 1 的缓存键，不能再设置 cache.key_version")
+		}
+		if config.Cache.StaleKeyCleanupIntervalSeconds < 0 {
+			return fmt.Errorf("旧版本缓存键的清理间隔不能小于 0 秒")
+		}
+		if config.Cache.SlidingMinHits < 0 {
+			return fmt.Errorf("缓存顺延的最小命中次数不能小于 0")
+		}
+		if config.Cache.SlidingMinHits > 0 && config.Cache.SlidingTTLSeconds <= 0 {
+			return fmt.Errorf("缓存顺延时长必须大于 0 秒")
+		}
+		if config.Cache.CanaryRate < 0 || config.Cache.CanaryRate > 1 {
+			return fmt.Errorf("缓存抽检比例必须在 0 到 1 之间")
+		}
+		if config.Cache.CanaryRate > 0 && config.Cache.CanaryConcurrency <= 0 {
+			return fmt.Errorf("缓存抽检并发数必须大于 0")
+		}
+		for pattern, ttl := range config.Cache.TTLOverrides {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("缓存 TTL 覆盖的接口模式无效: %q", pattern)
+			}
+			if ttl <= 0 {
+				return fmt.Errorf("接口 %s 的缓存 TTL 必须大于 0 秒", pattern)
+			}
+		}
+		for _, patterns := range [][]string{config.Cache.UncacheableAPIs, config.Cache.IntradayAPIs} {
+			for _, pattern := range patterns {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return fmt.Errorf("不缓存的接口模式无效: %q", pattern)
+				}
+			}
+		}
+		for _, pattern := range config.Cache.ImmutableAPIs {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("永久缓存的接口模式无效: %q", pattern)
+			}
+		}
+		for pattern, ttl := range config.Cache.RealtimeTTLs {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("实时接口的模式无效: %q", pattern)
+			}
+			if ttl < 0 {
+				return fmt.Errorf("实时接口 %s 的缓存 TTL 不能小于 0 秒", pattern)
+			}
+		}
+		for i, rule := range config.Cache.Rules {
+			name := rule.Name
+			if name == "" {
+				name = fmt.Sprintf("#%d", i+1)
+			}
+			switch rule.Action {
+			case "cache":
+				if rule.TTLSeconds < 0 {
+					return fmt.Errorf("缓存规则 %s 的缓存时长不能小于 0 秒", name)
+				}
+			case "no_cache":
+				if rule.TTLSeconds != 0 {
+					return fmt.Errorf("缓存规则 %s 不缓存，不能配置 ttl_seconds", name)
+				}
+			default:
+				return fmt.Errorf("缓存规则 %s 的动作无效: %q，可选 cache、no_cache", name, rule.Action)
+			}
+			for _, pattern := range rule.APIs {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return fmt.Errorf("缓存规则 %s 的接口模式无效: %q", name, pattern)
+				}
+			}
+			for param, cond := range rule.Params {
+				if _, err := path.Match(cond, ""); err != nil {
+					return fmt.Errorf("缓存规则 %s 的参数 %s 条件无效: %q", name, param, cond)
+				}
+			}
+		}
+		if config.Cache.NegativeTTLSeconds < 0 {
+			return fmt.Errorf("错误响应缓存时长不能小于 0 秒")
+		}
+		if config.Cache.MemoryMaxEntries < 0 || config.Cache.MemoryMaxMB < 0 {
+			return fmt.Errorf("内存缓存的条目数和大小上限不能小于 0")
+		}
+		if config.Cache.TombstoneTTLSeconds <= 0 {
+			return fmt.Errorf("缓存失效墓碑时长必须大于 0 秒")
+		}
+		if config.Cache.AsyncWriteQueue < 0 {
+			return fmt.Errorf("异步缓存写入队列长度不能小于 0")
+		}
+		if config.Cache.AsyncWriteQueue > 0 && config.Cache.AsyncWriteWorkers <= 0 {
+			return fmt.Errorf("异步缓存写入的 worker 数必须大于 0")
+		}
+		switch config.Cache.Compression {
+		case "zstd", "snappy", "none":
+		default:
+			return fmt.Errorf("不支持的缓存压缩算法: %q", config.Cache.Compression)
+		}
+		if config.Cache.CompressionMinBytes < 0 {
+			return fmt.Errorf("缓存压缩阈值不能小于 0")
+		}
+		if config.Cache.DedupMinBytes < 0 {
+			return fmt.Errorf("响应体去重阈值不能小于 0")
+		}
+		if config.Cache.EncryptionKeyFile != "" && config.Cache.EncryptionKeyEnv != "" {
+			return fmt.Errorf("缓存加密密钥只能从 encryption_key_file 和 encryption_key_env 中选一个")
+		}
+		key, err := config.Cache.EncryptionKey()
+		if err != nil {
+			return err
+		}
+		if key != nil && config.Cache.Backend == "redis" {
+			return fmt.Errorf("静态加密只支持 badger 存储，Redis 请使用 Redis 自身的加密方案")
+		}
+		if config.Cache.HealthErrorThreshold < 0 {
+			return fmt.Errorf("缓存存储连续出错阈值不能小于 0")
+		}
+		if config.Cache.HealthErrorThreshold > 0 && config.Cache.HealthProbeIntervalSeconds <= 0 {
+			return fmt.Errorf("缓存存储探测间隔必须大于 0 秒")
+		}
+		if config.Cache.MaxSizeMB < 0 {
+			return fmt.Errorf("缓存容量上限不能小于 0")
+		}
+		if config.Cache.MaxSizeMB > 0 && config.Cache.Backend == "redis" {
+			return fmt.Errorf("缓存容量上限只支持 badger 存储，Redis 请配置 maxmemory 和 maxmemory-policy")
+		}
+		switch config.Cache.EvictionPolicy {
+		case "lru", "lfu":
+		default:
+			return fmt.Errorf("缓存淘汰策略只支持 lru 和 lfu: %q", config.Cache.EvictionPolicy)
+		}
+		if cold := config.Cache.ColdTier; cold.AfterDays != 0 {
+			if cold.AfterDays < 0 {
+				return fmt.Errorf("冷存储天数不能小于 0")
+			}
+			if config.Cache.Backend == "redis" {
+				return fmt.Errorf("冷存储只支持 badger 存储")
+			}
+			if u, err := url.Parse(cold.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("冷存储地址无效: %q", cold.Endpoint)
+			}
+			if cold.Bucket == "" || cold.Region == "" {
+				return fmt.Errorf("冷存储需要配置 bucket 和 region")
+			}
+			if id, secret := cold.Credentials(); id == "" || secret == "" {
+				return fmt.Errorf("冷存储需要配置访问密钥，或设置环境变量 AWS_ACCESS_KEY_ID 和 AWS_SECRET_ACCESS_KEY")
+			}
+			if cold.MoveIntervalSeconds <= 0 || cold.TimeoutSeconds <= 0 {
+				return fmt.Errorf("冷存储的检查间隔和超时时间必须大于 0 秒")
+			}
+		}
+	}
+	if _, err := ParseIPRanges(config.Cache.BypassIPs); err != nil {
+		return err
+	}
+
+	if err := validateAuth(&config.Auth); err != nil {
+		return err
+	}
+	if config.Admin.Enabled && config.Admin.Token == "" {
+		return fmt.Errorf("开启管理接口需要配置 admin.token")
+	}
+	if config.Admin.PprofEnabled && !config.Admin.Enabled {
+		return fmt.Errorf("开启 admin.pprof_enabled 需要开启管理接口")
+	}
+
+	// 验证 tushare 上游配置
+	if config.Tushare.TimeoutSeconds <= 0 {
+		return fmt.Errorf("tushare 请求超时时间必须大于 0 秒")
+	}
+	if config.Tushare.DialTimeoutSeconds <= 0 {
+		return fmt.Errorf("tushare 连接超时时间必须大于 0 秒")
+	}
+	if config.Tushare.MaxIdleConns < 0 || config.Tushare.MaxIdleConnsPerHost < 0 {
+		return fmt.Errorf("tushare 空闲连接数不能小于 0")
+	}
+	if config.Tushare.IdleConnTimeoutSeconds < 0 {
+		return fmt.Errorf("tushare 空闲连接超时时间不能小于 0 秒")
+	}
+	if !isHTTPURL(config.Tushare.APIURL) {
+		return fmt.Errorf("tushare 接口地址无效: %q", config.Tushare.APIURL)
+	}
+	for pattern, target := range config.Tushare.Routes {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("tushare 路由模式无效: %q", pattern)
+		}
+		if !isHTTPURL(target) {
+			return fmt.Errorf("tushare 路由 %s 的地址无效: %q", pattern, target)
+		}
+	}
+	if config.Tushare.ProxyURL != "" {
+		proxyURL, err := url.Parse(config.Tushare.ProxyURL)
+		if err != nil {
+			return fmt.Errorf("tushare 出站代理地址无效: %w", err)
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return fmt.Errorf("tushare 出站代理只支持 http、https、socks5、socks5h: %s", proxyURL.Scheme)
+		}
+		if proxyURL.Host == "" {
+			return fmt.Errorf("tushare 出站代理地址缺少主机: %s", proxyURL.Redacted())
+		}
+	}
+
+	for name := range config.Tushare.Headers {
+		if IsReservedUpstreamHeader(name) {
+			return fmt.Errorf("tushare 请求头 %s 由代理管理，不能配置", name)
+		}
+	}
+	for _, name := range config.Tushare.PassthroughHeaders {
+		if IsReservedUpstreamHeader(name) {
+			return fmt.Errorf("tushare 请求头 %s 由代理管理，不能透传", name)
+		}
+	}
+	for _, name := range config.Tushare.ForwardResponseHeaders {
+		if IsReservedResponseHeader(name) {
+			return fmt.Errorf("响应头 %s 由代理管理，不能透传", name)
+		}
+	}
+	for name := range config.Server.ResponseHeaders {
+		if IsReservedResponseHeader(name) {
+			return fmt.Errorf("响应头 %s 由代理管理，不能配置", name)
+		}
+	}
+
+	if config.Tushare.RateLimitRetries < 0 {
+		return fmt.Errorf("tushare 限流重试次数不能小于 0")
+	}
+	if config.Tushare.RateLimitMaxWaitSeconds < 0 {
+		return fmt.Errorf("tushare 限流最长等待时间不能小于 0 秒")
+	}
+	if config.Tushare.RateLimitRetries > 0 &&
+		config.Server.WriteTimeout <= config.Tushare.RateLimitMaxWaitSeconds+config.Tushare.TimeoutSeconds {
+		return fmt.Errorf("开启限流重试时 server.write_timeout 必须大于 tushare.rate_limit_max_wait_seconds 与 tushare.timeout_seconds 之和")
+	}
+	if config.Tushare.DedupeWindowSeconds < 0 {
+		return fmt.Errorf("tushare 请求去重窗口不能小于 0 秒")
+	}
+	if config.Tushare.MaxResponseMB < 0 {
+		return fmt.Errorf("tushare 响应大小上限不能小于 0 MB")
+	}
+	if err := validateSigning(&config.Tushare.Signing); err != nil {
+		return err
+	}
+
+	// 验证落盘配置
+	if config.Spool.Dir == "" {
+		return fmt.Errorf("落盘目录不能为空")
+	}
+	if config.Spool.MemoryThresholdMB <= 0 {
+		return fmt.Errorf("落盘内存阈值必须大于 0 MB")
+	}
+	if config.Spool.MaxCacheMB < 0 {
+		return fmt.Errorf("落盘响应最大缓存大小不能小于 0 MB")
+	}
+	if config.Spool.CleanupIntervalSeconds < 0 {
+		return fmt.Errorf("临时文件清理间隔不能小于 0 秒")
+	}
+
+	// 验证压缩配置
+	if config.Compression.MinSizeKB < 0 {
+		return fmt.Errorf("压缩最小响应大小不能小于 0 KB")
+	}
+
+	// 验证批量请求配置
+	if config.Batch.MaxRequests <= 0 {
+		return fmt.Errorf("批量请求最大数量必须大于 0")
+	}
+	if config.Batch.Concurrency <= 0 {
+		return fmt.Errorf("批量请求并发数必须大于 0")
+	}
+
+	// 验证异步排队配置
+	if config.Async.Enabled && config.Async.ResultTTLSeconds <= 0 {
+		return fmt.Errorf("异步排队结果保留时长必须大于 0")
+	}
+
+	// 验证拆分配置
+	if config.Split.Concurrency <= 0 {
+		return fmt.Errorf("拆分请求并发数必须大于 0")
+	}
+
+	// 验证分级限速配置
+	if config.Tushare.PointsTier != 0 {
+		if _, ok := RateLimitTiers[config.Tushare.PointsTier]; !ok {
+			return fmt.Errorf("不支持的积分档位: %d (可选 120、2000、5000、10000)", config.Tushare.PointsTier)
+		}
+	}
+	for apiName, limit := range config.Tushare.MinuteLimits {
+		if limit < 0 {
+			return fmt.Errorf("接口 %s 的每分钟访问上限不能小于 0", apiName)
+		}
+	}
+	for apiName, limit := range config.Tushare.DailyLimits {
+		if limit < 0 {
+			return fmt.Errorf("接口 %s 的每天访问上限不能小于 0", apiName)
+		}
+	}
+
+	// 验证区间拼接配置
+	if len(config.Stitch.APIs) > 0 {
+		if !config.Cache.Enabled {
+			return fmt.Errorf("区间拼接需要开启缓存")
+		}
+		if config.Stitch.MaxSegments <= 0 {
+			return fmt.Errorf("区间拼接的最大子区间数必须大于 0")
+		}
+		if config.Stitch.Concurrency <= 0 {
+			return fmt.Errorf("区间拼接并发数必须大于 0")
+		}
+	}
+
+	// 验证按字段裁剪配置
+	if len(config.Projection.APIs) > 0 && !config.Cache.Enabled && !config.Replica.Enabled {
+		return fmt.Errorf("按字段裁剪缓存需要开启缓存")
+	}
+
+	// 验证并发隔离配置
+	if config.Bulkhead.DefaultConcurrency < 0 {
+		return fmt.Errorf("接口默认并发上限不能小于 0")
+	}
+	if config.Bulkhead.MaxWaitSeconds <= 0 {
+		return fmt.Errorf("等待并发名额的最长时间必须大于 0 秒")
+	}
+	for name, group := range config.Bulkhead.Groups {
+		if group.Concurrency <= 0 {
+			return fmt.Errorf("并发隔离分组 %s 的并发上限必须大于 0", name)
+		}
+		if len(group.APIs) == 0 {
+			return fmt.Errorf("并发隔离分组 %s 没有配置接口", name)
+		}
+		for _, pattern := range group.APIs {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("并发隔离分组 %s 的接口模式无效: %q", name, pattern)
+			}
+		}
+	}
+
+	// 验证接口策略文件，启动时策略文件有错误直接拒绝启动
+	if config.Policy.ReloadIntervalSeconds < 0 {
+		return fmt.Errorf("策略文件检查间隔不能小于 0 秒")
+	}
+	if config.Policy.RateLimit && config.Policy.File == "" {
+		return fmt.Errorf("开启 policy.rate_limit 需要配置 policy.file")
+	}
+	if config.Policy.File != "" {
+		if _, err := LoadPolicyFile(config.Policy.File); err != nil {
+			return err
+		}
+	}
+
+	// 验证时钟偏差检测配置
+	if config.Clock.SkewWarnSeconds < 0 {
+		return fmt.Errorf("时钟偏差警告阈值不能小于 0 秒")
+	}
+	if config.Clock.Compensate && config.Clock.SkewWarnSeconds == 0 {
+		return fmt.Errorf("开启时钟偏差补偿需要同时配置 clock.skew_warn_seconds")
+	}
+
+	// 验证内存压力降级配置
+	if config.Shedding.HeapLimitMB < 0 || config.Shedding.RSSLimitMB < 0 {
+		return fmt.Errorf("内存降级阈值不能小于 0")
+	}
+	if (config.Shedding.HeapLimitMB > 0 || config.Shedding.RSSLimitMB > 0) && config.Shedding.CheckIntervalMs < 10 {
+		return fmt.Errorf("内存检查间隔不能小于 10 毫秒")
+	}
+
+	// 验证缓存集群配置
+	if len(config.Cluster.Peers) > 0 || config.Cluster.Token != "" {
+		if config.Cluster.Token == "" {
+			return fmt.Errorf("配置了 cluster.peers 时必须设置 cluster.token")
+		}
+		if !config.Cache.Enabled || config.Replica.Enabled {
+			return fmt.Errorf("缓存集群需要开启缓存，且不能用于只读副本")
+		}
+		if config.Cache.Backend == "redis" {
+			return fmt.Errorf("使用 Redis 存储的实例已经共享缓存，不需要缓存集群")
+		}
+		for _, peer := range config.Cluster.Peers {
+			if u, err := url.Parse(peer); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("缓存集群实例地址无效: %q", peer)
+			}
+		}
+		if config.Cluster.QueueSize <= 0 || config.Cluster.BatchSize <= 0 {
+			return fmt.Errorf("缓存集群的队列长度和每批条目数必须大于 0")
+		}
+		if config.Cluster.TimeoutSeconds <= 0 {
+			return fmt.Errorf("缓存集群推送超时时间必须大于 0 秒")
+		}
+	}
+
+	// 验证访问时间窗口配置
+	if _, err := time.LoadLocation(config.Access.Timezone); err != nil {
+		return fmt.Errorf("访问时间窗口的时区无效: %q", config.Access.Timezone)
+	}
+	for i, rule := range config.Access.Rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if len(rule.Allow) == 0 {
+			return fmt.Errorf("访问规则 %s 没有配置允许的时间窗口", name)
+		}
+		for _, window := range rule.Allow {
+			if _, _, err := ParseTimeWindow(window); err != nil {
+				return fmt.Errorf("访问规则 %s: %w", name, err)
+			}
+		}
+		if _, err := ParseIPRanges(rule.IPs); err != nil {
+			return fmt.Errorf("访问规则 %s: %w", name, err)
+		}
+		for _, pattern := range rule.APIs {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("访问规则 %s 的接口模式无效: %q", name, pattern)
+			}
+		}
+	}
+
+	// 验证告警配置
+	if config.Alert.TimeoutSeconds <= 0 {
+		return fmt.Errorf("告警 webhook 超时时间必须大于 0 秒")
+	}
+	if config.Alert.CooldownSeconds < 0 {
+		return fmt.Errorf("告警冷却时间不能小于 0 秒")
+	}
+	if config.Alert.UpstreamErrorRate < 0 || config.Alert.UpstreamErrorRate > 1 {
+		return fmt.Errorf("上游错误率告警阈值必须在 0 到 1 之间")
+	}
+	if config.Alert.UpstreamErrorRate > 0 && config.Alert.UpstreamErrorWindowSeconds < 60 {
+		return fmt.Errorf("上游错误率统计窗口不能小于 60 秒")
+	}
+
+	// 验证 SLO 配置
+	if config.SLO.WindowSeconds < 60 {
+		return fmt.Errorf("SLO 统计窗口不能小于 60 秒")
+	}
+	for apiName, target := range config.SLO.HitRateTargets {
+		if target <= 0 || target > 1 {
+			return fmt.Errorf("接口 %s 的命中率目标必须在 (0, 1] 之间", apiName)
+		}
+	}
+
+	// 验证请求参数统计配置
+	if config.ParamStats.Enabled {
+		if config.ParamStats.SampleRate <= 0 || config.ParamStats.SampleRate > 1 {
+			return fmt.Errorf("参数统计抽样率必须在 (0, 1] 之间")
+		}
+		if config.ParamStats.MaxSignatures <= 0 {
+			return fmt.Errorf("参数统计最大组合数必须大于 0")
+		}
+	}
+
+	// 验证启动预热配置
+	if len(config.Warmup.Requests) > 0 {
+		if !config.Cache.Enabled && !config.Replica.Enabled {
+			return fmt.Errorf("启动预热需要开启缓存")
+		}
+		if config.Warmup.Token == "" {
+			return fmt.Errorf("启动预热需要配置 warmup.token")
+		}
+		if config.Warmup.Concurrency <= 0 {
+			return fmt.Errorf("启动预热并发数必须大于 0")
+		}
+		for i, request := range config.Warmup.Requests {
+			if strings.TrimSpace(request.APIName) == "" {
+				return fmt.Errorf("第 %d 个预热请求缺少 api_name", i+1)
+			}
+		}
+	}
+
+	// 验证定时预取配置
+	if len(config.Prefetch.Jobs) > 0 {
+		if err := validatePrefetch(config); err != nil {
+			return err
+		}
+	}
+
+	// 验证热点键提前刷新配置
+	if config.HotRefresh.TopN < 0 {
+		return fmt.Errorf("热点键提前刷新的 top_n 不能小于 0")
+	}
+	if config.HotRefresh.TopN > 0 {
+		if !config.Cache.Enabled || config.Replica.Enabled {
+			return fmt.Errorf("热点键提前刷新需要开启缓存，且不能在只读副本上使用")
+		}
+		if config.HotRefresh.RefreshBeforeSeconds <= 0 {
+			return fmt.Errorf("热点键提前刷新的 refresh_before_seconds 必须大于 0")
+		}
+		if config.HotRefresh.CheckIntervalSeconds <= 0 {
+			return fmt.Errorf("热点键提前刷新的检查间隔必须大于 0")
+		}
+		if config.HotRefresh.Concurrency <= 0 {
+			return fmt.Errorf("热点键提前刷新的并发数必须大于 0")
+		}
+	}
+
+	// 验证就绪检查配置
+	if config.Readiness.MinHitRate < 0 || config.Readiness.MinHitRate > 1 {
+		return fmt.Errorf("就绪检查的最低命中率必须在 0 到 1 之间")
+	}
+	if config.Readiness.MinHitRate > 0 || len(config.Readiness.MinEntries) > 0 {
+		if !config.Cache.Enabled {
+			return fmt.Errorf("就绪检查的预热标准需要开启缓存")
+		}
+		if config.Readiness.MinRequests <= 0 {
+			return fmt.Errorf("就绪检查的最少请求数必须大于 0")
+		}
+		if config.Readiness.CheckIntervalSeconds <= 0 {
+			return fmt.Errorf("就绪检查的统计间隔必须大于 0 秒")
+		}
+	}
+	if config.Readiness.UpstreamProbeIntervalSeconds < 0 {
+		return fmt.Errorf("就绪检查的上游探测间隔不能小于 0 秒")
+	}
+
+	// 验证请求历史配置
+	if config.History.Enabled {
+		if !config.Cache.Enabled || config.Replica.Enabled {
+			return fmt.Errorf("请求历史保存在缓存库中，需要开启缓存且不能是只读副本")
+		}
+		if config.History.RetentionDays <= 0 {
+			return fmt.Errorf("请求历史保留天数必须大于 0")
+		}
+		if config.History.FlushIntervalSeconds <= 0 {
+			return fmt.Errorf("请求历史写入间隔必须大于 0")
+		}
+		if _, err := time.LoadLocation(config.History.Timezone); err != nil {
+			return fmt.Errorf("请求历史的时区无效: %q", config.History.Timezone)
+		}
+	}
+
+	// 验证日期跨度配置
+	for apiName, days := range config.DateRange.MaxDays {
+		if days <= 0 {
+			return fmt.Errorf("接口 %s 的最大日期跨度必须大于 0 天", apiName)
+		}
+	}
+
+	// 验证交易日历配置
+	if config.Calendar.Enabled {
+		if config.Calendar.Token == "" {
+			return fmt.Errorf("交易日历需要配置拉取 trade_cal 的 token")
+		}
+		if config.Calendar.Mode != "empty" && config.Calendar.Mode != "previous" {
+			return fmt.Errorf("无效的交易日历处理方式: %s (可选 empty、previous)", config.Calendar.Mode)
+		}
+		if config.Calendar.RefreshIntervalSeconds <= 0 {
+			return fmt.Errorf("交易日历刷新间隔必须大于 0 秒")
+		}
+		if config.Calendar.Exchange != "" || len(config.Calendar.APIs) > 0 {
+			return fmt.Errorf("calendar.exchange 和 calendar.apis 已改为 calendar.exchanges，例如 exchanges = { SSE = [\"daily\"] }")
+		}
+		// 同一接口只能属于一个交易所，否则不知道按哪个日历检查
+		owners := make(map[string]string)
+		for exchange, patterns := range config.Calendar.Exchanges {
+			// viper 读出的键是小写
+			exchange = strings.ToUpper(exchange)
+			if _, ok := CalendarSources[exchange]; !ok {
+				return fmt.Errorf("交易日历不支持交易所 %s", exchange)
+			}
+			for _, pattern := range patterns {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return fmt.Errorf("交易所 %s 的接口模式无效: %q", exchange, pattern)
+				}
+				if owner, ok := owners[pattern]; ok {
+					return fmt.Errorf("接口 %s 同时配置在交易所 %s 和 %s 的日历中", pattern, owner, exchange)
+				}
+				owners[pattern] = exchange
+			}
+		}
+	}
+
+	// 验证 token 巡检配置
+	if len(config.TokenCheck.Tokens) > 0 && config.TokenCheck.IntervalSeconds <= 0 {
+		return fmt.Errorf("token 巡检间隔必须大于 0 秒")
+	}
+
+	// 验证只读副本配置
+	if config.Replica.Enabled {
+		if !config.Cache.Enabled {
+			return fmt.Errorf("只读副本模式需要开启缓存")
+		}
+		if config.Cache.Backend != "badger" {
+			return fmt.Errorf("只读副本模式只支持 badger 缓存存储，使用 redis 时各实例直接共享缓存")
+		}
+		if config.Replica.SnapshotDir == "" {
+			return fmt.Errorf("只读副本的快照目录不能为空")
+		}
+		if filepath.Clean(config.Replica.SnapshotDir) == filepath.Clean(config.Cache.DBPath) {
+			return fmt.Errorf("只读副本的快照目录不能与 cache.db_path 相同")
+		}
+		if !isHTTPURL(config.Replica.PrimaryURL) {
+			return fmt.Errorf("只读副本的主代理地址无效: %q", config.Replica.PrimaryURL)
+		}
+		if config.Replica.ReloadIntervalSeconds <= 0 {
+			return fmt.Errorf("只读副本重新加载间隔必须大于 0 秒")
+		}
+	}
+
+	// 验证录制/回放配置
+	switch config.Fixture.Mode {
+	case "off", "record", "replay":
+	default:
+		return fmt.Errorf("无效的录制模式: %s (可选: off, record, replay)", config.Fixture.Mode)
+	}
+	if config.Fixture.Mode != "off" && config.Fixture.Dir == "" {
+		return fmt.Errorf("录制目录不能为空")
 	}
 
 	// 验证日志配置
@@ -127,6 +1610,22 @@ func validateConfig(config *Config) error {
 		return fmt.Errorf("无效的日志最大备份数: %d", config.Log.MaxBackups)
 	}
 
+	// 验证访问日志配置
+	if config.AccessLog.Enabled {
+		if config.AccessLog.FilePath == "" {
+			return fmt.Errorf("访问日志文件路径不能为空")
+		}
+		if config.AccessLog.MaxSize <= 0 {
+			return fmt.Errorf("无效的访问日志最大大小: %d", config.AccessLog.MaxSize)
+		}
+		if config.AccessLog.MaxAge <= 0 {
+			return fmt.Errorf("无效的访问日志最大保留天数: %d", config.AccessLog.MaxAge)
+		}
+		if config.AccessLog.MaxBackups <= 0 {
+			return fmt.Errorf("无效的访问日志最大备份数: %d", config.AccessLog.MaxBackups)
+		}
+	}
+
 	return nil
 }
 
@@ -171,6 +1670,11 @@ func loadConfig(configPath string) (*Config, error) {
 	// 记录实际使用的配置文件
 	logger.Info("成功加载配置文件", zap.String("file", v.ConfigFileUsed()))
 
+	// 合并 conf.d 目录下的配置片段
+	if err := mergeConfigFragments(v, filepath.Join(filepath.Dir(v.ConfigFileUsed()), "conf.d")); err != nil {
+		return nil, err
+	}
+
 	// 设置默认值
 	setDefaultValues(v)
 
@@ -191,6 +1695,30 @@ func loadConfig(configPath string) (*Config, error) {
 	return &config, nil
 }
 
+// 按文件名字典序合并配置片段，后加载的覆盖先加载的
+func mergeConfigFragments(v *viper.Viper, dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.toml"))
+	if err != nil {
+		return fmt.Errorf("查找配置片段失败: %w", err)
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return fmt.Errorf("打开配置片段 %s 失败: %w", file, err)
+		}
+		err = v.MergeConfig(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("合并配置片段 %s 失败: %w", file, err)
+		}
+		logger.Info("合并配置片段", zap.String("file", file))
+	}
+
+	return nil
+}
+
 // 更新服务器端口配置
 func UpdateServerPort(port int) {
 	configMutex.Lock()
@@ -268,3 +1796,219 @@ func InitConfigFromPath(configPath string) error {
 
 	return nil
 }
+
+// EncryptionKey 读取缓存加密密钥，未配置时返回 nil。
+// 内容为 16、24 或 32 字节的原始密钥，或者对应长度的十六进制字符串（首尾空白忽略）
+func (c *CacheConfig) EncryptionKey() ([]byte, error) {
+	var raw []byte
+	switch {
+	case c.EncryptionKeyFile != "":
+		data, err := os.ReadFile(c.EncryptionKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取缓存加密密钥文件失败: %w", err)
+		}
+		raw = data
+	case c.EncryptionKeyEnv != "":
+		value, ok := os.LookupEnv(c.EncryptionKeyEnv)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("环境变量 %s 未设置缓存加密密钥", c.EncryptionKeyEnv)
+		}
+		raw = []byte(value)
+	default:
+		return nil, nil
+	}
+	return ParseEncryptionKey(raw)
+}
+
+// ParseEncryptionKey 解析原始或十六进制的 AES 密钥
+func ParseEncryptionKey(raw []byte) ([]byte, error) {
+	validLength := func(n int) bool { return n == 16 || n == 24 || n == 32 }
+	if validLength(len(raw)) {
+		return raw, nil
+	}
+	trimmed := strings.TrimSpace(string(raw))
+	if validLength(len(trimmed)) {
+		return []byte(trimmed), nil
+	}
+	if key, err := hex.DecodeString(trimmed); err == nil && validLength(len(key)) {
+		return key, nil
+	}
+	return nil, fmt.Errorf("缓存加密密钥长度必须是 16、24 或 32 字节（或对应长度的十六进制字符串），当前为 %d 字节", len(trimmed))
+}
+
+// ParseIPRanges 解析 IP 或 CIDR 列表，单个 IP 转成只包含自身的网段
+func ParseIPRanges(ranges []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(ranges))
+	for _, raw := range ranges {
+		raw = strings.TrimSpace(raw)
+		if prefix, err := netip.ParsePrefix(raw); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(raw)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 IP 或网段: %q", raw)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+// ParseTimeWindow 解析 "HH:MM-HH:MM" 形式的时间窗口，返回起止时间在一天中的分钟数
+func ParseTimeWindow(window string) (int, int, error) {
+	startText, endText, ok := strings.Cut(strings.TrimSpace(window), "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("无效的时间窗口: %q (格式为 HH:MM-HH:MM)", window)
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(startText))
+	if err != nil {
+		return 0, 0, fmt.Errorf("无效的时间窗口: %q (格式为 HH:MM-HH:MM)", window)
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(endText))
+	if err != nil {
+		return 0, 0, fmt.Errorf("无效的时间窗口: %q (格式为 HH:MM-HH:MM)", window)
+	}
+	return start.Hour()*60 + start.Minute(), end.Hour()*60 + end.Minute(), nil
+}
+
+// ParseClock 解析 "HH:MM" 形式的时刻，返回从零点开始的分钟数
+func ParseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(clock))
+	if err != nil {
+		return 0, fmt.Errorf("无效的时刻: %q (格式为 HH:MM)", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// validatePrefetch 检查定时预取配置
+func validatePrefetch(config *Config) error {
+	cfg := &config.Prefetch
+	if !config.Cache.Enabled || config.Replica.Enabled {
+		return fmt.Errorf("定时预取需要开启缓存且不能是只读副本")
+	}
+	if cfg.Token == "" {
+		return fmt.Errorf("定时预取需要配置 prefetch.token")
+	}
+	if cfg.Concurrency <= 0 {
+		return fmt.Errorf("定时预取并发数必须大于 0")
+	}
+	if _, err := time.LoadLocation(cfg.Timezone); err != nil {
+		return fmt.Errorf("定时预取的时区无效: %q", cfg.Timezone)
+	}
+
+	names := make(map[string]bool, len(cfg.Jobs))
+	for i, job := range cfg.Jobs {
+		name := job.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if names[name] {
+			return fmt.Errorf("定时预取任务名重复: %s", name)
+		}
+		names[name] = true
+
+		if _, err := ParseClock(job.At); err != nil {
+			return fmt.Errorf("定时预取任务 %s: %w", name, err)
+		}
+		if _, ok := CalendarSources[strings.ToUpper(job.Exchange)]; job.Exchange != "" && !ok {
+			return fmt.Errorf("定时预取任务 %s 的交易所 %s 不支持", name, job.Exchange)
+		}
+		if len(job.Requests) == 0 {
+			return fmt.Errorf("定时预取任务 %s 没有配置请求", name)
+		}
+		for j, request := range job.Requests {
+			if strings.TrimSpace(request.APIName) == "" {
+				return fmt.Errorf("定时预取任务 %s 的第 %d 个请求缺少 api_name", name, j+1)
+			}
+		}
+	}
+	return nil
+}
+
+// isHTTPURL 是否为带主机名的 http/https 地址
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// validateAuth 检查客户端鉴权配置
+func validateAuth(auth *AuthConfig) error {
+	switch auth.Provider {
+	case AuthProviderNone:
+	case AuthProviderStatic:
+		if len(auth.Keys) == 0 {
+			return fmt.Errorf("static 鉴权需要配置 auth.keys")
+		}
+		for _, key := range auth.Keys {
+			if strings.TrimSpace(key) == "" {
+				return fmt.Errorf("auth.keys 不能包含空字符串")
+			}
+		}
+	case AuthProviderHtpasswd:
+		if auth.HtpasswdFile == "" {
+			return fmt.Errorf("htpasswd 鉴权需要配置 auth.htpasswd_file")
+		}
+	case AuthProviderOIDC:
+		if !isHTTPURL(auth.OIDC.IntrospectionURL) {
+			return fmt.Errorf("OIDC introspection 地址无效: %q", auth.OIDC.IntrospectionURL)
+		}
+		if auth.OIDC.CacheSeconds < 0 {
+			return fmt.Errorf("OIDC 校验结果缓存时长不能小于 0 秒")
+		}
+		if auth.OIDC.TimeoutSeconds <= 0 {
+			return fmt.Errorf("OIDC introspection 超时时间必须大于 0 秒")
+		}
+	default:
+		return fmt.Errorf("不支持的客户端鉴权方式: %q", auth.Provider)
+	}
+	return nil
+}
+
+// validateSigning 检查签名请求头，开启签名时各请求头不能为空、不能重复，也不能是代理管理的请求头
+func validateSigning(signing *SigningConfig) error {
+	if signing.Secret == "" {
+		return nil
+	}
+
+	headers := []string{signing.TimestampHeader, signing.NonceHeader, signing.SignatureHeader}
+	if signing.KeyID != "" {
+		headers = append(headers, signing.KeyIDHeader)
+	}
+	seen := make(map[string]bool, len(headers))
+	for _, name := range headers {
+		canonical := http.CanonicalHeaderKey(strings.TrimSpace(name))
+		if canonical == "" {
+			return fmt.Errorf("开启签名时 tushare.signing 的请求头名称不能为空")
+		}
+		if IsReservedUpstreamHeader(canonical) {
+			return fmt.Errorf("签名请求头 %s 由代理管理，不能使用", name)
+		}
+		if seen[canonical] {
+			return fmt.Errorf("签名请求头 %s 重复", name)
+		}
+		seen[canonical] = true
+	}
+	return nil
+}
+
+// IsReservedResponseHeader 由代理自己管理、不允许配置或从 tushare 透传的响应头
+func IsReservedResponseHeader(name string) bool {
+	switch http.CanonicalHeaderKey(strings.TrimSpace(name)) {
+	case "Content-Type", "Content-Length", "Content-Encoding", "Transfer-Encoding", "Connection",
+		"Keep-Alive", "Trailer", "Upgrade", "Vary", "Date",
+		"X-Cache", "X-Cache-Key", "X-Cache-Age", "X-Cache-Expires", "Retry-After", "X-Row-Count", "X-Body-Sha256",
+		"X-Proxy-Request-Id":
+		return true
+	}
+	return false
+}
+
+// IsReservedUpstreamHeader 由代理自己管理、不允许配置或透传的上游请求头
+func IsReservedUpstreamHeader(name string) bool {
+	switch http.CanonicalHeaderKey(strings.TrimSpace(name)) {
+	case "Host", "Content-Type", "Content-Length", "Accept-Encoding", "Transfer-Encoding",
+		"Connection", "Proxy-Connection", "Keep-Alive", "Te", "Trailer", "Upgrade", "X-Proxy-Request-Id":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/spf13/viper"
+)
+
+// 支持的策略文件格式版本
+const PolicyVersion = 1
+
+// 接口策略文件配置
+type PolicyConfig struct {
+	// 策略文件路径（.toml 或 .yaml），为空时不使用
+	File string `mapstructure:"file"`
+	// 检查策略文件是否修改的间隔（秒），0 表示只在启动时加载
+	ReloadIntervalSeconds int `mapstructure:"reload_interval_seconds"`
+	// 是否使用策略文件中的 minute_limit、daily_limit，关闭时策略文件不影响本地限流
+	RateLimit bool `mapstructure:"rate_limit"`
+}
+
+// PolicyFile 接口策略文件：按 api_name 通配模式集中配置缓存、限流、超时和日期跨度，
+// 优先于主配置中对应接口的设置，可以单独热加载
+type PolicyFile struct {
+	// 文件格式版本，目前只支持 1
+	Version int `mapstructure:"version"`
+	// 策略内容的版本号，只用于日志和管理接口，方便确认生效的是哪一版
+	Revision string               `mapstructure:"revision"`
+	APIs     map[string]APIPolicy `mapstructure:"apis"`
+}
+
+// APIPolicy 单个 api_name 模式的策略，数值为 0、开关为 false 的项按主配置处理
+type APIPolicy struct {
+	// 缓存时长（秒），相当于 cache.ttl_overrides
+	TTLSeconds int `mapstructure:"ttl_seconds" json:"ttl_seconds,omitempty"`
+	// 实时数据的缓存时长（秒），相当于 cache.realtime_ttls
+	RealtimeTTLSeconds int `mapstructure:"realtime_ttl_seconds" json:"realtime_ttl_seconds,omitempty"`
+	// 相当于加入 cache.uncacheable_apis、intraday_apis、immutable_apis
+	Uncacheable bool `mapstructure:"uncacheable" json:"uncacheable,omitempty"`
+	Intraday    bool `mapstructure:"intraday" json:"intraday,omitempty"`
+	Immutable   bool `mapstructure:"immutable" json:"immutable,omitempty"`
+	// 每分钟、每天的本地限流上限，相当于 tushare.minute_limits、daily_limits
+	MinuteLimit int `mapstructure:"minute_limit" json:"minute_limit,omitempty"`
+	DailyLimit  int `mapstructure:"daily_limit" json:"daily_limit,omitempty"`
+	// 请求 tushare 的超时时间（秒），替代 tushare.timeout_seconds
+	TimeoutSeconds int `mapstructure:"timeout_seconds" json:"timeout_seconds,omitempty"`
+	// 单次请求的最大日期跨度（天），相当于 date_range.max_days
+	MaxDays int `mapstructure:"max_days" json:"max_days,omitempty"`
+}
+
+// LoadPolicyFile 读取并校验策略文件，格式按扩展名判断。未知的配置项也算错误，
+// 错误信息中带出有问题的接口模式和配置项
+func LoadPolicyFile(file string) (*PolicyFile, error) {
+	v := viper.New()
+	v.SetConfigFile(file)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("读取策略文件 %s 失败: %w", file, err)
+	}
+
+	var policies PolicyFile
+	if err := v.UnmarshalExact(&policies); err != nil {
+		return nil, fmt.Errorf("解析策略文件 %s 失败: %w", file, err)
+	}
+	if err := validatePolicyFile(&policies); err != nil {
+		return nil, fmt.Errorf("策略文件 %s 校验失败: %w", file, err)
+	}
+	return &policies, nil
+}
+
+func validatePolicyFile(policies *PolicyFile) error {
+	if policies.Version == 0 {
+		return fmt.Errorf("缺少 version")
+	}
+	if policies.Version != PolicyVersion {
+		return fmt.Errorf("不支持的 version %d，当前只支持 %d", policies.Version, PolicyVersion)
+	}
+
+	// 按模式排序后检查，多处出错时每次报告同一个
+	patterns := make([]string, 0, len(policies.APIs))
+	for pattern := range policies.APIs {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	for _, pattern := range patterns {
+		policy := policies.APIs[pattern]
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("apis.%q: 接口模式无效", pattern)
+		}
+		for _, field := range []struct {
+			name  string
+			value int
+		}{
+			{"ttl_seconds", policy.TTLSeconds},
+			{"realtime_ttl_seconds", policy.RealtimeTTLSeconds},
+			{"minute_limit", policy.MinuteLimit},
+			{"daily_limit", policy.DailyLimit},
+			{"timeout_seconds", policy.TimeoutSeconds},
+			{"max_days", policy.MaxDays},
+		} {
+			if field.value < 0 {
+				return fmt.Errorf("apis.%q.%s 不能小于 0，当前为 %d", pattern, field.name, field.value)
+			}
+		}
+		if policy.Uncacheable && (policy.TTLSeconds > 0 || policy.RealtimeTTLSeconds > 0 || policy.Immutable || policy.Intraday) {
+			return fmt.Errorf("apis.%q: uncacheable 的接口不能再配置缓存时长、intraday 或 immutable", pattern)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package fixture
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/roowe/tushareproxy/internal/config"
+)
+
+const (
+	ModeOff    = "off"
+	ModeRecord = "record"
+	ModeReplay = "replay"
+)
+
+var unsafeNamePattern = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// Fixture 一次录制的请求与响应
+type Fixture struct {
+	APIName    string          `json:"api_name"`
+	Request    json.RawMessage `json:"request"`
+	StatusCode int             `json:"status_code"`
+	Response   json.RawMessage `json:"response"`
+}
+
+// Store 录制/回放数据目录，每个请求一个文件：<dir>/<api_name>/<hash>.json。
+// 请求去掉 token 后计算 hash，回放时可以使用任意 token
+type Store struct {
+	mode string
+	dir  string
+}
+
+// NewStore 创建录制/回放存储，mode 为 off 时返回 nil
+func NewStore(cfg *config.FixtureConfig) (*Store, error) {
+	if cfg.Mode == ModeOff {
+		return nil, nil
+	}
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建录制目录失败: %w", err)
+	}
+	return &Store{mode: cfg.Mode, dir: cfg.Dir}, nil
+}
+
+// Recording 是否处于录制模式
+func (s *Store) Recording() bool {
+	return s != nil && s.mode == ModeRecord
+}
+
+// Replaying 是否处于回放模式
+func (s *Store) Replaying() bool {
+	return s != nil && s.mode == ModeReplay
+}
+
+// Save 保存一次请求与响应，响应必须是合法 JSON
+func (s *Store) Save(apiName string, forwardBody []byte, statusCode int, response []byte) error {
+	request, path, err := s.locate(apiName, forwardBody)
+	if err != nil {
+		return err
+	}
+	if !json.Valid(response) {
+		return fmt.Errorf("响应不是合法 JSON，不录制")
+	}
+
+	data, err := json.MarshalIndent(Fixture{
+		APIName:    apiName,
+		Request:    request,
+		StatusCode: statusCode,
+		Response:   response,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化录制数据失败: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("创建录制目录失败: %w", err)
+	}
+
+	// 先写临时文件再改名，避免回放读到写了一半的文件
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("写入录制文件失败: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("写入录制文件失败: %w", err)
+	}
+	return nil
+}
+
+// Load 读取录制的响应
+func (s *Store) Load(apiName string, forwardBody []byte) (*Fixture, bool, error) {
+	_, path, err := s.locate(apiName, forwardBody)
+	if err != nil {
+		return nil, false, err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("读取录制文件失败: %w", err)
+	}
+
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, false, fmt.Errorf("解析录制文件 %s 失败: %w", path, err)
+	}
+
+	// 录制文件为了可读做了缩进，回放时还原成紧凑格式
+	var response bytes.Buffer
+	if err := json.Compact(&response, fixture.Response); err != nil {
+		return nil, false, fmt.Errorf("解析录制文件 %s 失败: %w", path, err)
+	}
+	fixture.Response = response.Bytes()
+	return &fixture, true, nil
+}
+
+// locate 返回去掉 token 的规范化请求及其录制文件路径
+func (s *Store) locate(apiName string, forwardBody []byte) ([]byte, string, error) {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(forwardBody, &payload); err != nil {
+		return nil, "", fmt.Errorf("解析请求体失败: %w", err)
+	}
+	delete(payload, "token")
+
+	// map 序列化时键有序，结果稳定
+	request, err := json.Marshal(payload)
+	if err != nil {
+		return nil, "", fmt.Errorf("序列化请求体失败: %w", err)
+	}
+
+	hash := sha256.Sum256(request)
+	name := unsafeNamePattern.ReplaceAllString(apiName, "_")
+	if name == "" {
+		name = "_unknown"
+	}
+	return request, filepath.Join(s.dir, name, hex.EncodeToString(hash[:])+".json"), nil
+}
@@ -0,0 +1,274 @@
+package history
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/config"
+	"github.com/roowe/tushareproxy/internal/jobs"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// 请求历史键前缀，以 ! 开头，遍历缓存条目时跳过。
+// 完整的键为 !hist/<YYYYMMDD>/<api_name>/<请求摘要>，按日期、接口名前缀扫描
+const keyPrefix = "!hist/"
+
+const dateLayout = "20060102"
+
+// 两次写入之间内存中最多汇总的唯一请求数，超过后丢弃新请求直到下次写入
+const maxPending = 100000
+
+// Store 请求历史的持久化存储，由缓存库实现
+type Store interface {
+	GetRecord(key string) ([]byte, bool, error)
+	PutRecord(key string, data []byte, ttl time.Duration) error
+	ScanRecords(prefix string, fn func(key string, data []byte) error) error
+}
+
+// Record 一天内一个唯一请求的汇总，唯一请求由 api_name、params 和 fields 确定，不含 token
+type Record struct {
+	Date      string                 `json:"date"`
+	APIName   string                 `json:"api_name"`
+	Params    map[string]interface{} `json:"params,omitempty"`
+	Fields    string                 `json:"fields,omitempty"`
+	Count     int64                  `json:"count"`
+	FirstSeen int64                  `json:"first_seen"`
+	LastSeen  int64                  `json:"last_seen"`
+}
+
+// Recorder 在内存中按天汇总唯一请求，定期合并写入缓存库，保留最近若干天
+type Recorder struct {
+	store     Store
+	retention int
+	location  *time.Location
+	interval  time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*Record
+	dropped int64
+
+	// 保证同一时间只有一次写入，避免读取合并时互相覆盖
+	flushMu sync.Mutex
+}
+
+// NewRecorder 创建请求历史记录器
+func NewRecorder(cfg *config.HistoryConfig, store Store) (*Recorder, error) {
+	location, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("请求历史的时区无效: %w", err)
+	}
+
+	return &Recorder{
+		store:     store,
+		retention: cfg.RetentionDays,
+		location:  location,
+		interval:  time.Duration(cfg.FlushIntervalSeconds) * time.Second,
+		pending:   make(map[string]*Record),
+	}, nil
+}
+
+// Record 记录一次请求
+func (r *Recorder) Record(apiName string, params map[string]interface{}, fields string) {
+	if r == nil || apiName == "" {
+		return
+	}
+
+	fields = strings.TrimSpace(fields)
+	now := time.Now().In(r.location)
+	date := now.Format(dateLayout)
+	key := recordKey(date, apiName, requestDigest(apiName, params, fields))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if record, ok := r.pending[key]; ok {
+		record.Count++
+		record.LastSeen = now.Unix()
+		return
+	}
+	if len(r.pending) >= maxPending {
+		r.dropped++
+		return
+	}
+	r.pending[key] = &Record{
+		Date:      date,
+		APIName:   apiName,
+		Params:    params,
+		Fields:    fields,
+		Count:     1,
+		FirstSeen: now.Unix(),
+		LastSeen:  now.Unix(),
+	}
+}
+
+// Flush 把内存中的汇总合并到缓存库。写入失败的记录直接丢弃，只记录日志
+func (r *Recorder) Flush() error {
+	if r == nil {
+		return nil
+	}
+
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+
+	r.mu.Lock()
+	pending, dropped := r.pending, r.dropped
+	r.pending, r.dropped = make(map[string]*Record), 0
+	r.mu.Unlock()
+
+	if dropped > 0 {
+		logger.Warn("请求历史待写入数超过上限，部分请求未记录", zap.Int64("dropped", dropped))
+	}
+
+	now := time.Now()
+	var firstErr error
+	failed := 0
+	for key, record := range pending {
+		if err := r.merge(key, record, now); err != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	if firstErr != nil {
+		logger.Error("写入请求历史失败",
+			zap.Int("failed", failed),
+			zap.Int("total", len(pending)),
+			zap.Error(firstErr))
+		return firstErr
+	}
+	return nil
+}
+
+// merge 与缓存库中同一天的记录合并后写回，过期时间为记录日期之后 retention 天
+func (r *Recorder) merge(key string, record *Record, now time.Time) error {
+	ttl := r.expiresAt(record.Date).Sub(now)
+	if ttl <= 0 {
+		return nil
+	}
+
+	data, ok, err := r.store.GetRecord(key)
+	if err != nil {
+		return err
+	}
+	if ok {
+		var stored Record
+		if err := json.Unmarshal(data, &stored); err == nil {
+			record.Count += stored.Count
+			record.FirstSeen = min(record.FirstSeen, stored.FirstSeen)
+			record.LastSeen = max(record.LastSeen, stored.LastSeen)
+		}
+	}
+
+	data, err = json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return r.store.PutRecord(key, data, ttl)
+}
+
+// expiresAt 记录的过期时间，保留记录当天在内的 retention 个自然日
+func (r *Recorder) expiresAt(date string) time.Time {
+	day, err := time.ParseInLocation(dateLayout, date, r.location)
+	if err != nil {
+		return time.Time{}
+	}
+	return day.AddDate(0, 0, r.retention)
+}
+
+// Query 按接口名和日期查询请求历史，两者都可为空。
+// 查询前先写入内存中的汇总，结果按日期倒序、次数降序排列
+func (r *Recorder) Query(apiName, date string) ([]Record, error) {
+	if err := r.Flush(); err != nil {
+		return nil, err
+	}
+
+	prefix := keyPrefix
+	if date != "" {
+		prefix += date + "/"
+		if apiName != "" {
+			prefix += apiName + "/"
+		}
+	}
+
+	var records []Record
+	err := r.store.ScanRecords(prefix, func(key string, data []byte) error {
+		var record Record
+		if err := json.Unmarshal(data, &record); err != nil {
+			logger.Warn("解析请求历史失败，跳过", zap.Error(err), zap.String("key", key))
+			return nil
+		}
+		if apiName != "" && record.APIName != apiName {
+			return nil
+		}
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("读取请求历史失败: %w", err)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Date != records[j].Date {
+			return records[i].Date > records[j].Date
+		}
+		if records[i].Count != records[j].Count {
+			return records[i].Count > records[j].Count
+		}
+		return records[i].APIName < records[j].APIName
+	})
+	return records, nil
+}
+
+// StartFlushRoutine 启动定期写入例程
+func (r *Recorder) StartFlushRoutine() {
+	jobs.Register(jobs.HistoryFlush)
+
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if jobs.Paused(jobs.HistoryFlush) {
+				continue
+			}
+			r.Flush()
+		}
+	}()
+
+	logger.Info("请求历史写入例程已启动",
+		zap.Int("retention_days", r.retention),
+		zap.Duration("interval", r.interval))
+}
+
+// ValidDate 日期是否为 YYYYMMDD 格式
+func ValidDate(date string) bool {
+	_, err := time.Parse(dateLayout, date)
+	return err == nil
+}
+
+func recordKey(date, apiName, digest string) string {
+	return keyPrefix + date + "/" + apiName + "/" + digest
+}
+
+// requestDigest 唯一请求的摘要，json.Marshal 对 map 按键排序，参数顺序不影响结果
+func requestDigest(apiName string, params map[string]interface{}, fields string) string {
+	body, err := json.Marshal(struct {
+		APIName string                 `json:"api_name"`
+		Params  map[string]interface{} `json:"params"`
+		Fields  string                 `json:"fields"`
+	}{apiName, params, fields})
+	if err != nil {
+		body = []byte(apiName)
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:16])
+}
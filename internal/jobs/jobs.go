@@ -0,0 +1,92 @@
+package jobs
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// 内置后台任务名
+const (
+	CacheGC  = "cache_gc"
+	SLOCheck = "slo_check"
+
+	ReplicaReload   = "replica_reload"
+	CalendarRefresh = "calendar_refresh"
+	TokenCheck      = "token_check"
+	HistoryFlush    = "history_flush"
+	Prefetch        = "prefetch"
+	TempCleanup     = "temp_cleanup"
+	PolicyReload    = "policy_reload"
+	StaleKeyCleanup = "stale_key_cleanup"
+	ColdTier        = "cold_tier"
+	CacheEviction   = "cache_eviction"
+	HotRefresh      = "hot_refresh"
+)
+
+var (
+	mu     sync.RWMutex
+	paused = make(map[string]bool)
+)
+
+// Register 登记后台任务，登记后才能通过管理接口暂停
+func Register(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := paused[name]; !ok {
+		paused[name] = false
+	}
+}
+
+// SetPaused 暂停或恢复后台任务，name 为空时作用于全部任务
+func SetPaused(name string, pause bool) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if name == "" {
+		for job := range paused {
+			paused[job] = pause
+		}
+		logger.Info("后台任务已全部切换", zap.Bool("paused", pause))
+		return nil
+	}
+
+	if _, ok := paused[name]; !ok {
+		return fmt.Errorf("未知的后台任务: %s", name)
+	}
+	paused[name] = pause
+	logger.Info("后台任务已切换", zap.String("job", name), zap.Bool("paused", pause))
+	return nil
+}
+
+// Paused 后台任务是否已暂停，每次执行前检查
+func Paused(name string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return paused[name]
+}
+
+// JobStatus 后台任务状态
+type JobStatus struct {
+	Name   string `json:"name"`
+	Paused bool   `json:"paused"`
+}
+
+// Status 返回所有已登记任务的状态，按名称排序
+func Status() []JobStatus {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	status := make([]JobStatus, 0, len(paused))
+	for name, p := range paused {
+		status = append(status, JobStatus{Name: name, Paused: p})
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Name < status[j].Name })
+	return status
+}
@@ -0,0 +1,78 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// Hook 关闭钩子，需在 ctx 超时前返回
+type Hook func(ctx context.Context) error
+
+type hook struct {
+	name    string
+	timeout time.Duration
+	fn      Hook
+}
+
+var (
+	mu    sync.Mutex
+	hooks []hook
+)
+
+// Register 登记子系统的关闭钩子。关闭时按登记的逆序执行，后启动的子系统先关闭，
+// 每个钩子有独立的超时时间，超时或失败不影响后续钩子
+func Register(name string, timeout time.Duration, fn Hook) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	hooks = append(hooks, hook{name: name, timeout: timeout, fn: fn})
+}
+
+// Shutdown 依次执行所有关闭钩子，只执行一次
+func Shutdown() {
+	mu.Lock()
+	pending := hooks
+	hooks = nil
+	mu.Unlock()
+
+	for i := len(pending) - 1; i >= 0; i-- {
+		h := pending[i]
+		start := time.Now()
+		logger.Info("正在关闭子系统", zap.String("name", h.name), zap.Duration("timeout", h.timeout))
+
+		if err := run(h); err != nil {
+			logger.Error("关闭子系统失败", zap.String("name", h.name), zap.Error(err))
+			continue
+		}
+		logger.Info("子系统已关闭", zap.String("name", h.name), zap.Duration("duration", time.Since(start)))
+	}
+}
+
+// run 执行单个钩子，钩子不响应 ctx 时超时后直接放弃等待
+func run(h hook) error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("关闭钩子 panic: %v", r)
+			}
+		}()
+		done <- h.fn(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("超过 %s 未完成: %w", h.timeout, ctx.Err())
+	}
+}
@@ -0,0 +1,176 @@
+package paramstats
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/config"
+)
+
+// 超过签名上限后统一计入该签名
+const otherSignature = "_other"
+
+// SignatureCount 参数组合及出现次数
+type SignatureCount struct {
+	Signature string `json:"signature"`
+	Count     int64  `json:"count"`
+}
+
+// APIStats 单个接口的参数组合统计
+type APIStats struct {
+	APIName    string           `json:"api_name"`
+	Sampled    int64            `json:"sampled"`
+	Signatures []SignatureCount `json:"signatures"`
+}
+
+// Collector 按 api_name 抽样统计参数组合，只记录参数名和取值形态，不记录具体取值
+type Collector struct {
+	sampleRate    float64
+	maxSignatures int
+
+	mu   sync.Mutex
+	apis map[string]map[string]int64
+}
+
+// NewCollector 创建参数统计收集器
+func NewCollector(cfg *config.ParamStatsConfig) *Collector {
+	return &Collector{
+		sampleRate:    cfg.SampleRate,
+		maxSignatures: cfg.MaxSignatures,
+		apis:          make(map[string]map[string]int64),
+	}
+}
+
+// Record 按抽样率记录一次请求的参数组合
+func (c *Collector) Record(apiName string, params map[string]interface{}) {
+	if c == nil || apiName == "" {
+		return
+	}
+	if c.sampleRate < 1 && rand.Float64() >= c.sampleRate {
+		return
+	}
+
+	signature := Signature(params)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	signatures, ok := c.apis[apiName]
+	if !ok {
+		signatures = make(map[string]int64)
+		c.apis[apiName] = signatures
+	}
+	if _, ok := signatures[signature]; !ok && len(signatures) >= c.maxSignatures {
+		signature = otherSignature
+	}
+	signatures[signature]++
+}
+
+// Snapshot 返回按接口名排序、组合按次数降序的统计结果
+func (c *Collector) Snapshot() []APIStats {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := make([]APIStats, 0, len(c.apis))
+	for apiName, signatures := range c.apis {
+		stats := APIStats{APIName: apiName}
+		for signature, count := range signatures {
+			stats.Sampled += count
+			stats.Signatures = append(stats.Signatures, SignatureCount{Signature: signature, Count: count})
+		}
+		sort.Slice(stats.Signatures, func(i, j int) bool {
+			if stats.Signatures[i].Count != stats.Signatures[j].Count {
+				return stats.Signatures[i].Count > stats.Signatures[j].Count
+			}
+			return stats.Signatures[i].Signature < stats.Signatures[j].Signature
+		})
+		result = append(result, stats)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].APIName < result[j].APIName
+	})
+	return result
+}
+
+// Signature 生成匿名化的参数组合签名：非空参数名按字典序排列，
+// 附加日期跨度和股票代码数量等取值形态
+func Signature(params map[string]interface{}) string {
+	keys := make([]string, 0, len(params))
+	for key, value := range params {
+		if isEmptyValue(value) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return "(none)"
+	}
+	sort.Strings(keys)
+
+	parts := []string{strings.Join(keys, ",")}
+	if span, ok := dateSpanBucket(params); ok {
+		parts = append(parts, "span:"+span)
+	}
+	if codes, ok := params["ts_code"].(string); ok && codes != "" {
+		if strings.Contains(codes, ",") {
+			parts = append(parts, "codes:multi")
+		} else {
+			parts = append(parts, "codes:1")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func isEmptyValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(v) == ""
+	}
+	return false
+}
+
+// dateSpanBucket 按 start_date/end_date 计算日期跨度区间
+func dateSpanBucket(params map[string]interface{}) (string, bool) {
+	start, ok := params["start_date"].(string)
+	if !ok || start == "" {
+		return "", false
+	}
+
+	startDate, err := time.Parse("20060102", start)
+	if err != nil {
+		return "", false
+	}
+
+	endDate := time.Now()
+	if end, ok := params["end_date"].(string); ok && end != "" {
+		if endDate, err = time.Parse("20060102", end); err != nil {
+			return "", false
+		}
+	}
+
+	days := int(endDate.Sub(startDate).Hours() / 24)
+	switch {
+	case days < 0:
+		return "invalid", true
+	case days <= 7:
+		return "<=7d", true
+	case days <= 31:
+		return "<=1m", true
+	case days <= 366:
+		return "<=1y", true
+	case days <= 5*366:
+		return "<=5y", true
+	default:
+		return ">5y", true
+	}
+}
@@ -2,11 +2,14 @@ package server
 
 import (
 	"context"
+	"expvar"
 	"fmt"
 	"net/http"
+	"net/http/pprof"
 	"time"
 
 	"github.com/roowe/tushareproxy/internal/api"
+	"github.com/roowe/tushareproxy/internal/auth"
 	"github.com/roowe/tushareproxy/internal/config"
 	"github.com/roowe/tushareproxy/pkg/logger"
 
@@ -15,14 +18,19 @@ import (
 
 // HTTPServer HTTP服务器结构体
 type HTTPServer struct {
-	server *http.Server
-	config *config.ServerConfig
+	server      *http.Server
+	config      *config.ServerConfig
+	adminConfig *config.AdminConfig
+	// 数据接口的客户端鉴权，nil 表示不鉴权
+	authProvider auth.Provider
 }
 
 // NewHTTPServer 创建新的HTTP服务器实例
-func NewHTTPServer(cfg *config.ServerConfig) *HTTPServer {
+func NewHTTPServer(cfg *config.ServerConfig, adminCfg *config.AdminConfig, authProvider auth.Provider) *HTTPServer {
 	return &HTTPServer{
-		config: cfg,
+		config:       cfg,
+		adminConfig:  adminCfg,
+		authProvider: authProvider,
 	}
 }
 
@@ -37,17 +45,33 @@ func (s *HTTPServer) Start() error {
 	// 创建HTTP服务器
 	s.server = &http.Server{
 		Addr:         fmt.Sprintf("%s:%d", s.config.Host, s.config.Port),
-		Handler:      mux,
+		Handler:      accessLogMiddleware(mux),
 		ReadTimeout:  time.Duration(s.config.ReadTimeout) * time.Second,
 		WriteTimeout: time.Duration(s.config.WriteTimeout) * time.Second,
 	}
 
-	logger.Info("HTTP服务器启动",
+	if !s.config.TLS.Enabled() {
+		logger.Info("HTTP服务器启动",
+			zap.String("address", s.server.Addr),
+			zap.Int("read_timeout", s.config.ReadTimeout),
+			zap.Int("write_timeout", s.config.WriteTimeout))
+		return s.server.ListenAndServe()
+	}
+
+	reloader, err := newCertReloader(&s.config.TLS)
+	if err != nil {
+		return err
+	}
+	reloader.watchSignal()
+	s.server.TLSConfig = reloader.tlsConfig()
+
+	logger.Info("HTTPS服务器启动",
 		zap.String("address", s.server.Addr),
+		zap.Bool("client_auth", s.config.TLS.ClientCAFile != ""),
 		zap.Int("read_timeout", s.config.ReadTimeout),
 		zap.Int("write_timeout", s.config.WriteTimeout))
-
-	return s.server.ListenAndServe()
+	// 证书由 TLSConfig 提供
+	return s.server.ListenAndServeTLS("", "")
 }
 
 // Stop 停止HTTP服务器
@@ -63,5 +87,62 @@ func (s *HTTPServer) Stop(ctx context.Context) error {
 // registerRoutes 注册路由
 func (s *HTTPServer) registerRoutes(mux *http.ServeMux) {
 	// 注册/dataapi路由
-	mux.HandleFunc("/dataapi", api.DataAPIHandler)
+	data := func(pattern string, handler http.HandlerFunc) {
+		mux.Handle(pattern, lenientRequestMiddleware(responseHeadersMiddleware(s.config.ResponseHeaders,
+			clientAuthMiddleware(s.authProvider, handler))))
+	}
+	data("/dataapi", api.DataAPIHandler)
+	data("/dataapi/batch", api.BatchAPIHandler)
+	data(api.AsyncPollPath, api.AsyncPollHandler)
+	// 部分 HTTP 库会在路径末尾加斜杠，按同一接口处理
+	data("/dataapi/{$}", api.DataAPIHandler)
+	data("/dataapi/batch/{$}", api.BatchAPIHandler)
+	// 其他实例推送缓存条目，按 cluster.token 鉴权
+	mux.HandleFunc(api.ClusterEntriesPath, api.ClusterEntriesHandler)
+	// 存活和就绪检查，不需要鉴权
+	mux.HandleFunc("/healthz", api.HealthzHandler)
+	mux.HandleFunc("/readyz", api.ReadyzHandler)
+	// 未知路径也返回 tushare 格式的错误
+	mux.HandleFunc("/", api.NotFoundHandler)
+
+	// 注册管理接口
+	if s.adminConfig.Enabled {
+		admin := func(pattern string, handler http.HandlerFunc) {
+			mux.Handle(pattern, adminAuthMiddleware(s.adminConfig.Token, handler))
+		}
+		admin("/admin/stats/params", api.AdminParamStatsHandler)
+		admin("/admin/stats/canary", api.AdminCanaryStatsHandler)
+		admin("/admin/stats/cache", api.AdminCacheStatsHandler)
+		admin("/admin/cache/stats", api.AdminCacheSummaryHandler)
+		admin("/admin/cache/shadow", api.AdminCacheShadowHandler)
+		admin("/admin/cache/keys", api.AdminCacheKeysHandler)
+		admin("/admin/cache/entry", api.AdminCacheEntryHandler)
+		admin("/admin/cache/delete", api.AdminCacheDeleteHandler)
+		admin("/admin/cache/purge", api.AdminCachePurgeHandler)
+		admin("/admin/cache/gc", api.AdminCacheGCHandler)
+		admin("/admin/cache/invalidate", api.AdminCacheInvalidateHandler)
+		admin("/admin/history", api.AdminHistoryHandler)
+		admin("/admin/metrics", expvar.Handler().ServeHTTP)
+		admin("/admin/offline", api.AdminOfflineHandler)
+		admin("/admin/jobs", api.AdminJobsHandler)
+		admin("/admin/tokens", api.AdminTokensHandler)
+		admin("/admin/policies", api.AdminPoliciesHandler)
+		if s.adminConfig.PprofEnabled {
+			registerPprof(mux, s.adminConfig.Token)
+		}
+	}
+}
+
+// registerPprof 在 /admin/debug/pprof/ 下注册性能分析接口，按 admin.token 鉴权。
+// pprof 按 /debug/pprof/ 解析路径，注册时去掉 /admin 前缀
+func registerPprof(mux *http.ServeMux, token string) {
+	pprofHandler := func(pattern string, handler http.HandlerFunc) {
+		mux.Handle("/admin"+pattern, adminAuthMiddleware(token, http.StripPrefix("/admin", handler)))
+	}
+	pprofHandler("/debug/pprof/", pprof.Index)
+	pprofHandler("/debug/pprof/cmdline", pprof.Cmdline)
+	pprofHandler("/debug/pprof/profile", pprof.Profile)
+	pprofHandler("/debug/pprof/symbol", pprof.Symbol)
+	pprofHandler("/debug/pprof/trace", pprof.Trace)
+	logger.Warn("性能分析接口已开启", zap.String("path", "/admin/debug/pprof/"))
 }
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/api"
+	"github.com/roowe/tushareproxy/internal/auth"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// responseRecorder 记录响应状态码和写出字节数
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	bytes      int64
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	if r.statusCode == 0 {
+		r.statusCode = statusCode
+	}
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	if r.statusCode == 0 {
+		r.statusCode = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap 供 http.ResponseController 访问底层 ResponseWriter
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// accessLogMiddleware 给每个请求分配请求 ID 并写入响应头，处理完输出一行访问日志。
+// 数据接口的接口名、缓存状态和上游状态码由处理函数记在请求上下文的 AccessInfo 中
+func accessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startTime := time.Now()
+		requestID := api.NewRequestID(r)
+		w.Header().Set(api.HeaderRequestID, requestID)
+		recorder := &responseRecorder{ResponseWriter: w}
+		ctx, info := api.WithAccessInfo(r.Context())
+
+		// 流式响应中途出错时处理函数用 panic 断开连接，也要记录访问日志
+		defer logAccess(r, requestID, recorder, info, startTime)
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+	})
+}
+
+// logAccess 输出一行访问日志
+func logAccess(r *http.Request, requestID string, recorder *responseRecorder, info *api.AccessInfo, startTime time.Time) {
+	fields := []zap.Field{
+		zap.String("request_id", requestID),
+		zap.String("method", r.Method),
+		zap.String("path", r.URL.Path),
+		zap.String("api_name", info.APIName),
+		zap.String("client_ip", clientIP(r)),
+		zap.Int("status", recorder.statusCode),
+		zap.Int64("bytes", recorder.bytes),
+		zap.Duration("latency", time.Since(startTime)),
+		zap.String("cache_status", info.CacheStatus),
+		zap.Int("upstream_status", info.UpstreamStatus),
+		zap.Int("error_code", info.ErrorCode),
+	}
+	if info.BatchSize > 0 {
+		fields = append(fields, zap.Int("batch_size", info.BatchSize))
+	}
+	logger.Access("access", fields...)
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// adminAuthMiddleware 管理接口鉴权，token 为空时拒绝所有请求。
+// 支持 Authorization: Bearer <token> 和 X-Admin-Token 两种方式
+func adminAuthMiddleware(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provided := r.Header.Get("X-Admin-Token")
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			provided = strings.TrimSpace(bearer)
+		}
+
+		// 没有配置 token 时拒绝所有请求，不能放行
+		if token == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			logger.Warn("管理接口鉴权失败",
+				zap.String("path", r.URL.Path),
+				zap.String("client_ip", clientIP(r)))
+			api.SendError(w, api.CodeUnauthorized, "管理接口鉴权失败")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientAuthMiddleware 数据接口的客户端鉴权，provider 为 nil 时不校验。
+// 凭证无效返回 401，身份服务不可用返回 502，通过后把调用方放入请求上下文
+func clientAuthMiddleware(provider auth.Provider, next http.Handler) http.Handler {
+	if provider == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, err := provider.Authenticate(r)
+		if err != nil {
+			if errors.Is(err, auth.ErrUnauthenticated) {
+				logger.Warn("客户端鉴权失败",
+					zap.String("provider", provider.Name()),
+					zap.String("path", r.URL.Path),
+					zap.String("client_ip", clientIP(r)))
+				api.SendError(w, api.CodeUnauthorized, "客户端鉴权失败")
+				return
+			}
+			logger.Error("客户端鉴权服务不可用",
+				zap.String("provider", provider.Name()),
+				zap.Error(err))
+			api.SendError(w, api.CodeUpstreamError, "客户端鉴权服务不可用")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), identity)))
+	})
+}
+
+// responseHeadersMiddleware 给数据接口的每个响应加上 server.response_headers 配置的固定响应头
+func responseHeadersMiddleware(headers map[string]string, next http.Handler) http.Handler {
+	if len(headers) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for name, value := range headers {
+			w.Header().Set(name, value)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// 已记录过的不规范请求，按偏差类型和 User-Agent 去重，同一类客户端只在首次出现时输出 Info 日志；
+// 超过上限后不再记录新的组合，避免 User-Agent 随意变化时无限增长
+var (
+	seenDeviationsMu sync.Mutex
+	seenDeviations   = make(map[string]bool)
+)
+
+const maxSeenDeviations = 1000
+
+// lenientRequestMiddleware 记录路径末尾带斜杠、Content-Type 不是 application/json 的请求。
+// 这些请求照常处理，请求体始终按 JSON 解析
+func lenientRequestMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") && !strings.HasPrefix(r.URL.Path, api.AsyncPollPath) {
+			logDeviation(r, "trailing_slash")
+		}
+		if r.Method == http.MethodPost && !isJSONContentType(r.Header.Get("Content-Type")) {
+			logDeviation(r, "content_type")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "application/json"
+}
+
+func logDeviation(r *http.Request, deviation string) {
+	fields := []zap.Field{
+		zap.String("deviation", deviation),
+		zap.String("path", r.URL.Path),
+		zap.String("content_type", r.Header.Get("Content-Type")),
+		zap.String("user_agent", r.UserAgent()),
+		zap.String("client_ip", clientIP(r)),
+	}
+	key := deviation + "|" + r.UserAgent()
+	seenDeviationsMu.Lock()
+	first := !seenDeviations[key] && len(seenDeviations) < maxSeenDeviations
+	if first {
+		seenDeviations[key] = true
+	}
+	seenDeviationsMu.Unlock()
+
+	if first {
+		logger.Info("请求不规范，已兼容处理", fields...)
+		return
+	}
+	logger.Debug("请求不规范，已兼容处理", fields...)
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/roowe/tushareproxy/internal/config"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// certReloader 持有当前使用的证书和客户端 CA，收到 SIGHUP 时重新读取，已建立的连接不受影响
+type certReloader struct {
+	cfg     *config.TLSConfig
+	current atomic.Pointer[tls.Config]
+}
+
+func newCertReloader(cfg *config.TLSConfig) (*certReloader, error) {
+	r := &certReloader{cfg: cfg}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload 读取证书和客户端 CA，失败时保留原来的配置
+func (r *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("读取 TLS 证书失败: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if r.cfg.ClientCAFile != "" {
+		data, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("读取客户端 CA 失败: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("客户端 CA 文件 %s 中没有有效的 PEM 证书", r.cfg.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	// net/http 按 TLS 配置协商 HTTP/2，每次握手返回的配置都要带上
+	tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+	r.current.Store(tlsConfig)
+	return nil
+}
+
+// tlsConfig 服务器使用的 TLS 配置，每次握手取当前的证书和客户端 CA
+func (r *certReloader) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.current.Load(), nil
+		},
+	}
+}
+
+// watchSignal 收到 SIGHUP 时重新读取证书
+func (r *certReloader) watchSignal() {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGHUP)
+	go func() {
+		for range sigChan {
+			if err := r.reload(); err != nil {
+				logger.Error("重新加载 TLS 证书失败，继续使用原来的证书", zap.Error(err))
+				continue
+			}
+			logger.Info("已重新加载 TLS 证书",
+				zap.String("cert_file", r.cfg.CertFile),
+				zap.String("client_ca_file", r.cfg.ClientCAFile))
+		}
+	}()
+}
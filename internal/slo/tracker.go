@@ -0,0 +1,157 @@
+package slo
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/alert"
+	"github.com/roowe/tushareproxy/internal/config"
+	"github.com/roowe/tushareproxy/internal/jobs"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// 滚动窗口按分钟分桶
+const bucketDuration = time.Minute
+
+// HitRate 单个接口在滚动窗口内的命中率
+type HitRate struct {
+	APIName  string  `json:"api_name"`
+	Hits     int64   `json:"hits"`
+	Requests int64   `json:"requests"`
+	Rate     float64 `json:"rate"`
+	Target   float64 `json:"target"`
+}
+
+type bucket struct {
+	index    int64
+	hits     int64
+	requests int64
+}
+
+// Tracker 按 api_name 统计滚动命中率，低于目标时触发告警
+type Tracker struct {
+	targets     map[string]float64
+	buckets     int
+	minRequests int64
+	notifier    *alert.Notifier
+
+	mu   sync.Mutex
+	apis map[string][]bucket
+}
+
+// NewTracker 创建命中率 SLO 跟踪器
+func NewTracker(cfg *config.SLOConfig, notifier *alert.Notifier) *Tracker {
+	buckets := int(time.Duration(cfg.WindowSeconds) * time.Second / bucketDuration)
+	if buckets < 1 {
+		buckets = 1
+	}
+
+	return &Tracker{
+		targets:     cfg.HitRateTargets,
+		buckets:     buckets,
+		minRequests: int64(cfg.MinRequests),
+		notifier:    notifier,
+		apis:        make(map[string][]bucket),
+	}
+}
+
+// Record 记录一次可缓存请求是否命中，只统计配置了目标的接口
+func (t *Tracker) Record(apiName string, hit bool) {
+	if t == nil {
+		return
+	}
+	if _, ok := t.targets[apiName]; !ok {
+		return
+	}
+
+	index := time.Now().Unix() / int64(bucketDuration/time.Second)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ring, ok := t.apis[apiName]
+	if !ok {
+		ring = make([]bucket, t.buckets)
+		t.apis[apiName] = ring
+	}
+
+	b := &ring[index%int64(t.buckets)]
+	if b.index != index {
+		*b = bucket{index: index}
+	}
+	b.requests++
+	if hit {
+		b.hits++
+	}
+}
+
+// HitRates 返回各接口当前滚动窗口内的命中率
+func (t *Tracker) HitRates() []HitRate {
+	if t == nil {
+		return nil
+	}
+
+	index := time.Now().Unix() / int64(bucketDuration/time.Second)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	rates := make([]HitRate, 0, len(t.targets))
+	for apiName, target := range t.targets {
+		rate := HitRate{APIName: apiName, Target: target}
+		for _, b := range t.apis[apiName] {
+			if index-b.index < int64(t.buckets) {
+				rate.Hits += b.hits
+				rate.Requests += b.requests
+			}
+		}
+		if rate.Requests > 0 {
+			rate.Rate = float64(rate.Hits) / float64(rate.Requests)
+		}
+		rates = append(rates, rate)
+	}
+	return rates
+}
+
+// Check 检查命中率，请求数不足时不判定
+func (t *Tracker) Check() {
+	for _, rate := range t.HitRates() {
+		if rate.Requests < t.minRequests || rate.Rate >= rate.Target {
+			continue
+		}
+
+		t.notifier.Notify("slo:hit_rate:"+rate.APIName, alert.Event{
+			Type:    "cache_hit_rate_below_target",
+			APIName: rate.APIName,
+			Message: fmt.Sprintf("%s 缓存命中率 %.2f 低于目标 %.2f", rate.APIName, rate.Rate, rate.Target),
+			Details: map[string]interface{}{
+				"hits":     rate.Hits,
+				"requests": rate.Requests,
+				"rate":     rate.Rate,
+				"target":   rate.Target,
+			},
+		})
+	}
+}
+
+// StartCheckRoutine 启动后台检查例程
+func (t *Tracker) StartCheckRoutine() {
+	jobs.Register(jobs.SLOCheck)
+
+	go func() {
+		ticker := time.NewTicker(bucketDuration)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if jobs.Paused(jobs.SLOCheck) {
+				continue
+			}
+			t.Check()
+		}
+	}()
+
+	logger.Info("缓存命中率 SLO 检查例程已启动", zap.Int("targets", len(t.targets)))
+}
@@ -0,0 +1,175 @@
+package tokencheck
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/roowe/tushareproxy/internal/alert"
+	"github.com/roowe/tushareproxy/internal/config"
+	"github.com/roowe/tushareproxy/internal/jobs"
+	"github.com/roowe/tushareproxy/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// token 状态
+const (
+	StateUnknown   = "unknown"   // 尚未巡检
+	StateOK        = "ok"        // 可用，每分钟限流也算可用
+	StateExhausted = "exhausted" // 积分或每日配额不足
+	StateInvalid   = "invalid"   // token 无效或其他 tushare 错误
+	StateError     = "error"     // 网络错误，无法判断
+)
+
+// tushare 限流错误码，与 api 包保持一致
+const tushareCodeRateLimited = 40203
+
+// ProbeFunc 用 token 发一次廉价请求，返回 tushare 的 code 和 msg
+type ProbeFunc func(token string) (int, string, error)
+
+// Status 单个 token 的巡检状态，token 打码后展示
+type Status struct {
+	Token     string `json:"token"`
+	State     string `json:"state"`
+	Code      int    `json:"code"`
+	Msg       string `json:"msg"`
+	CheckedAt int64  `json:"checked_at"`
+	LastOKAt  int64  `json:"last_ok_at"`
+}
+
+// Monitor 定期巡检 token 是否可用，失效或额度用尽时告警
+type Monitor struct {
+	tokens   []string
+	interval time.Duration
+	probe    ProbeFunc
+	notifier *alert.Notifier
+
+	mu     sync.Mutex
+	status map[string]*Status
+}
+
+// NewMonitor 创建 token 巡检器
+func NewMonitor(cfg *config.TokenCheckConfig, probe ProbeFunc, notifier *alert.Notifier) *Monitor {
+	m := &Monitor{
+		tokens:   cfg.Tokens,
+		interval: time.Duration(cfg.IntervalSeconds) * time.Second,
+		probe:    probe,
+		notifier: notifier,
+		status:   make(map[string]*Status, len(cfg.Tokens)),
+	}
+	for _, token := range cfg.Tokens {
+		m.status[token] = &Status{Token: maskToken(token), State: StateUnknown}
+	}
+	return m
+}
+
+// Check 逐个巡检 token
+func (m *Monitor) Check() {
+	for _, token := range m.tokens {
+		code, msg, err := m.probe(token)
+		m.record(token, code, msg, err, time.Now())
+	}
+}
+
+// record 更新 token 状态，状态变为不可用时告警
+func (m *Monitor) record(token string, code int, msg string, err error, now time.Time) {
+	state := classify(code, msg, err)
+	if err != nil {
+		msg = err.Error()
+	}
+
+	m.mu.Lock()
+	status := m.status[token]
+	previous := status.State
+	status.State = state
+	status.Code = code
+	status.Msg = msg
+	status.CheckedAt = now.Unix()
+	if state == StateOK {
+		status.LastOKAt = now.Unix()
+	}
+	snapshot := *status
+	m.mu.Unlock()
+
+	switch {
+	case state == StateOK && previous != StateOK && previous != StateUnknown:
+		logger.Info("token 已恢复可用", zap.String("token", snapshot.Token))
+	case state == StateError:
+		logger.Warn("token 巡检请求失败", zap.String("token", snapshot.Token), zap.String("msg", msg))
+	case (state == StateInvalid || state == StateExhausted) && state != previous:
+		m.notifier.Notify("token:"+state+":"+snapshot.Token, alert.Event{
+			Type:    "token_" + state,
+			Message: fmt.Sprintf("token %s 不可用: %d %s", snapshot.Token, code, msg),
+			Details: map[string]interface{}{
+				"token":      snapshot.Token,
+				"state":      state,
+				"code":       code,
+				"msg":        msg,
+				"last_ok_at": snapshot.LastOKAt,
+			},
+		})
+	}
+}
+
+// classify 按巡检结果判断 token 状态
+func classify(code int, msg string, err error) string {
+	switch {
+	case err != nil:
+		return StateError
+	case code == 0:
+		return StateOK
+	case code == tushareCodeRateLimited && strings.Contains(msg, "每分钟最多访问"):
+		return StateOK
+	case code == tushareCodeRateLimited:
+		return StateExhausted
+	default:
+		return StateInvalid
+	}
+}
+
+// Statuses 返回所有 token 的巡检状态，顺序与配置一致
+func (m *Monitor) Statuses() []Status {
+	if m == nil {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	statuses := make([]Status, 0, len(m.tokens))
+	for _, token := range m.tokens {
+		statuses = append(statuses, *m.status[token])
+	}
+	return statuses
+}
+
+// StartCheckRoutine 启动时巡检一次，之后按间隔定期巡检
+func (m *Monitor) StartCheckRoutine() {
+	jobs.Register(jobs.TokenCheck)
+
+	go func() {
+		m.Check()
+
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if jobs.Paused(jobs.TokenCheck) {
+				continue
+			}
+			m.Check()
+		}
+	}()
+
+	logger.Info("token 巡检例程已启动", zap.Int("tokens", len(m.tokens)), zap.Duration("interval", m.interval))
+}
+
+// maskToken 只保留 token 首尾各 4 位
+func maskToken(token string) string {
+	if len(token) <= 8 {
+		return strings.Repeat("*", len(token))
+	}
+	return token[:4] + "****" + token[len(token)-4:]
+}
@@ -6,14 +6,26 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/roowe/tushareproxy/internal/alert"
 	"github.com/roowe/tushareproxy/internal/api"
+	"github.com/roowe/tushareproxy/internal/auth"
 	"github.com/roowe/tushareproxy/internal/cache"
 	"github.com/roowe/tushareproxy/internal/config"
+	"github.com/roowe/tushareproxy/internal/fixture"
+	"github.com/roowe/tushareproxy/internal/history"
+	"github.com/roowe/tushareproxy/internal/jobs"
+	"github.com/roowe/tushareproxy/internal/lifecycle"
+	"github.com/roowe/tushareproxy/internal/paramstats"
 	"github.com/roowe/tushareproxy/internal/server"
+	"github.com/roowe/tushareproxy/internal/slo"
+	"github.com/roowe/tushareproxy/internal/tokencheck"
 
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
+	// 内置时区数据，精简镜像里也能加载访问时间窗口的时区
+	_ "time/tzdata"
 
 	"github.com/roowe/tushareproxy/pkg/logger"
 
@@ -27,6 +39,14 @@ func main() {
 		panic(err)
 	}
 
+	// 子命令
+	if len(os.Args) > 1 && os.Args[1] == "cache" {
+		os.Exit(runCacheCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "init" {
+		os.Exit(runInitCommand(os.Args[2:]))
+	}
+
 	// 读取配置文件
 	configPath := ""
 	if len(os.Args) > 1 {
@@ -42,44 +62,263 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	if err := logger.InitAccessLogger(&cfg.AccessLog); err != nil {
+		panic(err)
+	}
 	logger.Debug("config and logger init success")
 
+	api.SetConfig(cfg)
+	// 接口策略文件要在处理请求之前加载
+	api.StartPolicyReload()
+
 	// 初始化缓存
 	var cacheManager *cache.CacheManager
-	if cfg.Cache.Enabled {
-		cacheManager, err = cache.NewCacheManager(
-			cfg.Cache.DBPath,
+	if cfg.Replica.Enabled {
+		// 只读副本：本地只读快照应答命中，未命中转发给主代理
+		encryptionKey, err := cfg.Cache.EncryptionKey()
+		if err != nil {
+			logger.Fatal("读取缓存加密密钥失败", zap.Error(err))
+		}
+		cacheManager, err = cache.NewReadOnlyCacheManager(
+			cfg.Replica.SnapshotDir,
+			filepath.Join(cfg.Cache.DBPath, "replica-snapshots"),
 			cfg.Cache.DefaultTTLSeconds,
 			cfg.Cache.DefaultNamespace,
-			time.Duration(cfg.Cache.GCIntervalSeconds)*time.Second,
+			encryptionKey,
 		)
+		if err != nil {
+			logger.Fatal("打开缓存快照失败", zap.Error(err))
+		}
+		cacheManager.SetMemoryCache(cfg.Cache.MemoryMaxEntries, int64(cfg.Cache.MemoryMaxMB)<<20)
+		api.SetCacheManager(cacheManager)
+		registerCacheShutdown(cacheManager)
+		cacheManager.StartReloadRoutine(time.Duration(cfg.Replica.ReloadIntervalSeconds) * time.Second)
+		logger.Info("只读副本模式已启用",
+			zap.String("snapshot_dir", cfg.Replica.SnapshotDir),
+			zap.String("primary_url", cfg.Replica.PrimaryURL))
+	} else if cfg.Cache.Enabled {
+		cacheManager, err = openCacheManager(&cfg.Cache)
 		if err != nil {
 			logger.Fatal("初始化缓存失败", zap.Error(err))
 		}
+		cacheManager.SetMemoryCache(cfg.Cache.MemoryMaxEntries, int64(cfg.Cache.MemoryMaxMB)<<20)
 		// 设置全局缓存管理器
 		api.SetCacheManager(cacheManager)
+		registerCacheShutdown(cacheManager)
+		// 异步写缓存，在 HTTP 服务停止后、关闭缓存前清空队列
+		api.StartCacheWriter()
+		lifecycle.Register("cache_writes", 10*time.Second, api.StopCacheWriter)
+		// 推送新写入的条目给其他实例，在异步写入清空之后停止
+		api.StartClusterReplication()
+		lifecycle.Register("cluster", 10*time.Second, api.StopClusterReplication)
 		// 启动垃圾回收例程
 		cacheManager.StartGCRoutine()
+		// 把写入较久的条目移到对象存储
+		cacheManager.StartColdTierRoutine()
+		// 超过容量上限时淘汰条目
+		cacheManager.StartEvictionRoutine()
+		// 后台清理缓存键规则升级前写入的条目
+		api.StartStaleKeyCleanup()
 		logger.Info("缓存系统初始化成功")
 	} else {
 		logger.Info("缓存功能已禁用")
+		if cfg.Tushare.Offline {
+			logger.Warn("缓存已禁用但开启了离线模式，所有请求都会失败")
+		}
+	}
+
+	// 内存超过阈值时拒绝回源请求
+	api.StartLoadShedding()
+
+	// 加载交易日历
+	if cfg.Calendar.Enabled {
+		api.StartTradeCalendar()
+	}
+
+	// 按预热清单在后台预热缓存
+	api.StartWarmup()
+
+	// 启动盘后定时预取
+	api.StartPrefetchScheduler()
+
+	// 后台刷新快要过期的热点键
+	api.StartHotRefresh()
+
+	// 统计关键接口的缓存条目数，供 /readyz 判断是否预热完成
+	api.StartReadinessCheck()
+
+	// 初始化告警、命中率 SLO、上游错误率告警和 token 巡检
+	notifier := alert.NewNotifier(&cfg.Alert)
+	if cacheManager != nil && len(cfg.SLO.HitRateTargets) > 0 {
+		sloTracker := slo.NewTracker(&cfg.SLO, notifier)
+		api.SetSLOTracker(sloTracker)
+		sloTracker.StartCheckRoutine()
+	}
+
+	// 缓存存储不可用时探测恢复并告警
+	api.StartCacheHealthCheck(notifier)
+
+	// 初始化上游错误率告警
+	if cfg.Alert.UpstreamErrorRate > 0 {
+		api.SetUpstreamErrorTracker(alert.NewUpstreamErrorTracker(&cfg.Alert, notifier))
+	}
+
+	// 初始化 token 巡检
+	if len(cfg.TokenCheck.Tokens) > 0 {
+		tokenMonitor := tokencheck.NewMonitor(&cfg.TokenCheck, api.ProbeToken, notifier)
+		api.SetTokenMonitor(tokenMonitor)
+		tokenMonitor.StartCheckRoutine()
+	}
+
+	// 初始化录制/回放
+	fixtureStore, err := fixture.NewStore(&cfg.Fixture)
+	if err != nil {
+		logger.Fatal("初始化录制/回放失败", zap.Error(err))
+	}
+	if fixtureStore != nil {
+		api.SetFixtureStore(fixtureStore)
+		logger.Info("录制/回放已启用", zap.String("mode", cfg.Fixture.Mode), zap.String("dir", cfg.Fixture.Dir))
+	}
+
+	// 清理异常退出遗留的落盘文件和录制临时文件
+	api.StartTempFileCleanup()
+
+	// 初始化请求参数统计
+	if cfg.ParamStats.Enabled {
+		api.SetParamCollector(paramstats.NewCollector(&cfg.ParamStats))
+	}
+
+	// 初始化请求历史，写在缓存库中
+	if cfg.History.Enabled && cacheManager != nil {
+		historyRecorder, err := history.NewRecorder(&cfg.History, cacheManager)
+		if err != nil {
+			logger.Fatal("初始化请求历史失败", zap.Error(err))
+		}
+		api.SetHistoryRecorder(historyRecorder)
+		historyRecorder.StartFlushRoutine()
+		// 在缓存关闭前写入剩余的汇总
+		lifecycle.Register("history", 5*time.Second, func(ctx context.Context) error {
+			return historyRecorder.Flush()
+		})
 	}
 
+	// 初始化客户端鉴权
+	authProvider, err := auth.New(&cfg.Auth)
+	if err != nil {
+		logger.Fatal("初始化客户端鉴权失败", zap.Error(err))
+	}
+	if authProvider != nil {
+		logger.Info("客户端鉴权已启用", zap.String("provider", authProvider.Name()))
+	}
+
+	// HTTP 服务停止后输出运行统计，按批次短时间运行时也能留下记录
+	lifecycle.Register("run_summary", time.Duration(cfg.Alert.TimeoutSeconds+1)*time.Second, func(ctx context.Context) error {
+		if !cfg.Alert.ShutdownSummary {
+			return api.ReportRunSummary(nil)
+		}
+		return api.ReportRunSummary(notifier)
+	})
+
 	// 创建HTTP服务器
-	httpServer := server.NewHTTPServer(&cfg.Server)
+	httpServer := server.NewHTTPServer(&cfg.Server, &cfg.Admin, authProvider)
+
+	lifecycle.Register("http_server", 30*time.Second, httpServer.Stop)
+	// 最先暂停后台任务，避免关闭过程中继续访问缓存
+	lifecycle.Register("jobs", time.Second, func(ctx context.Context) error {
+		return jobs.SetPaused("", true)
+	})
 
 	// 设置优雅关闭
-	setupGracefulShutdown(httpServer, cacheManager)
+	setupGracefulShutdown()
 
 	// 启动HTTP服务器
 	logger.Info("正在启动HTTP服务器...")
 	if err := httpServer.Start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		logger.Fatal("HTTP服务器启动失败", zap.Error(err))
 	}
+	// 服务器停止后等待其余子系统关闭，由关闭流程退出进程
+	select {}
+}
+
+// openCacheManager 按 cache.backend 打开缓存存储
+func openCacheManager(cfg *config.CacheConfig) (*cache.CacheManager, error) {
+	var (
+		cacheManager *cache.CacheManager
+		err          error
+	)
+	if cfg.Backend == cache.BackendRedis {
+		cacheManager, err = cache.NewRedisCacheManager(
+			cache.RedisOptions{
+				Addr:      cfg.Redis.Addr,
+				Username:  cfg.Redis.Username,
+				Password:  cfg.Redis.Password,
+				DB:        cfg.Redis.DB,
+				KeyPrefix: cfg.Redis.KeyPrefix,
+			},
+			cfg.DefaultTTLSeconds,
+			cfg.DefaultNamespace,
+		)
+	} else {
+		encryptionKey, keyErr := cfg.EncryptionKey()
+		if keyErr != nil {
+			return nil, keyErr
+		}
+		cacheManager, err = cache.NewCacheManager(
+			cfg.DBPath,
+			cfg.DefaultTTLSeconds,
+			cfg.DefaultNamespace,
+			time.Duration(cfg.GCIntervalSeconds)*time.Second,
+			encryptionKey,
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// 配置校验阶段已经检查过时间窗口和时区，这里不会出错
+	gcOptions := cache.GCOptions{DiscardRatio: cfg.GCDiscardRatio}
+	gcOptions.Location, _ = time.LoadLocation(cfg.GCTimezone)
+	for _, window := range cfg.GCWindows {
+		start, end, _ := config.ParseTimeWindow(window)
+		gcOptions.Windows = append(gcOptions.Windows, cache.GCWindow{Start: start, End: end})
+	}
+	cacheManager.SetGCOptions(gcOptions)
+	cacheManager.SetCompression(cfg.Compression, cfg.CompressionMinBytes)
+	cacheManager.SetDedup(cfg.DedupMinBytes)
+	cacheManager.SetRetention(int64(cfg.MaxSizeMB)<<20, cfg.EvictionPolicy)
+	cacheManager.SetHealthThreshold(cfg.HealthErrorThreshold)
+	if cold := cfg.ColdTier; cold.AfterDays > 0 {
+		accessKeyID, secretAccessKey := cold.Credentials()
+		err := cacheManager.SetColdTier(cache.ColdOptions{
+			S3: cache.S3Options{
+				Endpoint:        cold.Endpoint,
+				Region:          cold.Region,
+				Bucket:          cold.Bucket,
+				Prefix:          cold.Prefix,
+				AccessKeyID:     accessKeyID,
+				SecretAccessKey: secretAccessKey,
+				PathStyle:       cold.PathStyle,
+				Timeout:         time.Duration(cold.TimeoutSeconds) * time.Second,
+			},
+			After:        time.Duration(cold.AfterDays) * 24 * time.Hour,
+			MoveInterval: time.Duration(cold.MoveIntervalSeconds) * time.Second,
+		})
+		if err != nil {
+			cacheManager.Close()
+			return nil, err
+		}
+	}
+	return cacheManager, nil
+}
+
+// registerCacheShutdown 登记缓存的关闭钩子
+func registerCacheShutdown(cacheManager *cache.CacheManager) {
+	lifecycle.Register("cache", 10*time.Second, func(ctx context.Context) error {
+		return cacheManager.Close()
+	})
 }
 
 // 设置优雅关闭
-func setupGracefulShutdown(httpServer *server.HTTPServer, cacheManager *cache.CacheManager) {
+func setupGracefulShutdown() {
 	// 创建信号通道
 	sigChan := make(chan os.Signal, 1)
 
@@ -91,44 +330,16 @@ func setupGracefulShutdown(httpServer *server.HTTPServer, cacheManager *cache.Ca
 		sig := <-sigChan
 		logger.Info("收到关闭信号，开始优雅关闭", zap.String("signal", sig.String()))
 
-		// 执行优雅关闭流程
-		gracefulShutdown(httpServer, cacheManager)
+		// 按登记的逆序关闭各子系统
+		lifecycle.Shutdown()
+
+		// 同步日志
+		logger.SyncAccess()
+		logger.Sync()
+
+		logger.Info("优雅关闭流程完成")
 
 		// 退出程序
 		os.Exit(0)
 	}()
 }
-
-// 优雅关闭流程
-func gracefulShutdown(httpServer *server.HTTPServer, cacheManager *cache.CacheManager) {
-	logger.Info("开始优雅关闭流程")
-
-	// 创建关闭上下文，给服务器30秒时间优雅关闭
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	// 停止HTTP服务器
-	if httpServer != nil {
-		logger.Info("正在停止HTTP服务器")
-		if err := httpServer.Stop(ctx); err != nil {
-			logger.Error("停止HTTP服务器失败", zap.Error(err))
-		} else {
-			logger.Info("HTTP服务器已停止")
-		}
-	}
-
-	// 关闭缓存
-	if cacheManager != nil {
-		logger.Info("正在关闭缓存系统")
-		if err := cacheManager.Close(); err != nil {
-			logger.Error("关闭缓存失败", zap.Error(err))
-		} else {
-			logger.Info("缓存系统已关闭")
-		}
-	}
-
-	// 同步日志
-	logger.Sync()
-
-	logger.Info("优雅关闭流程完成")
-}
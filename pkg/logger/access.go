@@ -0,0 +1,101 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+var accessLogger *zap.Logger
+
+// AccessConfig 访问日志配置，轮转策略独立于应用日志
+type AccessConfig struct {
+	Enabled    bool   `json:"enabled" mapstructure:"enabled"`         // 是否启用访问日志
+	FilePath   string `json:"file_path" mapstructure:"file_path"`     // 访问日志文件路径
+	MaxSize    int    `json:"max_size" mapstructure:"max_size"`       // 单个日志文件最大大小(MB)
+	MaxBackups int    `json:"max_backups" mapstructure:"max_backups"` // 最大备份文件数
+	MaxAge     int    `json:"max_age" mapstructure:"max_age"`         // 日志文件最大保存天数
+	Compress   bool   `json:"compress" mapstructure:"compress"`       // 是否压缩备份文件
+}
+
+// DefaultAccessConfig 访问日志默认配置
+func DefaultAccessConfig() *AccessConfig {
+	return &AccessConfig{
+		Enabled:    true,
+		FilePath:   "logs/access.log",
+		MaxSize:    100,
+		MaxBackups: 10,
+		MaxAge:     7,
+		Compress:   true,
+	}
+}
+
+// InitAccessLogger 初始化访问日志，未启用时丢弃所有访问日志
+func InitAccessLogger(cfg *AccessConfig) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if cfg == nil || !cfg.Enabled {
+		if accessLogger != nil {
+			accessLogger.Sync()
+		}
+		accessLogger = nil
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cfg.FilePath), 0755); err != nil {
+		return fmt.Errorf("创建访问日志目录失败: %v", err)
+	}
+
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.TimeKey = "timestamp"
+	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	encoderConfig.LevelKey = ""
+	encoderConfig.CallerKey = ""
+
+	writer := &lumberjack.Logger{
+		Filename:   cfg.FilePath,
+		MaxSize:    cfg.MaxSize,
+		MaxBackups: cfg.MaxBackups,
+		MaxAge:     cfg.MaxAge,
+		Compress:   cfg.Compress,
+	}
+
+	core := zapcore.NewCore(
+		zapcore.NewJSONEncoder(encoderConfig),
+		zapcore.AddSync(writer),
+		zapcore.InfoLevel,
+	)
+
+	if accessLogger != nil {
+		accessLogger.Sync()
+	}
+	accessLogger = zap.New(core)
+
+	return nil
+}
+
+// Access 写一条访问日志
+func Access(msg string, fields ...zap.Field) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if accessLogger != nil {
+		accessLogger.Info(msg, fields...)
+	}
+}
+
+// SyncAccess 同步访问日志
+func SyncAccess() error {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if accessLogger != nil {
+		return accessLogger.Sync()
+	}
+	return nil
+}
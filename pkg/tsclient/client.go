@@ -0,0 +1,307 @@
+// Package tsclient 访问 tushareproxy 的 Go 客户端。按代理返回的 Retry-After 自动退避重试，
+// 可选按 X-Cache-Expires 在本地缓存结果，调用方不需要自己处理限流和缓存
+package tsclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/roowe/tushareproxy/pkg/tsdata"
+)
+
+// 代理返回的响应头
+const (
+	HeaderCache        = "X-Cache"
+	HeaderCacheKey     = "X-Cache-Key"
+	HeaderCacheAge     = "X-Cache-Age"
+	HeaderCacheExpires = "X-Cache-Expires"
+	HeaderRetryAfter   = "Retry-After"
+)
+
+// 稍后重试可以成功的错误码：tushare/本地限流、代理并发已满、上游连接失败或超时
+const (
+	codeRateLimited     = 40203
+	codeBusy            = 503
+	codeUpstreamError   = 502
+	codeUpstreamTimeout = 504
+)
+
+// 没有 Retry-After 时的退避起始时长，每次重试翻倍
+const baseBackoff = time.Second
+
+// Client tushareproxy 客户端，可以在多个 goroutine 中共用
+type Client struct {
+	url        string
+	token      string
+	httpClient *http.Client
+	maxRetries int
+	maxWait    time.Duration
+	memo       *memo
+}
+
+// Option 客户端选项
+type Option func(*Client)
+
+// WithHTTPClient 使用自定义的 http.Client
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// WithRetries 设置最多重试次数和单次最长等待，需要等待更久时（例如每天额度用尽）直接返回错误
+func WithRetries(maxRetries int, maxWait time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.maxWait = maxWait
+	}
+}
+
+// WithMemo 开启本地缓存，最多保存 maxEntries 条。只缓存代理给出了 X-Cache-Expires 的响应，
+// 到期前相同的请求直接返回本地结果，不访问代理
+func WithMemo(maxEntries int) Option {
+	return func(c *Client) {
+		if maxEntries > 0 {
+			c.memo = &memo{maxEntries: maxEntries, entries: make(map[string]*memoEntry)}
+		}
+	}
+}
+
+// New 创建客户端，url 为代理的 /dataapi 地址。默认最多重试 3 次、单次最多等待 65 秒，
+// 足够等到 tushare 下一分钟的限流窗口
+func New(url, token string, opts ...Option) *Client {
+	c := &Client{
+		url:        url,
+		token:      token,
+		httpClient: &http.Client{Timeout: 2 * time.Minute},
+		maxRetries: 3,
+		maxWait:    65 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Response 代理的响应
+type Response struct {
+	// Body 原始响应体，开启本地缓存时与缓存共用，不要修改
+	Body []byte
+	// CacheStatus 代理的缓存状态（X-Cache），如 HIT、MISS、UNCACHEABLE
+	CacheStatus string
+	CacheKey    string
+	// CacheAge 命中代理缓存时数据的年龄
+	CacheAge time.Duration
+	// ExpiresAt 代理缓存的过期时间，代理没有给出时为零值
+	ExpiresAt time.Time
+	// Memoized 是否来自客户端本地缓存
+	Memoized bool
+	// Retries 本次调用重试的次数
+	Retries int
+}
+
+// Data 解析响应的表格数据，code 非 0 时返回 *tsdata.APIError
+func (r *Response) Data() (*tsdata.Data, error) {
+	return tsdata.Decode(r.Body)
+}
+
+// Query 调用 tushare 接口，fields 为空时返回全部字段。遇到限流、并发已满等可重试的错误时，
+// 按 Retry-After（没有时指数退避）等待后重试；重试用尽或不可重试时，code 非 0 的响应同时返回
+// 响应和 *tsdata.APIError
+func (c *Client) Query(ctx context.Context, apiName string, params map[string]any, fields string) (*Response, error) {
+	if params == nil {
+		params = map[string]any{}
+	}
+	body, err := json.Marshal(map[string]any{
+		"api_name": apiName,
+		"token":    c.token,
+		"params":   params,
+		"fields":   fields,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("序列化请求失败: %w", err)
+	}
+
+	// 同一个客户端的 token 不变，请求体可以直接作为本地缓存键
+	key := string(body)
+	if resp, ok := c.memo.get(key, time.Now()); ok {
+		return resp, nil
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, code, msg, wait, err := c.do(ctx, body)
+		if err == nil && code == 0 {
+			resp.Retries = attempt
+			c.memo.put(key, resp)
+			return resp, nil
+		}
+
+		if !retryable(code, err) || attempt >= c.maxRetries {
+			return finish(resp, code, msg, attempt, err)
+		}
+		if wait <= 0 {
+			wait = baseBackoff << attempt
+		}
+		if wait > c.maxWait {
+			return finish(resp, code, msg, attempt, err)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// finish 返回最后一次尝试的结果
+func finish(resp *Response, code int, msg string, attempt int, err error) (*Response, error) {
+	if err != nil {
+		return nil, err
+	}
+	resp.Retries = attempt
+	return resp, &tsdata.APIError{Code: code, Msg: msg}
+}
+
+// retryable 网络错误和限流、并发已满、上游失败的错误码可以重试
+func retryable(code int, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch code {
+	case codeRateLimited, codeBusy, codeUpstreamError, codeUpstreamTimeout:
+		return true
+	}
+	return false
+}
+
+// do 发送一次请求，返回响应、tushare 格式的 code/msg 和建议的等待时长
+func (c *Client) do(ctx context.Context, body []byte) (*Response, int, string, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, "", 0, fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	httpResp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, "", 0, fmt.Errorf("请求代理失败: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	data, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, 0, "", 0, fmt.Errorf("读取响应失败: %w", err)
+	}
+
+	resp := &Response{
+		Body:        data,
+		CacheStatus: httpResp.Header.Get(HeaderCache),
+		CacheKey:    httpResp.Header.Get(HeaderCacheKey),
+	}
+	if age, err := strconv.ParseInt(httpResp.Header.Get(HeaderCacheAge), 10, 64); err == nil {
+		resp.CacheAge = time.Duration(age) * time.Second
+	}
+	if expires, err := strconv.ParseInt(httpResp.Header.Get(HeaderCacheExpires), 10, 64); err == nil {
+		resp.ExpiresAt = time.Unix(expires, 0)
+	}
+	wait := parseRetryAfter(httpResp.Header.Get(HeaderRetryAfter), time.Now())
+
+	var result struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		if httpResp.StatusCode == http.StatusTooManyRequests || httpResp.StatusCode == http.StatusServiceUnavailable {
+			return resp, codeBusy, httpResp.Status, wait, nil
+		}
+		return nil, 0, "", 0, fmt.Errorf("解析响应失败（HTTP %d）: %w", httpResp.StatusCode, err)
+	}
+	return resp, result.Code, result.Msg, wait, nil
+}
+
+// parseRetryAfter 解析秒数或 HTTP 日期格式的 Retry-After，无法解析时返回 0
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0)
+	}
+	return 0
+}
+
+// memo 客户端本地缓存，按代理给出的过期时间失效
+type memo struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*memoEntry
+}
+
+type memoEntry struct {
+	resp      Response
+	expiresAt time.Time
+}
+
+func (m *memo) get(key string, now time.Time) (*Response, bool) {
+	if m == nil {
+		return nil, false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !now.Before(entry.expiresAt) {
+		delete(m.entries, key)
+		return nil, false
+	}
+
+	resp := entry.resp
+	resp.Memoized = true
+	resp.Retries = 0
+	return &resp, true
+}
+
+// put 保存代理给出了过期时间的响应。满了时先清理过期条目，仍然满时淘汰最早过期的
+func (m *memo) put(key string, resp *Response) {
+	if m == nil || resp.ExpiresAt.IsZero() {
+		return
+	}
+	now := time.Now()
+	if !now.Before(resp.ExpiresAt) {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.entries[key]; !exists && len(m.entries) >= m.maxEntries {
+		var earliest string
+		for k, entry := range m.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(m.entries, k)
+				continue
+			}
+			if earliest == "" || entry.expiresAt.Before(m.entries[earliest].expiresAt) {
+				earliest = k
+			}
+		}
+		if len(m.entries) >= m.maxEntries {
+			delete(m.entries, earliest)
+		}
+	}
+	m.entries[key] = &memoEntry{resp: *resp, expiresAt: resp.ExpiresAt}
+}
@@ -0,0 +1,204 @@
+package tsdata
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// tushare 日期列常见的写法
+var timeLayouts = []string{"20060102", "2006-01-02", "20060102 15:04:05", "2006-01-02 15:04:05"}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// structField 结构体字段与 tushare 列的对应关系
+type structField struct {
+	index  []int
+	column int
+}
+
+// Structs 转换为结构体切片，out 必须是结构体切片的指针。
+// 结构体字段按 tsdata 标签对应列名，没有时用 json 标签，都没有时用字段名的蛇形写法
+// （TsCode 对应 ts_code），标签为 "-" 的字段忽略。响应里没有的列保持零值，
+// null 对应零值或 nil 指针。支持字符串、整数、浮点数、布尔、time.Time 及其指针
+func (d *Data) Structs(out any) error {
+	slice := reflect.ValueOf(out)
+	if slice.Kind() != reflect.Pointer || slice.IsNil() || slice.Elem().Kind() != reflect.Slice {
+		return errors.New("tsdata: out 必须是结构体切片的指针")
+	}
+	slice = slice.Elem()
+	elemType := slice.Type().Elem()
+	if elemType.Kind() != reflect.Struct {
+		return errors.New("tsdata: out 必须是结构体切片的指针")
+	}
+
+	fields := d.structFields(elemType)
+	rows := reflect.MakeSlice(slice.Type(), len(d.Items), len(d.Items))
+	for i, item := range d.Items {
+		row := rows.Index(i)
+		for _, field := range fields {
+			if field.column >= len(item) {
+				continue
+			}
+			if err := setValue(row.FieldByIndex(field.index), item[field.column]); err != nil {
+				return fmt.Errorf("tsdata: 第 %d 行字段 %s: %w", i+1, d.Fields[field.column], err)
+			}
+		}
+	}
+	slice.Set(rows)
+	return nil
+}
+
+// structFields 找出结构体中有对应列的字段
+func (d *Data) structFields(t reflect.Type) []structField {
+	var fields []structField
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous {
+			continue
+		}
+		name := columnName(f)
+		if name == "-" {
+			continue
+		}
+		if column := d.Index(name); column >= 0 {
+			fields = append(fields, structField{index: f.Index, column: column})
+		}
+	}
+	return fields
+}
+
+func columnName(f reflect.StructField) string {
+	for _, key := range []string{"tsdata", "json"} {
+		if tag, ok := f.Tag.Lookup(key); ok {
+			if name, _, _ := strings.Cut(tag, ","); name != "" {
+				return name
+			}
+		}
+	}
+	return snakeCase(f.Name)
+}
+
+// snakeCase 驼峰转蛇形：TsCode -> ts_code，PE -> pe，HTTPCode -> http_code
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (!unicode.IsUpper(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// setValue 把单元格写入结构体字段
+func setValue(field reflect.Value, value any) error {
+	if value == nil {
+		field.SetZero()
+		return nil
+	}
+
+	if field.Kind() == reflect.Pointer {
+		ptr := reflect.New(field.Type().Elem())
+		if err := setValue(ptr.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(ptr)
+		return nil
+	}
+
+	if field.Type() == timeType {
+		text := formatValue(value)
+		if text == "" {
+			field.SetZero()
+			return nil
+		}
+		for _, layout := range timeLayouts {
+			if t, err := time.ParseInLocation(layout, text, time.Local); err == nil {
+				field.Set(reflect.ValueOf(t))
+				return nil
+			}
+		}
+		return fmt.Errorf("无法解析时间 %q", text)
+	}
+
+	switch field.Kind() {
+	case reflect.Interface:
+		field.Set(reflect.ValueOf(value))
+	case reflect.String:
+		field.SetString(formatValue(value))
+	case reflect.Bool:
+		if b, ok := value.(bool); ok {
+			field.SetBool(b)
+			return nil
+		}
+		b, err := strconv.ParseBool(formatValue(value))
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := parseInt(value)
+		if err != nil {
+			return err
+		}
+		if field.OverflowInt(n) {
+			return fmt.Errorf("%d 超出 %s 的范围", n, field.Type())
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := parseInt(value)
+		if err != nil {
+			return err
+		}
+		if n < 0 || field.OverflowUint(uint64(n)) {
+			return fmt.Errorf("%d 超出 %s 的范围", n, field.Type())
+		}
+		field.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		f, err := parseFloat(value)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("不支持的字段类型 %s", field.Type())
+	}
+	return nil
+}
+
+// parseInt 解析整数，允许 tushare 把整数写成 1.0 的形式
+func parseInt(value any) (int64, error) {
+	text := formatValue(value)
+	if text == "" {
+		return 0, nil
+	}
+	if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return n, nil
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil || f != math.Trunc(f) || math.Abs(f) >= math.MaxInt64 {
+		return 0, fmt.Errorf("%q 不是整数", text)
+	}
+	return int64(f), nil
+}
+
+func parseFloat(value any) (float64, error) {
+	if n, ok := value.(json.Number); ok {
+		return n.Float64()
+	}
+	text := formatValue(value)
+	if text == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(text, 64)
+}
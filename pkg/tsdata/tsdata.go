@@ -0,0 +1,136 @@
+// Package tsdata 解析 tushare 响应的 fields/items 表格数据，
+// 可以转换为字符串表格、按字段名索引的 map 或结构体切片。
+// 代理内部的后处理和 Go 客户端共用这一份实现
+package tsdata
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// Response tushare 响应
+type Response struct {
+	RequestID string `json:"request_id"`
+	Code      int    `json:"code"`
+	Msg       string `json:"msg"`
+	Data      *Data  `json:"data"`
+}
+
+// Data tushare 响应中的表格数据。数字解析为 json.Number，保留原始精度
+type Data struct {
+	Fields  []string `json:"fields"`
+	Items   [][]any  `json:"items"`
+	HasMore bool     `json:"has_more"`
+}
+
+// APIError tushare 返回的 code 非 0
+type APIError struct {
+	Code int
+	Msg  string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("tushare 返回错误: %d %s", e.Code, e.Msg)
+}
+
+// Decode 解析 tushare 响应。code 非 0 时返回 *APIError，data 为 null 时返回空表格
+func Decode(body []byte) (*Data, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var resp Response
+	if err := decoder.Decode(&resp); err != nil {
+		return nil, fmt.Errorf("解析 tushare 响应失败: %w", err)
+	}
+	if resp.Code != 0 {
+		return nil, &APIError{Code: resp.Code, Msg: resp.Msg}
+	}
+	if resp.Data == nil {
+		return &Data{}, nil
+	}
+	return resp.Data, nil
+}
+
+// DecodeStrings 解析 tushare 响应为字段名和字符串表格
+func DecodeStrings(body []byte) ([]string, [][]string, error) {
+	data, err := Decode(body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data.Fields, data.Strings(), nil
+}
+
+// DecodeMaps 解析 tushare 响应为按字段名索引的行
+func DecodeMaps(body []byte) ([]map[string]any, error) {
+	data, err := Decode(body)
+	if err != nil {
+		return nil, err
+	}
+	return data.Maps(), nil
+}
+
+// DecodeStructs 解析 tushare 响应到结构体切片，out 必须是结构体切片的指针，
+// 字段对应规则见 Data.Structs
+func DecodeStructs(body []byte, out any) error {
+	data, err := Decode(body)
+	if err != nil {
+		return err
+	}
+	return data.Structs(out)
+}
+
+// Index 返回字段所在的列，不存在时返回 -1
+func (d *Data) Index(field string) int {
+	return slices.Index(d.Fields, field)
+}
+
+// Strings 转换为字符串表格，null 转为空字符串
+func (d *Data) Strings() [][]string {
+	rows := make([][]string, 0, len(d.Items))
+	for _, item := range d.Items {
+		row := make([]string, len(item))
+		for i, value := range item {
+			row[i] = formatValue(value)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// Maps 转换为按字段名索引的行，缺少的列不出现在 map 中
+func (d *Data) Maps() []map[string]any {
+	rows := make([]map[string]any, 0, len(d.Items))
+	for _, item := range d.Items {
+		row := make(map[string]any, len(d.Fields))
+		for i, field := range d.Fields {
+			if i < len(item) {
+				row[field] = item[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// formatValue 把单元格转为字符串，数字保持 tushare 返回的原始写法
+func formatValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(raw)
+	}
+}